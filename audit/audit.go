@@ -0,0 +1,96 @@
+// Package audit describes the append-only trail of configuration changes:
+// who changed what, when, and the values before and after.
+package audit
+
+import (
+        "encoding/json"
+        "time"
+)
+
+// Actions recorded in the audit log
+const (
+        ActionCreate = "create"
+        ActionUpdate = "update"
+        ActionDelete = "delete"
+        ActionPause  = "pause"
+        ActionResume = "resume"
+        ActionImport = "import"
+        ActionUpload = "upload"
+)
+
+// Resources whose changes are recorded
+const (
+        ResourceWebsite     = "website"
+        ResourceGroup       = "group"
+        ResourceMaintenance = "maintenance"
+        ResourceCertificate = "certificate"
+        ResourceUser        = "user"
+        ResourceToken       = "token"
+        ResourceWorkspace   = "workspace"
+        ResourceSecret      = "secret"
+)
+
+// DefaultLimit is how many entries a query returns when it sets no limit
+const DefaultLimit = 100
+
+// Entry is one change in the audit log
+type Entry struct {
+        ID         uint64          `json:"id"`
+        Time       time.Time       `json:"time"`
+        User       string          `json:"user"`
+        Method     string          `json:"method"` // How the user authenticated: "session", "token", "none", "cli" for direct database access, "sites-file" for site definitions, or "scheduler" for changes made by the monitor itself
+        TokenID    string          `json:"tokenId,omitempty"`
+        Action     string          `json:"action"`
+        Resource   string          `json:"resource"`
+        ResourceID string          `json:"resourceId"`
+        Before     json.RawMessage `json:"before,omitempty"` // Omitted when the resource was created
+        After      json.RawMessage `json:"after,omitempty"`  // Omitted when the resource was deleted
+}
+
+// Filter selects audit entries. Empty fields match every entry.
+type Filter struct {
+        User       string
+        Action     string
+        Resource   string
+        ResourceID string
+        Since      time.Time
+        Until      time.Time
+        Limit      int // Newest entries to return; DefaultLimit if zero
+}
+
+// Matches reports whether an entry passes the filter, apart from its limit
+func (f *Filter) Matches(entry *Entry) bool {
+        switch {
+        case f.User != "" && entry.User != f.User,
+                f.Action != "" && entry.Action != f.Action,
+                f.Resource != "" && entry.Resource != f.Resource,
+                f.ResourceID != "" && entry.ResourceID != f.ResourceID,
+                !f.Since.IsZero() && entry.Time.Before(f.Since),
+                !f.Until.IsZero() && !entry.Time.Before(f.Until):
+                return false
+        }
+        return true
+}
+
+// Redactor is implemented by resources holding credentials, which are
+// recorded as the copy Redacted returns
+type Redactor interface {
+        Redacted() interface{}
+}
+
+// Value encodes a resource for the Before or After field of an entry,
+// redacted if it is a Redactor. It returns nil for nil values, so they are
+// omitted.
+func Value(v interface{}) json.RawMessage {
+        if v == nil {
+                return nil
+        }
+        if r, ok := v.(Redactor); ok {
+                v = r.Redacted()
+        }
+        buf, err := json.Marshal(v)
+        if err != nil || string(buf) == "null" {
+                return nil
+        }
+        return buf
+}
@@ -0,0 +1,157 @@
+// Package auth authenticates API and dashboard requests with scoped API
+// tokens and login sessions.
+package auth
+
+import (
+        "context"
+        "crypto/rand"
+        "crypto/sha256"
+        "encoding/hex"
+        "errors"
+        "fmt"
+        "strings"
+        "time"
+)
+
+// Scopes of API tokens
+const (
+        ScopeRead  = "read"  // GET requests only
+        ScopeAdmin = "admin" // Every request
+)
+
+// AdminUser is the built-in admin account, whose password can be set from
+// the environment
+const AdminUser = "admin"
+
+// tokenPrefix marks strings as website monitor API tokens
+const tokenPrefix = "wm_"
+
+// ErrInvalidCredentials is returned when a login or token is not accepted
+var ErrInvalidCredentials = errors.New("invalid credentials")
+
+// Token is an API token. Only a hash of the secret is kept.
+type Token struct {
+        ID        string    `json:"id"`
+        Name      string    `json:"name"`
+        Scope     string    `json:"scope"`
+        User      string    `json:"user"`
+        Prefix    string    `json:"prefix"` // Start of the secret, to help recognize it
+        Hash      string    `json:"hash,omitempty"`
+        CreatedAt time.Time `json:"createdAt"`
+        ExpiresAt time.Time `json:"expiresAt"` // Zero if the token never expires
+}
+
+// Expired reports whether the token has expired at the given time
+func (t *Token) Expired(now time.Time) bool {
+        return !t.ExpiresAt.IsZero() && !now.Before(t.ExpiresAt)
+}
+
+// Public returns a copy of the token without its hash, for listing
+func (t *Token) Public() *Token {
+        copied := *t
+        copied.Hash = ""
+        return &copied
+}
+
+// Session is a dashboard login. Only a hash of the cookie value is kept.
+type Session struct {
+        Hash      string    `json:"hash"`
+        User      string    `json:"user"`
+        CreatedAt time.Time `json:"createdAt"`
+        ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// ValidScope reports whether scope is a known token scope
+func ValidScope(scope string) bool {
+        return scope == ScopeRead || scope == ScopeAdmin
+}
+
+// Principal identifies who made a request and what they may do
+type Principal struct {
+        User      string   `json:"user"`
+        Role      string   `json:"role"`
+        Groups    []string `json:"groups"` // Groups the user may manage
+        Workspace string   `json:"workspace"`
+        Scope     string   `json:"scope"`
+        Method    string   `json:"method"`            // "session", "token" or "none" when authentication is disabled
+        TokenID   string   `json:"tokenId,omitempty"` // Set when authenticated with a token
+}
+
+// EffectiveRole is the user's role, limited to viewer for read-only tokens
+func (p *Principal) EffectiveRole() string {
+        if p.Scope == ScopeRead {
+                return RoleViewer
+        }
+        return p.Role
+}
+
+// HasRole reports whether the principal has at least the given role
+func (p *Principal) HasRole(role string) bool {
+        return roleRank[p.EffectiveRole()] >= roleRank[role]
+}
+
+// IsInstanceAdmin reports whether the principal is an admin of the default
+// workspace, who may manage workspaces and act in any of them
+func (p *Principal) IsInstanceAdmin() bool {
+        return p.Workspace == DefaultWorkspace && p.HasRole(RoleAdmin)
+}
+
+// CanEditGroup reports whether the principal may manage a group: admins may
+// manage every group, editors the groups assigned to them and their subgroups
+func (p *Principal) CanEditGroup(group string) bool {
+        if p.HasRole(RoleAdmin) {
+                return true
+        }
+        if !p.HasRole(RoleEditor) || group == "" {
+                return false
+        }
+        for _, assigned := range p.Groups {
+                if group == assigned || strings.HasPrefix(group, assigned+"/") {
+                        return true
+                }
+        }
+        return false
+}
+
+// CanEdit reports whether the principal may manage a website with the given
+// owner and group: editors may manage the websites they own and those in
+// their groups
+func (p *Principal) CanEdit(owner, group string) bool {
+        if p.HasRole(RoleAdmin) {
+                return true
+        }
+        if !p.HasRole(RoleEditor) {
+                return false
+        }
+        return owner == p.User || p.CanEditGroup(group)
+}
+
+// contextKey is the type of context keys used by this package
+type contextKey struct{}
+
+// NewContext returns a context carrying the principal
+func NewContext(ctx context.Context, principal *Principal) context.Context {
+        return context.WithValue(ctx, contextKey{}, principal)
+}
+
+// FromContext returns the principal of a request, or nil if there is none
+func FromContext(ctx context.Context) *Principal {
+        principal, _ := ctx.Value(contextKey{}).(*Principal)
+        return principal
+}
+
+// randomString returns n random bytes encoded as hex
+func randomString(n int) (string, error) {
+        buf := make([]byte, n)
+        if _, err := rand.Read(buf); err != nil {
+                return "", fmt.Errorf("could not generate random value: %v", err)
+        }
+        return hex.EncodeToString(buf), nil
+}
+
+// hashSecret hashes a token secret or session ID for storage. Secrets are
+// random and long, so a plain SHA-256 is enough.
+func hashSecret(secret string) string {
+        sum := sha256.Sum256([]byte(secret))
+        return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,94 @@
+package auth
+
+import "testing"
+
+func TestPrincipalAccess(t *testing.T) {
+        type access struct {
+                viewer, editor, admin bool // HasRole
+                instanceAdmin         bool
+        }
+        tests := []struct {
+                name      string
+                principal Principal
+                want      access
+        }{
+                {"viewer", Principal{Role: RoleViewer, Scope: ScopeAdmin, Workspace: DefaultWorkspace}, access{true, false, false, false}},
+                {"editor", Principal{Role: RoleEditor, Scope: ScopeAdmin, Workspace: DefaultWorkspace}, access{true, true, false, false}},
+                {"admin", Principal{Role: RoleAdmin, Scope: ScopeAdmin, Workspace: DefaultWorkspace}, access{true, true, true, true}},
+                {"admin with a read token", Principal{Role: RoleAdmin, Scope: ScopeRead, Workspace: DefaultWorkspace}, access{true, false, false, false}},
+                {"editor with a read token", Principal{Role: RoleEditor, Scope: ScopeRead, Workspace: DefaultWorkspace}, access{true, false, false, false}},
+                {"admin of another workspace", Principal{Role: RoleAdmin, Scope: ScopeAdmin, Workspace: "team"}, access{true, true, true, false}},
+                {"unknown role", Principal{Role: "owner", Scope: ScopeAdmin, Workspace: DefaultWorkspace}, access{false, false, false, false}},
+        }
+
+        for _, test := range tests {
+                t.Run(test.name, func(t *testing.T) {
+                        p := test.principal
+                        got := access{p.HasRole(RoleViewer), p.HasRole(RoleEditor), p.HasRole(RoleAdmin), p.IsInstanceAdmin()}
+                        if got != test.want {
+                                t.Errorf("access = %+v, want %+v", got, test.want)
+                        }
+                })
+        }
+}
+
+func TestPrincipalCanEdit(t *testing.T) {
+        editor := Principal{User: "alice", Role: RoleEditor, Scope: ScopeAdmin, Groups: []string{"shop", "blog/eu"}}
+        readOnly := editor
+        readOnly.Scope = ScopeRead
+        viewer := editor
+        viewer.Role = RoleViewer
+        admin := Principal{User: "root", Role: RoleAdmin, Scope: ScopeAdmin}
+
+        tests := []struct {
+                name         string
+                principal    Principal
+                owner, group string
+                want         bool
+        }{
+                {"own website", editor, "alice", "", true},
+                {"website in an assigned group", editor, "bob", "shop", true},
+                {"website in a subgroup", editor, "bob", "shop/checkout", true},
+                {"website in a nested assigned group", editor, "bob", "blog/eu", true},
+                {"website in a parent group", editor, "bob", "blog", false},
+                {"group sharing a prefix", editor, "bob", "shopping", false},
+                {"someone else's ungrouped website", editor, "bob", "", false},
+                {"unowned website", editor, "", "", false},
+                {"own website with a read token", readOnly, "alice", "shop", false},
+                {"viewer's own website", viewer, "alice", "shop", false},
+                {"admin", admin, "bob", "anything", true},
+        }
+
+        for _, test := range tests {
+                t.Run(test.name, func(t *testing.T) {
+                        if got := test.principal.CanEdit(test.owner, test.group); got != test.want {
+                                t.Errorf("CanEdit(%q, %q) = %v, want %v", test.owner, test.group, got, test.want)
+                        }
+                })
+        }
+}
+
+func TestPrincipalCanEditGroup(t *testing.T) {
+        editor := Principal{User: "alice", Role: RoleEditor, Scope: ScopeAdmin, Groups: []string{"shop"}}
+        admin := Principal{User: "root", Role: RoleAdmin, Scope: ScopeAdmin}
+
+        tests := []struct {
+                principal Principal
+                group     string
+                want      bool
+        }{
+                {editor, "shop", true},
+                {editor, "shop/eu", true},
+                {editor, "shopping", false},
+                {editor, "blog", false},
+                {editor, "", false},
+                {admin, "blog", true},
+                {admin, "", true},
+        }
+
+        for _, test := range tests {
+                if got := test.principal.CanEditGroup(test.group); got != test.want {
+                        t.Errorf("%s CanEditGroup(%q) = %v, want %v", test.principal.Role, test.group, got, test.want)
+                }
+        }
+}
@@ -0,0 +1,391 @@
+package auth
+
+import (
+        "fmt"
+        "net/http"
+        "net/url"
+        "strings"
+        "sync"
+        "time"
+
+        "golang.org/x/crypto/bcrypt"
+)
+
+// SessionCookie is the name of the dashboard session cookie
+const SessionCookie = "wm_session"
+
+// Store persists users, tokens and sessions
+type Store interface {
+        SaveUser(user *User) error
+        GetUsers() ([]*User, error)
+        DeleteUser(username string) error
+        SaveToken(token *Token) error
+        GetTokens() ([]*Token, error)
+        DeleteToken(id string) error
+        SaveSession(session *Session) error
+        GetSession(hash string) (*Session, error) // nil if there is no such session
+        DeleteSession(hash string) error
+        DeleteUserSessions(username string) error
+}
+
+// Authenticator checks the credentials of requests
+type Authenticator struct {
+        store      Store
+        sessionTTL time.Duration
+        disabled   bool // Requests are served as the admin without authentication
+
+        mu     sync.RWMutex
+        users  map[string]*User  // By username
+        tokens map[string]*Token // By hash
+}
+
+// New creates an authenticator that loads its users and tokens from store.
+// A non-empty admin password is set on the built-in admin account, creating
+// it if needed. Requests must be authenticated unless Disable is called.
+func New(store Store, adminPassword string, sessionTTL time.Duration) (*Authenticator, error) {
+        a := &Authenticator{
+                store:      store,
+                sessionTTL: sessionTTL,
+                users:      make(map[string]*User),
+                tokens:     make(map[string]*Token),
+        }
+
+        users, err := store.GetUsers()
+        if err != nil {
+                return nil, fmt.Errorf("could not load users: %v", err)
+        }
+        for _, user := range users {
+                a.users[user.Username] = user
+        }
+
+        tokens, err := store.GetTokens()
+        if err != nil {
+                return nil, fmt.Errorf("could not load tokens: %v", err)
+        }
+        for _, token := range tokens {
+                a.tokens[token.Hash] = token
+        }
+
+        if adminPassword != "" {
+                role := RoleAdmin
+                user, err := a.UpdateUser(AdminUser, UserUpdate{Password: &adminPassword, Role: &role})
+                if err == nil && user == nil {
+                        // The admin account was deleted after another admin was added
+                        _, err = a.CreateUser(AdminUser, adminPassword, RoleAdmin, DefaultWorkspace, nil)
+                }
+                if err != nil {
+                        return nil, fmt.Errorf("could not set admin password: %v", err)
+                }
+        }
+        return a, nil
+}
+
+// Disable turns authentication off: every request is served as the admin.
+// It is meant for servers only reachable from trusted networks.
+func (a *Authenticator) Disable() {
+        a.mu.Lock()
+        defer a.mu.Unlock()
+
+        a.disabled = true
+}
+
+// Enabled reports whether requests must be authenticated
+func (a *Authenticator) Enabled() bool {
+        a.mu.RLock()
+        defer a.mu.RUnlock()
+
+        return !a.disabled
+}
+
+// HasCredentials reports whether any user or token exists that requests can
+// be authenticated with. Until one does, an enabled authenticator refuses
+// every request.
+func (a *Authenticator) HasCredentials() bool {
+        a.mu.RLock()
+        defer a.mu.RUnlock()
+
+        return len(a.users) > 0 || len(a.tokens) > 0
+}
+
+// LoginEnabled reports whether any user can log in to the dashboard
+func (a *Authenticator) LoginEnabled() bool {
+        a.mu.RLock()
+        defer a.mu.RUnlock()
+
+        for _, user := range a.users {
+                if user.PasswordHash != "" {
+                        return true
+                }
+        }
+        return false
+}
+
+// Login checks a user's password and starts a session. It returns the value
+// for the session cookie.
+func (a *Authenticator) Login(username, password string) (string, *Session, error) {
+        a.mu.RLock()
+        user, ok := a.users[username]
+        a.mu.RUnlock()
+
+        if !ok || user.PasswordHash == "" {
+                // Spend the same time as a real comparison so users can't be probed
+                bcrypt.CompareHashAndPassword(dummyHash(), []byte(password))
+                return "", nil, ErrInvalidCredentials
+        }
+        if bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)) != nil {
+                return "", nil, ErrInvalidCredentials
+        }
+
+        value, err := randomString(32)
+        if err != nil {
+                return "", nil, err
+        }
+        now := time.Now()
+        session := &Session{
+                Hash:      hashSecret(value),
+                User:      username,
+                CreatedAt: now,
+                ExpiresAt: now.Add(a.sessionTTL),
+        }
+        if err := a.store.SaveSession(session); err != nil {
+                return "", nil, fmt.Errorf("could not save session: %v", err)
+        }
+        return value, session, nil
+}
+
+// dummyHash is compared against for unknown users
+var dummyHash = sync.OnceValue(func() []byte {
+        hash, _ := bcrypt.GenerateFromPassword([]byte("website-monitor"), bcrypt.DefaultCost)
+        return hash
+})
+
+// Logout ends the session with the given cookie value
+func (a *Authenticator) Logout(value string) error {
+        return a.store.DeleteSession(hashSecret(value))
+}
+
+// session returns the live session for a cookie value, or nil
+func (a *Authenticator) session(value string) (*Session, error) {
+        hash := hashSecret(value)
+        session, err := a.store.GetSession(hash)
+        if err != nil || session == nil {
+                return nil, err
+        }
+        if !time.Now().Before(session.ExpiresAt) {
+                a.store.DeleteSession(hash)
+                return nil, nil
+        }
+        return session, nil
+}
+
+// CreateToken issues a new API token for user. A zero ttl never expires. It
+// returns the secret, which is not stored and can't be shown again.
+func (a *Authenticator) CreateToken(name, scope, user string, ttl time.Duration) (string, *Token, error) {
+        if a.User(user) == nil {
+                return "", nil, fmt.Errorf("User %q does not exist", user)
+        }
+        if !ValidScope(scope) {
+                return "", nil, fmt.Errorf("Scope must be %q or %q", ScopeRead, ScopeAdmin)
+        }
+        if ttl < 0 {
+                return "", nil, fmt.Errorf("Token lifetime must not be negative")
+        }
+
+        id, err := randomString(8)
+        if err != nil {
+                return "", nil, err
+        }
+        random, err := randomString(32)
+        if err != nil {
+                return "", nil, err
+        }
+        secret := tokenPrefix + random
+
+        now := time.Now()
+        token := &Token{
+                ID:        id,
+                Name:      strings.TrimSpace(name),
+                Scope:     scope,
+                User:      user,
+                Prefix:    secret[:len(tokenPrefix)+8],
+                Hash:      hashSecret(secret),
+                CreatedAt: now,
+        }
+        if ttl > 0 {
+                token.ExpiresAt = now.Add(ttl)
+        }
+        if err := a.store.SaveToken(token); err != nil {
+                return "", nil, fmt.Errorf("could not save token: %v", err)
+        }
+
+        a.mu.Lock()
+        a.tokens[token.Hash] = token
+        a.mu.Unlock()
+
+        return secret, token.Public(), nil
+}
+
+// Tokens returns all tokens without their hashes
+func (a *Authenticator) Tokens() []*Token {
+        a.mu.RLock()
+        defer a.mu.RUnlock()
+
+        tokens := make([]*Token, 0, len(a.tokens))
+        for _, token := range a.tokens {
+                tokens = append(tokens, token.Public())
+        }
+        return tokens
+}
+
+// RevokeToken deletes a token. It returns false if there is no such token.
+func (a *Authenticator) RevokeToken(id string) (bool, error) {
+        a.mu.Lock()
+        defer a.mu.Unlock()
+
+        for hash, token := range a.tokens {
+                if token.ID == id {
+                        if err := a.store.DeleteToken(id); err != nil {
+                                return false, err
+                        }
+                        delete(a.tokens, hash)
+                        return true, nil
+                }
+        }
+        return false, nil
+}
+
+// Token returns a token without its hash, or nil if there is none
+func (a *Authenticator) Token(id string) *Token {
+        a.mu.RLock()
+        defer a.mu.RUnlock()
+
+        for _, token := range a.tokens {
+                if token.ID == id {
+                        return token.Public()
+                }
+        }
+        return nil
+}
+
+// token returns the live token with the given secret, or nil
+func (a *Authenticator) token(secret string) *Token {
+        a.mu.RLock()
+        defer a.mu.RUnlock()
+
+        token, ok := a.tokens[hashSecret(secret)]
+        if !ok || token.Expired(time.Now()) {
+                return nil
+        }
+        return token
+}
+
+// Authenticate identifies the caller of a request from a bearer token or a
+// session cookie. It returns nil if neither is present and valid, or if the
+// user they belong to no longer exists.
+func (a *Authenticator) Authenticate(r *http.Request) (*Principal, error) {
+        if header := r.Header.Get("Authorization"); header != "" {
+                secret, ok := strings.CutPrefix(header, "Bearer ")
+                if !ok {
+                        return nil, nil
+                }
+                token := a.token(strings.TrimSpace(secret))
+                if token == nil {
+                        return nil, nil
+                }
+                return a.principal(token.User, token.Scope, "token", token.ID), nil
+        }
+
+        cookie, err := r.Cookie(SessionCookie)
+        if err != nil {
+                return nil, nil
+        }
+        session, err := a.session(cookie.Value)
+        if err != nil || session == nil {
+                return nil, err
+        }
+        return a.principal(session.User, ScopeAdmin, "session", ""), nil
+}
+
+// principal builds the principal for a user's current role and groups, or
+// returns nil if the user no longer exists
+func (a *Authenticator) principal(username, scope, method, tokenID string) *Principal {
+        user := a.User(username)
+        if user == nil {
+                return nil
+        }
+        return &Principal{
+                User:      user.Username,
+                Role:      user.Role,
+                Groups:    user.Groups,
+                Workspace: WorkspaceOf(user.Workspace),
+                Scope:     scope,
+                Method:    method,
+                TokenID:   tokenID,
+        }
+}
+
+// publicPaths can be requested without authentication
+var publicPaths = map[string]bool{
+        "/login":   true,
+        "/logout":  true,
+        "/healthz": true,
+        "/readyz":  true,
+}
+
+// Middleware rejects requests that are not authenticated or not allowed by
+// the caller's scope, and adds the principal to the request context
+func (a *Authenticator) Middleware(next http.Handler) http.Handler {
+        return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+                if publicPaths[r.URL.Path] || strings.HasPrefix(r.URL.Path, "/static/") {
+                        next.ServeHTTP(w, r)
+                        return
+                }
+                if !a.Enabled() {
+                        principal := &Principal{User: AdminUser, Role: RoleAdmin, Workspace: DefaultWorkspace, Scope: ScopeAdmin, Method: "none"}
+                        next.ServeHTTP(w, r.WithContext(NewContext(r.Context(), principal)))
+                        return
+                }
+
+                principal, err := a.Authenticate(r)
+                if err != nil {
+                        http.Error(w, "Authentication failed", http.StatusInternalServerError)
+                        return
+                }
+                if principal == nil {
+                        if r.Method == http.MethodGet && r.URL.Path == "/" {
+                                http.Redirect(w, r, "/login", http.StatusSeeOther)
+                                return
+                        }
+                        w.Header().Set("WWW-Authenticate", `Bearer realm="website-monitor"`)
+                        http.Error(w, "Authentication required", http.StatusUnauthorized)
+                        return
+                }
+
+                safe := r.Method == http.MethodGet || r.Method == http.MethodHead || r.Method == http.MethodOptions
+                if !safe && principal.Scope == ScopeRead {
+                        http.Error(w, "Token is read-only", http.StatusForbidden)
+                        return
+                }
+                if !safe && principal.Method == "session" && !sameOrigin(r) {
+                        http.Error(w, "Cross-origin request rejected", http.StatusForbidden)
+                        return
+                }
+
+                next.ServeHTTP(w, r.WithContext(NewContext(r.Context(), principal)))
+        })
+}
+
+// sameOrigin reports whether a cookie-authenticated request came from the
+// dashboard itself, to guard against cross-site request forgery
+func sameOrigin(r *http.Request) bool {
+        origin := r.Header.Get("Origin")
+        if origin == "" {
+                origin = r.Header.Get("Referer")
+        }
+        if origin == "" {
+                // Non-browser clients don't send cookies from other sites
+                return true
+        }
+        u, err := url.Parse(origin)
+        return err == nil && u.Host == r.Host
+}
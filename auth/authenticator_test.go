@@ -0,0 +1,337 @@
+package auth
+
+import (
+        "net/http"
+        "net/http/httptest"
+        "strings"
+        "sync"
+        "testing"
+        "time"
+)
+
+// fakeStore keeps users, tokens and sessions in memory, like the database
+type fakeStore struct {
+        mu       sync.Mutex
+        users    map[string]*User
+        tokens   map[string]*Token
+        sessions map[string]*Session
+}
+
+func newFakeStore() *fakeStore {
+        return &fakeStore{users: map[string]*User{}, tokens: map[string]*Token{}, sessions: map[string]*Session{}}
+}
+
+func (s *fakeStore) SaveUser(user *User) error {
+        s.mu.Lock()
+        defer s.mu.Unlock()
+
+        s.users[user.Username] = user
+        return nil
+}
+
+func (s *fakeStore) GetUsers() ([]*User, error) {
+        s.mu.Lock()
+        defer s.mu.Unlock()
+
+        var users []*User
+        for _, user := range s.users {
+                users = append(users, user)
+        }
+        return users, nil
+}
+
+func (s *fakeStore) DeleteUser(username string) error {
+        s.mu.Lock()
+        defer s.mu.Unlock()
+
+        delete(s.users, username)
+        return nil
+}
+
+func (s *fakeStore) SaveToken(token *Token) error {
+        s.mu.Lock()
+        defer s.mu.Unlock()
+
+        s.tokens[token.ID] = token
+        return nil
+}
+
+func (s *fakeStore) GetTokens() ([]*Token, error) {
+        s.mu.Lock()
+        defer s.mu.Unlock()
+
+        var tokens []*Token
+        for _, token := range s.tokens {
+                tokens = append(tokens, token)
+        }
+        return tokens, nil
+}
+
+func (s *fakeStore) DeleteToken(id string) error {
+        s.mu.Lock()
+        defer s.mu.Unlock()
+
+        delete(s.tokens, id)
+        return nil
+}
+
+func (s *fakeStore) SaveSession(session *Session) error {
+        s.mu.Lock()
+        defer s.mu.Unlock()
+
+        s.sessions[session.Hash] = session
+        return nil
+}
+
+func (s *fakeStore) GetSession(hash string) (*Session, error) {
+        s.mu.Lock()
+        defer s.mu.Unlock()
+
+        return s.sessions[hash], nil
+}
+
+func (s *fakeStore) DeleteSession(hash string) error {
+        s.mu.Lock()
+        defer s.mu.Unlock()
+
+        delete(s.sessions, hash)
+        return nil
+}
+
+func (s *fakeStore) DeleteUserSessions(username string) error {
+        s.mu.Lock()
+        defer s.mu.Unlock()
+
+        for hash, session := range s.sessions {
+                if session.User == username {
+                        delete(s.sessions, hash)
+                }
+        }
+        return nil
+}
+
+// newTestAuthenticator returns an authenticator with an admin whose password
+// is "password"
+func newTestAuthenticator(t *testing.T) *Authenticator {
+        t.Helper()
+        a, err := New(newFakeStore(), "password", time.Hour)
+        if err != nil {
+                t.Fatal(err)
+        }
+        return a
+}
+
+// newToken issues a token for user with the given scope and lifetime
+func newToken(t *testing.T, a *Authenticator, user, scope string, ttl time.Duration) string {
+        t.Helper()
+        secret, _, err := a.CreateToken("test", scope, user, ttl)
+        if err != nil {
+                t.Fatal(err)
+        }
+        return secret
+}
+
+func TestMiddleware(t *testing.T) {
+        a := newTestAuthenticator(t)
+        readToken := newToken(t, a, AdminUser, ScopeRead, 0)
+        adminToken := newToken(t, a, AdminUser, ScopeAdmin, 0)
+        expiredToken := newToken(t, a, AdminUser, ScopeAdmin, time.Nanosecond)
+        cookie, _, err := a.Login(AdminUser, "password")
+        if err != nil {
+                t.Fatal(err)
+        }
+        time.Sleep(time.Millisecond)
+
+        var reached *Principal
+        handler := a.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+                reached = FromContext(r.Context())
+        }))
+
+        tests := []struct {
+                name    string
+                method  string
+                path    string
+                token   string
+                session bool
+                origin  string
+                status  int
+        }{
+                {name: "public path", method: "GET", path: "/healthz", status: http.StatusOK},
+                {name: "dashboard redirects to login", method: "GET", path: "/", status: http.StatusSeeOther},
+                {name: "API needs credentials", method: "GET", path: "/api/websites", status: http.StatusUnauthorized},
+                {name: "unknown token", method: "GET", path: "/api/websites", token: "wm_unknown", status: http.StatusUnauthorized},
+                {name: "expired token", method: "GET", path: "/api/websites", token: expiredToken, status: http.StatusUnauthorized},
+                {name: "read token reads", method: "GET", path: "/api/websites", token: readToken, status: http.StatusOK},
+                {name: "read token can't write", method: "POST", path: "/api/websites", token: readToken, status: http.StatusForbidden},
+                {name: "read token can't delete", method: "DELETE", path: "/api/websites/1", token: readToken, status: http.StatusForbidden},
+                {name: "admin token writes", method: "POST", path: "/api/websites", token: adminToken, status: http.StatusOK},
+                {name: "tokens aren't sent cross-site", method: "POST", path: "/api/websites", token: adminToken, origin: "https://evil.example", status: http.StatusOK},
+                {name: "session reads", method: "GET", path: "/api/websites", session: true, status: http.StatusOK},
+                {name: "session writes from the dashboard", method: "POST", path: "/api/websites", session: true, origin: "http://monitor.example", status: http.StatusOK},
+                {name: "session writes without an origin", method: "POST", path: "/api/websites", session: true, status: http.StatusOK},
+                {name: "cross-site session write", method: "POST", path: "/api/websites", session: true, origin: "https://evil.example", status: http.StatusForbidden},
+                {name: "cross-site session read", method: "GET", path: "/api/websites", session: true, origin: "https://evil.example", status: http.StatusOK},
+        }
+
+        for _, test := range tests {
+                t.Run(test.name, func(t *testing.T) {
+                        reached = nil
+                        r := httptest.NewRequest(test.method, "http://monitor.example"+test.path, nil)
+                        if test.token != "" {
+                                r.Header.Set("Authorization", "Bearer "+test.token)
+                        }
+                        if test.session {
+                                r.AddCookie(&http.Cookie{Name: SessionCookie, Value: cookie})
+                        }
+                        if test.origin != "" {
+                                r.Header.Set("Origin", test.origin)
+                        }
+                        w := httptest.NewRecorder()
+                        handler.ServeHTTP(w, r)
+
+                        if w.Code != test.status {
+                                t.Errorf("status = %d, want %d: %s", w.Code, test.status, strings.TrimSpace(w.Body.String()))
+                        }
+                        if (reached != nil) != (test.status == http.StatusOK && test.path != "/healthz") {
+                                t.Errorf("handler reached with principal %+v", reached)
+                        }
+                })
+        }
+}
+
+func TestMiddlewareWithoutUsers(t *testing.T) {
+        a, err := New(newFakeStore(), "", time.Hour)
+        if err != nil {
+                t.Fatal(err)
+        }
+        var reached *Principal
+        handler := a.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+                reached = FromContext(r.Context())
+        }))
+
+        // Nobody can act before the first user or token exists, so whoever
+        // reaches the server first can't make themselves an admin
+        w := httptest.NewRecorder()
+        handler.ServeHTTP(w, httptest.NewRequest("POST", "/api/users", nil))
+        if w.Code != http.StatusUnauthorized || reached != nil {
+                t.Errorf("status = %d, principal %+v, want %d", w.Code, reached, http.StatusUnauthorized)
+        }
+
+        a.Disable()
+        w = httptest.NewRecorder()
+        handler.ServeHTTP(w, httptest.NewRequest("POST", "/api/users", nil))
+        if w.Code != http.StatusOK || reached == nil || !reached.IsInstanceAdmin() || reached.Method != "none" {
+                t.Errorf("with authentication disabled: status = %d, principal %+v, want the admin", w.Code, reached)
+        }
+}
+
+func TestDeletedUsersLoseAccess(t *testing.T) {
+        tests := []struct {
+                name     string
+                username string
+                role     string
+        }{
+                {"editor", "alice", RoleEditor},
+                {"built-in admin", AdminUser, RoleAdmin},
+        }
+
+        for _, test := range tests {
+                t.Run(test.name, func(t *testing.T) {
+                        a := newTestAuthenticator(t)
+                        // Another admin, so the built-in one isn't the last
+                        if _, err := a.CreateUser("root", "password", RoleAdmin, "", nil); err != nil {
+                                t.Fatal(err)
+                        }
+                        if test.username != AdminUser {
+                                if _, err := a.CreateUser(test.username, "password", test.role, "", nil); err != nil {
+                                        t.Fatal(err)
+                                }
+                        }
+                        token := newToken(t, a, test.username, ScopeAdmin, 0)
+                        cookie, _, err := a.Login(test.username, "password")
+                        if err != nil {
+                                t.Fatal(err)
+                        }
+
+                        if ok, err := a.DeleteUser(test.username); !ok || err != nil {
+                                t.Fatalf("DeleteUser = %v, %v", ok, err)
+                        }
+                        if a.User(test.username) != nil {
+                                t.Errorf("deleted user still exists")
+                        }
+
+                        byToken := httptest.NewRequest("GET", "/api/websites", nil)
+                        byToken.Header.Set("Authorization", "Bearer "+token)
+                        bySession := httptest.NewRequest("GET", "/api/websites", nil)
+                        bySession.AddCookie(&http.Cookie{Name: SessionCookie, Value: cookie})
+                        for _, r := range []*http.Request{byToken, bySession} {
+                                if principal, err := a.Authenticate(r); principal != nil || err != nil {
+                                        t.Errorf("Authenticate after deleting the user = %+v, %v, want nothing", principal, err)
+                                }
+                        }
+
+                        // An account created later under the same name doesn't inherit
+                        // the old session
+                        if _, err := a.CreateUser(test.username, "password", test.role, "", nil); err != nil {
+                                t.Fatal(err)
+                        }
+                        if principal, _ := a.Authenticate(bySession); principal != nil {
+                                t.Errorf("old session authenticated the new account as %+v", principal)
+                        }
+                })
+        }
+}
+
+func TestAdminPasswordRecreatesDeletedAdmin(t *testing.T) {
+        store := newFakeStore()
+        a, err := New(store, "password", time.Hour)
+        if err != nil {
+                t.Fatal(err)
+        }
+        if _, err := a.CreateUser("alice", "password", RoleAdmin, "", nil); err != nil {
+                t.Fatal(err)
+        }
+        if ok, err := a.DeleteUser(AdminUser); !ok || err != nil {
+                t.Fatalf("DeleteUser = %v, %v", ok, err)
+        }
+
+        a, err = New(store, "new password", time.Hour)
+        if err != nil {
+                t.Fatal(err)
+        }
+        if _, _, err := a.Login(AdminUser, "new password"); err != nil {
+                t.Errorf("Login with the admin password from the environment = %v", err)
+        }
+}
+
+func TestSameOrigin(t *testing.T) {
+        tests := []struct {
+                origin  string
+                referer string
+                want    bool
+        }{
+                {"", "", true},
+                {"http://monitor.example", "", true},
+                {"https://monitor.example", "", true},
+                {"http://monitor.example:8080", "", false},
+                {"http://evil.example", "", false},
+                {"http://monitor.example.evil.example", "", false},
+                {"null", "", false},
+                {"", "http://monitor.example/websites", true},
+                {"", "http://evil.example/monitor.example", false},
+                {"http://evil.example", "http://monitor.example/", false},
+        }
+
+        for _, test := range tests {
+                r := httptest.NewRequest("POST", "http://monitor.example/api/websites", nil)
+                if test.origin != "" {
+                        r.Header.Set("Origin", test.origin)
+                }
+                if test.referer != "" {
+                        r.Header.Set("Referer", test.referer)
+                }
+                if got := sameOrigin(r); got != test.want {
+                        t.Errorf("sameOrigin(Origin %q, Referer %q) = %v, want %v", test.origin, test.referer, got, test.want)
+                }
+        }
+}
@@ -0,0 +1,283 @@
+package auth
+
+import (
+        "fmt"
+        "strings"
+        "time"
+
+        "golang.org/x/crypto/bcrypt"
+)
+
+// Roles of users, from least to most privileged
+const (
+        RoleViewer = "viewer" // Read everything, change nothing
+        RoleEditor = "editor" // Also manage the websites and groups they own
+        RoleAdmin  = "admin"  // Manage everything, including users
+)
+
+// minPasswordLength is the shortest password accepted for a user
+const minPasswordLength = 8
+
+// roleRank orders roles by privilege
+var roleRank = map[string]int{
+        RoleViewer: 1,
+        RoleEditor: 2,
+        RoleAdmin:  3,
+}
+
+// ValidRole reports whether role is a known role
+func ValidRole(role string) bool {
+        return roleRank[role] > 0
+}
+
+// User is an account that can log in to the dashboard and own tokens,
+// websites and groups
+type User struct {
+        Username     string    `json:"username"`
+        Role         string    `json:"role"`
+        Groups       []string  `json:"groups"`              // Group paths whose websites the user may manage
+        Workspace    string    `json:"workspace,omitempty"` // Empty for the default workspace
+        PasswordHash string    `json:"passwordHash,omitempty"`
+        CreatedAt    time.Time `json:"createdAt"`
+}
+
+// Public returns a copy of the user without the password hash, for listing
+func (u *User) Public() *User {
+        copied := *u
+        copied.PasswordHash = ""
+        copied.Groups = append([]string(nil), u.Groups...)
+        return &copied
+}
+
+// UserUpdate holds the changes to make to a user; nil fields are left as they are
+type UserUpdate struct {
+        Password *string
+        Role     *string
+        Groups   *[]string
+}
+
+// validateUsername checks that a username can be used in URLs and logs
+func validateUsername(username string) error {
+        if username == "" {
+                return fmt.Errorf("Username is required")
+        }
+        if len(username) > 64 {
+                return fmt.Errorf("Username must be at most 64 characters")
+        }
+        if strings.ContainsAny(username, "/ \t\r\n") {
+                return fmt.Errorf("Username must not contain slashes or whitespace")
+        }
+        return nil
+}
+
+// hashPassword checks a password's length and hashes it for storage
+func hashPassword(password string) (string, error) {
+        if len(password) < minPasswordLength {
+                return "", fmt.Errorf("Password must be at least %d characters", minPasswordLength)
+        }
+        hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+        if err != nil {
+                return "", fmt.Errorf("could not hash password: %v", err)
+        }
+        return string(hash), nil
+}
+
+// cleanGroups trims the slashes and whitespace of group paths and drops
+// empty ones
+func cleanGroups(groups []string) []string {
+        var cleaned []string
+        for _, group := range groups {
+                var segments []string
+                for _, segment := range strings.Split(group, "/") {
+                        if segment = strings.TrimSpace(segment); segment != "" {
+                                segments = append(segments, segment)
+                        }
+                }
+                if len(segments) > 0 {
+                        cleaned = append(cleaned, strings.Join(segments, "/"))
+                }
+        }
+        return cleaned
+}
+
+// Users returns all users without their password hashes
+func (a *Authenticator) Users() []*User {
+        a.mu.RLock()
+        defer a.mu.RUnlock()
+
+        users := make([]*User, 0, len(a.users))
+        for _, user := range a.users {
+                users = append(users, user.Public())
+        }
+        return users
+}
+
+// User returns a user without the password hash, or nil if there is none
+func (a *Authenticator) User(username string) *User {
+        a.mu.RLock()
+        defer a.mu.RUnlock()
+
+        if user := a.userLocked(username); user != nil {
+                return user.Public()
+        }
+        return nil
+}
+
+// userLocked returns the stored user with the given name. Until an admin of
+// the default workspace is stored, the admin account exists without one, so
+// tokens created for it from the command line work.
+func (a *Authenticator) userLocked(username string) *User {
+        if user, ok := a.users[username]; ok {
+                return user
+        }
+        if username == AdminUser && !a.hasAdminLocked() {
+                return &User{Username: AdminUser, Role: RoleAdmin}
+        }
+        return nil
+}
+
+// hasAdminLocked reports whether an admin of the default workspace is stored
+func (a *Authenticator) hasAdminLocked() bool {
+        for _, user := range a.users {
+                if user.Role == RoleAdmin && user.Workspace == "" {
+                        return true
+                }
+        }
+        return false
+}
+
+// storedWorkspace returns how a user's workspace is stored: empty for the
+// default workspace
+func storedWorkspace(workspace string) string {
+        if workspace == DefaultWorkspace {
+                return ""
+        }
+        return workspace
+}
+
+// CreateUser adds a user with the given password, role, workspace and groups.
+// Callers check that the workspace exists.
+func (a *Authenticator) CreateUser(username, password, role, workspace string, groups []string) (*User, error) {
+        if err := validateUsername(username); err != nil {
+                return nil, err
+        }
+        if !ValidRole(role) {
+                return nil, fmt.Errorf("Role must be %q, %q or %q", RoleViewer, RoleEditor, RoleAdmin)
+        }
+        hash, err := hashPassword(password)
+        if err != nil {
+                return nil, err
+        }
+
+        a.mu.Lock()
+        defer a.mu.Unlock()
+
+        if _, exists := a.users[username]; exists {
+                return nil, fmt.Errorf("User %q already exists", username)
+        }
+        user := &User{
+                Username:     username,
+                Role:         role,
+                Groups:       cleanGroups(groups),
+                Workspace:    storedWorkspace(workspace),
+                PasswordHash: hash,
+                CreatedAt:    time.Now(),
+        }
+        if err := a.store.SaveUser(user); err != nil {
+                return nil, fmt.Errorf("could not save user: %v", err)
+        }
+        a.users[username] = user
+        return user.Public(), nil
+}
+
+// UpdateUser changes a user's password, role or groups. It returns nil if
+// there is no such user.
+func (a *Authenticator) UpdateUser(username string, update UserUpdate) (*User, error) {
+        var hash string
+        if update.Password != nil {
+                var err error
+                if hash, err = hashPassword(*update.Password); err != nil {
+                        return nil, err
+                }
+        }
+        if update.Role != nil && !ValidRole(*update.Role) {
+                return nil, fmt.Errorf("Role must be %q, %q or %q", RoleViewer, RoleEditor, RoleAdmin)
+        }
+
+        a.mu.Lock()
+        defer a.mu.Unlock()
+
+        stored := a.userLocked(username)
+        if stored == nil {
+                return nil, nil
+        }
+        user := *stored
+        if update.Password != nil {
+                user.PasswordHash = hash
+        }
+        if update.Role != nil {
+                user.Role = *update.Role
+        }
+        if update.Groups != nil {
+                user.Groups = cleanGroups(*update.Groups)
+        }
+        if user.CreatedAt.IsZero() {
+                user.CreatedAt = time.Now()
+        }
+        if user.Role != RoleAdmin && a.isLastAdminLocked(username) {
+                return nil, fmt.Errorf("Cannot remove the admin role from the last admin of the default workspace")
+        }
+
+        if err := a.store.SaveUser(&user); err != nil {
+                return nil, fmt.Errorf("could not save user: %v", err)
+        }
+        a.users[username] = &user
+        return user.Public(), nil
+}
+
+// DeleteUser removes a user and revokes their tokens and sessions. It returns
+// false if there is no such user.
+func (a *Authenticator) DeleteUser(username string) (bool, error) {
+        a.mu.Lock()
+        defer a.mu.Unlock()
+
+        if _, ok := a.users[username]; !ok {
+                return false, nil
+        }
+        if a.isLastAdminLocked(username) {
+                return false, fmt.Errorf("Cannot delete the last admin of the default workspace")
+        }
+
+        for hash, token := range a.tokens {
+                if token.User == username {
+                        if err := a.store.DeleteToken(token.ID); err != nil {
+                                return false, err
+                        }
+                        delete(a.tokens, hash)
+                }
+        }
+        if err := a.store.DeleteUserSessions(username); err != nil {
+                return false, err
+        }
+        if err := a.store.DeleteUser(username); err != nil {
+                return false, err
+        }
+        delete(a.users, username)
+        return true, nil
+}
+
+// isLastAdminLocked reports whether username is the only stored admin of the
+// default workspace, so removing it would lock everyone out of user and
+// workspace management
+func (a *Authenticator) isLastAdminLocked(username string) bool {
+        user, ok := a.users[username]
+        if !ok || user.Role != RoleAdmin || user.Workspace != "" {
+                return false
+        }
+        for name, other := range a.users {
+                if name != username && other.Role == RoleAdmin && other.Workspace == "" {
+                        return false
+                }
+        }
+        return true
+}
@@ -0,0 +1,43 @@
+package auth
+
+import (
+        "fmt"
+        "regexp"
+        "time"
+)
+
+// DefaultWorkspace is the workspace of users without one. Its data lives in
+// the database's top-level buckets, so instances created before workspaces
+// existed keep their websites and history.
+const DefaultWorkspace = "default"
+
+// workspaceNamePattern limits workspace names to short lowercase slugs, as
+// they are used in bucket names and certificate directories
+var workspaceNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,31}$`)
+
+// Workspace is an isolated set of websites, groups, maintenance windows,
+// certificates and history, shared by the users assigned to it
+type Workspace struct {
+        Name      string    `json:"name"`
+        CreatedAt time.Time `json:"createdAt"`
+}
+
+// ValidateWorkspaceName returns an error unless name can be used for a new
+// workspace
+func ValidateWorkspaceName(name string) error {
+        if name == DefaultWorkspace {
+                return fmt.Errorf("Workspace %q already exists", name)
+        }
+        if !workspaceNamePattern.MatchString(name) {
+                return fmt.Errorf("Workspace names must be 1-32 lowercase letters, digits or dashes")
+        }
+        return nil
+}
+
+// WorkspaceOf returns the workspace a user belongs to
+func WorkspaceOf(workspace string) string {
+        if workspace == "" {
+                return DefaultWorkspace
+        }
+        return workspace
+}
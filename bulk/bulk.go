@@ -0,0 +1,176 @@
+// Package bulk exports and imports monitored websites in JSON, CSV and OPML.
+package bulk
+
+import (
+        "fmt"
+        "strings"
+
+        "website-monitor/monitor"
+)
+
+// Supported formats
+const (
+        FormatJSON = "json"
+        FormatCSV  = "csv"
+        FormatOPML = "opml"
+)
+
+// ContentType returns the MIME type of a format
+func ContentType(format string) string {
+        switch format {
+        case FormatCSV:
+                return "text/csv"
+        case FormatOPML:
+                return "text/x-opml"
+        default:
+                return "application/json"
+        }
+}
+
+// FormatFromContentType guesses a format from a MIME type, defaulting to JSON
+func FormatFromContentType(contentType string) string {
+        switch {
+        case strings.Contains(contentType, "csv"):
+                return FormatCSV
+        case strings.Contains(contentType, "opml"), strings.Contains(contentType, "xml"):
+                return FormatOPML
+        default:
+                return FormatJSON
+        }
+}
+
+// FormatFromFilename guesses a format from a file extension, defaulting to JSON
+func FormatFromFilename(name string) string {
+        lower := strings.ToLower(name)
+        switch {
+        case strings.HasSuffix(lower, ".csv"):
+                return FormatCSV
+        case strings.HasSuffix(lower, ".opml"), strings.HasSuffix(lower, ".xml"):
+                return FormatOPML
+        default:
+                return FormatJSON
+        }
+}
+
+// ValidFormat reports whether format is supported
+func ValidFormat(format string) bool {
+        return format == FormatJSON || format == FormatCSV || format == FormatOPML
+}
+
+// Row is one website read from an import file. Err is set when the row could
+// not be read, in which case Website may be nil.
+type Row struct {
+        Row     int              // 1-based position in the file
+        ID      int              // ID from the file, or zero
+        Website *monitor.Website // Configuration fields of the website
+        Err     error
+}
+
+// Result statuses of an imported row
+const (
+        StatusImported  = "imported"
+        StatusDuplicate = "duplicate"
+        StatusInvalid   = "invalid"
+)
+
+// RowResult is the outcome of importing one row
+type RowResult struct {
+        Row    int    `json:"row"`
+        URL    string `json:"url"`
+        Status string `json:"status"`
+        ID     int    `json:"id,omitempty"`
+        Error  string `json:"error,omitempty"`
+}
+
+// Report summarizes an import
+type Report struct {
+        Imported   int         `json:"imported"`
+        Duplicates int         `json:"duplicates"`
+        Invalid    int         `json:"invalid"`
+        Results    []RowResult `json:"results"`
+}
+
+// AddFunc adds a website under the given ID, or the next free ID when id is zero
+type AddFunc func(id int, config *monitor.Website) (*monitor.Website, error)
+
+// Import validates rows and adds every valid row whose URL is not already
+// monitored or earlier in the file, comparing URLs by monitor.URLKey. With
+// preserveIDs, rows keep the IDs from the file; otherwise every website gets
+// a new ID.
+func Import(rows []Row, existing []*monitor.Website, preserveIDs bool, add AddFunc) *Report {
+        report := &Report{Results: []RowResult{}}
+
+        seen := map[string]int{}
+        for _, website := range existing {
+                seen[monitor.URLKey(website.URL)] = website.ID
+        }
+
+        for _, row := range rows {
+                result := RowResult{Row: row.Row}
+                if row.Website != nil {
+                        result.URL = row.Website.URL
+                }
+
+                err := row.Err
+                if err == nil {
+                        err = row.Website.Validate()
+                        if row.Website.Name == "" {
+                                row.Website.Name = row.Website.URL
+                        }
+                }
+                if err != nil {
+                        result.Status = StatusInvalid
+                        result.Error = err.Error()
+                        report.Invalid++
+                        report.Results = append(report.Results, result)
+                        continue
+                }
+
+                if id, ok := seen[monitor.URLKey(row.Website.URL)]; ok {
+                        result.Status = StatusDuplicate
+                        result.ID = id
+                        if id == 0 {
+                                result.Error = "URL appears earlier in the file"
+                        } else {
+                                result.Error = fmt.Sprintf("URL is already monitored as website %d", id)
+                        }
+                        report.Duplicates++
+                        report.Results = append(report.Results, result)
+                        continue
+                }
+
+                id := 0
+                if preserveIDs {
+                        id = row.ID
+                }
+                website, err := add(id, row.Website)
+                if err != nil {
+                        result.Status = StatusInvalid
+                        result.Error = err.Error()
+                        report.Invalid++
+                        report.Results = append(report.Results, result)
+                        // Still count the URL as seen so later copies are reported as duplicates
+                        seen[monitor.URLKey(row.Website.URL)] = 0
+                        continue
+                }
+
+                seen[monitor.URLKey(website.URL)] = website.ID
+                result.Status = StatusImported
+                result.ID = website.ID
+                report.Imported++
+                report.Results = append(report.Results, result)
+        }
+
+        return report
+}
+
+// splitList splits a separated list, trimming spaces and dropping empty values
+func splitList(value, sep string) []string {
+        var values []string
+        for _, v := range strings.Split(value, sep) {
+                if v = strings.TrimSpace(v); v != "" {
+                        values = append(values, v)
+                }
+        }
+        return values
+}
@@ -0,0 +1,193 @@
+package bulk
+
+import (
+        "bytes"
+        "errors"
+        "reflect"
+        "strings"
+        "testing"
+
+        "website-monitor/monitor"
+)
+
+func TestExportAndParse(t *testing.T) {
+        websites := []*monitor.Website{
+                {ID: 3, URL: "https://example.com/", Name: "Example", Group: "shop/eu", Tags: []string{"prod", "eu"}},
+                {ID: 7, URL: "https://example.org/status", Name: "Status", Tags: []string{"prod"}},
+                {ID: 9, URL: "https://example.net/", Name: "Other", Group: "shop/us"},
+        }
+
+        for _, format := range []string{FormatJSON, FormatCSV, FormatOPML} {
+                t.Run(format, func(t *testing.T) {
+                        var buf bytes.Buffer
+                        if err := Export(&buf, format, websites); err != nil {
+                                t.Fatal(err)
+                        }
+                        rows, err := Parse(&buf, format)
+                        if err != nil {
+                                t.Fatal(err)
+                        }
+                        if len(rows) != len(websites) {
+                                t.Fatalf("parsed %d rows, want %d", len(rows), len(websites))
+                        }
+
+                        // OPML lists websites by folder, so match them up by ID
+                        byID := map[int]*monitor.Website{}
+                        for _, website := range websites {
+                                byID[website.ID] = website
+                        }
+                        for i, row := range rows {
+                                if row.Err != nil {
+                                        t.Fatalf("row %d: %v", row.Row, row.Err)
+                                }
+                                want, got := byID[row.ID], row.Website
+                                if want == nil {
+                                        t.Fatalf("row %d has unknown ID %d", row.Row, row.ID)
+                                }
+                                if row.Row != i+1 || got.URL != want.URL || got.Name != want.Name || got.Group != want.Group {
+                                        t.Errorf("row %d = %d %s %q in %q, want %d %s %q in %q",
+                                                row.Row, row.ID, got.URL, got.Name, got.Group, want.ID, want.URL, want.Name, want.Group)
+                                }
+                                if len(got.Tags) > 0 || len(want.Tags) > 0 {
+                                        if !reflect.DeepEqual(got.Tags, want.Tags) {
+                                                t.Errorf("row %d tags = %v, want %v", row.Row, got.Tags, want.Tags)
+                                        }
+                                }
+                        }
+                })
+        }
+}
+
+func TestParseCSV(t *testing.T) {
+        input := "URL, Name, intervalSeconds, skipTLSVerify, tags\n" +
+                "https://a.example/, A, 60, true, one; two\n" +
+                "https://b.example/, B, often, false,\n" +
+                "https://c.example/\n"
+        rows, err := Parse(strings.NewReader(input), FormatCSV)
+        if err != nil {
+                t.Fatal(err)
+        }
+        if len(rows) != 3 {
+                t.Fatalf("parsed %d rows, want 3", len(rows))
+        }
+
+        a := rows[0].Website
+        if rows[0].Err != nil || a.Name != "A" || a.IntervalSeconds != 60 || !a.SkipTLSVerify || !reflect.DeepEqual(a.Tags, []string{"one", "two"}) {
+                t.Errorf("row 1 = %+v, %v", a, rows[0].Err)
+        }
+        if rows[1].Err == nil || !strings.Contains(rows[1].Err.Error(), `invalid intervalSeconds "often"`) {
+                t.Errorf("row 2 error = %v, want an invalid interval", rows[1].Err)
+        }
+        if rows[2].Err != nil || rows[2].Website.URL != "https://c.example/" {
+                t.Errorf("row 3 = %+v, %v", rows[2].Website, rows[2].Err)
+        }
+
+        for _, input := range []string{"", "name\nA\n", "url,color\nhttps://a.example/,red\n"} {
+                if _, err := Parse(strings.NewReader(input), FormatCSV); err == nil {
+                        t.Errorf("Parse(%q) succeeded, want an error", input)
+                }
+        }
+}
+
+func TestParseOPMLFolders(t *testing.T) {
+        input := `<?xml version="1.0"?>
+<opml version="2.0"><head><title>Feeds</title></head><body>
+  <outline text="Shop">
+    <outline text="EU">
+      <outline text="Store" htmlUrl="https://shop.example/eu" category="prod,eu"/>
+    </outline>
+  </outline>
+  <outline title="Blog" xmlUrl="https://blog.example/feed" id="twelve"/>
+</body></opml>`
+        rows, err := Parse(strings.NewReader(input), FormatOPML)
+        if err != nil {
+                t.Fatal(err)
+        }
+        if len(rows) != 2 {
+                t.Fatalf("parsed %d rows, want 2", len(rows))
+        }
+
+        store := rows[0].Website
+        if rows[0].Err != nil || store.URL != "https://shop.example/eu" || store.Group != "Shop/EU" || !reflect.DeepEqual(store.Tags, []string{"prod", "eu"}) {
+                t.Errorf("row 1 = %+v, %v", store, rows[0].Err)
+        }
+        if rows[1].Website.URL != "https://blog.example/feed" || rows[1].Website.Name != "Blog" || rows[1].Err == nil {
+                t.Errorf("row 2 = %+v, %v, want an invalid id", rows[1].Website, rows[1].Err)
+        }
+}
+
+func TestImport(t *testing.T) {
+        existing := []*monitor.Website{{ID: 1, URL: "https://monitored.example/"}}
+        rows := []Row{
+                {Row: 1, ID: 10, Website: &monitor.Website{URL: "https://new.example/"}},
+                {Row: 2, ID: 11, Website: &monitor.Website{URL: "https://MONITORED.example"}},
+                {Row: 3, ID: 12, Website: &monitor.Website{URL: "https://new.example"}},
+                {Row: 4, ID: 13, Website: &monitor.Website{URL: "ftp://files.example/"}},
+                {Row: 5, Err: errors.New("invalid website")},
+                {Row: 6, ID: 14, Website: &monitor.Website{URL: "https://refused.example/"}},
+                {Row: 7, ID: 15, Website: &monitor.Website{URL: "https://refused.example/"}},
+                {Row: 8, ID: 16, Website: &monitor.Website{URL: "https://other.example/", Name: "Other"}},
+        }
+
+        var added []*monitor.Website
+        nextID := 100
+        report := Import(rows, existing, false, func(id int, config *monitor.Website) (*monitor.Website, error) {
+                if strings.Contains(config.URL, "refused") {
+                        return nil, errors.New("Website is not allowed")
+                }
+                if id == 0 {
+                        id = nextID
+                        nextID++
+                }
+                website := *config
+                website.ID = id
+                added = append(added, &website)
+                return &website, nil
+        })
+
+        want := []RowResult{
+                {Row: 1, URL: "https://new.example/", Status: StatusImported, ID: 100},
+                {Row: 2, URL: "https://MONITORED.example", Status: StatusDuplicate, ID: 1, Error: "URL is already monitored as website 1"},
+                {Row: 3, URL: "https://new.example", Status: StatusDuplicate, ID: 100, Error: "URL is already monitored as website 100"},
+                {Row: 4, URL: "ftp://files.example/", Status: StatusInvalid},
+                {Row: 5, Status: StatusInvalid, Error: "invalid website"},
+                {Row: 6, URL: "https://refused.example/", Status: StatusInvalid, Error: "Website is not allowed"},
+                {Row: 7, URL: "https://refused.example/", Status: StatusDuplicate, Error: "URL appears earlier in the file"},
+                {Row: 8, URL: "https://other.example/", Status: StatusImported, ID: 101},
+        }
+        if len(report.Results) != len(want) {
+                t.Fatalf("results = %+v, want %+v", report.Results, want)
+        }
+        for i, result := range report.Results {
+                if want[i].Error == "" && result.Status == StatusInvalid && result.Error != "" {
+                        // Validation messages are checked by the monitor package
+                        result.Error = ""
+                }
+                if result != want[i] {
+                        t.Errorf("row %d = %+v, want %+v", i+1, result, want[i])
+                }
+        }
+        if report.Imported != 2 || report.Duplicates != 3 || report.Invalid != 3 {
+                t.Errorf("imported %d, duplicates %d, invalid %d, want 2, 3 and 3", report.Imported, report.Duplicates, report.Invalid)
+        }
+        if len(added) != 2 || added[0].Name != "https://new.example/" || added[1].Name != "Other" {
+                t.Errorf("added %+v, want two websites named after their URL or their name", added)
+        }
+}
+
+func TestImportPreservesIDs(t *testing.T) {
+        rows := []Row{{Row: 1, ID: 42, Website: &monitor.Website{URL: "https://example.com/"}}}
+
+        for _, preserve := range []bool{true, false} {
+                var gotID int
+                Import(rows, nil, preserve, func(id int, config *monitor.Website) (*monitor.Website, error) {
+                        gotID = id
+                        website := *config
+                        website.ID = 1
+                        return &website, nil
+                })
+                if want := map[bool]int{true: 42, false: 0}[preserve]; gotID != want {
+                        t.Errorf("preserveIDs %v added with ID %d, want %d", preserve, gotID, want)
+                }
+        }
+}
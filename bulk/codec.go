@@ -0,0 +1,331 @@
+package bulk
+
+import (
+        "encoding/csv"
+        "encoding/json"
+        "encoding/xml"
+        "fmt"
+        "io"
+        "strconv"
+        "strings"
+        "time"
+
+        "website-monitor/monitor"
+)
+
+// Export writes websites in the given format
+func Export(w io.Writer, format string, websites []*monitor.Website) error {
+        switch format {
+        case FormatJSON:
+                enc := json.NewEncoder(w)
+                enc.SetIndent("", "  ")
+                return enc.Encode(websites)
+        case FormatCSV:
+                return exportCSV(w, websites)
+        case FormatOPML:
+                return exportOPML(w, websites)
+        }
+        return fmt.Errorf("unsupported format %q", format)
+}
+
+// Parse reads the rows of an import file in the given format. It fails only
+// if the file as a whole cannot be read; problems with individual rows are
+// reported on the rows.
+func Parse(r io.Reader, format string) ([]Row, error) {
+        switch format {
+        case FormatJSON:
+                return parseJSON(r)
+        case FormatCSV:
+                return parseCSV(r)
+        case FormatOPML:
+                return parseOPML(r)
+        }
+        return nil, fmt.Errorf("unsupported format %q", format)
+}
+
+// parseJSON reads an array of websites as produced by the JSON export
+func parseJSON(r io.Reader) ([]Row, error) {
+        var raw []json.RawMessage
+        if err := json.NewDecoder(r).Decode(&raw); err != nil {
+                return nil, fmt.Errorf("invalid JSON: %v", err)
+        }
+
+        rows := make([]Row, 0, len(raw))
+        for i, item := range raw {
+                row := Row{Row: i + 1}
+                var website monitor.Website
+                if err := json.Unmarshal(item, &website); err != nil {
+                        row.Err = fmt.Errorf("invalid website: %v", err)
+                } else {
+                        row.ID = website.ID
+                        row.Website = monitor.NewWebsite(0, &website)
+                }
+                rows = append(rows, row)
+        }
+        return rows, nil
+}
+
+// csvColumns are the columns written by the CSV export. Tags and selectors
+// are separated by semicolons, which CSS selectors never contain.
+var csvColumns = []string{
+        "id", "url", "name", "group", "intervalSeconds", "tags", "selectors",
+        "usePKI", "clientCertPath", "clientKeyPath", "skipTLSVerify", "customRootCAPath",
+}
+
+// exportCSV writes websites as CSV with a header row
+func exportCSV(w io.Writer, websites []*monitor.Website) error {
+        cw := csv.NewWriter(w)
+        if err := cw.Write(csvColumns); err != nil {
+                return err
+        }
+        for _, website := range websites {
+                record := []string{
+                        strconv.Itoa(website.ID),
+                        website.URL,
+                        website.Name,
+                        website.Group,
+                        strconv.Itoa(website.IntervalSeconds),
+                        strings.Join(website.Tags, ";"),
+                        strings.Join(website.Selectors, ";"),
+                        strconv.FormatBool(website.UsePKI),
+                        website.ClientCertPath,
+                        website.ClientKeyPath,
+                        strconv.FormatBool(website.SkipTLSVerify),
+                        website.CustomRootCAPath,
+                }
+                if err := cw.Write(record); err != nil {
+                        return err
+                }
+        }
+        cw.Flush()
+        return cw.Error()
+}
+
+// parseCSV reads CSV with a header row naming any of csvColumns. Only url is
+// required; column names are case-insensitive and may appear in any order.
+func parseCSV(r io.Reader) ([]Row, error) {
+        cr := csv.NewReader(r)
+        cr.FieldsPerRecord = -1
+        cr.TrimLeadingSpace = true
+
+        header, err := cr.Read()
+        if err != nil {
+                return nil, fmt.Errorf("could not read CSV header: %v", err)
+        }
+
+        columns := map[string]int{}
+        for i, name := range header {
+                name = strings.TrimSpace(name)
+                known := false
+                for _, column := range csvColumns {
+                        if strings.EqualFold(name, column) {
+                                columns[column] = i
+                                known = true
+                        }
+                }
+                if !known {
+                        return nil, fmt.Errorf("unknown CSV column %q", name)
+                }
+        }
+        if _, ok := columns["url"]; !ok {
+                return nil, fmt.Errorf("CSV header has no url column")
+        }
+
+        var rows []Row
+        for line := 1; ; line++ {
+                record, err := cr.Read()
+                if err == io.EOF {
+                        break
+                }
+                row := Row{Row: line}
+                if err != nil {
+                        row.Err = err
+                        rows = append(rows, row)
+                        continue
+                }
+
+                field := func(column string) string {
+                        if i, ok := columns[column]; ok && i < len(record) {
+                                return strings.TrimSpace(record[i])
+                        }
+                        return ""
+                }
+                row.Website, row.ID, row.Err = csvWebsite(field)
+                rows = append(rows, row)
+        }
+        return rows, nil
+}
+
+// csvWebsite builds a website from the fields of one CSV record
+func csvWebsite(field func(string) string) (*monitor.Website, int, error) {
+        website := &monitor.Website{
+                URL:              field("url"),
+                Name:             field("name"),
+                Group:            field("group"),
+                Tags:             splitList(field("tags"), ";"),
+                Selectors:        splitList(field("selectors"), ";"),
+                ClientCertPath:   field("clientCertPath"),
+                ClientKeyPath:    field("clientKeyPath"),
+                CustomRootCAPath: field("customRootCAPath"),
+        }
+
+        var err error
+        parseInt := func(column string) int {
+                value := field(column)
+                if value == "" || err != nil {
+                        return 0
+                }
+                n, parseErr := strconv.Atoi(value)
+                if parseErr != nil {
+                        err = fmt.Errorf("invalid %s %q", column, value)
+                }
+                return n
+        }
+        parseBool := func(column string) bool {
+                value := field(column)
+                if value == "" || err != nil {
+                        return false
+                }
+                b, parseErr := strconv.ParseBool(value)
+                if parseErr != nil {
+                        err = fmt.Errorf("invalid %s %q", column, value)
+                }
+                return b
+        }
+
+        id := parseInt("id")
+        website.IntervalSeconds = parseInt("intervalSeconds")
+        website.UsePKI = parseBool("usePKI")
+        website.SkipTLSVerify = parseBool("skipTLSVerify")
+        return website, id, err
+}
+
+// opmlDocument is an OPML 2.0 outline document
+type opmlDocument struct {
+        XMLName xml.Name      `xml:"opml"`
+        Version string        `xml:"version,attr"`
+        Title   string        `xml:"head>title"`
+        Created string        `xml:"head>dateCreated,omitempty"`
+        Body    []opmlOutline `xml:"body>outline"`
+}
+
+// opmlOutline is a website link, or a folder of outlines
+type opmlOutline struct {
+        Text     string        `xml:"text,attr"`
+        Title    string        `xml:"title,attr,omitempty"`
+        Type     string        `xml:"type,attr,omitempty"`
+        URL      string        `xml:"url,attr,omitempty"`
+        HTMLURL  string        `xml:"htmlUrl,attr,omitempty"`
+        XMLURL   string        `xml:"xmlUrl,attr,omitempty"`
+        Category string        `xml:"category,attr,omitempty"`
+        ID       string        `xml:"id,attr,omitempty"`
+        Outlines []opmlOutline `xml:"outline"`
+}
+
+// exportOPML writes websites as link outlines nested in folder outlines that
+// mirror their groups. Tags are written as the OPML category.
+func exportOPML(w io.Writer, websites []*monitor.Website) error {
+        doc := opmlDocument{
+                Version: "2.0",
+                Title:   "Monitored websites",
+                Created: time.Now().UTC().Format(time.RFC1123Z),
+        }
+        for _, website := range websites {
+                link := opmlOutline{
+                        Text:     website.Name,
+                        Title:    website.Name,
+                        Type:     "link",
+                        URL:      website.URL,
+                        Category: strings.Join(website.Tags, ","),
+                        ID:       strconv.Itoa(website.ID),
+                }
+
+                // Descend into the folder for each segment of the group path
+                outlines := &doc.Body
+                if website.Group != "" {
+                        for _, folder := range strings.Split(website.Group, "/") {
+                                outlines = &opmlFolder(outlines, folder).Outlines
+                        }
+                }
+                *outlines = append(*outlines, link)
+        }
+
+        if _, err := io.WriteString(w, xml.Header); err != nil {
+                return err
+        }
+        enc := xml.NewEncoder(w)
+        enc.Indent("", "  ")
+        if err := enc.Encode(doc); err != nil {
+                return err
+        }
+        _, err := io.WriteString(w, "\n")
+        return err
+}
+
+// opmlFolder returns the folder outline with the given text, adding it if needed
+func opmlFolder(outlines *[]opmlOutline, text string) *opmlOutline {
+        for i := range *outlines {
+                folder := &(*outlines)[i]
+                if folder.URL == "" && folder.Text == text {
+                        return folder
+                }
+        }
+        *outlines = append(*outlines, opmlOutline{Text: text})
+        return &(*outlines)[len(*outlines)-1]
+}
+
+// parseOPML reads the link outlines of an OPML document. Outlines are read
+// from url, htmlUrl or xmlUrl in that order. Enclosing folder outlines become
+// the website's group, and the category becomes its tags.
+func parseOPML(r io.Reader) ([]Row, error) {
+        var doc opmlDocument
+        if err := xml.NewDecoder(r).Decode(&doc); err != nil {
+                return nil, fmt.Errorf("invalid OPML: %v", err)
+        }
+
+        var rows []Row
+        var walk func(outlines []opmlOutline, folders []string)
+        walk = func(outlines []opmlOutline, folders []string) {
+                for _, outline := range outlines {
+                        url := outline.URL
+                        if url == "" {
+                                url = outline.HTMLURL
+                        }
+                        if url == "" {
+                                url = outline.XMLURL
+                        }
+
+                        // Outlines without a URL are folders
+                        if url == "" {
+                                folder := outline.Text
+                                if folder == "" {
+                                        folder = outline.Title
+                                }
+                                walk(outline.Outlines, append(append([]string{}, folders...), folder))
+                                continue
+                        }
+
+                        row := Row{Row: len(rows) + 1}
+                        name := outline.Title
+                        if name == "" {
+                                name = outline.Text
+                        }
+                        row.Website = &monitor.Website{
+                                URL:   url,
+                                Name:  name,
+                                Group: monitor.CleanGroup(strings.Join(folders, "/")),
+                                Tags:  splitList(outline.Category, ","),
+                        }
+                        if outline.ID != "" {
+                                id, err := strconv.Atoi(outline.ID)
+                                if err != nil {
+                                        row.Err = fmt.Errorf("invalid id %q", outline.ID)
+                                }
+                                row.ID = id
+                        }
+                        rows = append(rows, row)
+                }
+        }
+        walk(doc.Body, nil)
+        return rows, nil
+}
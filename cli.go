@@ -0,0 +1,653 @@
+package main
+
+import (
+        "encoding/json"
+        "flag"
+        "fmt"
+        "io"
+        "os"
+        "strconv"
+        "strings"
+        "text/tabwriter"
+        "time"
+
+        "website-monitor/bulk"
+        "website-monitor/monitor"
+)
+
+// defaultDBPath is the database file used when -db is not given
+const defaultDBPath = "websites.db"
+
+// defaultServerURL is the API address used when -server is not given
+const defaultServerURL = "http://localhost:5000"
+
+// cliOptions holds the flags shared by every client subcommand
+type cliOptions struct {
+        server    string
+        token     string
+        dbPath    string
+        workspace string
+        mode      string
+        output    string
+        egress    egressFlags // Policy for checks run against the database
+}
+
+// newFlagSet creates a flag set for a subcommand with the shared flags registered
+func newFlagSet(name, usage string) (*flag.FlagSet, *cliOptions) {
+        opts := &cliOptions{}
+        flags := flag.NewFlagSet(name, flag.ContinueOnError)
+
+        server := os.Getenv("WEBSITE_MONITOR_URL")
+        if server == "" {
+                server = defaultServerURL
+        }
+        flags.StringVar(&opts.server, "server", server, "URL of a running instance (or set WEBSITE_MONITOR_URL)")
+        flags.StringVar(&opts.token, "token", os.Getenv("WEBSITE_MONITOR_TOKEN"), "API token for the server (or set WEBSITE_MONITOR_TOKEN)")
+        flags.StringVar(&opts.dbPath, "db", defaultDBPath, "database file to use when the server is not running")
+        flags.StringVar(&opts.workspace, "workspace", os.Getenv("WEBSITE_MONITOR_WORKSPACE"), "workspace to act in (or set WEBSITE_MONITOR_WORKSPACE; default: your own)")
+        flags.StringVar(&opts.mode, "mode", "auto", "backend to use: auto, api or db")
+        flags.StringVar(&opts.output, "o", "table", "output format: table or json")
+        opts.egress.register(flags)
+
+        flags.Usage = func() {
+                fmt.Fprintf(flags.Output(), "Usage: website-monitor %s %s\n\nFlags:\n", name, usage)
+                flags.PrintDefaults()
+        }
+        return flags, opts
+}
+
+// validate checks the shared flags after parsing
+func (o *cliOptions) validate() error {
+        if o.output != "table" && o.output != "json" {
+                return fmt.Errorf("unknown output format %q", o.output)
+        }
+        return nil
+}
+
+// runCommand dispatches a subcommand
+func runCommand(name string, args []string) error {
+        switch name {
+        case "serve":
+                serve(args)
+                return nil
+        case "add":
+                return runAdd(args)
+        case "list":
+                return runList(args)
+        case "remove":
+                return runRemove(args)
+        case "check":
+                return runCheck(args)
+        case "pause":
+                return runPause(args, true)
+        case "resume":
+                return runPause(args, false)
+        case "history":
+                return runHistory(args)
+        case "export":
+                return runExport(args)
+        case "import":
+                return runImport(args)
+        case "reconcile":
+                return runReconcile(args)
+        case "token":
+                return runToken(args)
+        case "secret":
+                return runSecret(args)
+        case "help", "-h", "-help", "--help":
+                printUsage(os.Stdout)
+                return nil
+        }
+
+        printUsage(os.Stderr)
+        return fmt.Errorf("unknown command %q", name)
+}
+
+// printUsage lists the available subcommands
+func printUsage(w io.Writer) {
+        fmt.Fprint(w, `Usage: website-monitor <command> [flags]
+
+Commands:
+  serve     Run the web server and monitoring loop (default)
+  add       Add a website to monitor
+  list      List monitored websites
+  remove    Stop monitoring a website
+  check     Check a website, or all websites, now; with -once, run every
+            check locally and report, for use in CI pipelines
+  pause     Pause scheduled checks of a website, optionally -for a duration
+  resume    Resume scheduled checks of a website
+  history   Show the check history of a website
+  export    Write all websites as JSON, CSV or OPML
+  import    Add websites from a JSON, CSV or OPML file
+  reconcile Sync the monitored websites with a YAML site definitions file
+  token     Create, list or revoke API tokens
+  secret    Set, list or delete secrets used in request templates
+
+Client commands talk to the REST API of a running instance, or open the
+database file directly when no instance is reachable. Run
+"website-monitor <command> -h" for the flags of a command.
+`)
+}
+
+// parseFlags parses flags that may appear before, after or between
+// positional arguments, and returns the positional arguments
+func parseFlags(flags *flag.FlagSet, args []string) ([]string, error) {
+        var positional []string
+        for {
+                if err := flags.Parse(args); err != nil {
+                        return nil, err
+                }
+                if flags.NArg() == 0 {
+                        return positional, nil
+                }
+                positional = append(positional, flags.Arg(0))
+                args = flags.Args()[1:]
+        }
+}
+
+// parseID parses a website ID argument
+func parseID(arg string) (int, error) {
+        id, err := strconv.Atoi(arg)
+        if err != nil {
+                return 0, fmt.Errorf("invalid website ID %q", arg)
+        }
+        return id, nil
+}
+
+// stringList is a flag that can be repeated to collect several values
+type stringList []string
+
+func (l *stringList) String() string {
+        return strings.Join(*l, ", ")
+}
+
+func (l *stringList) Set(value string) error {
+        *l = append(*l, value)
+        return nil
+}
+
+// parsePairs splits each value at the first sep into a name and a value,
+// trimming spaces around both
+func parsePairs(values []string, sep string) (map[string]string, error) {
+        if len(values) == 0 {
+                return nil, nil
+        }
+        pairs := map[string]string{}
+        for _, value := range values {
+                name, v, ok := strings.Cut(value, sep)
+                if !ok || strings.TrimSpace(name) == "" {
+                        return nil, fmt.Errorf("expected name%svalue, got %q", sep, value)
+                }
+                pairs[strings.TrimSpace(name)] = strings.TrimSpace(v)
+        }
+        return pairs, nil
+}
+
+// runAdd adds a website to monitor
+func runAdd(args []string) error {
+        flags, opts := newFlagSet("add", "[flags] URL")
+        config := &monitor.Website{}
+        var selectors, tags stringList
+        flags.StringVar(&config.Name, "name", "", "display name (defaults to the URL)")
+        flags.BoolVar(&config.UsePKI, "pki", false, "use PKI authentication")
+        flags.StringVar(&config.ClientCertPath, "cert", "", "path to client certificate file")
+        flags.StringVar(&config.ClientKeyPath, "key", "", "path to client key file")
+        flags.StringVar(&config.CustomRootCAPath, "ca", "", "path to custom root CA certificate")
+        flags.BoolVar(&config.SkipTLSVerify, "insecure", false, "skip TLS verification")
+        interval := flags.Duration("interval", 0, "time between checks (defaults to "+monitor.DefaultInterval.String()+")")
+        flags.Var(&selectors, "selector", "CSS selector limiting change detection (repeatable)")
+        flags.Var(&tags, "tag", "tag to attach to the website (repeatable)")
+        flags.StringVar(&config.Group, "group", "", "group path such as team/service")
+        var headers, query stringList
+        flags.StringVar(&config.Method, "method", "", "HTTP method to check with (defaults to GET)")
+        flags.Var(&headers, "header", "request header as \"Name: value\" (repeatable)")
+        flags.Var(&query, "query", "query parameter as name=value (repeatable)")
+        flags.StringVar(&config.Body, "body", "", "request body")
+        authConfig := &monitor.AuthConfig{}
+        var scopes, loginFields stringList
+        flags.StringVar(&authConfig.Type, "auth", "", "authentication: basic, bearer, oauth2 or form")
+        flags.StringVar(&authConfig.Username, "auth-user", "", "basic or form authentication user name")
+        flags.StringVar(&authConfig.Password, "auth-password", "", "basic or form authentication password, as a secret reference such as '{{secret \"name\"}}'")
+        flags.StringVar(&authConfig.Token, "auth-token", "", "bearer token, as a secret reference")
+        flags.StringVar(&authConfig.TokenURL, "token-url", "", "OAuth2 token endpoint")
+        flags.StringVar(&authConfig.ClientID, "client-id", "", "OAuth2 client ID")
+        flags.StringVar(&authConfig.ClientSecret, "client-secret", "", "OAuth2 client secret, as a secret reference")
+        flags.Var(&scopes, "scope", "OAuth2 scope to request (repeatable)")
+        flags.StringVar(&authConfig.LoginURL, "login-url", "", "page with the login form, for form authentication")
+        flags.StringVar(&authConfig.UsernameField, "username-field", "", "login form field for the user name (defaults to "+monitor.DefaultUsernameField+")")
+        flags.StringVar(&authConfig.PasswordField, "password-field", "", "login form field for the password (defaults to "+monitor.DefaultPasswordField+")")
+        flags.Var(&loginFields, "login-field", "extra login form field as name=value (repeatable)")
+        flags.StringVar(&authConfig.SessionMarker, "session-marker", "", "text only shown when logged out, such as \"Sign in\"")
+        redirects := &monitor.RedirectPolicy{}
+        flags.StringVar(&redirects.Mode, "redirects", "", "redirects to follow: follow, none or same-host")
+        flags.IntVar(&redirects.MaxHops, "max-redirects", 0, fmt.Sprintf("most redirects to follow (defaults to %d)", monitor.DefaultMaxRedirects))
+        stepsFile := flags.String("steps", "", "JSON file listing the steps of a transaction check")
+        proxy := &monitor.ProxyConfig{}
+        var noProxy stringList
+        flags.StringVar(&proxy.URL, "proxy", "", "proxy to check through instead of the server's, such as socks5://proxy:1080, or \"direct\" to bypass it")
+        flags.StringVar(&proxy.Username, "proxy-user", "", "proxy user name")
+        flags.StringVar(&proxy.Password, "proxy-password", "", "proxy password, as a secret reference")
+        flags.Var(&noProxy, "no-proxy", "host, domain or network (CIDR) to reach without the proxy (repeatable)")
+        positional, err := parseFlags(flags, args)
+        if err != nil {
+                return err
+        }
+        if err := opts.validate(); err != nil {
+                return err
+        }
+        if len(positional) != 1 {
+                flags.Usage()
+                return fmt.Errorf("expected exactly one URL")
+        }
+        config.URL = positional[0]
+        config.IntervalSeconds = int(*interval / time.Second)
+        config.Selectors = selectors
+        config.Tags = tags
+        if config.Headers, err = parsePairs(headers, ":"); err != nil {
+                return fmt.Errorf("invalid -header: %v", err)
+        }
+        if config.Query, err = parsePairs(query, "="); err != nil {
+                return fmt.Errorf("invalid -query: %v", err)
+        }
+        if authConfig.LoginFields, err = parsePairs(loginFields, "="); err != nil {
+                return fmt.Errorf("invalid -login-field: %v", err)
+        }
+        if authConfig.Type != "" {
+                authConfig.Scopes = scopes
+                config.Auth = authConfig
+        }
+        if redirects.Mode != "" || redirects.MaxHops != 0 {
+                config.Redirects = redirects
+        }
+        if proxy.URL == "direct" {
+                config.Proxy = &monitor.ProxyConfig{Direct: true}
+        } else if proxy.URL != "" {
+                proxy.NoProxy = noProxy
+                config.Proxy = proxy
+        }
+        if *stepsFile != "" {
+                data, err := os.ReadFile(*stepsFile)
+                if err != nil {
+                        return err
+                }
+                if err := json.Unmarshal(data, &config.Steps); err != nil {
+                        return fmt.Errorf("invalid -steps file: %v", err)
+                }
+        }
+
+        b, err := openBackend(opts)
+        if err != nil {
+                return err
+        }
+        defer b.Close()
+
+        website, err := b.Add(config)
+        if err != nil {
+                return err
+        }
+        return printWebsites(opts, []*monitor.Website{website})
+}
+
+// runList lists monitored websites
+func runList(args []string) error {
+        flags, opts := newFlagSet("list", "[flags]")
+        var tags stringList
+        flags.Var(&tags, "tag", "only list websites with this tag (repeatable)")
+        group := flags.String("group", "", "only list websites in this group or its subgroups")
+        if _, err := parseFlags(flags, args); err != nil {
+                return err
+        }
+        if err := opts.validate(); err != nil {
+                return err
+        }
+
+        b, err := openBackend(opts)
+        if err != nil {
+                return err
+        }
+        defer b.Close()
+
+        websites, err := b.List()
+        if err != nil {
+                return err
+        }
+
+        var matched []*monitor.Website
+        for _, website := range websites {
+                if website.HasTags(tags) && website.InGroup(*group) {
+                        matched = append(matched, website)
+                }
+        }
+        return printWebsites(opts, matched)
+}
+
+// runRemove stops monitoring a website
+func runRemove(args []string) error {
+        flags, opts := newFlagSet("remove", "[flags] ID")
+        positional, err := parseFlags(flags, args)
+        if err != nil {
+                return err
+        }
+        if err := opts.validate(); err != nil {
+                return err
+        }
+        if len(positional) != 1 {
+                flags.Usage()
+                return fmt.Errorf("expected exactly one website ID")
+        }
+        id, err := parseID(positional[0])
+        if err != nil {
+                return err
+        }
+
+        b, err := openBackend(opts)
+        if err != nil {
+                return err
+        }
+        defer b.Close()
+
+        if err := b.Remove(id); err != nil {
+                return err
+        }
+        fmt.Printf("Removed website %d\n", id)
+        return nil
+}
+
+// runPause pauses or resumes scheduled checks of a website
+func runPause(args []string, paused bool) error {
+        name := "resume"
+        if paused {
+                name = "pause"
+        }
+        flags, opts := newFlagSet(name, "[flags] ID")
+        var duration time.Duration
+        if paused {
+                flags.DurationVar(&duration, "for", 0, "resume automatically after this long, e.g. 2h (default: until resumed)")
+        }
+        positional, err := parseFlags(flags, args)
+        if err != nil {
+                return err
+        }
+        if err := opts.validate(); err != nil {
+                return err
+        }
+        if len(positional) != 1 {
+                flags.Usage()
+                return fmt.Errorf("expected exactly one website ID")
+        }
+        id, err := parseID(positional[0])
+        if err != nil {
+                return err
+        }
+        if duration < 0 {
+                return fmt.Errorf("-for must be positive")
+        }
+        var until time.Time
+        if duration > 0 {
+                until = time.Now().Add(duration)
+        }
+
+        b, err := openBackend(opts)
+        if err != nil {
+                return err
+        }
+        defer b.Close()
+
+        website, err := b.SetPaused(id, paused, until)
+        if err != nil {
+                return err
+        }
+        switch {
+        case !paused:
+                fmt.Printf("Resumed website %d\n", website.ID)
+        case until.IsZero():
+                fmt.Printf("Paused website %d\n", website.ID)
+        default:
+                fmt.Printf("Paused website %d until %s\n", website.ID, until.Format(time.RFC3339))
+        }
+        return nil
+}
+
+// runCheck checks one website, or all of them with -all. With -once it runs
+// every check locally instead, prints a report and fails if any site failed.
+func runCheck(args []string) error {
+        flags, opts := newFlagSet("check", "[flags] ID | -all | -once")
+        all := flags.Bool("all", false, "check every website")
+        var once onceOptions
+        flags.BoolVar(&once.enabled, "once", false, "check every website locally once, print a report and exit non-zero on failures")
+        flags.StringVar(&once.config, "config", "", "with -once, read websites from this JSON export instead of the database")
+        flags.BoolVar(&once.update, "update", false, "with -once -config, write the new check results back to the config file")
+        flags.StringVar(&once.report, "report", "text", "with -once, report format: text, json or junit")
+        flags.StringVar(&once.failOn, "fail-on", "error,changed", "with -once, comma-separated outcomes that fail the run: error, changed")
+        positional, err := parseFlags(flags, args)
+        if err != nil {
+                return err
+        }
+        if once.enabled {
+                if *all || len(positional) > 0 {
+                        flags.Usage()
+                        return fmt.Errorf("-once checks every website and takes no ID")
+                }
+                return runCheckOnce(opts, &once)
+        }
+        if err := opts.validate(); err != nil {
+                return err
+        }
+        if *all == (len(positional) == 1) || len(positional) > 1 {
+                flags.Usage()
+                return fmt.Errorf("expected either one website ID or -all")
+        }
+
+        b, err := openBackend(opts)
+        if err != nil {
+                return err
+        }
+        defer b.Close()
+
+        var ids []int
+        if *all {
+                websites, err := b.List()
+                if err != nil {
+                        return err
+                }
+                for _, website := range websites {
+                        ids = append(ids, website.ID)
+                }
+        } else {
+                id, err := parseID(positional[0])
+                if err != nil {
+                        return err
+                }
+                ids = []int{id}
+        }
+
+        var checked []*monitor.Website
+        for _, id := range ids {
+                website, err := b.Check(id)
+                if err != nil {
+                        return err
+                }
+                checked = append(checked, website)
+        }
+        return printWebsites(opts, checked)
+}
+
+// runHistory shows the check history of a website
+func runHistory(args []string) error {
+        flags, opts := newFlagSet("history", "[flags] ID")
+        limit := flags.Int("limit", 20, "number of most recent checks to show (0 for all)")
+        positional, err := parseFlags(flags, args)
+        if err != nil {
+                return err
+        }
+        if err := opts.validate(); err != nil {
+                return err
+        }
+        if len(positional) != 1 {
+                flags.Usage()
+                return fmt.Errorf("expected exactly one website ID")
+        }
+        id, err := parseID(positional[0])
+        if err != nil {
+                return err
+        }
+
+        b, err := openBackend(opts)
+        if err != nil {
+                return err
+        }
+        defer b.Close()
+
+        entries, err := b.History(id, *limit)
+        if err != nil {
+                return err
+        }
+
+        if opts.output == "json" {
+                return writeJSON(os.Stdout, entries)
+        }
+
+        tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+        fmt.Fprintln(tw, "CHECKED\tSTATUS\tCHANGED\tDURATION\tERROR")
+        for _, entry := range entries {
+                fmt.Fprintf(tw, "%s\t%d\t%v\t%s\t%s\n",
+                        entry.CheckedAt.Local().Format(time.RFC3339),
+                        entry.StatusCode,
+                        entry.Changed,
+                        time.Duration(entry.DurationMs)*time.Millisecond,
+                        entry.Error,
+                )
+        }
+        return tw.Flush()
+}
+
+// runExport writes all websites as JSON, CSV or OPML
+func runExport(args []string) error {
+        flags, opts := newFlagSet("export", "[flags]")
+        file := flags.String("file", "", "file to write to (defaults to standard output)")
+        format := flags.String("format", "", "json, csv or opml (defaults to the -file extension, else json)")
+        if _, err := parseFlags(flags, args); err != nil {
+                return err
+        }
+        if err := opts.validate(); err != nil {
+                return err
+        }
+        if *format == "" {
+                *format = bulk.FormatFromFilename(*file)
+        }
+        if !bulk.ValidFormat(*format) {
+                return fmt.Errorf("unsupported format %q", *format)
+        }
+
+        b, err := openBackend(opts)
+        if err != nil {
+                return err
+        }
+        defer b.Close()
+
+        out := os.Stdout
+        if *file != "" {
+                f, err := os.Create(*file)
+                if err != nil {
+                        return err
+                }
+                defer f.Close()
+                out = f
+        }
+        return b.Export(out, *format)
+}
+
+// runImport adds the websites from a JSON, CSV or OPML file
+func runImport(args []string) error {
+        flags, opts := newFlagSet("import", "[flags] FILE")
+        format := flags.String("format", "", "json, csv or opml (defaults to the file extension, else json)")
+        preserveIDs := flags.Bool("preserve-ids", false, "keep the IDs from the file instead of assigning new ones")
+        positional, err := parseFlags(flags, args)
+        if err != nil {
+                return err
+        }
+        if err := opts.validate(); err != nil {
+                return err
+        }
+        if len(positional) != 1 {
+                flags.Usage()
+                return fmt.Errorf("expected exactly one file")
+        }
+        if *format == "" {
+                *format = bulk.FormatFromFilename(positional[0])
+        }
+        if !bulk.ValidFormat(*format) {
+                return fmt.Errorf("unsupported format %q", *format)
+        }
+
+        data, err := os.ReadFile(positional[0])
+        if err != nil {
+                return err
+        }
+
+        b, err := openBackend(opts)
+        if err != nil {
+                return err
+        }
+        defer b.Close()
+
+        report, err := b.Import(data, *format, *preserveIDs)
+        if err != nil {
+                return err
+        }
+
+        if opts.output == "json" {
+                return writeJSON(os.Stdout, report)
+        }
+        tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+        fmt.Fprintln(tw, "ROW\tSTATUS\tID\tURL\tERROR")
+        for _, result := range report.Results {
+                fmt.Fprintf(tw, "%d\t%s\t%d\t%s\t%s\n", result.Row, result.Status, result.ID, result.URL, result.Error)
+        }
+        if err := tw.Flush(); err != nil {
+                return err
+        }
+        fmt.Printf("\n%d imported, %d duplicates, %d invalid\n", report.Imported, report.Duplicates, report.Invalid)
+        return nil
+}
+
+// printWebsites writes websites as a table or JSON
+func printWebsites(opts *cliOptions, websites []*monitor.Website) error {
+        if opts.output == "json" {
+                return writeJSON(os.Stdout, websites)
+        }
+
+        tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+        fmt.Fprintln(tw, "ID\tNAME\tGROUP\tURL\tSTATUS\tLAST CHECKED")
+        for _, website := range websites {
+                lastChecked := "never"
+                if !website.LastChecked.IsZero() {
+                        lastChecked = website.LastChecked.Local().Format(time.RFC3339)
+                }
+                fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\t%s\n", website.ID, website.Name, website.Group, website.URL, websiteStatus(website), lastChecked)
+        }
+        return tw.Flush()
+}
+
+// websiteStatus summarizes a website's state the same way the dashboard does
+func websiteStatus(website *monitor.Website) string {
+        switch {
+        case website.Paused:
+                return "paused"
+        case website.Error != "":
+                return "error: " + strings.TrimSpace(website.Error)
+        case website.IsFirstCheck:
+                return "pending"
+        case website.HasChanged:
+                return "changed"
+        default:
+                return "unchanged"
+        }
+}
+
+// writeJSON writes v as indented JSON
+func writeJSON(w io.Writer, v interface{}) error {
+        enc := json.NewEncoder(w)
+        enc.SetIndent("", "  ")
+        return enc.Encode(v)
+}
@@ -0,0 +1,646 @@
+package main
+
+import (
+        "bytes"
+        "encoding/json"
+        "errors"
+        "fmt"
+        "io"
+        "net/http"
+        "net/url"
+        "os"
+        "sort"
+        "strings"
+        "time"
+
+        "website-monitor/audit"
+        "website-monitor/auth"
+        "website-monitor/bulk"
+        "website-monitor/database"
+        "website-monitor/handlers"
+        "website-monitor/monitor"
+)
+
+// backend performs client commands either through the REST API of a running
+// instance or directly against the database file
+type backend interface {
+        List() ([]*monitor.Website, error)
+        Add(config *monitor.Website) (*monitor.Website, error)
+        Update(id int, config *monitor.Website) (*monitor.Website, error)
+        Remove(id int) error
+        Check(id int) (*monitor.Website, error)
+        SetPaused(id int, paused bool, until time.Time) (*monitor.Website, error)
+        History(id, limit int) ([]*monitor.HistoryEntry, error)
+        Export(w io.Writer, format string) error
+        Import(data []byte, format string, preserveIDs bool) (*bulk.Report, error)
+        Tokens() ([]*auth.Token, error)
+        CreateToken(name, scope, user string, ttl time.Duration) (string, *auth.Token, error)
+        RevokeToken(id string) error
+        Secrets() ([]*monitor.Secret, error)
+        SetSecret(name, value string) error
+        DeleteSecret(name string) error
+        Close() error
+}
+
+// openBackend selects the backend for the given options. In auto mode the API
+// is used if a server answers, otherwise the database file is opened.
+func openBackend(opts *cliOptions) (backend, error) {
+        switch opts.mode {
+        case "api":
+                return newAPIBackend(opts.server, opts.token, opts.workspace), nil
+        case "db":
+                return newDBBackend(opts)
+        case "auto":
+                api := newAPIBackend(opts.server, opts.token, opts.workspace)
+                if api.reachable() {
+                        return api, nil
+                }
+                b, err := newDBBackend(opts)
+                if err != nil {
+                        return nil, fmt.Errorf("no server at %s and %v", opts.server, err)
+                }
+                return b, nil
+        }
+        return nil, fmt.Errorf("unknown mode %q", opts.mode)
+}
+
+// openDatabase opens the database file, scoped to the selected workspace
+func (o *cliOptions) openDatabase() (*database.DB, error) {
+        db, err := database.New(o.dbPath)
+        if err != nil {
+                return nil, err
+        }
+        if o.workspace == "" {
+                return db, nil
+        }
+
+        scoped, err := db.Workspace(o.workspace)
+        if err != nil {
+                db.Close()
+                return nil, err
+        }
+        return scoped, nil
+}
+
+// apiBackend talks to the REST API of a running instance
+type apiBackend struct {
+        baseURL   string
+        token     string // API token sent as a bearer token, if set
+        workspace string // Workspace to act in; empty for the token's own
+        client    *http.Client
+}
+
+// newAPIBackend creates a backend for the server at baseURL
+func newAPIBackend(baseURL, token, workspace string) *apiBackend {
+        return &apiBackend{
+                baseURL:   strings.TrimRight(baseURL, "/"),
+                token:     token,
+                workspace: workspace,
+                client: &http.Client{
+                        // Checks can take up to the monitor's 30 second timeout
+                        Timeout: 60 * time.Second,
+                },
+        }
+}
+
+// reachable reports whether a server answers at the base URL
+func (a *apiBackend) reachable() bool {
+        client := &http.Client{Timeout: 2 * time.Second}
+        resp, err := client.Get(a.baseURL + "/api/websites")
+        if err != nil {
+                return false
+        }
+        resp.Body.Close()
+        return true
+}
+
+// do sends a request and decodes a JSON response into out, if non-nil
+func (a *apiBackend) do(method, path string, body interface{}, out interface{}) error {
+        var reader io.Reader
+        contentType := ""
+        if body != nil {
+                buf, err := json.Marshal(body)
+                if err != nil {
+                        return err
+                }
+                reader = bytes.NewReader(buf)
+                contentType = "application/json"
+        }
+
+        resp, err := a.send(method, path, contentType, reader)
+        if err != nil {
+                return err
+        }
+        defer resp.Body.Close()
+
+        if out == nil {
+                return nil
+        }
+        return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// send sends a request with a raw body and returns the response, turning
+// error statuses into errors
+func (a *apiBackend) send(method, path, contentType string, body io.Reader) (*http.Response, error) {
+        req, err := http.NewRequest(method, a.baseURL+path, body)
+        if err != nil {
+                return nil, err
+        }
+        if contentType != "" {
+                req.Header.Set("Content-Type", contentType)
+        }
+        if a.token != "" {
+                req.Header.Set("Authorization", "Bearer "+a.token)
+        }
+        if a.workspace != "" {
+                req.Header.Set(handlers.WorkspaceHeader, a.workspace)
+        }
+
+        resp, err := a.client.Do(req)
+        if err != nil {
+                return nil, err
+        }
+
+        if resp.StatusCode >= 300 {
+                defer resp.Body.Close()
+                msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+
+                // Validation errors come as JSON; their summary reads best
+                var validation struct {
+                        Error string `json:"error"`
+                }
+                if json.Unmarshal(msg, &validation) == nil && validation.Error != "" {
+                        msg = []byte(validation.Error)
+                }
+                return nil, fmt.Errorf("%s %s: %s: %s", method, path, resp.Status, strings.TrimSpace(string(msg)))
+        }
+        return resp, nil
+}
+
+func (a *apiBackend) List() ([]*monitor.Website, error) {
+        var websites []*monitor.Website
+        err := a.do("GET", "/api/websites", nil, &websites)
+        return websites, err
+}
+
+func (a *apiBackend) Add(config *monitor.Website) (*monitor.Website, error) {
+        var website monitor.Website
+        if err := a.do("POST", "/api/websites", config, &website); err != nil {
+                return nil, err
+        }
+        return &website, nil
+}
+
+func (a *apiBackend) Update(id int, config *monitor.Website) (*monitor.Website, error) {
+        var website monitor.Website
+        if err := a.do("PUT", fmt.Sprintf("/api/websites/%d", id), config, &website); err != nil {
+                return nil, err
+        }
+        return &website, nil
+}
+
+func (a *apiBackend) Remove(id int) error {
+        return a.do("DELETE", fmt.Sprintf("/api/websites/%d", id), nil, nil)
+}
+
+func (a *apiBackend) Check(id int) (*monitor.Website, error) {
+        var website monitor.Website
+        if err := a.do("POST", fmt.Sprintf("/api/websites/%d/check", id), nil, &website); err != nil {
+                return nil, err
+        }
+        return &website, nil
+}
+
+func (a *apiBackend) SetPaused(id int, paused bool, until time.Time) (*monitor.Website, error) {
+        path := fmt.Sprintf("/api/websites/%d/resume", id)
+        var body interface{}
+        if paused {
+                path = fmt.Sprintf("/api/websites/%d/pause", id)
+                if !until.IsZero() {
+                        body = map[string]time.Time{"until": until}
+                }
+        }
+
+        var website monitor.Website
+        if err := a.do("POST", path, body, &website); err != nil {
+                return nil, err
+        }
+        return &website, nil
+}
+
+func (a *apiBackend) History(id, limit int) ([]*monitor.HistoryEntry, error) {
+        var entries []*monitor.HistoryEntry
+        err := a.do("GET", fmt.Sprintf("/api/websites/%d/history?limit=%d", id, limit), nil, &entries)
+        return entries, err
+}
+
+func (a *apiBackend) Export(w io.Writer, format string) error {
+        resp, err := a.send("GET", "/api/export?format="+url.QueryEscape(format), "", nil)
+        if err != nil {
+                return err
+        }
+        defer resp.Body.Close()
+
+        _, err = io.Copy(w, resp.Body)
+        return err
+}
+
+func (a *apiBackend) Import(data []byte, format string, preserveIDs bool) (*bulk.Report, error) {
+        ids := "reassign"
+        if preserveIDs {
+                ids = "preserve"
+        }
+        path := fmt.Sprintf("/api/import?format=%s&ids=%s", url.QueryEscape(format), ids)
+
+        resp, err := a.send("POST", path, bulk.ContentType(format), bytes.NewReader(data))
+        if err != nil {
+                return nil, err
+        }
+        defer resp.Body.Close()
+
+        var report bulk.Report
+        if err := json.NewDecoder(resp.Body).Decode(&report); err != nil {
+                return nil, err
+        }
+        return &report, nil
+}
+
+func (a *apiBackend) Tokens() ([]*auth.Token, error) {
+        var tokens []*auth.Token
+        err := a.do("GET", "/api/tokens", nil, &tokens)
+        return tokens, err
+}
+
+func (a *apiBackend) CreateToken(name, scope, user string, ttl time.Duration) (string, *auth.Token, error) {
+        body := map[string]string{"name": name, "scope": scope, "user": user}
+        if ttl > 0 {
+                body["expiresIn"] = ttl.String()
+        }
+        var created struct {
+                auth.Token
+                Secret string `json:"secret"`
+        }
+        if err := a.do("POST", "/api/tokens", body, &created); err != nil {
+                return "", nil, err
+        }
+        return created.Secret, &created.Token, nil
+}
+
+func (a *apiBackend) RevokeToken(id string) error {
+        return a.do("DELETE", "/api/tokens/"+url.PathEscape(id), nil, nil)
+}
+
+func (a *apiBackend) Secrets() ([]*monitor.Secret, error) {
+        var secrets []*monitor.Secret
+        err := a.do("GET", "/api/secrets", nil, &secrets)
+        return secrets, err
+}
+
+func (a *apiBackend) SetSecret(name, value string) error {
+        return a.do("PUT", "/api/secrets/"+url.PathEscape(name), map[string]string{"value": value}, nil)
+}
+
+func (a *apiBackend) DeleteSecret(name string) error {
+        return a.do("DELETE", "/api/secrets/"+url.PathEscape(name), nil, nil)
+}
+
+func (a *apiBackend) Close() error {
+        return nil
+}
+
+// dbBackend operates directly on the database file. It can only be used
+// while the server is stopped, since the server holds the file lock.
+type dbBackend struct {
+        db     *database.DB
+        egress *monitor.EgressPolicy // What checks may connect to, as on the server
+}
+
+// newDBBackend opens the database file, scoped to the selected workspace
+func newDBBackend(opts *cliOptions) (*dbBackend, error) {
+        egress, err := opts.egress.policy()
+        if err != nil {
+                return nil, fmt.Errorf("invalid egress policy: %v", err)
+        }
+        db, err := opts.openDatabase()
+        if err != nil {
+                return nil, err
+        }
+        return &dbBackend{db: db, egress: egress}, nil
+}
+
+func (d *dbBackend) List() ([]*monitor.Website, error) {
+        websites, err := d.db.GetWebsites()
+        if err != nil {
+                return nil, err
+        }
+
+        // Keys are stored as strings, so restore numeric order
+        sort.Slice(websites, func(i, j int) bool { return websites[i].ID < websites[j].ID })
+        return websites, nil
+}
+
+func (d *dbBackend) Add(config *monitor.Website) (*monitor.Website, error) {
+        return d.addWithID(0, config)
+}
+
+// addWithID saves a new website under the given ID, or the next free ID when
+// id is zero
+func (d *dbBackend) addWithID(id int, config *monitor.Website) (*monitor.Website, error) {
+        if err := config.Validate(); err != nil {
+                return nil, err
+        }
+
+        websites, err := d.db.GetWebsites()
+        if err != nil {
+                return nil, err
+        }
+
+        // Allocate IDs the same way the server does when it loads the database
+        nextID := 1
+        for _, website := range websites {
+                if monitor.URLKey(website.URL) == monitor.URLKey(config.URL) {
+                        return nil, fmt.Errorf("URL is already monitored as website %d", website.ID)
+                }
+                if website.ID == id {
+                        return nil, fmt.Errorf("website ID %d is already in use", id)
+                }
+                if website.ID >= nextID {
+                        nextID = website.ID + 1
+                }
+        }
+        if id == 0 {
+                id = nextID
+        } else if id < 0 {
+                return nil, fmt.Errorf("invalid website ID %d", id)
+        }
+
+        website := monitor.NewWebsite(id, config)
+        if website.Name == "" {
+                website.Name = website.URL
+        }
+        if err := d.db.SaveWebsite(website); err != nil {
+                return nil, err
+        }
+        d.record(audit.ActionCreate, audit.ResourceWebsite, website.ID, nil, website)
+        return website, nil
+}
+
+func (d *dbBackend) Update(id int, config *monitor.Website) (*monitor.Website, error) {
+        if err := config.Validate(); err != nil {
+                return nil, err
+        }
+
+        website, err := d.find(id)
+        if err != nil {
+                return nil, err
+        }
+        if duplicate, err := d.findURL(config.URL, id); err != nil {
+                return nil, err
+        } else if duplicate != nil {
+                return nil, fmt.Errorf("URL is already monitored as website %d", duplicate.ID)
+        }
+        before := *website
+        website.ApplyConfig(config)
+        if website.Name == "" {
+                website.Name = website.URL
+        }
+        if err := d.db.SaveWebsite(website); err != nil {
+                return nil, err
+        }
+        d.record(audit.ActionUpdate, audit.ResourceWebsite, id, &before, website)
+        return website, nil
+}
+
+func (d *dbBackend) Remove(id int) error {
+        website, err := d.find(id)
+        if err != nil {
+                return err
+        }
+        if err := d.db.DeleteWebsite(id); err != nil {
+                return err
+        }
+        d.record(audit.ActionDelete, audit.ResourceWebsite, id, website, nil)
+        return nil
+}
+
+func (d *dbBackend) Check(id int) (*monitor.Website, error) {
+        var saveErr error
+        m := monitor.NewMonitor(func(website *monitor.Website) {
+                if err := d.db.SaveWebsite(website); err != nil {
+                        saveErr = err
+                }
+        })
+        m.SetEgressPolicy(d.egress)
+        m.SetSecretFunc(d.db.GetSecretValue)
+        m.SetHistoryFunc(func(entry *monitor.HistoryEntry) {
+                if err := d.db.AddHistoryEntry(entry); err != nil {
+                        saveErr = err
+                }
+        })
+        if err := d.db.LoadWebsitesToMonitor(m); err != nil {
+                return nil, err
+        }
+
+        website := m.CheckWebsite(id)
+        if website == nil {
+                return nil, fmt.Errorf("website %d not found", id)
+        }
+        return website, saveErr
+}
+
+func (d *dbBackend) History(id, limit int) ([]*monitor.HistoryEntry, error) {
+        if _, err := d.find(id); err != nil {
+                return nil, err
+        }
+        return d.db.GetHistory(id, limit)
+}
+
+func (d *dbBackend) Export(w io.Writer, format string) error {
+        websites, err := d.List()
+        if err != nil {
+                return err
+        }
+        return bulk.Export(w, format, websites)
+}
+
+func (d *dbBackend) Import(data []byte, format string, preserveIDs bool) (*bulk.Report, error) {
+        rows, err := bulk.Parse(bytes.NewReader(data), format)
+        if err != nil {
+                return nil, err
+        }
+        existing, err := d.List()
+        if err != nil {
+                return nil, err
+        }
+        return bulk.Import(rows, existing, preserveIDs, d.addWithID), nil
+}
+
+// authenticator gives access to the tokens in the database
+func (d *dbBackend) authenticator() (*auth.Authenticator, error) {
+        return auth.New(d.db, "", 0)
+}
+
+func (d *dbBackend) Tokens() ([]*auth.Token, error) {
+        a, err := d.authenticator()
+        if err != nil {
+                return nil, err
+        }
+        return a.Tokens(), nil
+}
+
+func (d *dbBackend) CreateToken(name, scope, user string, ttl time.Duration) (string, *auth.Token, error) {
+        a, err := d.authenticator()
+        if err != nil {
+                return "", nil, err
+        }
+        if user == "" {
+                user = auth.AdminUser
+        }
+        secret, token, err := a.CreateToken(name, scope, user, ttl)
+        if err == nil {
+                d.record(audit.ActionCreate, audit.ResourceToken, token.ID, nil, token.Public())
+        }
+        return secret, token, err
+}
+
+func (d *dbBackend) RevokeToken(id string) error {
+        a, err := d.authenticator()
+        if err != nil {
+                return err
+        }
+        token := a.Token(id)
+        found, err := a.RevokeToken(id)
+        if err == nil && !found {
+                err = fmt.Errorf("token %s not found", id)
+        }
+        if err == nil {
+                d.record(audit.ActionDelete, audit.ResourceToken, id, token, nil)
+        }
+        return err
+}
+
+func (d *dbBackend) Secrets() ([]*monitor.Secret, error) {
+        return d.db.GetSecrets()
+}
+
+func (d *dbBackend) SetSecret(name, value string) error {
+        if err := monitor.ValidateSecretName(name); err != nil {
+                return err
+        }
+        if value == "" {
+                return fmt.Errorf("secret value is empty")
+        }
+        existing, err := d.db.GetSecret(name)
+        if err != nil && !errors.Is(err, monitor.ErrSecretNotFound) {
+                return err
+        }
+
+        secret := &monitor.Secret{Name: name, Value: value, UpdatedAt: time.Now(), UpdatedBy: localUser()}
+        if err := d.db.SaveSecret(secret); err != nil {
+                return err
+        }
+        secret.Value = ""
+        if existing == nil {
+                d.record(audit.ActionCreate, audit.ResourceSecret, name, nil, secret)
+        } else {
+                existing.Value = ""
+                d.record(audit.ActionUpdate, audit.ResourceSecret, name, existing, secret)
+        }
+        return nil
+}
+
+func (d *dbBackend) DeleteSecret(name string) error {
+        existing, err := d.db.GetSecret(name)
+        if err != nil {
+                return err
+        }
+        if err := d.db.DeleteSecret(name); err != nil {
+                return err
+        }
+        existing.Value = ""
+        d.record(audit.ActionDelete, audit.ResourceSecret, name, existing, nil)
+        return nil
+}
+
+func (d *dbBackend) Close() error {
+        return d.db.Close()
+}
+
+func (d *dbBackend) SetPaused(id int, paused bool, until time.Time) (*monitor.Website, error) {
+        website, err := d.find(id)
+        if err != nil {
+                return nil, err
+        }
+        before := *website
+        website.Paused = paused
+        website.PausedUntil = time.Time{}
+        if paused {
+                website.PausedUntil = until
+        }
+        if err := d.db.SaveWebsite(website); err != nil {
+                return nil, err
+        }
+        action := audit.ActionResume
+        if paused {
+                action = audit.ActionPause
+        }
+        d.record(action, audit.ResourceWebsite, id, &before, website)
+        return website, nil
+}
+
+// record appends a change made directly to the database to its audit log,
+// attributed to the local user. The change has already been saved, so
+// failures are only reported.
+func (d *dbBackend) record(action, resource string, id interface{}, before, after interface{}) {
+        entry := &audit.Entry{
+                Time:       time.Now(),
+                User:       localUser(),
+                Method:     "cli",
+                Action:     action,
+                Resource:   resource,
+                ResourceID: fmt.Sprint(id),
+                Before:     audit.Value(before),
+                After:      audit.Value(after),
+        }
+        if err := d.db.AddAuditEntry(entry); err != nil {
+                fmt.Fprintf(os.Stderr, "Error recording %s of %s %v in the audit log: %v\n", action, resource, id, err)
+        }
+}
+
+// localUser names the user running the CLI, for changes made with -db
+func localUser() string {
+        if user := os.Getenv("USER"); user != "" {
+                return user
+        }
+        return "unknown"
+}
+
+// find returns the stored website with the given ID
+func (d *dbBackend) find(id int) (*monitor.Website, error) {
+        websites, err := d.db.GetWebsites()
+        if err != nil {
+                return nil, err
+        }
+        for _, website := range websites {
+                if website.ID == id {
+                        return website, nil
+                }
+        }
+        return nil, fmt.Errorf("website %d not found", id)
+}
+
+// findURL returns the website, other than exceptID, whose URL matches url as
+// compared by monitor.URLKey, or nil if there is none
+func (d *dbBackend) findURL(url string, exceptID int) (*monitor.Website, error) {
+        websites, err := d.db.GetWebsites()
+        if err != nil {
+                return nil, err
+        }
+        key := monitor.URLKey(url)
+        for _, website := range websites {
+                if website.ID != exceptID && monitor.URLKey(website.URL) == key {
+                        return website, nil
+                }
+        }
+        return nil, nil
+}
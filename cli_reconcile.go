@@ -0,0 +1,109 @@
+package main
+
+import (
+        "fmt"
+        "os"
+        "time"
+
+        "website-monitor/monitor"
+        "website-monitor/sites"
+)
+
+// backendTarget applies reconcile changes through a client backend
+type backendTarget struct {
+        backend backend
+}
+
+func (t backendTarget) Add(config *monitor.Website) error {
+        _, err := t.backend.Add(config)
+        return err
+}
+
+func (t backendTarget) Update(id int, config *monitor.Website) error {
+        _, err := t.backend.Update(id, config)
+        return err
+}
+
+func (t backendTarget) Remove(id int) error {
+        return t.backend.Remove(id)
+}
+
+// runReconcile makes the monitored websites match a site definitions file
+func runReconcile(args []string) error {
+        flags, opts := newFlagSet("reconcile", "[flags] FILE")
+        dryRun := flags.Bool("dry-run", false, "print the plan without applying it")
+        prune := flags.Bool("prune", false, "remove websites that are not in the file, with their history")
+        watch := flags.Bool("watch", false, "keep running and reconcile whenever the file changes")
+        positional, err := parseFlags(flags, args)
+        if err != nil {
+                return err
+        }
+        if err := opts.validate(); err != nil {
+                return err
+        }
+        if len(positional) != 1 {
+                flags.Usage()
+                return fmt.Errorf("expected exactly one site definitions file")
+        }
+        path := positional[0]
+
+        desired, err := sites.Load(path)
+        if err != nil {
+                return err
+        }
+
+        b, err := openBackend(opts)
+        if err != nil {
+                return err
+        }
+        defer b.Close()
+
+        reconcile := func(desired []*monitor.Website) error {
+                current, err := b.List()
+                if err != nil {
+                        return err
+                }
+                plan := sites.Plan(current, desired, *prune)
+
+                if opts.output == "json" {
+                        if plan == nil {
+                                plan = []sites.Change{}
+                        }
+                        if err := writeJSON(os.Stdout, plan); err != nil {
+                                return err
+                        }
+                } else if len(plan) == 0 {
+                        fmt.Println("No changes")
+                } else {
+                        for _, change := range plan {
+                                fmt.Println(change)
+                        }
+                }
+
+                if *dryRun {
+                        return nil
+                }
+                errs := sites.Apply(backendTarget{backend: b}, plan)
+                for _, err := range errs {
+                        fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+                }
+                if len(errs) > 0 {
+                        return fmt.Errorf("%d of %d changes failed", len(errs), len(plan))
+                }
+                return nil
+        }
+
+        if err := reconcile(desired); err != nil {
+                return err
+        }
+        if !*watch {
+                return nil
+        }
+
+        sites.Watch(path, 5*time.Second, nil, func(desired []*monitor.Website) {
+                if err := reconcile(desired); err != nil {
+                        fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+                }
+        })
+        return nil
+}
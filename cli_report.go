@@ -0,0 +1,349 @@
+package main
+
+import (
+        "encoding/json"
+        "encoding/xml"
+        "fmt"
+        "io"
+        "os"
+        "sort"
+        "strings"
+        "sync"
+        "text/tabwriter"
+        "time"
+
+        "website-monitor/monitor"
+)
+
+// onceOptions holds the flags of check -once
+type onceOptions struct {
+        enabled bool
+        config  string
+        update  bool
+        report  string
+        failOn  string
+}
+
+// Outcomes of a website in a one-shot check report
+const (
+        outcomeOK          = "ok"
+        outcomeChanged     = "changed"
+        outcomeError       = "error"
+        outcomePaused      = "paused"
+        outcomeMaintenance = "maintenance"
+)
+
+// reportEntry is the result for one website in a one-shot check report
+type reportEntry struct {
+        ID         int    `json:"id"`
+        Name       string `json:"name"`
+        URL        string `json:"url"`
+        Outcome    string `json:"outcome"`
+        Failed     bool   `json:"failed"`
+        StatusCode int    `json:"statusCode"`
+        Error      string `json:"error,omitempty"`
+        DurationMs int64  `json:"durationMs"`
+}
+
+// checkReport is the result of a one-shot check of every website
+type checkReport struct {
+        StartedAt  time.Time      `json:"startedAt"`
+        DurationMs int64          `json:"durationMs"`
+        Checked    int            `json:"checked"`
+        Changed    int            `json:"changed"`
+        Errored    int            `json:"errored"`
+        Failed     int            `json:"failed"`
+        Websites   []*reportEntry `json:"websites"`
+}
+
+// runCheckOnce runs the monitor engine once over the websites from a config
+// file or the database, prints a report and returns an error if any website
+// had an outcome listed in -fail-on
+func runCheckOnce(opts *cliOptions, once *onceOptions) error {
+        if once.report != "text" && once.report != "json" && once.report != "junit" {
+                return fmt.Errorf("unknown report format %q", once.report)
+        }
+        if once.update && once.config == "" {
+                return fmt.Errorf("-update requires -config")
+        }
+        failOn := map[string]bool{}
+        for _, outcome := range strings.Split(once.failOn, ",") {
+                outcome = strings.TrimSpace(outcome)
+                switch outcome {
+                case "":
+                case outcomeError, outcomeChanged:
+                        failOn[outcome] = true
+                default:
+                        return fmt.Errorf("unknown -fail-on outcome %q", outcome)
+                }
+        }
+
+        // Record how long each check took from the history entries
+        var durationsMu sync.Mutex
+        durations := map[int]int64{}
+        recordDuration := func(entry *monitor.HistoryEntry) {
+                durationsMu.Lock()
+                durations[entry.WebsiteID] = entry.DurationMs
+                durationsMu.Unlock()
+        }
+
+        var m *monitor.Monitor
+        if once.config != "" {
+                websites, err := loadConfigWebsites(once.config)
+                if err != nil {
+                        return err
+                }
+                m = monitor.NewMonitor(nil)
+                m.SetHistoryFunc(recordDuration)
+                highestID := 0
+                for _, website := range websites {
+                        m.AddExistingWebsite(website)
+                        if website.ID > highestID {
+                                highestID = website.ID
+                        }
+                }
+                m.SetIDCounter(highestID + 1)
+        } else {
+                // Websites in the database may have been added by other users,
+                // so they are checked under the same policy as on the server
+                egress, err := opts.egress.policy()
+                if err != nil {
+                        return fmt.Errorf("invalid egress policy: %v", err)
+                }
+                db, err := opts.openDatabase()
+                if err != nil {
+                        return fmt.Errorf("%v (is the server running? stop it or use -config)", err)
+                }
+                defer db.Close()
+
+                m = monitor.NewMonitor(func(website *monitor.Website) {
+                        if err := db.SaveWebsite(website); err != nil {
+                                fmt.Fprintf(os.Stderr, "Error saving website to database: %v\n", err)
+                        }
+                })
+                m.SetEgressPolicy(egress)
+                m.SetSecretFunc(db.GetSecretValue)
+                m.SetHistoryFunc(func(entry *monitor.HistoryEntry) {
+                        recordDuration(entry)
+                        if err := db.AddHistoryEntry(entry); err != nil {
+                                fmt.Fprintf(os.Stderr, "Error saving check history to database: %v\n", err)
+                        }
+                })
+                if err := db.LoadWebsitesToMonitor(m); err != nil {
+                        return err
+                }
+        }
+
+        report := &checkReport{StartedAt: time.Now()}
+        m.CheckAllWebsites()
+        report.DurationMs = time.Since(report.StartedAt).Milliseconds()
+
+        websites := m.GetWebsites()
+        sort.Slice(websites, func(i, j int) bool { return websites[i].ID < websites[j].ID })
+        for _, website := range websites {
+                entry := &reportEntry{
+                        ID:         website.ID,
+                        Name:       website.Name,
+                        URL:        website.URL,
+                        Outcome:    outcomeOK,
+                        StatusCode: website.LastStatusCode,
+                        Error:      website.Error,
+                        DurationMs: durations[website.ID],
+                }
+                switch {
+                case website.IsPaused(report.StartedAt):
+                        // Paused websites are not checked, so their result is stale
+                        entry.Outcome = outcomePaused
+                case website.Maintenance:
+                        // Checked during a maintenance window, so never a failure
+                        entry.Outcome = outcomeMaintenance
+                case website.Error != "":
+                        entry.Outcome = outcomeError
+                        report.Errored++
+                case website.HasChanged:
+                        entry.Outcome = outcomeChanged
+                        report.Changed++
+                }
+                entry.Failed = failOn[entry.Outcome]
+                if entry.Failed {
+                        report.Failed++
+                }
+                report.Websites = append(report.Websites, entry)
+        }
+        report.Checked = len(report.Websites)
+
+        if once.update {
+                if err := writeConfigWebsites(once.config, websites); err != nil {
+                        return err
+                }
+        }
+
+        var err error
+        switch once.report {
+        case "json":
+                err = writeJSON(os.Stdout, report)
+        case "junit":
+                err = writeJUnitReport(os.Stdout, report)
+        default:
+                err = writeTextReport(os.Stdout, report)
+        }
+        if err != nil {
+                return err
+        }
+
+        if report.Failed > 0 {
+                return fmt.Errorf("%d of %d websites failed", report.Failed, report.Checked)
+        }
+        return nil
+}
+
+// loadConfigWebsites reads websites from a JSON file in the export format.
+// Only url is required; websites without a recorded hash start as a first check.
+func loadConfigWebsites(path string) ([]*monitor.Website, error) {
+        data, err := os.ReadFile(path)
+        if err != nil {
+                return nil, err
+        }
+
+        var websites []*monitor.Website
+        if err := json.Unmarshal(data, &websites); err != nil {
+                return nil, fmt.Errorf("could not parse %s: %v", path, err)
+        }
+
+        nextID := 1
+        for _, website := range websites {
+                if website.ID >= nextID {
+                        nextID = website.ID + 1
+                }
+        }
+        for i, website := range websites {
+                if website.URL == "" {
+                        return nil, fmt.Errorf("%s: website %d has no url", path, i+1)
+                }
+                if website.ID == 0 {
+                        website.ID = nextID
+                        nextID++
+                }
+                if website.Name == "" {
+                        website.Name = website.URL
+                }
+                if website.LastHash == "" {
+                        website.IsFirstCheck = true
+                }
+        }
+        return websites, nil
+}
+
+// writeConfigWebsites writes websites back to a config file in the export format
+func writeConfigWebsites(path string, websites []*monitor.Website) error {
+        f, err := os.Create(path)
+        if err != nil {
+                return err
+        }
+        if err := writeJSON(f, websites); err != nil {
+                f.Close()
+                return err
+        }
+        return f.Close()
+}
+
+// writeTextReport writes a human-readable report
+func writeTextReport(w io.Writer, report *checkReport) error {
+        tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+        for _, entry := range report.Websites {
+                result := "PASS"
+                if entry.Failed {
+                        result = "FAIL"
+                }
+                detail := entry.Outcome
+                if entry.Error != "" {
+                        detail = "error: " + entry.Error
+                }
+                fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%dms\n", result, entry.Name, entry.URL, detail, entry.DurationMs)
+        }
+        if err := tw.Flush(); err != nil {
+                return err
+        }
+
+        _, err := fmt.Fprintf(w, "\n%d checked, %d changed, %d errored, %d failed in %s\n",
+                report.Checked, report.Changed, report.Errored, report.Failed,
+                time.Duration(report.DurationMs)*time.Millisecond)
+        return err
+}
+
+// junitTestSuites is the root element of a JUnit XML report
+type junitTestSuites struct {
+        XMLName xml.Name         `xml:"testsuites"`
+        Suites  []junitTestSuite `xml:"testsuite"`
+}
+
+// junitTestSuite groups the test cases of one run
+type junitTestSuite struct {
+        Name      string          `xml:"name,attr"`
+        Tests     int             `xml:"tests,attr"`
+        Failures  int             `xml:"failures,attr"`
+        Time      string          `xml:"time,attr"`
+        Timestamp string          `xml:"timestamp,attr"`
+        Cases     []junitTestCase `xml:"testcase"`
+}
+
+// junitTestCase is the result of checking one website
+type junitTestCase struct {
+        Name      string        `xml:"name,attr"`
+        ClassName string        `xml:"classname,attr"`
+        Time      string        `xml:"time,attr"`
+        Failure   *junitFailure `xml:"failure,omitempty"`
+}
+
+// junitFailure describes why a website check failed
+type junitFailure struct {
+        Message string `xml:"message,attr"`
+        Type    string `xml:"type,attr"`
+        Text    string `xml:",chardata"`
+}
+
+// junitSeconds formats milliseconds as JUnit's decimal seconds
+func junitSeconds(ms int64) string {
+        return fmt.Sprintf("%.3f", float64(ms)/1000)
+}
+
+// writeJUnitReport writes the report as JUnit XML for CI systems
+func writeJUnitReport(w io.Writer, report *checkReport) error {
+        suite := junitTestSuite{
+                Name:      "website-monitor",
+                Tests:     report.Checked,
+                Failures:  report.Failed,
+                Time:      junitSeconds(report.DurationMs),
+                Timestamp: report.StartedAt.UTC().Format("2006-01-02T15:04:05"),
+        }
+        for _, entry := range report.Websites {
+                testCase := junitTestCase{
+                        Name:      entry.Name,
+                        ClassName: entry.URL,
+                        Time:      junitSeconds(entry.DurationMs),
+                }
+                if entry.Failed {
+                        message := "content changed since last check"
+                        if entry.Error != "" {
+                                message = entry.Error
+                        }
+                        testCase.Failure = &junitFailure{
+                                Message: message,
+                                Type:    entry.Outcome,
+                                Text:    fmt.Sprintf("%s (%s): %s, status %d", entry.Name, entry.URL, message, entry.StatusCode),
+                        }
+                }
+                suite.Cases = append(suite.Cases, testCase)
+        }
+
+        if _, err := io.WriteString(w, xml.Header); err != nil {
+                return err
+        }
+        enc := xml.NewEncoder(w)
+        enc.Indent("", "  ")
+        if err := enc.Encode(junitTestSuites{Suites: []junitTestSuite{suite}}); err != nil {
+                return err
+        }
+        _, err := io.WriteString(w, "\n")
+        return err
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+        "bufio"
+        "fmt"
+        "os"
+        "sort"
+        "strings"
+        "text/tabwriter"
+        "time"
+)
+
+// runSecret manages the secrets request templates refer to: "secret set
+// NAME", which reads the value from standard input so it stays out of shell
+// history, "secret list" and "secret delete NAME"
+func runSecret(args []string) error {
+        if len(args) == 0 {
+                return fmt.Errorf("expected a secret subcommand: set, list or delete")
+        }
+        action, args := args[0], args[1:]
+
+        usage := "[flags]"
+        switch action {
+        case "set", "delete":
+                usage = "[flags] NAME"
+        case "list":
+        default:
+                return fmt.Errorf("unknown secret subcommand %q", action)
+        }
+
+        flags, opts := newFlagSet("secret "+action, usage)
+        positional, err := parseFlags(flags, args)
+        if err != nil {
+                return err
+        }
+        if err := opts.validate(); err != nil {
+                return err
+        }
+        if action != "list" && len(positional) != 1 {
+                flags.Usage()
+                return fmt.Errorf("expected exactly one secret name")
+        }
+        if action == "list" && len(positional) != 0 {
+                flags.Usage()
+                return fmt.Errorf("unexpected arguments: %v", positional)
+        }
+
+        var value string
+        if action == "set" {
+                if value, err = readSecretValue(); err != nil {
+                        return err
+                }
+        }
+
+        b, err := openBackend(opts)
+        if err != nil {
+                return err
+        }
+        defer b.Close()
+
+        switch action {
+        case "set":
+                if err := b.SetSecret(positional[0], value); err != nil {
+                        return err
+                }
+                fmt.Printf("Saved secret %s; refer to it as {{secret %q}}\n", positional[0], positional[0])
+                return nil
+
+        case "delete":
+                if err := b.DeleteSecret(positional[0]); err != nil {
+                        return err
+                }
+                fmt.Printf("Deleted secret %s\n", positional[0])
+                return nil
+        }
+
+        secrets, err := b.Secrets()
+        if err != nil {
+                return err
+        }
+        sort.Slice(secrets, func(i, j int) bool { return secrets[i].Name < secrets[j].Name })
+        if opts.output == "json" {
+                return writeJSON(os.Stdout, secrets)
+        }
+
+        tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+        fmt.Fprintln(tw, "NAME\tUPDATED\tBY")
+        for _, secret := range secrets {
+                fmt.Fprintf(tw, "%s\t%s\t%s\n", secret.Name, secret.UpdatedAt.Local().Format(time.RFC3339), secret.UpdatedBy)
+        }
+        return tw.Flush()
+}
+
+// readSecretValue reads a secret value from the first line of standard input
+func readSecretValue() (string, error) {
+        if info, err := os.Stdin.Stat(); err == nil && info.Mode()&os.ModeCharDevice != 0 {
+                fmt.Fprint(os.Stderr, "Value: ")
+        }
+        line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+        if err != nil && line == "" {
+                return "", fmt.Errorf("could not read the secret value: %v", err)
+        }
+        value := strings.TrimRight(line, "\r\n")
+        if value == "" {
+                return "", fmt.Errorf("secret value is empty")
+        }
+        return value, nil
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+        "fmt"
+        "os"
+        "sort"
+        "text/tabwriter"
+        "time"
+
+        "website-monitor/auth"
+)
+
+// runToken manages API tokens: "token create", "token list" and "token revoke ID"
+func runToken(args []string) error {
+        if len(args) == 0 {
+                return fmt.Errorf("expected a token subcommand: create, list or revoke")
+        }
+        action, args := args[0], args[1:]
+
+        flags, opts := newFlagSet("token "+action, "[flags]")
+        var name, scope, user string
+        var ttl time.Duration
+        switch action {
+        case "create":
+                flags.StringVar(&name, "name", "", "description of what the token is for (required)")
+                flags.StringVar(&scope, "scope", auth.ScopeRead, "token scope: read or admin")
+                flags.DurationVar(&ttl, "expires", 0, "lifetime of the token, e.g. 720h (default: never expires)")
+                flags.StringVar(&user, "user", "", "user the token acts as (default: the caller, or admin when using -db)")
+        case "list":
+        case "revoke":
+                flags.Usage = func() {
+                        fmt.Fprintf(flags.Output(), "Usage: website-monitor token revoke [flags] ID\n\nFlags:\n")
+                        flags.PrintDefaults()
+                }
+        default:
+                return fmt.Errorf("unknown token subcommand %q", action)
+        }
+
+        positional, err := parseFlags(flags, args)
+        if err != nil {
+                return err
+        }
+        if err := opts.validate(); err != nil {
+                return err
+        }
+        if action == "revoke" && len(positional) != 1 {
+                flags.Usage()
+                return fmt.Errorf("expected exactly one token ID")
+        }
+        if action != "revoke" && len(positional) != 0 {
+                flags.Usage()
+                return fmt.Errorf("unexpected arguments: %v", positional)
+        }
+        if action == "create" && name == "" {
+                return fmt.Errorf("-name is required")
+        }
+
+        b, err := openBackend(opts)
+        if err != nil {
+                return err
+        }
+        defer b.Close()
+
+        switch action {
+        case "create":
+                secret, token, err := b.CreateToken(name, scope, user, ttl)
+                if err != nil {
+                        return err
+                }
+                if opts.output == "json" {
+                        return writeJSON(os.Stdout, map[string]interface{}{"token": token, "secret": secret})
+                }
+                fmt.Printf("Created %s token %s (%s). Store it now, it won't be shown again:\n%s\n", token.Scope, token.ID, token.Name, secret)
+                return nil
+
+        case "revoke":
+                if err := b.RevokeToken(positional[0]); err != nil {
+                        return err
+                }
+                fmt.Printf("Revoked token %s\n", positional[0])
+                return nil
+        }
+
+        tokens, err := b.Tokens()
+        if err != nil {
+                return err
+        }
+        sort.Slice(tokens, func(i, j int) bool { return tokens[i].CreatedAt.Before(tokens[j].CreatedAt) })
+        if opts.output == "json" {
+                return writeJSON(os.Stdout, tokens)
+        }
+
+        tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+        fmt.Fprintln(tw, "ID\tNAME\tSCOPE\tUSER\tPREFIX\tEXPIRES")
+        for _, token := range tokens {
+                expires := "never"
+                if !token.ExpiresAt.IsZero() {
+                        expires = token.ExpiresAt.Local().Format(time.RFC3339)
+                }
+                fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", token.ID, token.Name, token.Scope, token.User, token.Prefix, expires)
+        }
+        return tw.Flush()
+}
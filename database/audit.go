@@ -0,0 +1,74 @@
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"go.etcd.io/bbolt"
+	"website-monitor/audit"
+)
+
+// AuditBucket is the name of the bucket holding the audit log, keyed by
+// sequence number. Entries are only ever appended.
+const AuditBucket = "audit"
+
+// AddAuditEntry appends an entry to the audit log, assigning its ID
+func (db *DB) AddAuditEntry(entry *audit.Entry) error {
+	return db.bolt.Update(func(tx *bbolt.Tx) error {
+		b, err := db.bucket(tx, AuditBucket)
+		if err != nil {
+			return err
+		}
+
+		seq, err := b.NextSequence()
+		if err != nil {
+			return fmt.Errorf("could not get audit sequence: %v", err)
+		}
+		entry.ID = seq
+
+		buf, err := json.Marshal(entry)
+		if err != nil {
+			return fmt.Errorf("could not marshal audit entry: %v", err)
+		}
+		return b.Put(historyKey(seq), buf)
+	})
+}
+
+// GetAuditEntries returns the newest audit entries matching the filter,
+// newest first
+func (db *DB) GetAuditEntries(filter *audit.Filter) ([]*audit.Entry, error) {
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = audit.DefaultLimit
+	}
+	entries := []*audit.Entry{}
+
+	err := db.bolt.View(func(tx *bbolt.Tx) error {
+		b, err := db.bucket(tx, AuditBucket)
+		if err != nil {
+			return err
+		}
+
+		c := b.Cursor()
+		for k, v := c.Last(); k != nil && len(entries) < limit; k, v = c.Prev() {
+			var entry audit.Entry
+			if err := json.Unmarshal(v, &entry); err != nil {
+				return fmt.Errorf("could not unmarshal audit entry: %v", err)
+			}
+			// Entries are appended in time order, so nothing older matches
+			if !filter.Since.IsZero() && entry.Time.Before(filter.Since) {
+				break
+			}
+			if filter.Matches(&entry) {
+				entries = append(entries, &entry)
+			}
+		}
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
@@ -0,0 +1,167 @@
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"go.etcd.io/bbolt"
+	"website-monitor/auth"
+)
+
+// TokensBucket is the name of the bucket where API tokens are stored
+const TokensBucket = "tokens"
+
+// SessionsBucket is the name of the bucket where dashboard sessions are stored
+const SessionsBucket = "sessions"
+
+// SaveToken saves an API token to the database
+func (db *DB) SaveToken(token *auth.Token) error {
+	return db.bolt.Update(func(tx *bbolt.Tx) error {
+		buf, err := json.Marshal(token)
+		if err != nil {
+			return fmt.Errorf("could not marshal token: %v", err)
+		}
+		return tx.Bucket([]byte(TokensBucket)).Put([]byte(token.ID), buf)
+	})
+}
+
+// GetTokens returns all API tokens from the database
+func (db *DB) GetTokens() ([]*auth.Token, error) {
+	var tokens []*auth.Token
+
+	err := db.bolt.View(func(tx *bbolt.Tx) error {
+		return tx.Bucket([]byte(TokensBucket)).ForEach(func(k, v []byte) error {
+			var token auth.Token
+			if err := json.Unmarshal(v, &token); err != nil {
+				return fmt.Errorf("could not unmarshal token: %v", err)
+			}
+			tokens = append(tokens, &token)
+			return nil
+		})
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return tokens, nil
+}
+
+// DeleteToken deletes an API token from the database
+func (db *DB) DeleteToken(id string) error {
+	return db.bolt.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket([]byte(TokensBucket)).Delete([]byte(id))
+	})
+}
+
+// SaveSession saves a dashboard session to the database
+func (db *DB) SaveSession(session *auth.Session) error {
+	return db.bolt.Update(func(tx *bbolt.Tx) error {
+		buf, err := json.Marshal(session)
+		if err != nil {
+			return fmt.Errorf("could not marshal session: %v", err)
+		}
+		return tx.Bucket([]byte(SessionsBucket)).Put([]byte(session.Hash), buf)
+	})
+}
+
+// GetSession returns the session with the given hash, or nil if there is none
+func (db *DB) GetSession(hash string) (*auth.Session, error) {
+	var session *auth.Session
+
+	err := db.bolt.View(func(tx *bbolt.Tx) error {
+		v := tx.Bucket([]byte(SessionsBucket)).Get([]byte(hash))
+		if v == nil {
+			return nil
+		}
+		session = &auth.Session{}
+		if err := json.Unmarshal(v, session); err != nil {
+			return fmt.Errorf("could not unmarshal session: %v", err)
+		}
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return session, nil
+}
+
+// DeleteSession deletes a dashboard session from the database
+func (db *DB) DeleteSession(hash string) error {
+	return db.bolt.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket([]byte(SessionsBucket)).Delete([]byte(hash))
+	})
+}
+
+// DeleteUserSessions deletes every dashboard session of a user from the
+// database
+func (db *DB) DeleteUserSessions(username string) error {
+	return db.bolt.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket([]byte(SessionsBucket))
+		var hashes [][]byte
+		err := b.ForEach(func(k, v []byte) error {
+			var session auth.Session
+			if err := json.Unmarshal(v, &session); err != nil {
+				return fmt.Errorf("could not unmarshal session: %v", err)
+			}
+			if session.User == username {
+				hashes = append(hashes, append([]byte(nil), k...))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, hash := range hashes {
+			if err := b.Delete(hash); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// UsersBucket is the name of the bucket where user accounts are stored
+const UsersBucket = "users"
+
+// SaveUser saves a user account to the database
+func (db *DB) SaveUser(user *auth.User) error {
+	return db.bolt.Update(func(tx *bbolt.Tx) error {
+		buf, err := json.Marshal(user)
+		if err != nil {
+			return fmt.Errorf("could not marshal user: %v", err)
+		}
+		return tx.Bucket([]byte(UsersBucket)).Put([]byte(user.Username), buf)
+	})
+}
+
+// GetUsers returns all user accounts from the database
+func (db *DB) GetUsers() ([]*auth.User, error) {
+	var users []*auth.User
+
+	err := db.bolt.View(func(tx *bbolt.Tx) error {
+		return tx.Bucket([]byte(UsersBucket)).ForEach(func(k, v []byte) error {
+			var user auth.User
+			if err := json.Unmarshal(v, &user); err != nil {
+				return fmt.Errorf("could not unmarshal user: %v", err)
+			}
+			users = append(users, &user)
+			return nil
+		})
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
+
+// DeleteUser deletes a user account from the database
+func (db *DB) DeleteUser(username string) error {
+	return db.bolt.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket([]byte(UsersBucket)).Delete([]byte(username))
+	})
+}
@@ -12,7 +12,9 @@ import (
 
 // DB represents the database
 type DB struct {
-	bolt *bbolt.DB
+	bolt      *bbolt.DB
+	workspace string     // Empty for the default workspace
+	key       *secretKey // Encrypts secrets; shared by workspace views
 }
 
 // WebsitesBucket is the name of the bucket where websites are stored
@@ -24,6 +26,9 @@ const CounterBucket = "counters"
 // IDCounterKey is the key for the website ID counter
 const IDCounterKey = "website_id_counter"
 
+// HealthCheckKey is the key written by readiness checks to verify the database accepts writes
+const HealthCheckKey = "health_check"
+
 // New creates a new database connection
 func New(path string) (*DB, error) {
 	// Open the database file
@@ -32,6 +37,9 @@ func New(path string) (*DB, error) {
 		return nil, fmt.Errorf("could not open db: %v", err)
 	}
 
+	key := &secretKey{path: path + ".key"}
+	migrations := &DB{bolt: db, key: key}
+
 	// Initialize buckets
 	err = db.Update(func(tx *bbolt.Tx) error {
 		// Create websites bucket if it doesn't exist
@@ -40,6 +48,76 @@ func New(path string) (*DB, error) {
 			return fmt.Errorf("could not create websites bucket: %v", err)
 		}
 
+		// Create history bucket if it doesn't exist
+		_, err = tx.CreateBucketIfNotExists([]byte(HistoryBucket))
+		if err != nil {
+			return fmt.Errorf("could not create history bucket: %v", err)
+		}
+
+		// Create groups bucket if it doesn't exist
+		_, err = tx.CreateBucketIfNotExists([]byte(GroupsBucket))
+		if err != nil {
+			return fmt.Errorf("could not create groups bucket: %v", err)
+		}
+
+		// Create maintenance bucket if it doesn't exist
+		_, err = tx.CreateBucketIfNotExists([]byte(MaintenanceBucket))
+		if err != nil {
+			return fmt.Errorf("could not create maintenance bucket: %v", err)
+		}
+
+		// Create audit bucket if it doesn't exist
+		_, err = tx.CreateBucketIfNotExists([]byte(AuditBucket))
+		if err != nil {
+			return fmt.Errorf("could not create audit bucket: %v", err)
+		}
+
+		// Create secrets bucket if it doesn't exist, and encrypt secrets
+		// saved before values were encrypted
+		secrets, err := tx.CreateBucketIfNotExists([]byte(SecretsBucket))
+		if err != nil {
+			return fmt.Errorf("could not create secrets bucket: %v", err)
+		}
+		if err := migrations.encryptPlaintextSecrets(secrets); err != nil {
+			return fmt.Errorf("could not encrypt secrets: %v", err)
+		}
+
+		// Create user, token and session buckets if they don't exist
+		_, err = tx.CreateBucketIfNotExists([]byte(UsersBucket))
+		if err != nil {
+			return fmt.Errorf("could not create users bucket: %v", err)
+		}
+		_, err = tx.CreateBucketIfNotExists([]byte(TokensBucket))
+		if err != nil {
+			return fmt.Errorf("could not create tokens bucket: %v", err)
+		}
+		_, err = tx.CreateBucketIfNotExists([]byte(SessionsBucket))
+		if err != nil {
+			return fmt.Errorf("could not create sessions bucket: %v", err)
+		}
+
+		// Create workspaces bucket if it doesn't exist, and add buckets
+		// introduced since each workspace was created
+		workspaces, err := tx.CreateBucketIfNotExists([]byte(WorkspacesBucket))
+		if err != nil {
+			return fmt.Errorf("could not create workspaces bucket: %v", err)
+		}
+		err = workspaces.ForEachBucket(func(name []byte) error {
+			workspace := workspaces.Bucket(name)
+			for _, bucket := range workspaceBuckets {
+				if _, err := workspace.CreateBucketIfNotExists([]byte(bucket)); err != nil {
+					return fmt.Errorf("could not create %s bucket of workspace %s: %v", bucket, name, err)
+				}
+			}
+			if err := migrations.encryptPlaintextSecrets(workspace.Bucket([]byte(SecretsBucket))); err != nil {
+				return fmt.Errorf("could not encrypt secrets of workspace %s: %v", name, err)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
 		// Create counter bucket if it doesn't exist
 		counterBucket, err := tx.CreateBucketIfNotExists([]byte(CounterBucket))
 		if err != nil {
@@ -62,7 +140,7 @@ func New(path string) (*DB, error) {
 		return nil, err
 	}
 
-	return &DB{bolt: db}, nil
+	return &DB{bolt: db, key: key}, nil
 }
 
 // Close closes the database connection
@@ -70,10 +148,22 @@ func (db *DB) Close() error {
 	return db.bolt.Close()
 }
 
+// CheckWritable verifies that the database is open and accepts writes by
+// recording the time of the check
+func (db *DB) CheckWritable() error {
+	return db.bolt.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket([]byte(CounterBucket))
+		return b.Put([]byte(HealthCheckKey), []byte(time.Now().UTC().Format(time.RFC3339)))
+	})
+}
+
 // SaveWebsite saves a website to the database
 func (db *DB) SaveWebsite(website *monitor.Website) error {
 	return db.bolt.Update(func(tx *bbolt.Tx) error {
-		b := tx.Bucket([]byte(WebsitesBucket))
+		b, err := db.bucket(tx, WebsitesBucket)
+		if err != nil {
+			return err
+		}
 
 		// Convert website to JSON
 		buf, err := json.Marshal(website)
@@ -92,7 +182,10 @@ func (db *DB) GetWebsites() ([]*monitor.Website, error) {
 	var websites []*monitor.Website
 
 	err := db.bolt.View(func(tx *bbolt.Tx) error {
-		b := tx.Bucket([]byte(WebsitesBucket))
+		b, err := db.bucket(tx, WebsitesBucket)
+		if err != nil {
+			return err
+		}
 
 		return b.ForEach(func(k, v []byte) error {
 			var website monitor.Website
@@ -111,12 +204,26 @@ func (db *DB) GetWebsites() ([]*monitor.Website, error) {
 	return websites, nil
 }
 
-// DeleteWebsite deletes a website from the database
+// DeleteWebsite deletes a website and its check history from the database
 func (db *DB) DeleteWebsite(id int) error {
 	return db.bolt.Update(func(tx *bbolt.Tx) error {
-		b := tx.Bucket([]byte(WebsitesBucket))
+		b, err := db.bucket(tx, WebsitesBucket)
+		if err != nil {
+			return err
+		}
 		key := fmt.Sprintf("%d", id)
-		return b.Delete([]byte(key))
+		if err := b.Delete([]byte(key)); err != nil {
+			return err
+		}
+
+		history, err := db.bucket(tx, HistoryBucket)
+		if err != nil {
+			return err
+		}
+		if history.Bucket([]byte(key)) != nil {
+			return history.DeleteBucket([]byte(key))
+		}
+		return nil
 	})
 }
 
@@ -125,7 +232,10 @@ func (db *DB) GetNextID() (int, error) {
 	var id int
 
 	err := db.bolt.Update(func(tx *bbolt.Tx) error {
-		b := tx.Bucket([]byte(CounterBucket))
+		b, err := db.bucket(tx, CounterBucket)
+		if err != nil {
+			return err
+		}
 		
 		// Get current ID
 		idBytes := b.Get([]byte(IDCounterKey))
@@ -134,7 +244,7 @@ func (db *DB) GetNextID() (int, error) {
 		}
 		
 		// Parse ID
-		_, err := fmt.Sscanf(string(idBytes), "%d", &id)
+		_, err = fmt.Sscanf(string(idBytes), "%d", &id)
 		if err != nil {
 			return fmt.Errorf("could not parse ID counter: %v", err)
 		}
@@ -156,8 +266,25 @@ func (db *DB) GetNextID() (int, error) {
 	return id, nil
 }
 
-// LoadWebsitesToMonitor loads all websites from the database into the monitor
+// LoadWebsitesToMonitor loads all websites, group defaults and maintenance
+// windows from the database into the monitor
 func (db *DB) LoadWebsitesToMonitor(m *monitor.Monitor) error {
+	groups, err := db.GetGroups()
+	if err != nil {
+		return fmt.Errorf("could not get groups: %v", err)
+	}
+	for _, group := range groups {
+		m.AddExistingGroup(group)
+	}
+
+	windows, err := db.GetMaintenanceWindows()
+	if err != nil {
+		return fmt.Errorf("could not get maintenance windows: %v", err)
+	}
+	for _, window := range windows {
+		m.AddExistingMaintenanceWindow(window)
+	}
+
 	websites, err := db.GetWebsites()
 	if err != nil {
 		return fmt.Errorf("could not get websites: %v", err)
@@ -0,0 +1,68 @@
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"go.etcd.io/bbolt"
+	"website-monitor/monitor"
+)
+
+// GroupsBucket is the name of the bucket where group defaults are stored
+const GroupsBucket = "groups"
+
+// SaveGroup saves group defaults to the database
+func (db *DB) SaveGroup(group *monitor.Group) error {
+	return db.bolt.Update(func(tx *bbolt.Tx) error {
+		b, err := db.bucket(tx, GroupsBucket)
+		if err != nil {
+			return err
+		}
+
+		buf, err := json.Marshal(group)
+		if err != nil {
+			return fmt.Errorf("could not marshal group: %v", err)
+		}
+
+		// Save group with its path as key
+		return b.Put([]byte(group.Path), buf)
+	})
+}
+
+// GetGroups returns all group defaults from the database
+func (db *DB) GetGroups() ([]*monitor.Group, error) {
+	var groups []*monitor.Group
+
+	err := db.bolt.View(func(tx *bbolt.Tx) error {
+		b, err := db.bucket(tx, GroupsBucket)
+		if err != nil {
+			return err
+		}
+
+		return b.ForEach(func(k, v []byte) error {
+			var group monitor.Group
+			if err := json.Unmarshal(v, &group); err != nil {
+				return fmt.Errorf("could not unmarshal group: %v", err)
+			}
+			groups = append(groups, &group)
+			return nil
+		})
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return groups, nil
+}
+
+// DeleteGroup deletes group defaults from the database
+func (db *DB) DeleteGroup(path string) error {
+	return db.bolt.Update(func(tx *bbolt.Tx) error {
+		b, err := db.bucket(tx, GroupsBucket)
+		if err != nil {
+			return err
+		}
+		return b.Delete([]byte(path))
+	})
+}
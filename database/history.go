@@ -0,0 +1,141 @@
+package database
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"go.etcd.io/bbolt"
+	"website-monitor/monitor"
+)
+
+// HistoryBucket is the name of the bucket where check history is stored.
+// It holds one nested bucket per website, keyed by website ID.
+const HistoryBucket = "history"
+
+// MaxHistoryEntries is the most check results kept per website, whatever
+// their age. It only applies to websites checked more often than every
+// minute; others keep monitor.HistoryRetention worth of history.
+const MaxHistoryEntries = 100000
+
+// historyKey returns the sortable key for a history entry sequence number
+func historyKey(seq uint64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, seq)
+	return key
+}
+
+// AddHistoryEntry appends a check result to a website's history, pruning
+// entries older than monitor.HistoryRetention and the oldest entries once
+// MaxHistoryEntries is exceeded
+func (db *DB) AddHistoryEntry(entry *monitor.HistoryEntry) error {
+	return db.bolt.Update(func(tx *bbolt.Tx) error {
+		root, err := db.bucket(tx, HistoryBucket)
+		if err != nil {
+			return err
+		}
+		b, err := root.CreateBucketIfNotExists([]byte(fmt.Sprintf("%d", entry.WebsiteID)))
+		if err != nil {
+			return fmt.Errorf("could not create history bucket: %v", err)
+		}
+
+		buf, err := json.Marshal(entry)
+		if err != nil {
+			return fmt.Errorf("could not marshal history entry: %v", err)
+		}
+
+		seq, err := b.NextSequence()
+		if err != nil {
+			return fmt.Errorf("could not get history sequence: %v", err)
+		}
+		if err := b.Put(historyKey(seq), buf); err != nil {
+			return err
+		}
+
+		// Entries are in chronological order, so expired ones are first
+		expiry := entry.CheckedAt.Add(-monitor.HistoryRetention)
+		c := b.Cursor()
+		for k, v := c.First(); k != nil; k, v = c.First() {
+			var oldest monitor.HistoryEntry
+			if err := json.Unmarshal(v, &oldest); err != nil || !oldest.CheckedAt.Before(expiry) {
+				break
+			}
+			if err := c.Delete(); err != nil {
+				return err
+			}
+		}
+
+		// Sequence numbers are contiguous, so everything at or below
+		// seq-MaxHistoryEntries is beyond the retention limit
+		if seq <= MaxHistoryEntries {
+			return nil
+		}
+		cutoff := historyKey(seq - MaxHistoryEntries)
+		for k, _ := c.First(); k != nil && bytes.Compare(k, cutoff) <= 0; k, _ = c.First() {
+			if err := c.Delete(); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// GetHistory returns the most recent check results for a website in
+// chronological order. A limit of zero or less returns the full history.
+func (db *DB) GetHistory(websiteID, limit int) ([]*monitor.HistoryEntry, error) {
+	return db.getHistory(websiteID, limit, time.Time{})
+}
+
+// GetHistorySince returns a website's check results at or after since, in
+// chronological order
+func (db *DB) GetHistorySince(websiteID int, since time.Time) ([]*monitor.HistoryEntry, error) {
+	return db.getHistory(websiteID, 0, since)
+}
+
+// getHistory walks a website's history backwards from the newest entry,
+// stopping at limit entries or the first entry older than since
+func (db *DB) getHistory(websiteID, limit int, since time.Time) ([]*monitor.HistoryEntry, error) {
+	var entries []*monitor.HistoryEntry
+
+	err := db.bolt.View(func(tx *bbolt.Tx) error {
+		root, err := db.bucket(tx, HistoryBucket)
+		if err != nil {
+			return err
+		}
+		b := root.Bucket([]byte(fmt.Sprintf("%d", websiteID)))
+		if b == nil {
+			return nil
+		}
+
+		c := b.Cursor()
+		for k, v := c.Last(); k != nil; k, v = c.Prev() {
+			if limit > 0 && len(entries) >= limit {
+				break
+			}
+
+			var entry monitor.HistoryEntry
+			if err := json.Unmarshal(v, &entry); err != nil {
+				return fmt.Errorf("could not unmarshal history entry: %v", err)
+			}
+			if entry.CheckedAt.Before(since) {
+				break
+			}
+			entries = append(entries, &entry)
+		}
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	// Entries were collected newest first
+	for i, j := 0, len(entries)-1; i < j; i, j = i+1, j-1 {
+		entries[i], entries[j] = entries[j], entries[i]
+	}
+
+	return entries, nil
+}
@@ -0,0 +1,41 @@
+package database
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"website-monitor/monitor"
+)
+
+func TestAddHistoryEntryPrunesExpiredEntries(t *testing.T) {
+	db, err := New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	now := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	for _, age := range []time.Duration{
+		monitor.HistoryRetention + 2*time.Hour,
+		monitor.HistoryRetention + time.Hour,
+		monitor.HistoryRetention - time.Hour,
+		time.Hour,
+		0,
+	} {
+		if err := db.AddHistoryEntry(&monitor.HistoryEntry{WebsiteID: 1, CheckedAt: now.Add(-age)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	entries, err := db.GetHistory(1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("kept %d entries, want 3", len(entries))
+	}
+	if want := now.Add(-monitor.HistoryRetention + time.Hour); !entries[0].CheckedAt.Equal(want) {
+		t.Errorf("oldest entry checked at %v, want %v", entries[0].CheckedAt, want)
+	}
+}
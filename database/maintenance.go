@@ -0,0 +1,70 @@
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"go.etcd.io/bbolt"
+	"website-monitor/monitor"
+)
+
+// MaintenanceBucket is the name of the bucket where maintenance windows are stored
+const MaintenanceBucket = "maintenance"
+
+// SaveMaintenanceWindow saves a maintenance window to the database
+func (db *DB) SaveMaintenanceWindow(window *monitor.MaintenanceWindow) error {
+	return db.bolt.Update(func(tx *bbolt.Tx) error {
+		b, err := db.bucket(tx, MaintenanceBucket)
+		if err != nil {
+			return err
+		}
+
+		buf, err := json.Marshal(window)
+		if err != nil {
+			return fmt.Errorf("could not marshal maintenance window: %v", err)
+		}
+
+		// Save window with ID as key
+		key := fmt.Sprintf("%d", window.ID)
+		return b.Put([]byte(key), buf)
+	})
+}
+
+// GetMaintenanceWindows returns all maintenance windows from the database
+func (db *DB) GetMaintenanceWindows() ([]*monitor.MaintenanceWindow, error) {
+	var windows []*monitor.MaintenanceWindow
+
+	err := db.bolt.View(func(tx *bbolt.Tx) error {
+		b, err := db.bucket(tx, MaintenanceBucket)
+		if err != nil {
+			return err
+		}
+
+		return b.ForEach(func(k, v []byte) error {
+			var window monitor.MaintenanceWindow
+			if err := json.Unmarshal(v, &window); err != nil {
+				return fmt.Errorf("could not unmarshal maintenance window: %v", err)
+			}
+			windows = append(windows, &window)
+			return nil
+		})
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return windows, nil
+}
+
+// DeleteMaintenanceWindow deletes a maintenance window from the database
+func (db *DB) DeleteMaintenanceWindow(id int) error {
+	return db.bolt.Update(func(tx *bbolt.Tx) error {
+		b, err := db.bucket(tx, MaintenanceBucket)
+		if err != nil {
+			return err
+		}
+		key := fmt.Sprintf("%d", id)
+		return b.Delete([]byte(key))
+	})
+}
@@ -0,0 +1,124 @@
+package database
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+)
+
+// SecretKeyEnv is the environment variable that may hold the key encrypting
+// stored secrets, as 32 base64-encoded bytes. Without it the key is read from
+// the file named after the database with a ".key" suffix, which is generated
+// the first time a secret is saved. Back the key up with the database:
+// secrets cannot be read without it.
+const SecretKeyEnv = "WEBSITE_MONITOR_SECRET_KEY"
+
+// secretKey loads the AES-256-GCM key encrypting secrets on first use. It is
+// shared by all workspace views of a database.
+type secretKey struct {
+	path string // Key file, used when SecretKeyEnv is not set
+
+	mu   sync.Mutex
+	aead cipher.AEAD
+}
+
+// get returns the cipher, generating the key file if it doesn't exist and
+// create is set
+func (k *secretKey) get(create bool) (cipher.AEAD, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if k.aead != nil {
+		return k.aead, nil
+	}
+
+	encoded := os.Getenv(SecretKeyEnv)
+	source := SecretKeyEnv
+	if encoded == "" {
+		source = k.path
+		data, err := os.ReadFile(k.path)
+		if errors.Is(err, os.ErrNotExist) && create {
+			data, err = generateKeyFile(k.path)
+		}
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("secret key file %s is missing; restore it or set %s", k.path, SecretKeyEnv)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("could not read secret key: %v", err)
+		}
+		encoded = string(data)
+	}
+
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil || len(key) != 32 {
+		return nil, fmt.Errorf("invalid secret key in %s: expected 32 base64-encoded bytes", source)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	k.aead, err = cipher.NewGCM(block)
+	return k.aead, err
+}
+
+// generateKeyFile writes a new random key to path, readable only by the owner
+func generateKeyFile(path string) ([]byte, error) {
+	key := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return nil, err
+	}
+	data := []byte(base64.StdEncoding.EncodeToString(key) + "\n")
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if errors.Is(err, os.ErrExist) {
+		// Another process created it first
+		return os.ReadFile(path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not create secret key file: %v", err)
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("could not write secret key file: %v", err)
+	}
+	return data, f.Close()
+}
+
+// encrypt seals a secret value, binding it to the secret's name
+func (k *secretKey) encrypt(name, value string) (string, error) {
+	aead, err := k.get(true)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(value), []byte(name))
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// decrypt opens a value sealed by encrypt
+func (k *secretKey) decrypt(name, encrypted string) (string, error) {
+	aead, err := k.get(false)
+	if err != nil {
+		return "", err
+	}
+	sealed, err := base64.StdEncoding.DecodeString(encrypted)
+	if err != nil || len(sealed) < aead.NonceSize() {
+		return "", fmt.Errorf("secret %s is corrupt", name)
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	value, err := aead.Open(nil, nonce, ciphertext, []byte(name))
+	if err != nil {
+		return "", fmt.Errorf("could not decrypt secret %s; is the secret key the one it was saved with?", name)
+	}
+	return string(value), nil
+}
@@ -0,0 +1,165 @@
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"go.etcd.io/bbolt"
+	"website-monitor/monitor"
+)
+
+// SecretsBucket is the name of the bucket holding the secrets referenced by
+// request templates, keyed by name. Values are encrypted; see SecretKeyEnv.
+const SecretsBucket = "secrets"
+
+// storedSecret is a secret as saved, with its value encrypted
+type storedSecret struct {
+	monitor.Secret
+	EncryptedValue string `json:"encryptedValue,omitempty"`
+}
+
+// seal returns the stored form of a secret
+func (db *DB) seal(secret *monitor.Secret) ([]byte, error) {
+	encrypted, err := db.key.encrypt(secret.Name, secret.Value)
+	if err != nil {
+		return nil, err
+	}
+	stored := storedSecret{Secret: *secret, EncryptedValue: encrypted}
+	stored.Value = ""
+
+	buf, err := json.Marshal(stored)
+	if err != nil {
+		return nil, fmt.Errorf("could not marshal secret: %v", err)
+	}
+	return buf, nil
+}
+
+// encryptPlaintextSecrets encrypts the values of secrets saved before secrets
+// were encrypted
+func (db *DB) encryptPlaintextSecrets(b *bbolt.Bucket) error {
+	sealed := map[string][]byte{}
+	err := b.ForEach(func(k, v []byte) error {
+		var stored storedSecret
+		if err := json.Unmarshal(v, &stored); err != nil {
+			return fmt.Errorf("could not unmarshal secret: %v", err)
+		}
+		if stored.EncryptedValue != "" {
+			return nil
+		}
+		buf, err := db.seal(&stored.Secret)
+		if err != nil {
+			return err
+		}
+		sealed[string(k)] = buf
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for name, buf := range sealed {
+		if err := b.Put([]byte(name), buf); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SaveSecret creates or replaces a secret, encrypting its value
+func (db *DB) SaveSecret(secret *monitor.Secret) error {
+	buf, err := db.seal(secret)
+	if err != nil {
+		return err
+	}
+
+	return db.bolt.Update(func(tx *bbolt.Tx) error {
+		b, err := db.bucket(tx, SecretsBucket)
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(secret.Name), buf)
+	})
+}
+
+// GetSecret returns a secret with its decrypted value, or an error wrapping
+// monitor.ErrSecretNotFound
+func (db *DB) GetSecret(name string) (*monitor.Secret, error) {
+	var stored *storedSecret
+
+	err := db.bolt.View(func(tx *bbolt.Tx) error {
+		b, err := db.bucket(tx, SecretsBucket)
+		if err != nil {
+			return err
+		}
+
+		v := b.Get([]byte(name))
+		if v == nil {
+			return fmt.Errorf("%w: %s", monitor.ErrSecretNotFound, name)
+		}
+		stored = &storedSecret{}
+		if err := json.Unmarshal(v, stored); err != nil {
+			return fmt.Errorf("could not unmarshal secret: %v", err)
+		}
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	secret := stored.Secret
+	if stored.EncryptedValue != "" {
+		if secret.Value, err = db.key.decrypt(name, stored.EncryptedValue); err != nil {
+			return nil, err
+		}
+	}
+	return &secret, nil
+}
+
+// GetSecretValue returns the value of a secret; it is a monitor.SecretFunc
+func (db *DB) GetSecretValue(name string) (string, error) {
+	secret, err := db.GetSecret(name)
+	if err != nil {
+		return "", err
+	}
+	return secret.Value, nil
+}
+
+// GetSecrets returns all secrets without their values, ordered by name
+func (db *DB) GetSecrets() ([]*monitor.Secret, error) {
+	secrets := []*monitor.Secret{}
+
+	err := db.bolt.View(func(tx *bbolt.Tx) error {
+		b, err := db.bucket(tx, SecretsBucket)
+		if err != nil {
+			return err
+		}
+
+		return b.ForEach(func(k, v []byte) error {
+			var stored storedSecret
+			if err := json.Unmarshal(v, &stored); err != nil {
+				return fmt.Errorf("could not unmarshal secret: %v", err)
+			}
+			secret := stored.Secret
+			secret.Value = ""
+			secrets = append(secrets, &secret)
+			return nil
+		})
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return secrets, nil
+}
+
+// DeleteSecret deletes a secret
+func (db *DB) DeleteSecret(name string) error {
+	return db.bolt.Update(func(tx *bbolt.Tx) error {
+		b, err := db.bucket(tx, SecretsBucket)
+		if err != nil {
+			return err
+		}
+		return b.Delete([]byte(name))
+	})
+}
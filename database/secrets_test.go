@@ -0,0 +1,138 @@
+package database
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.etcd.io/bbolt"
+	"website-monitor/monitor"
+)
+
+// rawSecret returns a secret as stored in the database
+func rawSecret(t *testing.T, db *DB, name string) []byte {
+	t.Helper()
+	var raw []byte
+	err := db.bolt.View(func(tx *bbolt.Tx) error {
+		b, err := db.bucket(tx, SecretsBucket)
+		if err != nil {
+			return err
+		}
+		raw = append([]byte(nil), b.Get([]byte(name))...)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return raw
+}
+
+// newKey returns a random secret key, encoded as SecretKeyEnv expects
+func newKey(t *testing.T) string {
+	t.Helper()
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatal(err)
+	}
+	return base64.StdEncoding.EncodeToString(key)
+}
+
+func TestSecretsAreEncrypted(t *testing.T) {
+	t.Setenv(SecretKeyEnv, "")
+	path := filepath.Join(t.TempDir(), "test.db")
+	db, err := New(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := db.SaveSecret(&monitor.Secret{Name: "api-key", Value: "hunter2"}); err != nil {
+		t.Fatal(err)
+	}
+	if raw := rawSecret(t, db, "api-key"); strings.Contains(string(raw), "hunter2") {
+		t.Errorf("secret stored in plain text: %s", raw)
+	}
+	value, err := db.GetSecretValue("api-key")
+	if err != nil || value != "hunter2" {
+		t.Errorf("GetSecretValue = %q, %v, want %q", value, err, "hunter2")
+	}
+
+	info, err := os.Stat(path + ".key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode := info.Mode().Perm(); mode != 0600 {
+		t.Errorf("key file mode = %v, want 0600", mode)
+	}
+}
+
+func TestSecretsNeedTheirKey(t *testing.T) {
+	t.Setenv(SecretKeyEnv, newKey(t))
+	path := filepath.Join(t.TempDir(), "test.db")
+	db, err := New(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.SaveSecret(&monitor.Secret{Name: "api-key", Value: "hunter2"}); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	// Another key can't decrypt the secret
+	t.Setenv(SecretKeyEnv, newKey(t))
+	db, err = New(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if value, err := db.GetSecretValue("api-key"); err == nil || value != "" {
+		t.Errorf("GetSecretValue with the wrong key = %q, %v, want an error", value, err)
+	}
+
+	// Without a key, nothing is generated to read it with either
+	t.Setenv(SecretKeyEnv, "")
+	db.key = &secretKey{path: path + ".key"}
+	if _, err := db.GetSecretValue("api-key"); err == nil || !strings.Contains(err.Error(), "missing") {
+		t.Errorf("GetSecretValue without a key = %v, want a missing key error", err)
+	}
+	if _, err := os.Stat(path + ".key"); !os.IsNotExist(err) {
+		t.Errorf("reading a secret created a key file")
+	}
+}
+
+func TestSecretsAreBoundToTheirName(t *testing.T) {
+	t.Setenv(SecretKeyEnv, newKey(t))
+	db, err := New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := db.SaveSecret(&monitor.Secret{Name: "low", Value: "public"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.SaveSecret(&monitor.Secret{Name: "high", Value: "hunter2"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Copying the stored value of one secret over another doesn't reveal it
+	// under the other name
+	high := rawSecret(t, db, "high")
+	stored := strings.Replace(string(high), `"name":"high"`, `"name":"low"`, 1)
+	err = db.bolt.Update(func(tx *bbolt.Tx) error {
+		b, err := db.bucket(tx, SecretsBucket)
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte("low"), []byte(stored))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value, err := db.GetSecretValue("low"); err == nil {
+		t.Errorf("GetSecretValue of a moved secret = %q, want an error", value)
+	}
+}
@@ -0,0 +1,126 @@
+package database
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"go.etcd.io/bbolt"
+	"website-monitor/auth"
+)
+
+// WorkspacesBucket is the name of the bucket holding one nested bucket per
+// workspace other than the default. Each has its own websites, history,
+// groups, maintenance, audit, secrets and counter buckets, so workspaces never
+// see each other's data and number their websites independently.
+const WorkspacesBucket = "workspaces"
+
+// workspaceInfoKey is the key of a workspace's metadata within its bucket
+const workspaceInfoKey = "info"
+
+// workspaceBuckets are the buckets every workspace has
+var workspaceBuckets = []string{WebsitesBucket, HistoryBucket, GroupsBucket, MaintenanceBucket, AuditBucket, SecretsBucket, CounterBucket}
+
+// ErrWorkspaceNotFound is returned when a workspace does not exist
+var ErrWorkspaceNotFound = errors.New("workspace not found")
+
+// bucket returns one of the current workspace's buckets. Users, tokens and
+// sessions are shared by all workspaces and are not looked up here.
+func (db *DB) bucket(tx *bbolt.Tx, name string) (*bbolt.Bucket, error) {
+	if db.workspace == "" {
+		return tx.Bucket([]byte(name)), nil
+	}
+	workspace := tx.Bucket([]byte(WorkspacesBucket)).Bucket([]byte(db.workspace))
+	if workspace == nil {
+		return nil, fmt.Errorf("%w: %s", ErrWorkspaceNotFound, db.workspace)
+	}
+	return workspace.Bucket([]byte(name)), nil
+}
+
+// Workspace returns a view of the database scoped to a workspace. The view
+// shares the connection, so closing either closes both.
+func (db *DB) Workspace(name string) (*DB, error) {
+	if name == auth.DefaultWorkspace || name == "" {
+		return &DB{bolt: db.bolt, key: db.key}, nil
+	}
+
+	err := db.bolt.View(func(tx *bbolt.Tx) error {
+		if tx.Bucket([]byte(WorkspacesBucket)).Bucket([]byte(name)) == nil {
+			return fmt.Errorf("%w: %s", ErrWorkspaceNotFound, name)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &DB{bolt: db.bolt, workspace: name, key: db.key}, nil
+}
+
+// CreateWorkspace creates the buckets of a new workspace
+func (db *DB) CreateWorkspace(workspace *auth.Workspace) error {
+	return db.bolt.Update(func(tx *bbolt.Tx) error {
+		root := tx.Bucket([]byte(WorkspacesBucket))
+		if root.Bucket([]byte(workspace.Name)) != nil {
+			return fmt.Errorf("Workspace %q already exists", workspace.Name)
+		}
+		b, err := root.CreateBucket([]byte(workspace.Name))
+		if err != nil {
+			return fmt.Errorf("could not create workspace bucket: %v", err)
+		}
+
+		for _, name := range workspaceBuckets {
+			if _, err := b.CreateBucket([]byte(name)); err != nil {
+				return fmt.Errorf("could not create %s bucket: %v", name, err)
+			}
+		}
+		if err := b.Bucket([]byte(CounterBucket)).Put([]byte(IDCounterKey), []byte("1")); err != nil {
+			return fmt.Errorf("could not initialize ID counter: %v", err)
+		}
+
+		buf, err := json.Marshal(workspace)
+		if err != nil {
+			return fmt.Errorf("could not marshal workspace: %v", err)
+		}
+		return b.Put([]byte(workspaceInfoKey), buf)
+	})
+}
+
+// GetWorkspaces returns all workspaces except the default one
+func (db *DB) GetWorkspaces() ([]*auth.Workspace, error) {
+	var workspaces []*auth.Workspace
+
+	err := db.bolt.View(func(tx *bbolt.Tx) error {
+		root := tx.Bucket([]byte(WorkspacesBucket))
+
+		return root.ForEach(func(k, v []byte) error {
+			b := root.Bucket(k)
+			if b == nil {
+				return nil
+			}
+			var workspace auth.Workspace
+			if err := json.Unmarshal(b.Get([]byte(workspaceInfoKey)), &workspace); err != nil {
+				return fmt.Errorf("could not unmarshal workspace: %v", err)
+			}
+			workspaces = append(workspaces, &workspace)
+			return nil
+		})
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return workspaces, nil
+}
+
+// DeleteWorkspace deletes a workspace with all its websites and history
+func (db *DB) DeleteWorkspace(name string) error {
+	return db.bolt.Update(func(tx *bbolt.Tx) error {
+		root := tx.Bucket([]byte(WorkspacesBucket))
+		if root.Bucket([]byte(name)) == nil {
+			return fmt.Errorf("%w: %s", ErrWorkspaceNotFound, name)
+		}
+		return root.DeleteBucket([]byte(name))
+	})
+}
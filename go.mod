@@ -1,10 +1,21 @@
 module website-monitor
 
-go 1.19
+// go.etcd.io/bbolt v1.4.0, required since the first version of this module,
+// declares go 1.23, so go mod tidy raises this line to match it. The code
+// also uses sync.OnceFunc and sync.OnceValue from Go 1.21 and
+// strings.CutPrefix from Go 1.20.
+go 1.23
 
 require (
+	github.com/andybalholm/cascadia v1.3.3
 	github.com/gorilla/mux v1.8.1
 	go.etcd.io/bbolt v1.4.0
+	golang.org/x/crypto v0.31.0
+	golang.org/x/net v0.33.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
-require golang.org/x/sys v0.29.0 // indirect
+require (
+	golang.org/x/sys v0.29.0 // indirect
+	golang.org/x/text v0.21.0 // indirect
+)
@@ -0,0 +1,100 @@
+package handlers
+
+import (
+        "net/http"
+        "strconv"
+
+        "website-monitor/auth"
+        "website-monitor/monitor"
+        "github.com/gorilla/mux"
+)
+
+// nobody acts for requests that did not pass through the authentication
+// middleware. It has no role, so every check denies it.
+var nobody = &auth.Principal{}
+
+// principal returns the caller of a request, or nobody if it has none
+func principal(r *http.Request) *auth.Principal {
+        if p := auth.FromContext(r.Context()); p != nil {
+                return p
+        }
+        return nobody
+}
+
+// requireRole writes a 403 response and returns false unless the caller has
+// at least the given role
+func (h *Handlers) requireRole(w http.ResponseWriter, r *http.Request, role string) bool {
+        if !principal(r).HasRole(role) {
+                http.Error(w, "This requires the "+role+" role", http.StatusForbidden)
+                return false
+        }
+        return true
+}
+
+// requireWebsite writes a 403 response and returns false unless the caller
+// may manage the website
+func (h *Handlers) requireWebsite(w http.ResponseWriter, r *http.Request, website *monitor.Website) bool {
+        if !principal(r).CanEdit(website.Owner, website.Group) {
+                http.Error(w, "You don't have access to website "+strconv.Itoa(website.ID), http.StatusForbidden)
+                return false
+        }
+        return true
+}
+
+// requireGroup writes a 403 response and returns false unless the caller may
+// manage the group
+func (h *Handlers) requireGroup(w http.ResponseWriter, r *http.Request, group string) bool {
+        if !principal(r).CanEditGroup(group) {
+                http.Error(w, "You don't have access to group "+group, http.StatusForbidden)
+                return false
+        }
+        return true
+}
+
+// checkOwner validates a requested website owner. Changing the owner from
+// current requires the admin role and an existing user. It writes an error
+// response and returns false if the change is not allowed.
+func (h *Handlers) checkOwner(w http.ResponseWriter, r *http.Request, owner, current string) bool {
+        if owner == "" || owner == current {
+                return true
+        }
+        if owner != principal(r).User && !h.requireRole(w, r, auth.RoleAdmin) {
+                return false
+        }
+        if h.Auth != nil && h.workspaceUser(owner) == nil {
+                http.Error(w, "User not found: "+owner, http.StatusBadRequest)
+                return false
+        }
+        return true
+}
+
+// workspaceUser returns a user of the workspace h serves, or nil if there is
+// no such user in it
+func (h *Handlers) workspaceUser(username string) *auth.User {
+        user := h.Auth.User(username)
+        if user == nil || auth.WorkspaceOf(user.Workspace) != auth.WorkspaceOf(h.Workspace) {
+                return nil
+        }
+        return user
+}
+
+// editableWebsite parses the website ID from the URL and returns the website
+// if the caller may manage it. Otherwise it writes an error response and
+// returns nil.
+func (h *Handlers) editableWebsite(w http.ResponseWriter, r *http.Request) *monitor.Website {
+        id, err := strconv.Atoi(mux.Vars(r)["id"])
+        if err != nil {
+                http.Error(w, "Invalid ID format", http.StatusBadRequest)
+                return nil
+        }
+
+        website := h.Monitor.GetWebsiteByID(id)
+        if website == nil {
+                http.Error(w, "Website not found", http.StatusNotFound)
+                return nil
+        }
+        if !h.requireWebsite(w, r, website) {
+                return nil
+        }
+        return website
+}
@@ -0,0 +1,131 @@
+package handlers
+
+import (
+        "net/http"
+        "net/http/httptest"
+        "strconv"
+        "testing"
+
+        "website-monitor/auth"
+        "website-monitor/monitor"
+        "github.com/gorilla/mux"
+)
+
+// testAdmin is an admin of the default workspace
+var testAdmin = &auth.Principal{User: "root", Role: auth.RoleAdmin, Workspace: auth.DefaultWorkspace, Scope: auth.ScopeAdmin, Method: "session"}
+
+// requestAs returns a request made by the given principal
+func requestAs(method, target string, p *auth.Principal) *http.Request {
+        r := httptest.NewRequest(method, target, nil)
+        return r.WithContext(auth.NewContext(r.Context(), p))
+}
+
+func TestRequireRole(t *testing.T) {
+        h, _ := newTestHandlers(t)
+        viewer := &auth.Principal{User: "vera", Role: auth.RoleViewer, Scope: auth.ScopeAdmin}
+        editor := &auth.Principal{User: "alice", Role: auth.RoleEditor, Scope: auth.ScopeAdmin}
+        readOnlyAdmin := &auth.Principal{User: "root", Role: auth.RoleAdmin, Scope: auth.ScopeRead}
+
+        tests := []struct {
+                name      string
+                principal *auth.Principal // nil without the middleware
+                role      string
+                want      bool
+        }{
+                {"viewer reads", viewer, auth.RoleViewer, true},
+                {"viewer edits", viewer, auth.RoleEditor, false},
+                {"editor edits", editor, auth.RoleEditor, true},
+                {"editor administers", editor, auth.RoleAdmin, false},
+                {"admin with a read token", readOnlyAdmin, auth.RoleEditor, false},
+                {"without authentication", nil, auth.RoleViewer, false},
+        }
+
+        for _, test := range tests {
+                t.Run(test.name, func(t *testing.T) {
+                        r := httptest.NewRequest("GET", "/", nil)
+                        if test.principal != nil {
+                                r = requestAs("GET", "/", test.principal)
+                        }
+                        w := httptest.NewRecorder()
+                        if got := h.requireRole(w, r, test.role); got != test.want {
+                                t.Errorf("requireRole(%s) = %v, want %v", test.role, got, test.want)
+                        }
+                        if !test.want && w.Code != http.StatusForbidden {
+                                t.Errorf("status = %d, want %d", w.Code, http.StatusForbidden)
+                        }
+                })
+        }
+}
+
+func TestEditorsOnlyManageTheirWebsites(t *testing.T) {
+        h, _ := newTestHandlers(t)
+        websites := map[string]*monitor.Website{
+                "own":         {ID: 1, URL: "http://own.example/", Owner: "alice"},
+                "group":       {ID: 2, URL: "http://group.example/", Owner: "bob", Group: "shop/eu"},
+                "other group": {ID: 3, URL: "http://other.example/", Owner: "bob", Group: "blog"},
+                "unowned":     {ID: 4, URL: "http://unowned.example/"},
+        }
+        for _, website := range websites {
+                h.Monitor.AddExistingWebsite(website)
+        }
+
+        editor := &auth.Principal{User: "alice", Role: auth.RoleEditor, Scope: auth.ScopeAdmin, Groups: []string{"shop"}}
+        viewer := &auth.Principal{User: "alice", Role: auth.RoleViewer, Scope: auth.ScopeAdmin, Groups: []string{"shop"}}
+        admin := &auth.Principal{User: "root", Role: auth.RoleAdmin, Scope: auth.ScopeAdmin}
+
+        tests := []struct {
+                principal *auth.Principal
+                website   string
+                status    int
+        }{
+                {editor, "own", http.StatusOK},
+                {editor, "group", http.StatusOK},
+                {editor, "other group", http.StatusForbidden},
+                {editor, "unowned", http.StatusForbidden},
+                {viewer, "own", http.StatusForbidden},
+                {admin, "other group", http.StatusOK},
+                {admin, "unowned", http.StatusOK},
+        }
+
+        for _, test := range tests {
+                website := websites[test.website]
+                id := strconv.Itoa(website.ID)
+                r := mux.SetURLVars(requestAs("POST", "/api/websites/"+id+"/resume", test.principal), map[string]string{"id": id})
+                w := httptest.NewRecorder()
+                h.ResumeWebsite(w, r)
+
+                if w.Code != test.status {
+                        t.Errorf("%s %s resuming the %s website: status = %d, want %d", test.principal.Role, test.principal.User, test.website, w.Code, test.status)
+                }
+        }
+}
+
+func TestCheckJobsAreOnlyVisibleToTheirOwner(t *testing.T) {
+        h, _ := newTestHandlers(t)
+        alice := &auth.Principal{User: "alice", Role: auth.RoleEditor, Workspace: auth.DefaultWorkspace, Scope: auth.ScopeAdmin}
+        bob := &auth.Principal{User: "bob", Role: auth.RoleViewer, Workspace: auth.DefaultWorkspace, Scope: auth.ScopeAdmin}
+
+        w := httptest.NewRecorder()
+        h.StartCheckJob(w, requestAs("POST", "/api/checks", alice))
+        if w.Code != http.StatusAccepted {
+                t.Fatalf("starting a job: status = %d, want %d", w.Code, http.StatusAccepted)
+        }
+        location := w.Header().Get("Location")
+        id := location[len("/api/checks/"):]
+
+        for _, test := range []struct {
+                caller *auth.Principal
+                want   int
+        }{
+                {alice, http.StatusOK},
+                {bob, http.StatusNotFound},
+                {testAdmin, http.StatusNotFound},
+        } {
+                r := mux.SetURLVars(requestAs("GET", location, test.caller), map[string]string{"job": id})
+                w := httptest.NewRecorder()
+                h.GetCheckJob(w, r)
+                if w.Code != test.want {
+                        t.Errorf("%s reading the job: status = %d, want %d", test.caller.User, w.Code, test.want)
+                }
+        }
+}
@@ -0,0 +1,102 @@
+package handlers
+
+import (
+        "encoding/json"
+        "fmt"
+        "log"
+        "net/http"
+        "strconv"
+        "time"
+
+        "website-monitor/audit"
+        "website-monitor/auth"
+        "website-monitor/monitor"
+)
+
+// recordChange appends a change made by the caller to the workspace's audit
+// log. The change has already been made, so failures are logged rather than
+// returned. before is nil for new resources and after is nil for deleted ones.
+func (h *Handlers) recordChange(r *http.Request, action, resource string, id interface{}, before, after interface{}) {
+        h.record(principal(r), action, resource, id, before, after)
+}
+
+// record appends a change made by caller to the workspace's audit log, as
+// for recordChange
+func (h *Handlers) record(caller *auth.Principal, action, resource string, id interface{}, before, after interface{}) {
+        if h.store == nil {
+                return
+        }
+
+        entry := &audit.Entry{
+                Time:       time.Now(),
+                User:       caller.User,
+                Method:     caller.Method,
+                TokenID:    caller.TokenID,
+                Action:     action,
+                Resource:   resource,
+                ResourceID: fmt.Sprint(id),
+                Before:     audit.Value(before),
+                After:      audit.Value(after),
+        }
+        if err := h.store.AddAuditEntry(entry); err != nil {
+                log.Printf("Error recording %s of %s %v in the audit log: %v", action, resource, id, err)
+        }
+}
+
+// scheduler is recorded as the author of changes the monitor makes by itself
+var scheduler = &auth.Principal{User: "scheduler", Role: auth.RoleAdmin, Scope: auth.ScopeAdmin, Method: "scheduler"}
+
+// RecordResume records that a website resumed because its pause ran out. It
+// is meant for Monitor.SetResumeFunc.
+func (h *Handlers) RecordResume(before, after *monitor.Website) {
+        h.record(scheduler, audit.ActionResume, audit.ResourceWebsite, after.ID, before, after)
+}
+
+// GetAuditLog returns the newest audit log entries, newest first. The user,
+// action, resource and resourceId query parameters filter by those fields,
+// since and until (RFC3339) by time, and limit caps the number of entries.
+func (h *Handlers) GetAuditLog(w http.ResponseWriter, r *http.Request) {
+        if !h.requireRole(w, r, auth.RoleAdmin) {
+                return
+        }
+
+        query := r.URL.Query()
+        filter := &audit.Filter{
+                User:       query.Get("user"),
+                Action:     query.Get("action"),
+                Resource:   query.Get("resource"),
+                ResourceID: query.Get("resourceId"),
+        }
+        for name, field := range map[string]*time.Time{"since": &filter.Since, "until": &filter.Until} {
+                if value := query.Get(name); value != "" {
+                        parsed, err := time.Parse(time.RFC3339, value)
+                        if err != nil {
+                                http.Error(w, "Invalid "+name+" time, expected RFC3339", http.StatusBadRequest)
+                                return
+                        }
+                        *field = parsed
+                }
+        }
+        if value := query.Get("limit"); value != "" {
+                limit, err := strconv.Atoi(value)
+                if err != nil || limit <= 0 {
+                        http.Error(w, "Invalid limit", http.StatusBadRequest)
+                        return
+                }
+                filter.Limit = limit
+        }
+
+        entries := []*audit.Entry{}
+        if h.store != nil {
+                loaded, err := h.store.GetAuditEntries(filter)
+                if err != nil {
+                        log.Printf("Error loading audit log: %v", err)
+                        http.Error(w, "Failed to load audit log", http.StatusInternalServerError)
+                        return
+                }
+                entries = loaded
+        }
+
+        w.Header().Set("Content-Type", "application/json")
+        json.NewEncoder(w).Encode(entries)
+}
@@ -0,0 +1,70 @@
+package handlers
+
+import (
+        "strings"
+        "testing"
+        "time"
+
+        "website-monitor/audit"
+        "website-monitor/monitor"
+)
+
+func TestAuditLogRedactsCredentials(t *testing.T) {
+        h, db := newTestHandlers(t)
+        before := &monitor.Website{
+                ID:    1,
+                URL:   "https://example.com/",
+                Auth:  &monitor.AuthConfig{Type: monitor.AuthBasic, Username: "monitor", Password: `{{secret "basic-password"}}`},
+                Proxy: &monitor.ProxyConfig{URL: "http://proxy.example.com:3128", Username: "proxy-user", Password: `{{secret "proxy-password"}}`},
+        }
+        after := *before
+        after.Auth = &monitor.AuthConfig{Type: monitor.AuthBearer, Token: `{{secret "api-token"}}`}
+
+        h.recordChange(requestAs("PUT", "/api/websites/1", testAdmin), audit.ActionUpdate, audit.ResourceWebsite, 1, before, &after)
+
+        entries := auditEntries(t, db)
+        if len(entries) != 1 {
+                t.Fatalf("got %d audit entries, want 1", len(entries))
+        }
+        recorded := string(entries[0].Before) + string(entries[0].After)
+        for _, credential := range []string{"basic-password", "proxy-password", "api-token"} {
+                if strings.Contains(recorded, credential) {
+                        t.Errorf("audit entry contains %s: %s", credential, recorded)
+                }
+        }
+        for _, kept := range []string{`"username":"monitor"`, `"username":"proxy-user"`, `"password":"[redacted]"`, `"token":"[redacted]"`} {
+                if !strings.Contains(recorded, kept) {
+                        t.Errorf("audit entry lacks %s: %s", kept, recorded)
+                }
+        }
+        if before.Auth.Password != `{{secret "basic-password"}}` || before.Proxy.Password != `{{secret "proxy-password"}}` {
+                t.Error("redacting the audit entry changed the website")
+        }
+}
+
+func TestAuditLogRecordsPausesThatRunOut(t *testing.T) {
+        h, db := newTestHandlers(t)
+        h.Monitor.SetResumeFunc(h.RecordResume)
+
+        // Checked recently, so resuming doesn't make it due
+        h.Monitor.AddExistingWebsite(&monitor.Website{
+                ID:          1,
+                URL:         "https://example.com/",
+                Paused:      true,
+                PausedUntil: time.Now().Add(-time.Minute),
+                LastChecked: time.Now(),
+        })
+        h.Monitor.CheckDueWebsites()
+
+        entries := auditEntries(t, db)
+        if len(entries) != 1 {
+                t.Fatalf("got %d audit entries, want 1", len(entries))
+        }
+        entry := entries[0]
+        if entry.Action != audit.ActionResume || entry.User != "scheduler" || entry.Method != "scheduler" || entry.ResourceID != "1" {
+                t.Errorf("audit entry = %s of %s %s by %s (%s), want resume of website 1 by scheduler", entry.Action, entry.Resource, entry.ResourceID, entry.User, entry.Method)
+        }
+        if !strings.Contains(string(entry.Before), `"paused":true`) || !strings.Contains(string(entry.After), `"paused":false`) {
+                t.Errorf("audit entry before %s after %s, want paused then resumed", entry.Before, entry.After)
+        }
+}
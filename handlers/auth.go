@@ -0,0 +1,224 @@
+package handlers
+
+import (
+        "encoding/json"
+        "log"
+        "net/http"
+        "sort"
+        "time"
+
+        "website-monitor/audit"
+        "website-monitor/auth"
+        "github.com/gorilla/mux"
+)
+
+// loginData is passed to the login template
+type loginData struct {
+        LoginEnabled bool
+        Username     string
+        Error        string
+}
+
+// LoginPage renders the dashboard login form
+func (h *Handlers) LoginPage(w http.ResponseWriter, r *http.Request) {
+        h.renderLogin(w, http.StatusOK, "", "")
+}
+
+// renderLogin renders the login form with an optional error
+func (h *Handlers) renderLogin(w http.ResponseWriter, status int, username, message string) {
+        data := loginData{
+                LoginEnabled: h.Auth != nil && h.Auth.LoginEnabled(),
+                Username:     username,
+                Error:        message,
+        }
+        w.Header().Set("Content-Type", "text/html; charset=utf-8")
+        w.WriteHeader(status)
+        h.tmpl.ExecuteTemplate(w, "login.html", data)
+}
+
+// Login checks the submitted username and password, starts a session and
+// redirects to the dashboard
+func (h *Handlers) Login(w http.ResponseWriter, r *http.Request) {
+        if h.Auth == nil || !h.Auth.LoginEnabled() {
+                h.renderLogin(w, http.StatusNotFound, "", "")
+                return
+        }
+
+        username := r.FormValue("username")
+        value, session, err := h.Auth.Login(username, r.FormValue("password"))
+        if err == auth.ErrInvalidCredentials {
+                log.Printf("Failed login for %q from %s", username, r.RemoteAddr)
+                h.renderLogin(w, http.StatusUnauthorized, username, "Invalid username or password")
+                return
+        }
+        if err != nil {
+                log.Printf("Error logging in: %v", err)
+                h.renderLogin(w, http.StatusInternalServerError, username, "Login failed, please try again")
+                return
+        }
+
+        http.SetCookie(w, &http.Cookie{
+                Name:     auth.SessionCookie,
+                Value:    value,
+                Path:     "/",
+                Expires:  session.ExpiresAt,
+                HttpOnly: true,
+                Secure:   r.TLS != nil,
+                SameSite: http.SameSiteLaxMode,
+        })
+        http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// Logout ends the current session and returns to the login form
+func (h *Handlers) Logout(w http.ResponseWriter, r *http.Request) {
+        if cookie, err := r.Cookie(auth.SessionCookie); err == nil && h.Auth != nil {
+                if err := h.Auth.Logout(cookie.Value); err != nil {
+                        log.Printf("Error ending session: %v", err)
+                }
+        }
+
+        http.SetCookie(w, &http.Cookie{
+                Name:     auth.SessionCookie,
+                Path:     "/",
+                MaxAge:   -1,
+                HttpOnly: true,
+                Secure:   r.TLS != nil,
+                SameSite: http.SameSiteLaxMode,
+        })
+        http.Redirect(w, r, "/login", http.StatusSeeOther)
+}
+
+// requireAuth writes a 404 response and returns false if authentication is
+// not configured
+func (h *Handlers) requireAuth(w http.ResponseWriter) bool {
+        if h.Auth == nil {
+                http.Error(w, "Authentication is not configured", http.StatusNotFound)
+                return false
+        }
+        return true
+}
+
+// GetTokens lists the caller's API tokens, or for admins every token of the
+// workspace's users, without their secrets
+func (h *Handlers) GetTokens(w http.ResponseWriter, r *http.Request) {
+        if !h.requireAuth(w) || !h.requireRole(w, r, auth.RoleViewer) {
+                return
+        }
+
+        caller := principal(r)
+        tokens := []*auth.Token{}
+        for _, token := range h.Auth.Tokens() {
+                if token.User == caller.User || (caller.HasRole(auth.RoleAdmin) && h.workspaceUser(token.User) != nil) {
+                        tokens = append(tokens, token)
+                }
+        }
+        sort.Slice(tokens, func(i, j int) bool { return tokens[i].CreatedAt.Before(tokens[j].CreatedAt) })
+
+        w.Header().Set("Content-Type", "application/json")
+        json.NewEncoder(w).Encode(tokens)
+}
+
+// tokenRequest is the body of a request to create an API token
+type tokenRequest struct {
+        Name      string `json:"name"`
+        Scope     string `json:"scope"`
+        ExpiresIn string `json:"expiresIn"` // Go duration such as "720h"; empty never expires
+        User      string `json:"user"`      // Only admins may create tokens for other users
+}
+
+// tokenResponse returns a new token along with its secret, which is only
+// shown this once
+type tokenResponse struct {
+        *auth.Token
+        Secret string `json:"secret"`
+}
+
+// CreateToken issues a new API token owned by the caller. A token never
+// grants more than its user's role.
+func (h *Handlers) CreateToken(w http.ResponseWriter, r *http.Request) {
+        if !h.requireAuth(w) || !h.requireRole(w, r, auth.RoleViewer) {
+                return
+        }
+
+        var data tokenRequest
+        if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+                http.Error(w, "Invalid request format", http.StatusBadRequest)
+                return
+        }
+        if data.Name == "" {
+                http.Error(w, "Name is required", http.StatusBadRequest)
+                return
+        }
+        var ttl time.Duration
+        if data.ExpiresIn != "" {
+                var err error
+                if ttl, err = time.ParseDuration(data.ExpiresIn); err != nil || ttl <= 0 {
+                        http.Error(w, "Invalid expiresIn duration", http.StatusBadRequest)
+                        return
+                }
+        }
+
+        caller := principal(r)
+        user := caller.User
+        if data.User != "" && data.User != user {
+                if !h.requireRole(w, r, auth.RoleAdmin) {
+                        return
+                }
+                if h.workspaceUser(data.User) == nil {
+                        http.Error(w, "User not found: "+data.User, http.StatusBadRequest)
+                        return
+                }
+                user = data.User
+        }
+
+        secret, token, err := h.Auth.CreateToken(data.Name, data.Scope, user, ttl)
+        if err != nil {
+                http.Error(w, err.Error(), http.StatusBadRequest)
+                return
+        }
+        log.Printf("Created %s token %s (%s) for %s", token.Scope, token.ID, token.Name, token.User)
+        h.recordChange(r, audit.ActionCreate, audit.ResourceToken, token.ID, nil, token.Public())
+
+        w.Header().Set("Content-Type", "application/json")
+        w.WriteHeader(http.StatusCreated)
+        json.NewEncoder(w).Encode(tokenResponse{Token: token, Secret: secret})
+}
+
+// RevokeToken deletes one of the caller's API tokens, or for admins any token
+// of the workspace's users
+func (h *Handlers) RevokeToken(w http.ResponseWriter, r *http.Request) {
+        if !h.requireAuth(w) || !h.requireRole(w, r, auth.RoleViewer) {
+                return
+        }
+
+        id := mux.Vars(r)["id"]
+        token := h.Auth.Token(id)
+        if token == nil {
+                http.Error(w, "Token not found", http.StatusNotFound)
+                return
+        }
+        if token.User != principal(r).User {
+                if !h.requireRole(w, r, auth.RoleAdmin) {
+                        return
+                }
+                if h.workspaceUser(token.User) == nil {
+                        http.Error(w, "Token not found", http.StatusNotFound)
+                        return
+                }
+        }
+
+        found, err := h.Auth.RevokeToken(id)
+        if err != nil {
+                log.Printf("Error revoking token %s: %v", id, err)
+                http.Error(w, "Failed to revoke token", http.StatusInternalServerError)
+                return
+        }
+        if !found {
+                http.Error(w, "Token not found", http.StatusNotFound)
+                return
+        }
+        log.Printf("Revoked token %s", id)
+        h.recordChange(r, audit.ActionDelete, audit.ResourceToken, id, token, nil)
+
+        w.WriteHeader(http.StatusNoContent)
+}
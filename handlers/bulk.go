@@ -0,0 +1,101 @@
+package handlers
+
+import (
+        "encoding/json"
+        "log"
+        "net/http"
+        "sort"
+
+        "website-monitor/audit"
+        "website-monitor/auth"
+        "website-monitor/bulk"
+        "website-monitor/monitor"
+)
+
+// maxImportSize limits the size of an import file
+const maxImportSize = 10 << 20
+
+// ExportWebsites returns every monitored website in the format given by the
+// format query parameter: json (default), csv or opml
+func (h *Handlers) ExportWebsites(w http.ResponseWriter, r *http.Request) {
+        if !h.requireRole(w, r, auth.RoleViewer) {
+                return
+        }
+
+        format := r.URL.Query().Get("format")
+        if format == "" {
+                format = bulk.FormatJSON
+        }
+        if !bulk.ValidFormat(format) {
+                http.Error(w, "Unsupported format: "+format, http.StatusBadRequest)
+                return
+        }
+
+        websites := h.Monitor.GetWebsites()
+        sort.Slice(websites, func(i, j int) bool { return websites[i].ID < websites[j].ID })
+
+        w.Header().Set("Content-Type", bulk.ContentType(format))
+        w.Header().Set("Content-Disposition", `attachment; filename="websites.`+format+`"`)
+        if err := bulk.Export(w, format, websites); err != nil {
+                log.Printf("Error exporting websites: %v", err)
+        }
+}
+
+// ImportWebsites adds the websites in the request body. The format query
+// parameter selects json, csv or opml, falling back to the Content-Type. With
+// ids=preserve, websites keep the IDs from the file. Invalid and duplicate
+// rows are skipped and reported per row. Imported websites are owned by the
+// caller; admins may keep the owners given in the file and preserve IDs.
+func (h *Handlers) ImportWebsites(w http.ResponseWriter, r *http.Request) {
+        if !h.requireRole(w, r, auth.RoleEditor) {
+                return
+        }
+
+        format := r.URL.Query().Get("format")
+        if format == "" {
+                format = bulk.FormatFromContentType(r.Header.Get("Content-Type"))
+        }
+        if !bulk.ValidFormat(format) {
+                http.Error(w, "Unsupported format: "+format, http.StatusBadRequest)
+                return
+        }
+
+        ids := r.URL.Query().Get("ids")
+        if ids != "" && ids != "preserve" && ids != "reassign" {
+                http.Error(w, "ids must be preserve or reassign", http.StatusBadRequest)
+                return
+        }
+        if ids == "preserve" && !h.requireRole(w, r, auth.RoleAdmin) {
+                return
+        }
+
+        rows, err := bulk.Parse(http.MaxBytesReader(w, r.Body, maxImportSize), format)
+        if err != nil {
+                http.Error(w, "Invalid import file: "+err.Error(), http.StatusBadRequest)
+                return
+        }
+
+        caller := principal(r)
+        add := func(id int, config *monitor.Website) (*monitor.Website, error) {
+                if config.Owner == "" || !caller.HasRole(auth.RoleAdmin) {
+                        config.Owner = caller.User
+                }
+                if err := h.validateCertPaths(config); err != nil {
+                        return nil, err
+                }
+                if err := h.checkEgress(config); err != nil {
+                        return nil, err
+                }
+                website, err := h.Monitor.AddWebsiteWithID(id, config)
+                if err == nil {
+                        h.recordChange(r, audit.ActionImport, audit.ResourceWebsite, website.ID, nil, website)
+                }
+                return website, err
+        }
+
+        report := bulk.Import(rows, h.Monitor.GetWebsites(), ids == "preserve", add)
+        log.Printf("Imported %d websites (%d duplicates, %d invalid)", report.Imported, report.Duplicates, report.Invalid)
+
+        w.Header().Set("Content-Type", "application/json")
+        json.NewEncoder(w).Encode(report)
+}
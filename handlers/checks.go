@@ -0,0 +1,97 @@
+package handlers
+
+import (
+        "encoding/json"
+        "net/http"
+        "strconv"
+        "time"
+
+        "website-monitor/auth"
+        "website-monitor/monitor"
+        "github.com/gorilla/mux"
+)
+
+// checkJobRequest is the optional body of a check job request. Explicit IDs
+// are checked even if paused; otherwise every unpaused website matching the
+// group and tags that the caller may manage is checked.
+type checkJobRequest struct {
+        IDs   []int    `json:"ids"`
+        Group string   `json:"group"`
+        Tags  []string `json:"tags"`
+}
+
+// StartCheckJob starts checking all or a filtered set of websites in the
+// background and returns the job, whose progress is available from GetCheckJob
+func (h *Handlers) StartCheckJob(w http.ResponseWriter, r *http.Request) {
+        if !h.requireRole(w, r, auth.RoleEditor) {
+                return
+        }
+
+        var data checkJobRequest
+        if r.ContentLength != 0 {
+                if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+                        http.Error(w, "Invalid request format", http.StatusBadRequest)
+                        return
+                }
+        }
+
+        // The filters can also be given as query parameters, as for GetWebsites
+        query := r.URL.Query()
+        if data.Group == "" {
+                data.Group = query.Get("group")
+        }
+        data.Tags = append(data.Tags, query["tag"]...)
+        group := monitor.CleanGroup(data.Group)
+
+        caller := principal(r)
+        var ids []int
+        if len(data.IDs) > 0 {
+                for _, id := range data.IDs {
+                        website := h.Monitor.GetWebsiteByID(id)
+                        if website == nil {
+                                http.Error(w, "Website not found: "+strconv.Itoa(id), http.StatusBadRequest)
+                                return
+                        }
+                        if !h.requireWebsite(w, r, website) {
+                                return
+                        }
+                        if website.HasTags(data.Tags) && website.InGroup(group) {
+                                ids = append(ids, id)
+                        }
+                }
+        } else {
+                now := time.Now()
+                for _, website := range h.Monitor.GetWebsites() {
+                        if !website.IsPaused(now) && website.HasTags(data.Tags) && website.InGroup(group) &&
+                                caller.CanEdit(website.Owner, website.Group) {
+                                ids = append(ids, website.ID)
+                        }
+                }
+        }
+
+        job := h.Monitor.StartCheckJob(ids, caller.User, caller.Workspace)
+
+        w.Header().Set("Content-Type", "application/json")
+        w.Header().Set("Location", "/api/checks/"+job.ID)
+        w.WriteHeader(http.StatusAccepted)
+        json.NewEncoder(w).Encode(job)
+}
+
+// GetCheckJob reports the progress and per-website results of a check job.
+// Jobs started by other users are not found.
+func (h *Handlers) GetCheckJob(w http.ResponseWriter, r *http.Request) {
+        if !h.requireRole(w, r, auth.RoleViewer) {
+                return
+        }
+
+        vars := mux.Vars(r)
+        caller := principal(r)
+        job := h.Monitor.GetCheckJob(vars["job"], caller.User, caller.Workspace)
+        if job == nil {
+                http.Error(w, "Check job not found", http.StatusNotFound)
+                return
+        }
+
+        w.Header().Set("Content-Type", "application/json")
+        json.NewEncoder(w).Encode(job)
+}
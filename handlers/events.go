@@ -0,0 +1,79 @@
+package handlers
+
+import (
+        "encoding/json"
+        "fmt"
+        "log"
+        "net/http"
+        "strconv"
+        "time"
+
+        "website-monitor/auth"
+)
+
+// eventsHeartbeat is how often a comment is sent on an idle event stream so
+// proxies and clients don't time the connection out
+const eventsHeartbeat = 30 * time.Second
+
+// Events streams check events as Server-Sent Events. Each event is named after
+// its type and carries the JSON-encoded event as data. With ?website=ID only
+// events for that website are sent.
+func (h *Handlers) Events(w http.ResponseWriter, r *http.Request) {
+        if !h.requireRole(w, r, auth.RoleViewer) {
+                return
+        }
+
+        flusher, ok := w.(http.Flusher)
+        if !ok {
+                http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+                return
+        }
+
+        websiteID := 0
+        if value := r.URL.Query().Get("website"); value != "" {
+                id, err := strconv.Atoi(value)
+                if err != nil {
+                        http.Error(w, "Invalid website ID", http.StatusBadRequest)
+                        return
+                }
+                websiteID = id
+        }
+
+        events, cancel := h.Monitor.Subscribe()
+        defer cancel()
+
+        w.Header().Set("Content-Type", "text/event-stream")
+        w.Header().Set("Cache-Control", "no-cache")
+        w.Header().Set("Connection", "keep-alive")
+        w.WriteHeader(http.StatusOK)
+        fmt.Fprint(w, ": connected\n\n")
+        flusher.Flush()
+
+        heartbeat := time.NewTicker(eventsHeartbeat)
+        defer heartbeat.Stop()
+
+        for {
+                select {
+                case <-r.Context().Done():
+                        return
+                case <-heartbeat.C:
+                        if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+                                return
+                        }
+                        flusher.Flush()
+                case event := <-events:
+                        if websiteID != 0 && event.WebsiteID != websiteID {
+                                continue
+                        }
+                        data, err := json.Marshal(event)
+                        if err != nil {
+                                log.Printf("Error encoding event: %v", err)
+                                continue
+                        }
+                        if _, err := fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data); err != nil {
+                                return
+                        }
+                        flusher.Flush()
+                }
+        }
+}
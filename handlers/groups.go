@@ -0,0 +1,225 @@
+package handlers
+
+import (
+        "encoding/json"
+        "log"
+        "net/http"
+        "sort"
+        "strings"
+        "time"
+
+        "website-monitor/audit"
+        "website-monitor/auth"
+        "website-monitor/monitor"
+        "github.com/gorilla/mux"
+)
+
+// groupSummary describes a group for GET /api/groups
+type groupSummary struct {
+        Path            string `json:"path"`
+        IntervalSeconds int    `json:"intervalSeconds"` // Stored default; 0 inherits from the parent group
+        Websites        int    `json:"websites"`        // Websites in the group and its subgroups
+        Paused          int    `json:"paused"`
+}
+
+// GetGroups lists every group that has websites or stored defaults
+func (h *Handlers) GetGroups(w http.ResponseWriter, r *http.Request) {
+        if !h.requireRole(w, r, auth.RoleViewer) {
+                return
+        }
+
+        websites := h.Monitor.GetWebsites()
+
+        summaries := map[string]*groupSummary{}
+        summary := func(path string) *groupSummary {
+                s, ok := summaries[path]
+                if !ok {
+                        s = &groupSummary{Path: path}
+                        summaries[path] = s
+                }
+                return s
+        }
+
+        for _, group := range h.Monitor.GetGroups() {
+                summary(group.Path).IntervalSeconds = group.IntervalSeconds
+        }
+        for _, website := range websites {
+                // Count the website in its group and every parent group
+                path := website.Group
+                for path != "" {
+                        s := summary(path)
+                        s.Websites++
+                        if website.Paused {
+                                s.Paused++
+                        }
+                        path = parentGroup(path)
+                }
+        }
+
+        groups := make([]*groupSummary, 0, len(summaries))
+        for _, s := range summaries {
+                groups = append(groups, s)
+        }
+        sort.Slice(groups, func(i, j int) bool { return groups[i].Path < groups[j].Path })
+
+        w.Header().Set("Content-Type", "application/json")
+        json.NewEncoder(w).Encode(groups)
+}
+
+// parentGroup returns the parent of a group path, or "" for a top-level group
+func parentGroup(path string) string {
+        if i := strings.LastIndex(path, "/"); i >= 0 {
+                return path[:i]
+        }
+        return ""
+}
+
+// groupFromRequest returns the cleaned group path from the URL if the caller
+// may manage the group, writing an error response and returning "" if it is
+// empty or not allowed
+func (h *Handlers) groupFromRequest(w http.ResponseWriter, r *http.Request) string {
+        group := monitor.CleanGroup(mux.Vars(r)["group"])
+        if group == "" {
+                http.Error(w, "Group is required", http.StatusBadRequest)
+                return ""
+        }
+        if !h.requireGroup(w, r, group) {
+                return ""
+        }
+        return group
+}
+
+// groupWebsites returns the IDs of the websites in a group and its subgroups
+func (h *Handlers) groupWebsites(group string) []int {
+        var ids []int
+        for _, website := range h.Monitor.GetWebsites() {
+                if website.InGroup(group) {
+                        ids = append(ids, website.ID)
+                }
+        }
+        return ids
+}
+
+// SetGroup stores the defaults of a group
+func (h *Handlers) SetGroup(w http.ResponseWriter, r *http.Request) {
+        path := h.groupFromRequest(w, r)
+        if path == "" {
+                return
+        }
+
+        var data struct {
+                IntervalSeconds int `json:"intervalSeconds"`
+        }
+        if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+                http.Error(w, "Invalid request format", http.StatusBadRequest)
+                return
+        }
+        if data.IntervalSeconds < 0 {
+                http.Error(w, "Interval cannot be negative", http.StatusBadRequest)
+                return
+        }
+
+        var before *monitor.Group
+        for _, existing := range h.Monitor.GetGroups() {
+                if existing.Path == path {
+                        before = existing
+                }
+        }
+        group := h.Monitor.SetGroup(&monitor.Group{Path: path, IntervalSeconds: data.IntervalSeconds})
+        if before == nil {
+                h.recordChange(r, audit.ActionCreate, audit.ResourceGroup, path, nil, group)
+        } else {
+                h.recordChange(r, audit.ActionUpdate, audit.ResourceGroup, path, before, group)
+        }
+
+        w.Header().Set("Content-Type", "application/json")
+        json.NewEncoder(w).Encode(group)
+}
+
+// DeleteGroup stops monitoring every website in a group and its subgroups and
+// deletes the group's defaults. Each removed website is recorded in the audit
+// log along with the group.
+func (h *Handlers) DeleteGroup(w http.ResponseWriter, r *http.Request) {
+        path := h.groupFromRequest(w, r)
+        if path == "" {
+                return
+        }
+
+        ids := h.groupWebsites(path)
+        for _, id := range ids {
+                website := h.Monitor.GetWebsiteByID(id)
+                if website != nil && h.removeWebsite(id) {
+                        h.recordChange(r, audit.ActionDelete, audit.ResourceWebsite, id, website, nil)
+                }
+        }
+
+        var before *monitor.Group
+        for _, existing := range h.Monitor.GetGroups() {
+                if existing.Path == path {
+                        before = existing
+                }
+        }
+        if h.Monitor.RemoveGroup(path) && h.store != nil {
+                if err := h.store.DeleteGroup(path); err != nil {
+                        log.Printf("Error deleting group %s from database: %v", path, err)
+                }
+        }
+        h.recordChange(r, audit.ActionDelete, audit.ResourceGroup, path, before, nil)
+
+        log.Printf("Deleted group %s with %d websites", path, len(ids))
+        w.WriteHeader(http.StatusNoContent)
+}
+
+// CheckGroup checks every website in a group and its subgroups, including
+// paused ones, and returns the updated websites
+func (h *Handlers) CheckGroup(w http.ResponseWriter, r *http.Request) {
+        path := h.groupFromRequest(w, r)
+        if path == "" {
+                return
+        }
+
+        websites := h.Monitor.CheckWebsites(h.groupWebsites(path))
+
+        w.Header().Set("Content-Type", "application/json")
+        json.NewEncoder(w).Encode(websites)
+}
+
+// PauseGroup pauses scheduled checks of every website in a group and its
+// subgroups, optionally until a given time; see parsePauseRequest
+func (h *Handlers) PauseGroup(w http.ResponseWriter, r *http.Request) {
+        until, ok := parsePauseRequest(w, r)
+        if !ok {
+                return
+        }
+        h.setGroupPaused(w, r, true, until)
+}
+
+// ResumeGroup resumes scheduled checks of every website in a group and its subgroups
+func (h *Handlers) ResumeGroup(w http.ResponseWriter, r *http.Request) {
+        h.setGroupPaused(w, r, false, time.Time{})
+}
+
+// setGroupPaused implements PauseGroup and ResumeGroup
+func (h *Handlers) setGroupPaused(w http.ResponseWriter, r *http.Request, paused bool, until time.Time) {
+        path := h.groupFromRequest(w, r)
+        if path == "" {
+                return
+        }
+
+        action := audit.ActionResume
+        if paused {
+                action = audit.ActionPause
+        }
+
+        websites := []*monitor.Website{}
+        for _, id := range h.groupWebsites(path) {
+                before := h.Monitor.GetWebsiteByID(id)
+                if website := h.Monitor.SetPaused(id, paused, until); website != nil {
+                        websites = append(websites, website)
+                        h.recordChange(r, action, audit.ResourceWebsite, id, before, website)
+                }
+        }
+
+        w.Header().Set("Content-Type", "application/json")
+        json.NewEncoder(w).Encode(websites)
+}
@@ -3,117 +3,286 @@ package handlers
 import (
         "embed"
         "encoding/json"
+        "errors"
         "fmt"
         "html/template"
         "io"
         "log"
         "net/http"
+        "net/url"
         "os"
         "path/filepath"
         "strconv"
+        "strings"
         "time"
 
+        "website-monitor/audit"
+        "website-monitor/auth"
         "website-monitor/monitor"
         "github.com/gorilla/mux"
 )
 
+// Store is the persistent storage the handlers use alongside the monitor
+type Store interface {
+        DeleteWebsite(id int) error
+        GetHistory(websiteID, limit int) ([]*monitor.HistoryEntry, error)
+        GetHistorySince(websiteID int, since time.Time) ([]*monitor.HistoryEntry, error)
+        DeleteGroup(path string) error
+        DeleteMaintenanceWindow(id int) error
+        AddAuditEntry(entry *audit.Entry) error
+        GetAuditEntries(filter *audit.Filter) ([]*audit.Entry, error)
+        SaveSecret(secret *monitor.Secret) error
+        GetSecret(name string) (*monitor.Secret, error)
+        GetSecrets() ([]*monitor.Secret, error)
+        DeleteSecret(name string) error
+        CheckWritable() error
+}
+
 // Handlers contains the HTTP handlers for the application
 type Handlers struct {
-        Monitor       *monitor.Monitor
-        tmpl          *template.Template
-        deleteFromDB  func(int) error // Function to delete website from database
+        Monitor   *monitor.Monitor
+        Auth      *auth.Authenticator // Login and token management; may be nil
+        Workspace string              // Workspace served; empty for the default one
+        CertsDir  string              // Where uploaded certificates are saved; defaults to ./certs
+        Metrics   http.Handler        // Prometheus metrics of the workspace; may be nil
+        Stop      func()              // Stops checking the workspace's websites; may be nil
+        tmpl      *template.Template
+        store     Store // Database the monitor saves to; may be nil
 }
 
 // NewHandlers creates a new Handlers instance
-func NewHandlers(monitor *monitor.Monitor, deleteFunc func(int) error) *Handlers {
-        tmpl := template.Must(template.ParseFiles("templates/index.html"))
+func NewHandlers(monitor *monitor.Monitor, store Store) *Handlers {
+        tmpl := template.Must(template.ParseFiles("templates/index.html", "templates/login.html", "templates/sla.html"))
         return &Handlers{
-                Monitor:      monitor,
-                tmpl:         tmpl,
-                deleteFromDB: deleteFunc,
+                Monitor: monitor,
+                tmpl:    tmpl,
+                store:   store,
         }
 }
 
 // NewHandlersWithEmbeddedTemplates creates a new Handlers instance with embedded templates
-func NewHandlersWithEmbeddedTemplates(monitor *monitor.Monitor, deleteFunc func(int) error, templatesFS embed.FS) *Handlers {
+func NewHandlersWithEmbeddedTemplates(monitor *monitor.Monitor, store Store, templatesFS embed.FS) *Handlers {
         // Parse templates from embedded filesystem
-        tmpl := template.Must(template.ParseFS(templatesFS, "templates/index.html"))
+        tmpl := template.Must(template.ParseFS(templatesFS, "templates/index.html", "templates/login.html", "templates/sla.html"))
         return &Handlers{
-                Monitor:      monitor,
-                tmpl:         tmpl,
-                deleteFromDB: deleteFunc,
+                Monitor: monitor,
+                tmpl:    tmpl,
+                store:   store,
         }
 }
 
+// dashboardData is passed to the dashboard template
+type dashboardData struct {
+        User      string // Logged in user, empty unless authenticated with a session
+        Role      string
+        Workspace string // Shown when it isn't the default workspace
+}
+
 // Dashboard renders the main dashboard
 func (h *Handlers) Dashboard(w http.ResponseWriter, r *http.Request) {
-        h.tmpl.Execute(w, nil)
+        if !h.requireRole(w, r, auth.RoleViewer) {
+                return
+        }
+
+        var data dashboardData
+        if caller := principal(r); caller.Method == "session" {
+                data.User = caller.User
+                data.Role = caller.Role
+        }
+        if workspace := auth.WorkspaceOf(h.Workspace); workspace != auth.DefaultWorkspace {
+                data.Workspace = workspace
+        }
+        h.tmpl.ExecuteTemplate(w, "index.html", data)
 }
 
-// GetWebsites returns all monitored websites as JSON
+// GetWebsites returns all monitored websites as JSON. Repeated tag query
+// parameters keep only websites with all of those tags, and group keeps only
+// websites in that group or its subgroups.
 func (h *Handlers) GetWebsites(w http.ResponseWriter, r *http.Request) {
-        websites := h.Monitor.GetWebsites()
-        
+        if !h.requireRole(w, r, auth.RoleViewer) {
+                return
+        }
+
+        query := r.URL.Query()
+        tags := query["tag"]
+        group := query.Get("group")
+
+        websites := []*monitor.Website{}
+        for _, website := range h.Monitor.GetWebsites() {
+                if website.HasTags(tags) && website.InGroup(group) {
+                        websites = append(websites, website)
+                }
+        }
+
         w.Header().Set("Content-Type", "application/json")
         json.NewEncoder(w).Encode(websites)
 }
 
-// AddWebsite adds a new website to monitor
-func (h *Handlers) AddWebsite(w http.ResponseWriter, r *http.Request) {
-        var data struct {
-                URL             string `json:"url"`
-                Name            string `json:"name"`
-                UsePKI          bool   `json:"usePKI"`
-                ClientCertPath  string `json:"clientCertPath"`
-                ClientKeyPath   string `json:"clientKeyPath"`
-                SkipTLSVerify   bool   `json:"skipTLSVerify"`
-                CustomRootCAPath string `json:"customRootCAPath"`
-        }
+// websiteRequest is the body of requests that add or update a website
+type websiteRequest struct {
+        URL              string                  `json:"url"`
+        Name             string                  `json:"name"`
+        UsePKI           bool                    `json:"usePKI"`
+        ClientCertPath   string                  `json:"clientCertPath"`
+        ClientKeyPath    string                  `json:"clientKeyPath"`
+        SkipTLSVerify    bool                    `json:"skipTLSVerify"`
+        CustomRootCAPath string                  `json:"customRootCAPath"`
+        IntervalSeconds  int                     `json:"intervalSeconds"`
+        Selectors        []string                `json:"selectors"`
+        Tags             []string                `json:"tags"`
+        Group            string                  `json:"group"`
+        Method           string                  `json:"method"`
+        Headers          map[string]string       `json:"headers"`
+        Query            map[string]string       `json:"query"`
+        Body             string                  `json:"body"`
+        Auth             *monitor.AuthConfig     `json:"auth"`
+        Proxy            *monitor.ProxyConfig    `json:"proxy"`
+        Redirects        *monitor.RedirectPolicy `json:"redirects"`
+        Steps            []monitor.Step          `json:"steps"`
+        Owner            string                  `json:"owner"` // Only admins may set the owner
+}
+
+// parseWebsiteRequest decodes and validates a website configuration from the
+// request body, writing an error response and returning nil if it is invalid
+func parseWebsiteRequest(w http.ResponseWriter, r *http.Request) *monitor.Website {
+        var data websiteRequest
 
         // Parse the request body
         err := json.NewDecoder(r.Body).Decode(&data)
         if err != nil {
                 http.Error(w, "Invalid request format", http.StatusBadRequest)
-                return
+                return nil
         }
 
-        // Validate inputs
-        if data.URL == "" {
-                http.Error(w, "URL is required", http.StatusBadRequest)
-                return
+        config := &monitor.Website{
+                URL:             data.URL,
+                Name:            data.Name,
+                UsePKI:          data.UsePKI,
+                IntervalSeconds: data.IntervalSeconds,
+                Selectors:       data.Selectors,
+                Tags:            data.Tags,
+                Group:           data.Group,
+                Method:          data.Method,
+                Headers:         data.Headers,
+                Query:           data.Query,
+                Body:            data.Body,
+                Auth:            data.Auth,
+                Proxy:           data.Proxy,
+                Redirects:       data.Redirects,
+                Steps:           data.Steps,
+                Owner:           data.Owner,
+        }
+
+        // PKI settings only apply when PKI is enabled
+        if data.UsePKI {
+                config.ClientCertPath = data.ClientCertPath
+                config.ClientKeyPath = data.ClientKeyPath
+                config.SkipTLSVerify = data.SkipTLSVerify
+                config.CustomRootCAPath = data.CustomRootCAPath
+        }
+
+        // Validate inputs, which also normalizes the URL
+        if err := config.Validate(); err != nil {
+                writeValidationError(w, http.StatusBadRequest, err)
+                return nil
         }
 
         // Set default name if not provided
-        if data.Name == "" {
-                data.Name = data.URL
+        if config.Name == "" {
+                config.Name = config.URL
+        }
+
+        return config
+}
+
+// checkURL writes an error response and returns false if the website's URL
+// duplicates the URL of a website other than exceptID, or if the egress
+// policy refuses any of the URLs it connects to
+func (h *Handlers) checkURL(w http.ResponseWriter, config *monitor.Website, exceptID int) bool {
+        if duplicate := h.Monitor.FindDuplicate(config.URL, exceptID); duplicate != nil {
+                message := fmt.Sprintf("URL is already monitored as website %d", duplicate.ID)
+                writeValidationError(w, http.StatusConflict, monitor.NewValidationError("url", monitor.CodeDuplicate, message))
+                return false
+        }
+        if err := h.checkEgress(config); err != nil {
+                writeValidationError(w, http.StatusBadRequest, err)
+                return false
+        }
+        return true
+}
+
+// checkEgress returns a validation error if the egress policy refuses the
+// website's URL, OAuth2 token URL, login URL, proxy or absolute step URLs.
+// Step URLs built from templates are only checked when the steps run.
+func (h *Handlers) checkEgress(config *monitor.Website) error {
+        if err := h.Monitor.CheckURL(config.URL); err != nil {
+                return monitor.NewValidationError("url", monitor.CodePolicy, "URL rejected: "+err.Error())
+        }
+        if config.Auth != nil && config.Auth.Type == monitor.AuthOAuth2 {
+                if err := h.Monitor.CheckURL(config.Auth.TokenURL); err != nil {
+                        return monitor.NewValidationError("auth.tokenURL", monitor.CodePolicy, "Token URL rejected: "+err.Error())
+                }
+        }
+        if config.Auth != nil && config.Auth.Type == monitor.AuthForm {
+                if err := h.Monitor.CheckURL(config.Auth.LoginURL); err != nil {
+                        return monitor.NewValidationError("auth.loginURL", monitor.CodePolicy, "Login URL rejected: "+err.Error())
+                }
+        }
+        if err := h.Monitor.CheckProxy(config.Proxy); err != nil {
+                return monitor.NewValidationError("proxy.url", monitor.CodePolicy, "Proxy rejected: "+err.Error())
+        }
+        for i, step := range config.Steps {
+                if u, err := url.Parse(step.URL); err == nil && u.IsAbs() && !strings.Contains(step.URL, "{{") {
+                        if err := h.Monitor.CheckURL(step.URL); err != nil {
+                                return monitor.NewValidationError("steps", monitor.CodePolicy, fmt.Sprintf("Step %d: URL rejected: %v", i+1, err))
+                        }
+                }
         }
+        return nil
+}
 
-        // Check for client certificate if PKI is enabled
-        if data.UsePKI && data.ClientCertPath != "" && data.ClientKeyPath == "" {
-                http.Error(w, "Client key path is required when client certificate is provided", http.StatusBadRequest)
+// writeValidationError writes err with the given status. Validation errors
+// are sent as JSON listing every invalid field; other errors as plain text.
+func writeValidationError(w http.ResponseWriter, status int, err error) {
+        var validationErr *monitor.ValidationError
+        if !errors.As(err, &validationErr) {
+                http.Error(w, err.Error(), status)
                 return
         }
+        w.Header().Set("Content-Type", "application/json")
+        w.WriteHeader(status)
+        json.NewEncoder(w).Encode(struct {
+                Error  string               `json:"error"`
+                Errors []monitor.FieldError `json:"errors"`
+        }{validationErr.Error(), validationErr.Errors})
+}
 
-        if data.UsePKI && data.ClientKeyPath != "" && data.ClientCertPath == "" {
-                http.Error(w, "Client certificate path is required when client key is provided", http.StatusBadRequest)
+// AddWebsite adds a new website to monitor, owned by the caller
+func (h *Handlers) AddWebsite(w http.ResponseWriter, r *http.Request) {
+        if !h.requireRole(w, r, auth.RoleEditor) {
                 return
         }
 
-        // Add the website to the monitor with PKI configuration if needed
-        var website *monitor.Website
-        if data.UsePKI {
-                website = h.Monitor.AddWebsiteWithPKI(
-                        data.URL, 
-                        data.Name, 
-                        data.UsePKI, 
-                        data.ClientCertPath, 
-                        data.ClientKeyPath, 
-                        data.SkipTLSVerify, 
-                        data.CustomRootCAPath,
-                )
-        } else {
-                website = h.Monitor.AddWebsite(data.URL, data.Name)
+        config := parseWebsiteRequest(w, r)
+        if config == nil {
+                return
+        }
+        if !h.checkOwner(w, r, config.Owner, "") {
+                return
+        }
+        if err := h.validateCertPaths(config); err != nil {
+                writeValidationError(w, http.StatusBadRequest, err)
+                return
+        }
+        if !h.checkURL(w, config, 0) {
+                return
         }
+        if config.Owner == "" {
+                config.Owner = principal(r).User
+        }
+
+        website := h.Monitor.AddConfiguredWebsite(config)
+        h.recordChange(r, audit.ActionCreate, audit.ResourceWebsite, website.ID, nil, website)
 
         // Return the new website as JSON
         w.Header().Set("Content-Type", "application/json")
@@ -121,37 +290,111 @@ func (h *Handlers) AddWebsite(w http.ResponseWriter, r *http.Request) {
         json.NewEncoder(w).Encode(website)
 }
 
+// UpdateWebsite replaces the configuration of a monitored website. Moving it
+// to another group requires access to that group too, unless the caller owns
+// the website.
+func (h *Handlers) UpdateWebsite(w http.ResponseWriter, r *http.Request) {
+        existing := h.editableWebsite(w, r)
+        if existing == nil {
+                return
+        }
+
+        config := parseWebsiteRequest(w, r)
+        if config == nil {
+                return
+        }
+        if !principal(r).CanEdit(existing.Owner, monitor.CleanGroup(config.Group)) {
+                http.Error(w, "You don't have access to group "+config.Group, http.StatusForbidden)
+                return
+        }
+        if !h.checkOwner(w, r, config.Owner, existing.Owner) {
+                return
+        }
+        if err := h.validateCertPaths(config); err != nil {
+                writeValidationError(w, http.StatusBadRequest, err)
+                return
+        }
+        if !h.checkURL(w, config, existing.ID) {
+                return
+        }
+        if config.Owner != "" && config.Owner != existing.Owner {
+                h.Monitor.SetOwner(existing.ID, config.Owner)
+        }
+
+        website := h.Monitor.UpdateWebsite(existing.ID, config)
+        if website == nil {
+                http.Error(w, "Website not found", http.StatusNotFound)
+                return
+        }
+        h.recordChange(r, audit.ActionUpdate, audit.ResourceWebsite, website.ID, existing, website)
+
+        w.Header().Set("Content-Type", "application/json")
+        json.NewEncoder(w).Encode(website)
+}
+
 // RemoveWebsite removes a website from monitoring
 func (h *Handlers) RemoveWebsite(w http.ResponseWriter, r *http.Request) {
-        vars := mux.Vars(r)
-        id, err := strconv.Atoi(vars["id"])
-        if err != nil {
-                http.Error(w, "Invalid ID format", http.StatusBadRequest)
+        website := h.editableWebsite(w, r)
+        if website == nil {
                 return
         }
 
         // Try to remove the website from memory
-        success := h.Monitor.RemoveWebsite(id)
+        success := h.removeWebsite(website.ID)
         if !success {
                 http.Error(w, "Website not found", http.StatusNotFound)
                 return
         }
+        h.recordChange(r, audit.ActionDelete, audit.ResourceWebsite, website.ID, website, nil)
 
-        // Delete from database if delete function is provided
-        if h.deleteFromDB != nil {
-                if err := h.deleteFromDB(id); err != nil {
-                        // Log the error but don't fail the request since the website 
+        // Return success
+        w.WriteHeader(http.StatusNoContent)
+}
+
+// removeWebsite removes a website from the monitor and the database,
+// reporting whether it was being monitored
+func (h *Handlers) removeWebsite(id int) bool {
+        if !h.Monitor.RemoveWebsite(id) {
+                return false
+        }
+
+        // Delete from database if a store is provided
+        if h.store != nil {
+                if err := h.store.DeleteWebsite(id); err != nil {
+                        // Log the error but don't fail the request since the website
                         // is already removed from memory
                         log.Printf("Error deleting website %d from database: %v", id, err)
                 }
         }
-
-        // Return success
-        w.WriteHeader(http.StatusNoContent)
+        return true
 }
 
 // CheckWebsite manually triggers a check for a specific website
 func (h *Handlers) CheckWebsite(w http.ResponseWriter, r *http.Request) {
+        existing := h.editableWebsite(w, r)
+        if existing == nil {
+                return
+        }
+
+        // Check the website; nil means it was removed in the meantime
+        website := h.Monitor.CheckWebsite(existing.ID)
+        if website == nil {
+                http.Error(w, "Website not found", http.StatusNotFound)
+                return
+        }
+
+        // Return the updated website
+        w.Header().Set("Content-Type", "application/json")
+        json.NewEncoder(w).Encode(website)
+}
+
+// GetHistory returns the check history of a website as JSON. The optional
+// limit query parameter restricts the result to the most recent entries.
+func (h *Handlers) GetHistory(w http.ResponseWriter, r *http.Request) {
+        if !h.requireRole(w, r, auth.RoleViewer) {
+                return
+        }
+
         vars := mux.Vars(r)
         id, err := strconv.Atoi(vars["id"])
         if err != nil {
@@ -159,23 +402,43 @@ func (h *Handlers) CheckWebsite(w http.ResponseWriter, r *http.Request) {
                 return
         }
 
-        // Find the website
-        website := h.Monitor.GetWebsiteByID(id)
-        if website == nil {
+        limit := 0
+        if value := r.URL.Query().Get("limit"); value != "" {
+                limit, err = strconv.Atoi(value)
+                if err != nil || limit < 0 {
+                        http.Error(w, "Invalid limit", http.StatusBadRequest)
+                        return
+                }
+        }
+
+        if h.Monitor.GetWebsiteByID(id) == nil {
                 http.Error(w, "Website not found", http.StatusNotFound)
                 return
         }
 
-        // Check the website
-        h.Monitor.CheckWebsite(website)
+        entries := []*monitor.HistoryEntry{}
+        if h.store != nil {
+                loaded, err := h.store.GetHistory(id, limit)
+                if err != nil {
+                        log.Printf("Error loading history for website %d: %v", id, err)
+                        http.Error(w, "Failed to load history", http.StatusInternalServerError)
+                        return
+                }
+                if loaded != nil {
+                        entries = loaded
+                }
+        }
 
-        // Return the updated website
         w.Header().Set("Content-Type", "application/json")
-        json.NewEncoder(w).Encode(website)
+        json.NewEncoder(w).Encode(entries)
 }
 
 // UploadCertificate handles certificate file uploads
 func (h *Handlers) UploadCertificate(w http.ResponseWriter, r *http.Request) {
+        if !h.requireRole(w, r, auth.RoleEditor) {
+                return
+        }
+
         // Limit file size to 5MB
         r.ParseMultipartForm(5 << 20)
         
@@ -201,8 +464,8 @@ func (h *Handlers) UploadCertificate(w http.ResponseWriter, r *http.Request) {
                 return
         }
         
-        // Get the current executable directory or use a default location
-        certsDir := "./certs"
+        // Save certificates in the workspace's directory
+        certsDir := h.certsDir()
         
         // Create a directory for certificates if it doesn't exist
         err = os.MkdirAll(certsDir, 0755)
@@ -230,6 +493,7 @@ func (h *Handlers) UploadCertificate(w http.ResponseWriter, r *http.Request) {
                 "filePath": filePath,
                 "type":     certType,
         }
+        h.recordChange(r, audit.ActionUpload, audit.ResourceCertificate, filePath, nil, response)
         
         w.Header().Set("Content-Type", "application/json")
         json.NewEncoder(w).Encode(response)
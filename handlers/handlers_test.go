@@ -0,0 +1,42 @@
+package handlers
+
+import (
+        "path/filepath"
+        "testing"
+
+        "website-monitor/audit"
+        "website-monitor/database"
+        "website-monitor/monitor"
+)
+
+// newTestHandlers returns handlers for the default workspace of a new
+// database, with a monitor that saves to it. Added websites are checked at
+// once, so tests should only add websites served by httptest.
+func newTestHandlers(t *testing.T) (*Handlers, *database.DB) {
+        t.Helper()
+        db, err := database.New(filepath.Join(t.TempDir(), "test.db"))
+        if err != nil {
+                t.Fatal(err)
+        }
+        t.Cleanup(func() { db.Close() })
+
+        // Checks started by adding websites may finish after the test
+        m := monitor.NewMonitor(func(website *monitor.Website) {
+                db.SaveWebsite(website)
+        })
+        return &Handlers{Monitor: m, store: db}, db
+}
+
+// auditEntries returns the audit log of the handlers' workspace, oldest
+// first
+func auditEntries(t *testing.T, db *database.DB) []*audit.Entry {
+        t.Helper()
+        entries, err := db.GetAuditEntries(&audit.Filter{})
+        if err != nil {
+                t.Fatal(err)
+        }
+        for i, j := 0, len(entries)-1; i < j; i, j = i+1, j-1 {
+                entries[i], entries[j] = entries[j], entries[i]
+        }
+        return entries
+}
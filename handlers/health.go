@@ -0,0 +1,142 @@
+package handlers
+
+import (
+        "encoding/json"
+        "fmt"
+        "net/http"
+        "time"
+
+        "website-monitor/auth"
+        "website-monitor/monitor"
+)
+
+// startedAt is when the process started, for reporting uptime
+var startedAt = time.Now()
+
+// healthCheck is the result of one readiness check
+type healthCheck struct {
+        Status string `json:"status"`
+        Detail string `json:"detail,omitempty"`
+}
+
+// healthResponse is the body of health and readiness responses
+type healthResponse struct {
+        Status        string                  `json:"status"`
+        UptimeSeconds float64                 `json:"uptimeSeconds"`
+        Checks        map[string]*healthCheck `json:"checks,omitempty"`
+        Scheduler     *monitor.SchedulerStats `json:"scheduler,omitempty"`
+}
+
+// writeHealth writes a health response, with 503 if it is not ok
+func writeHealth(w http.ResponseWriter, response *healthResponse) {
+        w.Header().Set("Content-Type", "application/json")
+        w.Header().Set("Cache-Control", "no-store")
+        if response.Status != "ok" {
+                w.WriteHeader(http.StatusServiceUnavailable)
+        }
+        json.NewEncoder(w).Encode(response)
+}
+
+// Healthz reports that the process is alive and serving requests
+func (h *Handlers) Healthz(w http.ResponseWriter, r *http.Request) {
+        writeHealth(w, &healthResponse{
+                Status:        "ok",
+                UptimeSeconds: time.Since(startedAt).Seconds(),
+        })
+}
+
+// Readyz returns a handler that reports whether the service is ready: the
+// database accepts writes, and in every workspace the scheduler has started
+// and has not stalled; see cycleStalled. Any failure answers 503, so a stuck
+// monitoring loop can be detected. It is public, so it reports only the
+// overall status; Readiness has the details.
+func (ws *Workspaces) Readyz(maxCycleAge time.Duration) http.HandlerFunc {
+        return func(w http.ResponseWriter, r *http.Request) {
+                status := "ok"
+                for _, h := range ws.all() {
+                        if readiness(h, maxCycleAge).Status != "ok" {
+                                status = "fail"
+                        }
+                }
+                writeHealth(w, &healthResponse{
+                        Status:        status,
+                        UptimeSeconds: time.Since(startedAt).Seconds(),
+                })
+        }
+}
+
+// Readiness returns a handler that reports the readiness checks and
+// scheduler statistics of the caller's workspace
+func (ws *Workspaces) Readiness(maxCycleAge time.Duration) http.HandlerFunc {
+        return ws.Handle(func(h *Handlers, w http.ResponseWriter, r *http.Request) {
+                if !h.requireRole(w, r, auth.RoleViewer) {
+                        return
+                }
+                writeHealth(w, readiness(h, maxCycleAge))
+        })
+}
+
+// readiness checks the database and the scheduler of a workspace
+func readiness(h *Handlers, maxCycleAge time.Duration) *healthResponse {
+        now := time.Now()
+        stats := h.Monitor.SchedulerStats()
+        response := &healthResponse{
+                Status:        "ok",
+                UptimeSeconds: now.Sub(startedAt).Seconds(),
+                Checks:        map[string]*healthCheck{},
+                Scheduler:     &stats,
+        }
+        check := func(name string, err error) {
+                if err != nil {
+                        response.Checks[name] = &healthCheck{Status: "fail", Detail: err.Error()}
+                        response.Status = "fail"
+                        return
+                }
+                response.Checks[name] = &healthCheck{Status: "ok"}
+        }
+
+        var dbErr error
+        if h.store == nil {
+                dbErr = fmt.Errorf("no database configured")
+        } else {
+                dbErr = h.store.CheckWritable()
+        }
+        check("database", dbErr)
+
+        var schedulerErr error
+        if stats.LastCycleStarted.IsZero() {
+                schedulerErr = fmt.Errorf("scheduler has not started")
+        }
+        check("scheduler", schedulerErr)
+        check("lastCycle", cycleStalled(stats, now, maxCycleAge))
+        return response
+}
+
+// cycleStalled reports whether scheduling has stalled: no cycle has
+// completed, none started within maxCycleAge of the last one completing, or
+// the running one has taken maxCycleAge longer than its slowest check can
+func cycleStalled(stats monitor.SchedulerStats, now time.Time, maxCycleAge time.Duration) error {
+        if stats.LastCycleCompleted.IsZero() {
+                return fmt.Errorf("no check cycle has completed yet")
+        }
+        if stats.LastCycleStarted.After(stats.LastCycleCompleted) {
+                budget := time.Duration(stats.CycleBudget * float64(time.Second))
+                if running := now.Sub(stats.LastCycleStarted); running > budget+maxCycleAge {
+                        return fmt.Errorf("check cycle has run for %s, more than its checks can take (%s)", running.Round(time.Second), budget)
+                }
+                return nil
+        }
+        if idle := now.Sub(stats.LastCycleCompleted); idle > maxCycleAge {
+                return fmt.Errorf("last check cycle completed %s ago, more than %s", idle.Round(time.Second), maxCycleAge)
+        }
+        return nil
+}
+
+// ServeMetrics serves the Prometheus metrics of the workspace
+func (h *Handlers) ServeMetrics(w http.ResponseWriter, r *http.Request) {
+        if h.Metrics == nil {
+                http.Error(w, "Metrics are not configured", http.StatusNotFound)
+                return
+        }
+        h.Metrics.ServeHTTP(w, r)
+}
@@ -0,0 +1,96 @@
+package handlers
+
+import (
+        "encoding/json"
+        "net/http"
+        "net/http/httptest"
+        "strings"
+        "testing"
+        "time"
+
+        "website-monitor/auth"
+        "website-monitor/monitor"
+)
+
+func TestReadyzOnlyReportsDetailsToViewers(t *testing.T) {
+        h, db := newTestHandlers(t)
+        ws := NewWorkspaces(h, nil, nil)
+        sales := &Handlers{Monitor: monitor.NewMonitor(nil), Workspace: "sales", store: db}
+        ws.workspaces["sales"] = &auth.Workspace{Name: "sales"}
+        ws.handlers["sales"] = sales
+
+        get := func(handler http.HandlerFunc, r *http.Request) (int, string) {
+                w := httptest.NewRecorder()
+                handler(w, r)
+                return w.Code, w.Body.String()
+        }
+
+        // The sales scheduler has not started
+        h.Monitor.CheckDueWebsites()
+        code, body := get(ws.Readyz(time.Minute), httptest.NewRequest("GET", "/readyz", nil))
+        if code != http.StatusServiceUnavailable {
+                t.Errorf("status = %d, want %d", code, http.StatusServiceUnavailable)
+        }
+        var response map[string]interface{}
+        if err := json.Unmarshal([]byte(body), &response); err != nil {
+                t.Fatal(err)
+        }
+        if response["status"] != "fail" || response["checks"] != nil || response["scheduler"] != nil || strings.Contains(body, "sales") {
+                t.Errorf("public readiness = %s, want only the overall status", body)
+        }
+
+        sales.Monitor.CheckDueWebsites()
+        if code, body := get(ws.Readyz(time.Minute), httptest.NewRequest("GET", "/readyz", nil)); code != http.StatusOK {
+                t.Errorf("status = %d, want %d: %s", code, http.StatusOK, body)
+        }
+
+        if code, _ := get(ws.Readiness(time.Minute), httptest.NewRequest("GET", "/api/readiness", nil)); code != http.StatusUnauthorized {
+                t.Errorf("status without authentication = %d, want %d", code, http.StatusUnauthorized)
+        }
+        viewer := &auth.Principal{User: "vera", Role: auth.RoleViewer, Workspace: "sales", Scope: auth.ScopeRead}
+        code, body = get(ws.Readiness(time.Minute), requestAs("GET", "/api/readiness", viewer))
+        if code != http.StatusOK || !strings.Contains(body, `"lastCycle"`) || !strings.Contains(body, `"scheduler"`) {
+                t.Errorf("readiness for a viewer = %d %s, want the checks of the workspace", code, body)
+        }
+}
+
+func TestCycleStalled(t *testing.T) {
+        now := time.Now()
+        maxCycleAge := 90 * time.Second
+
+        tests := []struct {
+                name    string
+                stats   monitor.SchedulerStats
+                stalled bool
+        }{
+                {"no cycle yet", monitor.SchedulerStats{LastCycleStarted: now.Add(-time.Second)}, true},
+                {"idle after a cycle", monitor.SchedulerStats{
+                        LastCycleStarted:   now.Add(-40 * time.Second),
+                        LastCycleCompleted: now.Add(-30 * time.Second),
+                }, false},
+                {"no cycle started since", monitor.SchedulerStats{
+                        LastCycleStarted:   now.Add(-10 * time.Minute),
+                        LastCycleCompleted: now.Add(-5 * time.Minute),
+                }, true},
+                // A transaction of ten steps may run for ten client timeouts
+                {"slow checks within their budget", monitor.SchedulerStats{
+                        LastCycleStarted:   now.Add(-8 * time.Minute),
+                        LastCycleCompleted: now.Add(-9 * time.Minute),
+                        CycleBudget:        (10 * time.Minute).Seconds(),
+                }, false},
+                {"checks past their budget", monitor.SchedulerStats{
+                        LastCycleStarted:   now.Add(-5 * time.Minute),
+                        LastCycleCompleted: now.Add(-6 * time.Minute),
+                        CycleBudget:        time.Minute.Seconds(),
+                }, true},
+        }
+
+        for _, test := range tests {
+                t.Run(test.name, func(t *testing.T) {
+                        err := cycleStalled(test.stats, now, maxCycleAge)
+                        if stalled := err != nil; stalled != test.stalled {
+                                t.Errorf("cycleStalled() = %v, want stalled %v", err, test.stalled)
+                        }
+                })
+        }
+}
@@ -0,0 +1,196 @@
+package handlers
+
+import (
+        "encoding/json"
+        "log"
+        "net/http"
+        "strconv"
+        "time"
+
+        "website-monitor/audit"
+        "website-monitor/auth"
+        "website-monitor/monitor"
+        "github.com/gorilla/mux"
+)
+
+// parsePauseRequest reads the optional body of a pause request, which may set
+// "until" to an RFC 3339 time or "duration" to a Go duration such as "2h".
+// An empty body pauses indefinitely. It writes an error response and returns
+// false if the body is invalid.
+func parsePauseRequest(w http.ResponseWriter, r *http.Request) (time.Time, bool) {
+        var data struct {
+                Until    time.Time `json:"until"`
+                Duration string    `json:"duration"`
+        }
+        if r.ContentLength != 0 {
+                if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+                        http.Error(w, "Invalid request format", http.StatusBadRequest)
+                        return time.Time{}, false
+                }
+        }
+
+        until := data.Until
+        if data.Duration != "" {
+                if !until.IsZero() {
+                        http.Error(w, "Set either until or duration, not both", http.StatusBadRequest)
+                        return time.Time{}, false
+                }
+                duration, err := time.ParseDuration(data.Duration)
+                if err != nil || duration <= 0 {
+                        http.Error(w, "Invalid duration", http.StatusBadRequest)
+                        return time.Time{}, false
+                }
+                until = time.Now().Add(duration)
+        }
+        if !until.IsZero() && !until.After(time.Now()) {
+                http.Error(w, "Pause end must be in the future", http.StatusBadRequest)
+                return time.Time{}, false
+        }
+        return until, true
+}
+
+// PauseWebsite pauses scheduled checks of a website, optionally until a given
+// time; see parsePauseRequest
+func (h *Handlers) PauseWebsite(w http.ResponseWriter, r *http.Request) {
+        until, ok := parsePauseRequest(w, r)
+        if !ok {
+                return
+        }
+        h.setWebsitePaused(w, r, true, until)
+}
+
+// ResumeWebsite resumes scheduled checks of a website
+func (h *Handlers) ResumeWebsite(w http.ResponseWriter, r *http.Request) {
+        h.setWebsitePaused(w, r, false, time.Time{})
+}
+
+// setWebsitePaused implements PauseWebsite and ResumeWebsite
+func (h *Handlers) setWebsitePaused(w http.ResponseWriter, r *http.Request, paused bool, until time.Time) {
+        existing := h.editableWebsite(w, r)
+        if existing == nil {
+                return
+        }
+
+        website := h.Monitor.SetPaused(existing.ID, paused, until)
+        if website == nil {
+                http.Error(w, "Website not found", http.StatusNotFound)
+                return
+        }
+        action := audit.ActionResume
+        if paused {
+                action = audit.ActionPause
+        }
+        h.recordChange(r, action, audit.ResourceWebsite, website.ID, existing, website)
+
+        w.Header().Set("Content-Type", "application/json")
+        json.NewEncoder(w).Encode(website)
+}
+
+// requireMaintenanceWindow writes a 403 response and returns false unless the
+// caller may manage every website the window covers. Windows covering all
+// websites need the admin role.
+func (h *Handlers) requireMaintenanceWindow(w http.ResponseWriter, r *http.Request, window *monitor.MaintenanceWindow) bool {
+        if len(window.WebsiteIDs) == 0 && window.Group == "" {
+                return h.requireRole(w, r, auth.RoleAdmin)
+        }
+        if window.Group != "" && !h.requireGroup(w, r, monitor.CleanGroup(window.Group)) {
+                return false
+        }
+        for _, id := range window.WebsiteIDs {
+                // Websites removed since the window was scheduled don't matter
+                if website := h.Monitor.GetWebsiteByID(id); website != nil && !h.requireWebsite(w, r, website) {
+                        return false
+                }
+        }
+        return true
+}
+
+// GetMaintenanceWindows lists all maintenance windows. With active=true only
+// windows in progress now are returned.
+func (h *Handlers) GetMaintenanceWindows(w http.ResponseWriter, r *http.Request) {
+        if !h.requireRole(w, r, auth.RoleViewer) {
+                return
+        }
+
+        activeOnly := r.URL.Query().Get("active") == "true"
+        now := time.Now()
+
+        windows := []*monitor.MaintenanceWindow{}
+        for _, window := range h.Monitor.GetMaintenanceWindows() {
+                if !activeOnly || (!now.Before(window.Start) && now.Before(window.End)) {
+                        windows = append(windows, window)
+                }
+        }
+
+        w.Header().Set("Content-Type", "application/json")
+        json.NewEncoder(w).Encode(windows)
+}
+
+// AddMaintenanceWindow schedules a maintenance window
+func (h *Handlers) AddMaintenanceWindow(w http.ResponseWriter, r *http.Request) {
+        var window monitor.MaintenanceWindow
+        if err := json.NewDecoder(r.Body).Decode(&window); err != nil {
+                http.Error(w, "Invalid request format", http.StatusBadRequest)
+                return
+        }
+        if err := window.Validate(); err != nil {
+                http.Error(w, err.Error(), http.StatusBadRequest)
+                return
+        }
+        for _, id := range window.WebsiteIDs {
+                if h.Monitor.GetWebsiteByID(id) == nil {
+                        http.Error(w, "Website not found: "+strconv.Itoa(id), http.StatusBadRequest)
+                        return
+                }
+        }
+        if !h.requireMaintenanceWindow(w, r, &window) {
+                return
+        }
+
+        added := h.Monitor.AddMaintenanceWindow(&window)
+        log.Printf("Scheduled maintenance window %d from %s to %s", added.ID, added.Start.Format(time.RFC3339), added.End.Format(time.RFC3339))
+        h.recordChange(r, audit.ActionCreate, audit.ResourceMaintenance, added.ID, nil, added)
+
+        w.Header().Set("Content-Type", "application/json")
+        w.WriteHeader(http.StatusCreated)
+        json.NewEncoder(w).Encode(added)
+}
+
+// RemoveMaintenanceWindow cancels a maintenance window
+func (h *Handlers) RemoveMaintenanceWindow(w http.ResponseWriter, r *http.Request) {
+        vars := mux.Vars(r)
+        id, err := strconv.Atoi(vars["id"])
+        if err != nil {
+                http.Error(w, "Invalid ID format", http.StatusBadRequest)
+                return
+        }
+
+        var window *monitor.MaintenanceWindow
+        for _, existing := range h.Monitor.GetMaintenanceWindows() {
+                if existing.ID == id {
+                        window = existing
+                }
+        }
+        if window == nil {
+                http.Error(w, "Maintenance window not found", http.StatusNotFound)
+                return
+        }
+        if !h.requireMaintenanceWindow(w, r, window) {
+                return
+        }
+
+        if !h.Monitor.RemoveMaintenanceWindow(id) {
+                http.Error(w, "Maintenance window not found", http.StatusNotFound)
+                return
+        }
+
+        // Delete from database if a store is provided
+        if h.store != nil {
+                if err := h.store.DeleteMaintenanceWindow(id); err != nil {
+                        log.Printf("Error deleting maintenance window %d from database: %v", id, err)
+                }
+        }
+        h.recordChange(r, audit.ActionDelete, audit.ResourceMaintenance, id, window, nil)
+
+        w.WriteHeader(http.StatusNoContent)
+}
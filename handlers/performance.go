@@ -0,0 +1,113 @@
+package handlers
+
+import (
+        "encoding/json"
+        "errors"
+        "fmt"
+        "log"
+        "net/http"
+        "net/url"
+        "strconv"
+        "strings"
+        "time"
+
+        "website-monitor/auth"
+        "website-monitor/monitor"
+        "github.com/gorilla/mux"
+)
+
+// Defaults and limits of performance report parameters
+const (
+        defaultPeriod       = 24 * time.Hour
+        defaultTrendBuckets = 24
+        maxTrendBuckets     = 500
+)
+
+// parsePeriod returns the period a report covers from the query parameters
+// period, a duration such as "24h", "7d" or "30d" ending now, or since and
+// until (RFC3339) for a custom period. Without until, the period ends now;
+// with until but not since, it is the period before until.
+func parsePeriod(query url.Values, now time.Time) (time.Time, time.Time, error) {
+        length := defaultPeriod
+        if value := query.Get("period"); value != "" {
+                var err error
+                if days, ok := strings.CutSuffix(value, "d"); ok {
+                        var n int
+                        n, err = strconv.Atoi(days)
+                        length = time.Duration(n) * 24 * time.Hour
+                } else {
+                        length, err = time.ParseDuration(value)
+                }
+                if err != nil || length <= 0 {
+                        return time.Time{}, time.Time{}, errors.New("Invalid period, expected a duration such as 24h, 7d or 30d")
+                }
+        }
+
+        until := now
+        var since time.Time
+        for name, field := range map[string]*time.Time{"since": &since, "until": &until} {
+                if value := query.Get(name); value != "" {
+                        parsed, err := time.Parse(time.RFC3339, value)
+                        if err != nil {
+                                return time.Time{}, time.Time{}, fmt.Errorf("Invalid %s time, expected RFC3339", name)
+                        }
+                        *field = parsed
+                }
+        }
+        if since.IsZero() {
+                since = until.Add(-length)
+        }
+        if !since.Before(until) {
+                return time.Time{}, time.Time{}, errors.New("The period must start before it ends")
+        }
+        return since, until, nil
+}
+
+// GetPerformance returns the response time percentiles of a website over a
+// period, broken down into DNS, connect, TLS, time to first byte and
+// transfer, and their trend. The period is chosen as described for
+// parsePeriod; buckets sets how many intervals the trend has.
+func (h *Handlers) GetPerformance(w http.ResponseWriter, r *http.Request) {
+        if !h.requireRole(w, r, auth.RoleViewer) {
+                return
+        }
+
+        id, err := strconv.Atoi(mux.Vars(r)["id"])
+        if err != nil {
+                http.Error(w, "Invalid ID format", http.StatusBadRequest)
+                return
+        }
+
+        query := r.URL.Query()
+        since, until, err := parsePeriod(query, time.Now())
+        if err != nil {
+                http.Error(w, err.Error(), http.StatusBadRequest)
+                return
+        }
+        buckets := defaultTrendBuckets
+        if value := query.Get("buckets"); value != "" {
+                buckets, err = strconv.Atoi(value)
+                if err != nil || buckets < 1 || buckets > maxTrendBuckets {
+                        http.Error(w, fmt.Sprintf("Invalid buckets, expected 1 to %d", maxTrendBuckets), http.StatusBadRequest)
+                        return
+                }
+        }
+
+        if h.Monitor.GetWebsiteByID(id) == nil {
+                http.Error(w, "Website not found", http.StatusNotFound)
+                return
+        }
+
+        var entries []*monitor.HistoryEntry
+        if h.store != nil {
+                entries, err = h.store.GetHistorySince(id, since)
+                if err != nil {
+                        log.Printf("Error loading history for website %d: %v", id, err)
+                        http.Error(w, "Failed to load history", http.StatusInternalServerError)
+                        return
+                }
+        }
+
+        w.Header().Set("Content-Type", "application/json")
+        json.NewEncoder(w).Encode(monitor.NewPerformanceReport(id, entries, since, until, buckets))
+}
@@ -0,0 +1,122 @@
+package handlers
+
+import (
+        "encoding/json"
+        "errors"
+        "log"
+        "net/http"
+        "time"
+
+        "website-monitor/audit"
+        "website-monitor/auth"
+        "website-monitor/monitor"
+        "github.com/gorilla/mux"
+)
+
+// requireStore writes a 404 response and returns false when the handlers have
+// no database, since secrets are only kept there
+func (h *Handlers) requireStore(w http.ResponseWriter) bool {
+        if h.store == nil {
+                http.Error(w, "Secrets are not available without a database", http.StatusNotFound)
+                return false
+        }
+        return true
+}
+
+// GetSecrets lists the names of the workspace's secrets, never their values
+func (h *Handlers) GetSecrets(w http.ResponseWriter, r *http.Request) {
+        if !h.requireRole(w, r, auth.RoleViewer) || !h.requireStore(w) {
+                return
+        }
+
+        secrets, err := h.store.GetSecrets()
+        if err != nil {
+                log.Printf("Error loading secrets: %v", err)
+                http.Error(w, "Failed to load secrets", http.StatusInternalServerError)
+                return
+        }
+
+        w.Header().Set("Content-Type", "application/json")
+        json.NewEncoder(w).Encode(secrets)
+}
+
+// SetSecret creates or replaces a secret from a {"value": "..."} body. Any
+// editor can refer to secrets in request templates, so only admins may
+// change them.
+func (h *Handlers) SetSecret(w http.ResponseWriter, r *http.Request) {
+        if !h.requireRole(w, r, auth.RoleAdmin) || !h.requireStore(w) {
+                return
+        }
+
+        name := mux.Vars(r)["name"]
+        if err := monitor.ValidateSecretName(name); err != nil {
+                http.Error(w, err.Error(), http.StatusBadRequest)
+                return
+        }
+        var data struct {
+                Value string `json:"value"`
+        }
+        if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+                http.Error(w, "Invalid request format", http.StatusBadRequest)
+                return
+        }
+        if data.Value == "" {
+                http.Error(w, "Value is required", http.StatusBadRequest)
+                return
+        }
+
+        existing, err := h.store.GetSecret(name)
+        if err != nil && !errors.Is(err, monitor.ErrSecretNotFound) {
+                log.Printf("Error loading secret %s: %v", name, err)
+                http.Error(w, "Failed to save secret", http.StatusInternalServerError)
+                return
+        }
+
+        secret := &monitor.Secret{Name: name, Value: data.Value, UpdatedAt: time.Now(), UpdatedBy: principal(r).User}
+        if err := h.store.SaveSecret(secret); err != nil {
+                log.Printf("Error saving secret %s: %v", name, err)
+                http.Error(w, "Failed to save secret", http.StatusInternalServerError)
+                return
+        }
+
+        // Never record or return the value
+        secret.Value = ""
+        status, action := http.StatusCreated, audit.ActionCreate
+        var before *monitor.Secret
+        if existing != nil {
+                existing.Value = ""
+                status, action, before = http.StatusOK, audit.ActionUpdate, existing
+        }
+        h.recordChange(r, action, audit.ResourceSecret, name, before, secret)
+
+        w.Header().Set("Content-Type", "application/json")
+        w.WriteHeader(status)
+        json.NewEncoder(w).Encode(secret)
+}
+
+// DeleteSecret deletes a secret. Websites still referring to it fail their
+// checks with a configuration error.
+func (h *Handlers) DeleteSecret(w http.ResponseWriter, r *http.Request) {
+        if !h.requireRole(w, r, auth.RoleAdmin) || !h.requireStore(w) {
+                return
+        }
+
+        name := mux.Vars(r)["name"]
+        existing, err := h.store.GetSecret(name)
+        if errors.Is(err, monitor.ErrSecretNotFound) {
+                http.Error(w, "Secret not found", http.StatusNotFound)
+                return
+        }
+        if err == nil {
+                err = h.store.DeleteSecret(name)
+        }
+        if err != nil {
+                log.Printf("Error deleting secret %s: %v", name, err)
+                http.Error(w, "Failed to delete secret", http.StatusInternalServerError)
+                return
+        }
+        existing.Value = ""
+        h.recordChange(r, audit.ActionDelete, audit.ResourceSecret, name, existing, nil)
+
+        w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,83 @@
+package handlers
+
+import (
+        "fmt"
+
+        "website-monitor/audit"
+        "website-monitor/auth"
+        "website-monitor/monitor"
+)
+
+// SitesTarget is the sites.Target that applies the changes of a site definitions file to the
+// workspace's websites with the same checks as the API: certificate paths,
+// duplicate URLs and the egress policy. Every change is recorded in the audit
+// log as made by "sites-file:" and the file's path.
+type SitesTarget struct {
+        h      *Handlers
+        caller *auth.Principal
+}
+
+// SitesTarget returns the target reconciling the workspace against the site
+// definitions file at path
+func (h *Handlers) SitesTarget(path string) *SitesTarget {
+        return &SitesTarget{
+                h: h,
+                caller: &auth.Principal{
+                        User:      "sites-file:" + path,
+                        Role:      auth.RoleAdmin,
+                        Workspace: h.Workspace,
+                        Scope:     auth.ScopeAdmin,
+                        Method:    "sites-file",
+                },
+        }
+}
+
+// check returns an error if the API would refuse the configuration of the
+// website exceptID, or of a new website if it is zero
+func (t *SitesTarget) check(config *monitor.Website, exceptID int) error {
+        if err := t.h.validateCertPaths(config); err != nil {
+                return err
+        }
+        if duplicate := t.h.Monitor.FindDuplicate(config.URL, exceptID); duplicate != nil {
+                return fmt.Errorf("URL is already monitored as website %d", duplicate.ID)
+        }
+        return t.h.checkEgress(config)
+}
+
+// Add adds a website defined in the file
+func (t *SitesTarget) Add(config *monitor.Website) error {
+        if err := t.check(config, 0); err != nil {
+                return err
+        }
+        website := t.h.Monitor.AddConfiguredWebsite(config)
+        t.h.record(t.caller, audit.ActionCreate, audit.ResourceWebsite, website.ID, nil, website)
+        return nil
+}
+
+// Update replaces the configuration of a website with its definition
+func (t *SitesTarget) Update(id int, config *monitor.Website) error {
+        existing := t.h.Monitor.GetWebsiteByID(id)
+        if existing == nil {
+                return fmt.Errorf("website %d not found", id)
+        }
+        if err := t.check(config, id); err != nil {
+                return err
+        }
+        website := t.h.Monitor.UpdateWebsite(id, config)
+        if website == nil {
+                return fmt.Errorf("website %d not found", id)
+        }
+        t.h.record(t.caller, audit.ActionUpdate, audit.ResourceWebsite, id, existing, website)
+        return nil
+}
+
+// Remove stops monitoring a website that is no longer in the file and
+// deletes it from the database
+func (t *SitesTarget) Remove(id int) error {
+        existing := t.h.Monitor.GetWebsiteByID(id)
+        if existing == nil || !t.h.removeWebsite(id) {
+                return fmt.Errorf("website %d not found", id)
+        }
+        t.h.record(t.caller, audit.ActionDelete, audit.ResourceWebsite, id, existing, nil)
+        return nil
+}
@@ -0,0 +1,65 @@
+package handlers
+
+import (
+        "net/http"
+        "net/http/httptest"
+        "strings"
+        "testing"
+
+        "website-monitor/audit"
+        "website-monitor/monitor"
+        "website-monitor/sites"
+)
+
+func TestSitesTargetValidatesAndAudits(t *testing.T) {
+        server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+        defer server.Close()
+
+        h, db := newTestHandlers(t)
+        policy, err := monitor.NewEgressPolicy(monitor.DefaultEgressSchemes, []string{"127.0.0.1"}, monitor.DefaultDeniedNetworks)
+        if err != nil {
+                t.Fatal(err)
+        }
+        h.Monitor.SetEgressPolicy(policy)
+
+        kept := h.Monitor.AddConfiguredWebsite(&monitor.Website{URL: server.URL + "/kept", Name: "Old name"})
+        pruned := h.Monitor.AddConfiguredWebsite(&monitor.Website{URL: server.URL + "/pruned"})
+
+        desired, err := sites.Parse([]byte(`
+websites:
+  - url: ` + server.URL + `/kept
+    name: New name
+  - url: ` + server.URL + `/added
+  - url: http://10.0.0.1/
+`))
+        if err != nil {
+                t.Fatal(err)
+        }
+        plan := sites.Plan(h.Monitor.GetWebsites(), desired, true)
+        errs := sites.Apply(h.SitesTarget("sites.yaml"), plan)
+
+        if len(errs) != 1 || !strings.Contains(errs[0].Error(), "http://10.0.0.1/") {
+                t.Fatalf("errors = %v, want one for http://10.0.0.1/", errs)
+        }
+        if h.Monitor.FindDuplicate("http://10.0.0.1/", 0) != nil {
+                t.Error("website refused by the egress policy was added")
+        }
+        if got := h.Monitor.GetWebsiteByID(kept.ID).Name; got != "New name" {
+                t.Errorf("updated name = %q, want %q", got, "New name")
+        }
+        if h.Monitor.GetWebsiteByID(pruned.ID) != nil {
+                t.Error("website missing from the file was not pruned")
+        }
+
+        var actions []string
+        for _, entry := range auditEntries(t, db) {
+                if entry.User != "sites-file:sites.yaml" || entry.Method != "sites-file" || entry.Resource != audit.ResourceWebsite {
+                        t.Errorf("audit entry by %s (%s) for %s, want sites-file:sites.yaml (sites-file) for a website", entry.User, entry.Method, entry.Resource)
+                }
+                actions = append(actions, entry.Action+" "+entry.ResourceID)
+        }
+        want := []string{"update 1", "create 3", "delete 2"}
+        if strings.Join(actions, ", ") != strings.Join(want, ", ") {
+                t.Errorf("audit log = %v, want %v", actions, want)
+        }
+}
@@ -0,0 +1,309 @@
+package handlers
+
+import (
+        "encoding/csv"
+        "encoding/json"
+        "fmt"
+        "io"
+        "log"
+        "net/http"
+        "sort"
+        "strconv"
+        "time"
+
+        "website-monitor/auth"
+        "website-monitor/monitor"
+        "github.com/gorilla/mux"
+)
+
+// defaultSLATarget is the uptime percentage SLA reports compare against
+// unless the target query parameter sets another
+const defaultSLATarget = 99.9
+
+// slaCSVColumns are the columns of the CSV SLA report
+var slaCSVColumns = []string{
+        "websiteId", "name", "url", "uptimePercent", "met", "checks", "expectedChecks",
+        "coveragePercent", "failedChecks", "downtimeSeconds", "maintenanceSeconds",
+        "incidents", "longestIncidentSeconds",
+}
+
+// checkRetention returns an error if a report period starts before the
+// oldest history that is kept, since its uptime can't be known
+func checkRetention(since, now time.Time) error {
+        if since.Before(now.Add(-monitor.HistoryRetention)) {
+                return fmt.Errorf("History is only kept for %d days", int(monitor.HistoryRetention.Hours()/24))
+        }
+        return nil
+}
+
+// GetUptime returns the uptime of a website over a period, chosen as
+// described for parsePeriod, with the incidents in it
+func (h *Handlers) GetUptime(w http.ResponseWriter, r *http.Request) {
+        if !h.requireRole(w, r, auth.RoleViewer) {
+                return
+        }
+
+        id, err := strconv.Atoi(mux.Vars(r)["id"])
+        if err != nil {
+                http.Error(w, "Invalid ID format", http.StatusBadRequest)
+                return
+        }
+        now := time.Now()
+        since, until, err := parsePeriod(r.URL.Query(), now)
+        if err == nil {
+                err = checkRetention(since, now)
+        }
+        if err != nil {
+                http.Error(w, err.Error(), http.StatusBadRequest)
+                return
+        }
+
+        website := h.Monitor.GetWebsiteByID(id)
+        if website == nil {
+                http.Error(w, "Website not found", http.StatusNotFound)
+                return
+        }
+        report, err := h.uptimeReport(website, since, until)
+        if err != nil {
+                http.Error(w, "Failed to load history", http.StatusInternalServerError)
+                return
+        }
+
+        w.Header().Set("Content-Type", "application/json")
+        json.NewEncoder(w).Encode(report)
+}
+
+// uptimeReport computes a website's uptime from its stored history, at its
+// effective check interval
+func (h *Handlers) uptimeReport(website *monitor.Website, since, until time.Time) (*monitor.UptimeReport, error) {
+        var entries []*monitor.HistoryEntry
+        if h.store != nil {
+                var err error
+                if entries, err = h.store.GetHistorySince(website.ID, since); err != nil {
+                        log.Printf("Error loading history for website %d: %v", website.ID, err)
+                        return nil, err
+                }
+        }
+        return monitor.NewUptimeReport(website, entries, since, until, h.Monitor.EffectiveInterval(website)), nil
+}
+
+// GetSLAReport returns the monthly SLA report of every website, or of those
+// matching the group and tag query parameters as for GetWebsites. The month
+// parameter (such as 2026-09, in UTC) defaults to the previous month, target
+// sets the uptime percentage to meet, and format selects json (default), csv
+// or html, a page meant for printing.
+func (h *Handlers) GetSLAReport(w http.ResponseWriter, r *http.Request) {
+        if !h.requireRole(w, r, auth.RoleViewer) {
+                return
+        }
+
+        query := r.URL.Query()
+        now := time.Now().UTC()
+        since := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC).AddDate(0, -1, 0)
+        if value := query.Get("month"); value != "" {
+                parsed, err := time.ParseInLocation("2006-01", value, time.UTC)
+                if err != nil {
+                        http.Error(w, "Invalid month, expected YYYY-MM", http.StatusBadRequest)
+                        return
+                }
+                since = parsed
+        }
+        if since.After(now) {
+                http.Error(w, "The month has not started yet", http.StatusBadRequest)
+                return
+        }
+        if err := checkRetention(since, now); err != nil {
+                http.Error(w, err.Error(), http.StatusBadRequest)
+                return
+        }
+        until := since.AddDate(0, 1, 0)
+        if until.After(now) {
+                until = now
+        }
+
+        target := defaultSLATarget
+        if value := query.Get("target"); value != "" {
+                var err error
+                target, err = strconv.ParseFloat(value, 64)
+                if err != nil || target < 0 || target > 100 {
+                        http.Error(w, "Invalid target, expected a percentage", http.StatusBadRequest)
+                        return
+                }
+        }
+
+        format := query.Get("format")
+        if format == "" {
+                format = "json"
+        }
+        if format != "json" && format != "csv" && format != "html" {
+                http.Error(w, "Unsupported format: "+format, http.StatusBadRequest)
+                return
+        }
+
+        report := &monitor.SLAReport{
+                Month:         since.Format("2006-01"),
+                Since:         since,
+                Until:         until,
+                TargetPercent: target,
+                Websites:      []*monitor.SLAResult{},
+        }
+        websites := h.Monitor.GetWebsites()
+        sort.Slice(websites, func(i, j int) bool { return websites[i].ID < websites[j].ID })
+        for _, website := range websites {
+                if !website.HasTags(query["tag"]) || !website.InGroup(query.Get("group")) {
+                        continue
+                }
+                uptime, err := h.uptimeReport(website, since, until)
+                if err != nil {
+                        http.Error(w, "Failed to load history", http.StatusInternalServerError)
+                        return
+                }
+                report.Websites = append(report.Websites, monitor.NewSLAResult(uptime, target))
+        }
+
+        filename := "sla-" + report.Month
+        switch format {
+        case "csv":
+                w.Header().Set("Content-Type", "text/csv")
+                w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`.csv"`)
+                if err := writeSLACSV(w, report); err != nil {
+                        log.Printf("Error writing SLA report: %v", err)
+                }
+        case "html":
+                if err := h.tmpl.ExecuteTemplate(w, "sla.html", newSLAPage(report, now)); err != nil {
+                        log.Printf("Error rendering SLA report: %v", err)
+                }
+        default:
+                w.Header().Set("Content-Type", "application/json")
+                json.NewEncoder(w).Encode(report)
+        }
+}
+
+// writeSLACSV writes an SLA report as CSV with a header row and one row per
+// website. The uptime is empty for websites without checks, and met when
+// there is not enough data to tell.
+func writeSLACSV(w io.Writer, report *monitor.SLAReport) error {
+        cw := csv.NewWriter(w)
+        if err := cw.Write(slaCSVColumns); err != nil {
+                return err
+        }
+        for _, result := range report.Websites {
+                uptime, met := "", ""
+                if result.UptimePercent != nil {
+                        uptime = strconv.FormatFloat(*result.UptimePercent, 'f', 3, 64)
+                }
+                if result.Met != nil {
+                        met = strconv.FormatBool(*result.Met)
+                }
+                record := []string{
+                        strconv.Itoa(result.WebsiteID),
+                        result.Name,
+                        result.URL,
+                        uptime,
+                        met,
+                        strconv.Itoa(result.Checks),
+                        strconv.Itoa(result.ExpectedChecks),
+                        strconv.FormatFloat(result.CoveragePercent, 'f', 3, 64),
+                        strconv.Itoa(result.FailedChecks),
+                        strconv.FormatFloat(result.DowntimeSeconds, 'f', 0, 64),
+                        strconv.FormatFloat(result.MaintenanceSeconds, 'f', 0, 64),
+                        strconv.Itoa(len(result.Incidents)),
+                        strconv.FormatFloat(result.LongestIncident(), 'f', 0, 64),
+                }
+                if err := cw.Write(record); err != nil {
+                        return err
+                }
+        }
+        cw.Flush()
+        return cw.Error()
+}
+
+// slaPage is passed to the SLA report template, with values formatted for
+// reading
+type slaPage struct {
+        Month       string
+        Since       string
+        Until       string
+        Target      string
+        Generated   string
+        Met         int
+        Judged      int // Websites with enough checks to tell whether they met the target
+        MinCoverage string
+        Websites    []slaPageWebsite
+}
+
+// slaPageWebsite is one website's row in the SLA report page
+type slaPageWebsite struct {
+        Name      string
+        URL       string
+        Uptime    string
+        Status    string // Met, Missed or Insufficient data
+        Checks    int
+        Expected  int
+        Coverage  string
+        Downtime  string
+        Incidents []slaPageIncident
+}
+
+// slaPageIncident is one incident listed in the SLA report page
+type slaPageIncident struct {
+        Start    string
+        End      string
+        Duration string
+        Error    string
+}
+
+// newSLAPage formats an SLA report for the template
+func newSLAPage(report *monitor.SLAReport, generated time.Time) *slaPage {
+        const layout = "2006-01-02 15:04 MST"
+        page := &slaPage{
+                Month:       report.Since.Format("January 2006"),
+                Since:       report.Since.Format(layout),
+                Until:       report.Until.Format(layout),
+                Target:      strconv.FormatFloat(report.TargetPercent, 'f', -1, 64) + "%",
+                Generated:   generated.Format(layout),
+                MinCoverage: strconv.FormatFloat(monitor.MinCoveragePercent, 'f', -1, 64) + "%",
+        }
+        for _, result := range report.Websites {
+                row := slaPageWebsite{
+                        Name:     result.Name,
+                        URL:      result.URL,
+                        Uptime:   "No checks",
+                        Status:   "Insufficient data",
+                        Checks:   result.Checks,
+                        Expected: result.ExpectedChecks,
+                        Coverage: fmt.Sprintf("%.1f%%", result.CoveragePercent),
+                        Downtime: formatSeconds(result.DowntimeSeconds),
+                }
+                if result.UptimePercent != nil {
+                        row.Uptime = fmt.Sprintf("%.3f%%", *result.UptimePercent)
+                }
+                if result.Met != nil {
+                        page.Judged++
+                        row.Status = "Missed"
+                        if *result.Met {
+                                page.Met++
+                                row.Status = "Met"
+                        }
+                }
+                for _, incident := range result.Incidents {
+                        end := incident.End.Format(layout)
+                        if incident.Ongoing {
+                                end = "Ongoing"
+                        }
+                        row.Incidents = append(row.Incidents, slaPageIncident{
+                                Start:    incident.Start.Format(layout),
+                                End:      end,
+                                Duration: formatSeconds(incident.DurationSeconds),
+                                Error:    incident.Error,
+                        })
+                }
+                page.Websites = append(page.Websites, row)
+        }
+        return page
+}
+
+// formatSeconds formats a number of seconds as a duration such as 1h2m3s
+func formatSeconds(seconds float64) string {
+        return (time.Duration(seconds) * time.Second).String()
+}
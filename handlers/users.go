@@ -0,0 +1,164 @@
+package handlers
+
+import (
+        "encoding/json"
+        "log"
+        "net/http"
+        "sort"
+
+        "website-monitor/audit"
+        "website-monitor/auth"
+        "github.com/gorilla/mux"
+)
+
+// userRequest is the body of requests that create or update a user. When
+// updating, omitted fields are left unchanged.
+type userRequest struct {
+        Username string    `json:"username"`
+        Password *string   `json:"password"`
+        Role     *string   `json:"role"`
+        Groups   *[]string `json:"groups"`
+}
+
+// GetCurrentUser returns the caller's account along with how they
+// authenticated
+func (h *Handlers) GetCurrentUser(w http.ResponseWriter, r *http.Request) {
+        if !h.requireRole(w, r, auth.RoleViewer) {
+                return
+        }
+
+        w.Header().Set("Content-Type", "application/json")
+        json.NewEncoder(w).Encode(principal(r))
+}
+
+// GetUsers lists the users of the workspace
+func (h *Handlers) GetUsers(w http.ResponseWriter, r *http.Request) {
+        if !h.requireAuth(w) || !h.requireRole(w, r, auth.RoleAdmin) {
+                return
+        }
+
+        users := []*auth.User{}
+        for _, user := range h.Auth.Users() {
+                if auth.WorkspaceOf(user.Workspace) == auth.WorkspaceOf(h.Workspace) {
+                        users = append(users, user)
+                }
+        }
+        sort.Slice(users, func(i, j int) bool { return users[i].Username < users[j].Username })
+
+        w.Header().Set("Content-Type", "application/json")
+        json.NewEncoder(w).Encode(users)
+}
+
+// CreateUser adds a user to the workspace
+func (h *Handlers) CreateUser(w http.ResponseWriter, r *http.Request) {
+        if !h.requireAuth(w) || !h.requireRole(w, r, auth.RoleAdmin) {
+                return
+        }
+
+        var data userRequest
+        if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+                http.Error(w, "Invalid request format", http.StatusBadRequest)
+                return
+        }
+        if data.Password == nil {
+                http.Error(w, "Password is required", http.StatusBadRequest)
+                return
+        }
+        role := auth.RoleViewer
+        if data.Role != nil {
+                role = *data.Role
+        }
+        var groups []string
+        if data.Groups != nil {
+                groups = *data.Groups
+        }
+
+        user, err := h.Auth.CreateUser(data.Username, *data.Password, role, auth.WorkspaceOf(h.Workspace), groups)
+        if err != nil {
+                http.Error(w, err.Error(), http.StatusBadRequest)
+                return
+        }
+        log.Printf("Created %s user %s in workspace %s", user.Role, user.Username, auth.WorkspaceOf(user.Workspace))
+        h.recordChange(r, audit.ActionCreate, audit.ResourceUser, user.Username, nil, user)
+
+        w.Header().Set("Content-Type", "application/json")
+        w.WriteHeader(http.StatusCreated)
+        json.NewEncoder(w).Encode(user)
+}
+
+// UpdateUser changes a user's password, role or groups. Users may change
+// their own password; everything else needs the admin role.
+func (h *Handlers) UpdateUser(w http.ResponseWriter, r *http.Request) {
+        if !h.requireAuth(w) || !h.requireRole(w, r, auth.RoleViewer) {
+                return
+        }
+
+        username := mux.Vars(r)["username"]
+        var data userRequest
+        if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+                http.Error(w, "Invalid request format", http.StatusBadRequest)
+                return
+        }
+
+        ownPassword := username == principal(r).User && data.Role == nil && data.Groups == nil
+        if !ownPassword {
+                if !h.requireRole(w, r, auth.RoleAdmin) {
+                        return
+                }
+                if h.workspaceUser(username) == nil {
+                        http.Error(w, "User not found", http.StatusNotFound)
+                        return
+                }
+        }
+
+        before := h.Auth.User(username)
+        user, err := h.Auth.UpdateUser(username, auth.UserUpdate{
+                Password: data.Password,
+                Role:     data.Role,
+                Groups:   data.Groups,
+        })
+        if err != nil {
+                http.Error(w, err.Error(), http.StatusBadRequest)
+                return
+        }
+        if user == nil {
+                http.Error(w, "User not found", http.StatusNotFound)
+                return
+        }
+        log.Printf("Updated user %s", user.Username)
+        h.recordChange(r, audit.ActionUpdate, audit.ResourceUser, user.Username, before, struct {
+                *auth.User
+                PasswordChanged bool `json:"passwordChanged,omitempty"`
+        }{user, data.Password != nil})
+
+        w.Header().Set("Content-Type", "application/json")
+        json.NewEncoder(w).Encode(user)
+}
+
+// DeleteUser removes a user and revokes their tokens. Websites they own are
+// left in place for admins and group editors to manage.
+func (h *Handlers) DeleteUser(w http.ResponseWriter, r *http.Request) {
+        if !h.requireAuth(w) || !h.requireRole(w, r, auth.RoleAdmin) {
+                return
+        }
+
+        username := mux.Vars(r)["username"]
+        if h.workspaceUser(username) == nil {
+                http.Error(w, "User not found", http.StatusNotFound)
+                return
+        }
+        before := h.Auth.User(username)
+        found, err := h.Auth.DeleteUser(username)
+        if err != nil {
+                http.Error(w, err.Error(), http.StatusBadRequest)
+                return
+        }
+        if !found {
+                http.Error(w, "User not found", http.StatusNotFound)
+                return
+        }
+        log.Printf("Deleted user %s", username)
+        h.recordChange(r, audit.ActionDelete, audit.ResourceUser, username, before, nil)
+
+        w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,308 @@
+package handlers
+
+import (
+        "encoding/json"
+        "fmt"
+        "log"
+        "net/http"
+        "path/filepath"
+        "sort"
+        "strings"
+        "sync"
+        "time"
+
+        "website-monitor/audit"
+        "website-monitor/auth"
+        "website-monitor/monitor"
+        "github.com/gorilla/mux"
+)
+
+// WorkspaceHeader selects the workspace an instance admin acts in. The
+// workspace query parameter does the same for links and event streams.
+const WorkspaceHeader = "X-Workspace"
+
+// WorkspaceStore creates and deletes workspaces in the database
+type WorkspaceStore interface {
+        CreateWorkspace(workspace *auth.Workspace) error
+        DeleteWorkspace(name string) error
+}
+
+// OpenFunc starts serving a workspace: it loads its websites into a monitor,
+// starts checking them and returns the handlers for its requests
+type OpenFunc func(name string) (*Handlers, error)
+
+// Workspaces routes requests to the Handlers of the workspace they act in.
+// Each workspace has its own monitor, database buckets and certificate
+// directory, so one department never sees another's websites or history.
+type Workspaces struct {
+        store      WorkspaceStore
+        open       OpenFunc
+        mu         sync.RWMutex
+        workspaces map[string]*auth.Workspace
+        handlers   map[string]*Handlers
+}
+
+// NewWorkspaces creates a registry serving the default workspace with h
+func NewWorkspaces(h *Handlers, store WorkspaceStore, open OpenFunc) *Workspaces {
+        h.Workspace = auth.DefaultWorkspace
+        return &Workspaces{
+                store:      store,
+                open:       open,
+                workspaces: map[string]*auth.Workspace{auth.DefaultWorkspace: {Name: auth.DefaultWorkspace}},
+                handlers:   map[string]*Handlers{auth.DefaultWorkspace: h},
+        }
+}
+
+// AddExisting starts serving a workspace loaded from the database
+func (ws *Workspaces) AddExisting(workspace *auth.Workspace) error {
+        h, err := ws.open(workspace.Name)
+        if err != nil {
+                return err
+        }
+        h.Workspace = workspace.Name
+
+        ws.mu.Lock()
+        defer ws.mu.Unlock()
+        ws.workspaces[workspace.Name] = workspace
+        ws.handlers[workspace.Name] = h
+        return nil
+}
+
+// resolve returns the handlers of the workspace a request acts in: the
+// caller's own, or for instance admins the one they select. It writes an
+// error response and returns nil if that workspace can't be used.
+func (ws *Workspaces) resolve(w http.ResponseWriter, r *http.Request) *Handlers {
+        caller := principal(r)
+        if caller == nobody {
+                http.Error(w, "Authentication required", http.StatusUnauthorized)
+                return nil
+        }
+        name := r.Header.Get(WorkspaceHeader)
+        if name == "" {
+                name = r.URL.Query().Get("workspace")
+        }
+        if name == "" {
+                name = caller.Workspace
+        }
+        if name != caller.Workspace && !caller.IsInstanceAdmin() {
+                http.Error(w, "You don't have access to workspace "+name, http.StatusForbidden)
+                return nil
+        }
+
+        ws.mu.RLock()
+        h := ws.handlers[name]
+        ws.mu.RUnlock()
+        if h == nil {
+                http.Error(w, "Workspace not found: "+name, http.StatusNotFound)
+                return nil
+        }
+        return h
+}
+
+// Handle returns a handler that runs a Handlers method, such as
+// (*Handlers).GetWebsites, in the workspace of each request
+func (ws *Workspaces) Handle(method func(*Handlers, http.ResponseWriter, *http.Request)) http.HandlerFunc {
+        return func(w http.ResponseWriter, r *http.Request) {
+                if h := ws.resolve(w, r); h != nil {
+                        method(h, w, r)
+                }
+        }
+}
+
+// all returns the handlers of every workspace, the default one first
+func (ws *Workspaces) all() []*Handlers {
+        ws.mu.RLock()
+        defer ws.mu.RUnlock()
+
+        names := make([]string, 0, len(ws.handlers))
+        for name := range ws.handlers {
+                if name != auth.DefaultWorkspace {
+                        names = append(names, name)
+                }
+        }
+        sort.Strings(names)
+
+        all := []*Handlers{ws.handlers[auth.DefaultWorkspace]}
+        for _, name := range names {
+                all = append(all, ws.handlers[name])
+        }
+        return all
+}
+
+// recordChange records a change to a workspace in the audit log of the
+// default workspace, which outlives the others
+func (ws *Workspaces) recordChange(r *http.Request, action, name string, before, after interface{}) {
+        ws.mu.RLock()
+        h := ws.handlers[auth.DefaultWorkspace]
+        ws.mu.RUnlock()
+        h.recordChange(r, action, audit.ResourceWorkspace, name, before, after)
+}
+
+// requireInstanceAdmin writes a 403 response and returns false unless the
+// caller is an admin of the default workspace
+func requireInstanceAdmin(w http.ResponseWriter, r *http.Request) bool {
+        if !principal(r).IsInstanceAdmin() {
+                http.Error(w, "This requires the admin role in the "+auth.DefaultWorkspace+" workspace", http.StatusForbidden)
+                return false
+        }
+        return true
+}
+
+// workspaceResponse describes a workspace in API responses
+type workspaceResponse struct {
+        *auth.Workspace
+        Websites int `json:"websites"`
+}
+
+// GetWorkspaces lists all workspaces
+func (ws *Workspaces) GetWorkspaces(w http.ResponseWriter, r *http.Request) {
+        if !requireInstanceAdmin(w, r) {
+                return
+        }
+
+        response := []*workspaceResponse{}
+        for _, h := range ws.all() {
+                ws.mu.RLock()
+                workspace := ws.workspaces[h.Workspace]
+                ws.mu.RUnlock()
+                response = append(response, &workspaceResponse{Workspace: workspace, Websites: len(h.Monitor.GetWebsites())})
+        }
+
+        w.Header().Set("Content-Type", "application/json")
+        json.NewEncoder(w).Encode(response)
+}
+
+// CreateWorkspace creates an empty workspace and starts serving it
+func (ws *Workspaces) CreateWorkspace(w http.ResponseWriter, r *http.Request) {
+        if !requireInstanceAdmin(w, r) {
+                return
+        }
+
+        var data struct {
+                Name string `json:"name"`
+        }
+        if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+                http.Error(w, "Invalid request format", http.StatusBadRequest)
+                return
+        }
+        name := strings.TrimSpace(data.Name)
+        if err := auth.ValidateWorkspaceName(name); err != nil {
+                http.Error(w, err.Error(), http.StatusBadRequest)
+                return
+        }
+
+        workspace := &auth.Workspace{Name: name, CreatedAt: time.Now()}
+        if err := ws.store.CreateWorkspace(workspace); err != nil {
+                http.Error(w, err.Error(), http.StatusBadRequest)
+                return
+        }
+        if err := ws.AddExisting(workspace); err != nil {
+                log.Printf("Error starting workspace %s: %v", name, err)
+                http.Error(w, "Failed to start workspace", http.StatusInternalServerError)
+                return
+        }
+        log.Printf("Created workspace %s", name)
+        ws.recordChange(r, audit.ActionCreate, name, nil, workspace)
+
+        w.Header().Set("Content-Type", "application/json")
+        w.WriteHeader(http.StatusCreated)
+        json.NewEncoder(w).Encode(&workspaceResponse{Workspace: workspace})
+}
+
+// DeleteWorkspace stops checking a workspace's websites and deletes all its
+// data. Its users must be deleted first.
+func (ws *Workspaces) DeleteWorkspace(w http.ResponseWriter, r *http.Request) {
+        if !requireInstanceAdmin(w, r) {
+                return
+        }
+
+        name := mux.Vars(r)["name"]
+        if name == auth.DefaultWorkspace {
+                http.Error(w, "The default workspace cannot be deleted", http.StatusBadRequest)
+                return
+        }
+
+        ws.mu.Lock()
+        h := ws.handlers[name]
+        if h == nil {
+                ws.mu.Unlock()
+                http.Error(w, "Workspace not found: "+name, http.StatusNotFound)
+                return
+        }
+        if h.Auth != nil {
+                for _, user := range h.Auth.Users() {
+                        if auth.WorkspaceOf(user.Workspace) == name {
+                                ws.mu.Unlock()
+                                http.Error(w, fmt.Sprintf("Workspace %s still has users, such as %s", name, user.Username), http.StatusConflict)
+                                return
+                        }
+                }
+        }
+
+        // Delete the data first, so the workspace keeps being served if that
+        // fails. Checks still running then fail to save rather than
+        // recreating it.
+        if err := ws.store.DeleteWorkspace(name); err != nil {
+                ws.mu.Unlock()
+                log.Printf("Error deleting workspace %s from database: %v", name, err)
+                http.Error(w, "Failed to delete workspace", http.StatusInternalServerError)
+                return
+        }
+        workspace := ws.workspaces[name]
+        delete(ws.handlers, name)
+        delete(ws.workspaces, name)
+        ws.mu.Unlock()
+
+        if h.Stop != nil {
+                h.Stop()
+        }
+        for _, website := range h.Monitor.GetWebsites() {
+                h.Monitor.RemoveWebsite(website.ID)
+        }
+        log.Printf("Deleted workspace %s", name)
+        ws.recordChange(r, audit.ActionDelete, name, workspace, nil)
+
+        w.WriteHeader(http.StatusNoContent)
+}
+
+// certsDir returns the directory uploaded certificates of the workspace are
+// saved in
+func (h *Handlers) certsDir() string {
+        if h.CertsDir != "" {
+                return h.CertsDir
+        }
+        return "./certs"
+}
+
+// validateCertPaths returns an error if a website outside the default
+// workspace refers to certificate files outside its workspace's certificate
+// directory, which could belong to another workspace
+func (h *Handlers) validateCertPaths(config *monitor.Website) error {
+        if auth.WorkspaceOf(h.Workspace) == auth.DefaultWorkspace {
+                return nil
+        }
+
+        dir, err := filepath.Abs(h.certsDir())
+        if err != nil {
+                return fmt.Errorf("could not resolve certificate directory: %v", err)
+        }
+        paths := []struct{ field, path string }{
+                {"clientCertPath", config.ClientCertPath},
+                {"clientKeyPath", config.ClientKeyPath},
+                {"customRootCAPath", config.CustomRootCAPath},
+        }
+        for _, p := range paths {
+                if p.path == "" {
+                        continue
+                }
+                abs, err := filepath.Abs(p.path)
+                if err != nil {
+                        return monitor.NewValidationError(p.field, monitor.CodeInvalid, fmt.Sprintf("Invalid certificate path %s: %v", p.path, err))
+                }
+                rel, err := filepath.Rel(dir, abs)
+                if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+                        return monitor.NewValidationError(p.field, monitor.CodeInvalid, "Certificate files must be uploaded to this workspace: "+p.path)
+                }
+        }
+        return nil
+}
@@ -0,0 +1,70 @@
+package handlers
+
+import (
+        "errors"
+        "net/http"
+        "net/http/httptest"
+        "testing"
+
+        "website-monitor/auth"
+        "website-monitor/monitor"
+        "github.com/gorilla/mux"
+)
+
+// fakeWorkspaceStore fails to delete workspaces while err is set
+type fakeWorkspaceStore struct {
+        err     error
+        deleted []string
+}
+
+func (s *fakeWorkspaceStore) CreateWorkspace(workspace *auth.Workspace) error {
+        return nil
+}
+
+func (s *fakeWorkspaceStore) DeleteWorkspace(name string) error {
+        if s.err != nil {
+                return s.err
+        }
+        s.deleted = append(s.deleted, name)
+        return nil
+}
+
+func TestDeleteWorkspaceKeepsServingWhenTheDatabaseFails(t *testing.T) {
+        store := &fakeWorkspaceStore{err: errors.New("disk full")}
+        ws := NewWorkspaces(&Handlers{Monitor: monitor.NewMonitor(nil)}, store, nil)
+
+        sales := &Handlers{Monitor: monitor.NewMonitor(nil)}
+        sales.Monitor.AddExistingWebsite(&monitor.Website{ID: 1, URL: "https://sales.example.com/"})
+        stopped := false
+        sales.Stop = func() { stopped = true }
+        ws.workspaces["sales"] = &auth.Workspace{Name: "sales"}
+        ws.handlers["sales"] = sales
+
+        deleteSales := func() int {
+                r := mux.SetURLVars(requestAs("DELETE", "/api/workspaces/sales", testAdmin), map[string]string{"name": "sales"})
+                w := httptest.NewRecorder()
+                ws.DeleteWorkspace(w, r)
+                return w.Code
+        }
+
+        if code := deleteSales(); code != http.StatusInternalServerError {
+                t.Fatalf("status = %d, want %d", code, http.StatusInternalServerError)
+        }
+        if ws.handlers["sales"] != sales || ws.workspaces["sales"] == nil {
+                t.Error("workspace stopped being served after failing to delete it")
+        }
+        if stopped || len(sales.Monitor.GetWebsites()) != 1 {
+                t.Error("workspace stopped checking websites after failing to delete it")
+        }
+
+        store.err = nil
+        if code := deleteSales(); code != http.StatusNoContent {
+                t.Fatalf("status = %d, want %d", code, http.StatusNoContent)
+        }
+        if ws.handlers["sales"] != nil || !stopped || len(sales.Monitor.GetWebsites()) != 0 {
+                t.Error("deleted workspace is still served or checked")
+        }
+        if len(store.deleted) != 1 {
+                t.Errorf("deleted from the database %d times, want once", len(store.deleted))
+        }
+}
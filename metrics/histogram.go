@@ -0,0 +1,46 @@
+package metrics
+
+import (
+        "bufio"
+        "strconv"
+)
+
+// histogram counts observations in cumulative buckets. It is not safe for
+// concurrent use; the collector's lock guards it.
+type histogram struct {
+        bounds []float64
+        counts []uint64 // Per bucket, not cumulative; the last is +Inf
+        sum    float64
+        count  uint64
+}
+
+// newHistogram creates a histogram with the given ascending bucket bounds
+func newHistogram(bounds []float64) *histogram {
+        return &histogram{
+                bounds: bounds,
+                counts: make([]uint64, len(bounds)+1),
+        }
+}
+
+// observe adds a value to the histogram
+func (h *histogram) observe(value float64) {
+        i := 0
+        for i < len(h.bounds) && value > h.bounds[i] {
+                i++
+        }
+        h.counts[i]++
+        h.sum += value
+        h.count++
+}
+
+// write writes the bucket, sum and count samples of the histogram
+func (h *histogram) write(w *bufio.Writer, name string, labels []string) {
+        var cumulative uint64
+        for i, bound := range h.bounds {
+                cumulative += h.counts[i]
+                writeSample(w, name+"_bucket", append(labels[:len(labels):len(labels)], "le", strconv.FormatFloat(bound, 'g', -1, 64)), float64(cumulative))
+        }
+        writeSample(w, name+"_bucket", append(labels[:len(labels):len(labels)], "le", "+Inf"), float64(h.count))
+        writeSample(w, name+"_sum", labels, h.sum)
+        writeSample(w, name+"_count", labels, float64(h.count))
+}
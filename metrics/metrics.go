@@ -0,0 +1,288 @@
+// Package metrics exposes monitoring results in the Prometheus text
+// exposition format.
+package metrics
+
+import (
+        "bufio"
+        "fmt"
+        "net/http"
+        "sort"
+        "strconv"
+        "strings"
+        "sync"
+        "time"
+
+        "website-monitor/monitor"
+)
+
+// namespace prefixes every metric name
+const namespace = "website_monitor"
+
+// Bucket upper bounds, in seconds
+var (
+        responseBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+        cycleBuckets    = []float64{0.1, 0.5, 1, 5, 10, 30, 60, 120, 300}
+)
+
+// siteMetrics accumulates the metrics of one website
+type siteMetrics struct {
+        last     *monitor.HistoryEntry
+        checks   uint64
+        changes  uint64
+        errors   map[string]uint64 // By error class
+        response *histogram
+}
+
+// Collector records check results and serves them as Prometheus metrics
+type Collector struct {
+        monitor *monitor.Monitor
+
+        mu     sync.Mutex
+        sites  map[int]*siteMetrics
+        checks *histogram // Durations of all checks
+        cycles *histogram // Durations of scheduling cycles
+}
+
+// NewCollector creates a collector for the websites of a monitor
+func NewCollector(m *monitor.Monitor) *Collector {
+        return &Collector{
+                monitor: m,
+                sites:   make(map[int]*siteMetrics),
+                checks:  newHistogram(responseBuckets),
+                cycles:  newHistogram(cycleBuckets),
+        }
+}
+
+// site returns the metrics of a website, creating them if needed
+func (c *Collector) site(id int) *siteMetrics {
+        site, ok := c.sites[id]
+        if !ok {
+                site = &siteMetrics{
+                        errors:   make(map[string]uint64),
+                        response: newHistogram(responseBuckets),
+                }
+                c.sites[id] = site
+        }
+        return site
+}
+
+// Observe records the outcome of a check
+func (c *Collector) Observe(entry *monitor.HistoryEntry) {
+        c.mu.Lock()
+        defer c.mu.Unlock()
+
+        site := c.site(entry.WebsiteID)
+        site.last = entry
+        site.checks++
+        if entry.Changed {
+                site.changes++
+        }
+        if entry.Error != "" {
+                class := entry.ErrorClass
+                if class == "" {
+                        class = monitor.ErrorClassOther
+                }
+                site.errors[class]++
+        }
+
+        seconds := float64(entry.DurationMs) / 1000
+        site.response.observe(seconds)
+        c.checks.observe(seconds)
+}
+
+// ObserveCycle records the duration of a scheduling cycle, in seconds
+func (c *Collector) ObserveCycle(seconds float64) {
+        c.mu.Lock()
+        defer c.mu.Unlock()
+
+        c.cycles.observe(seconds)
+}
+
+// SetLast records the most recent check of a website without counting it,
+// so gauges are available after a restart before the next check
+func (c *Collector) SetLast(entry *monitor.HistoryEntry) {
+        c.mu.Lock()
+        defer c.mu.Unlock()
+
+        c.site(entry.WebsiteID).last = entry
+}
+
+// ServeHTTP writes the current metrics
+func (c *Collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+        w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+
+        buf := bufio.NewWriter(w)
+        c.write(buf, time.Now())
+        buf.Flush()
+}
+
+// write renders every metric in the text exposition format
+func (c *Collector) write(w *bufio.Writer, now time.Time) {
+        websites := c.monitor.GetWebsites()
+        sort.Slice(websites, func(i, j int) bool { return websites[i].ID < websites[j].ID })
+        stats := c.monitor.SchedulerStats()
+
+        c.mu.Lock()
+        defer c.mu.Unlock()
+
+        // Forget websites that are no longer monitored
+        current := make(map[int]bool, len(websites))
+        for _, website := range websites {
+                current[website.ID] = true
+        }
+        for id := range c.sites {
+                if !current[id] {
+                        delete(c.sites, id)
+                }
+        }
+
+        writeHeader(w, "websites", "gauge", "Number of monitored websites.")
+        writeSample(w, "websites", nil, float64(len(websites)))
+
+        writeHeader(w, "paused", "gauge", "Whether scheduled checks of the website are paused.")
+        for _, website := range websites {
+                writeSample(w, "paused", siteLabels(website), boolValue(website.IsPaused(now)))
+        }
+
+        writeHeader(w, "maintenance", "gauge", "Whether the last check ran during a maintenance window.")
+        for _, website := range websites {
+                writeSample(w, "maintenance", siteLabels(website), boolValue(website.Maintenance))
+        }
+
+        writeSiteGauge(w, websites, c.sites, "up", "Whether the last check of the website succeeded.",
+                func(e *monitor.HistoryEntry) (float64, bool) { return boolValue(e.Error == ""), true })
+        writeSiteGauge(w, websites, c.sites, "last_status_code", "HTTP status code of the last check, 0 if no response was received.",
+                func(e *monitor.HistoryEntry) (float64, bool) { return float64(e.StatusCode), true })
+        writeSiteGauge(w, websites, c.sites, "last_check_timestamp_seconds", "Unix time of the last check.",
+                func(e *monitor.HistoryEntry) (float64, bool) { return unixSeconds(e.CheckedAt), true })
+        writeSiteGauge(w, websites, c.sites, "body_size_bytes", "Size of the response body in the last check.",
+                func(e *monitor.HistoryEntry) (float64, bool) { return float64(e.BodySize), true })
+        writeSiteGauge(w, websites, c.sites, "tls_cert_expiry_seconds", "Seconds until the earliest certificate in the chain expires, negative once expired.",
+                func(e *monitor.HistoryEntry) (float64, bool) {
+                        if e.CertExpiry.IsZero() {
+                                return 0, false
+                        }
+                        return e.CertExpiry.Sub(now).Seconds(), true
+                })
+
+        writeHeader(w, "checks_total", "counter", "Checks since the service started.")
+        for _, website := range websites {
+                if site, ok := c.sites[website.ID]; ok {
+                        writeSample(w, "checks_total", siteLabels(website), float64(site.checks))
+                }
+        }
+
+        writeHeader(w, "changes_total", "counter", "Checks that detected a content change since the service started.")
+        for _, website := range websites {
+                if site, ok := c.sites[website.ID]; ok {
+                        writeSample(w, "changes_total", siteLabels(website), float64(site.changes))
+                }
+        }
+
+        writeHeader(w, "errors_total", "counter", "Failed checks since the service started, by error class.")
+        for _, website := range websites {
+                site, ok := c.sites[website.ID]
+                if !ok {
+                        continue
+                }
+                classes := make([]string, 0, len(site.errors))
+                for class := range site.errors {
+                        classes = append(classes, class)
+                }
+                sort.Strings(classes)
+                for _, class := range classes {
+                        labels := append(siteLabels(website), "class", class)
+                        writeSample(w, "errors_total", labels, float64(site.errors[class]))
+                }
+        }
+
+        writeHeader(w, "response_seconds", "histogram", "Time taken to fetch the website.")
+        for _, website := range websites {
+                if site, ok := c.sites[website.ID]; ok {
+                        site.response.write(w, "response_seconds", siteLabels(website))
+                }
+        }
+
+        writeHeader(w, "check_duration_seconds", "histogram", "Time taken by checks of all websites.")
+        c.checks.write(w, "check_duration_seconds", nil)
+
+        writeHeader(w, "scheduler_queue_depth", "gauge", "Checks requested but not yet completed.")
+        writeSample(w, "scheduler_queue_depth", nil, float64(stats.QueueDepth))
+
+        writeHeader(w, "scheduler_cycles_total", "counter", "Completed scheduling cycles.")
+        writeSample(w, "scheduler_cycles_total", nil, float64(stats.Cycles))
+
+        writeHeader(w, "scheduler_last_cycle_timestamp_seconds", "gauge", "Unix time the last scheduling cycle completed.")
+        writeSample(w, "scheduler_last_cycle_timestamp_seconds", nil, unixSeconds(stats.LastCycleCompleted))
+
+        writeHeader(w, "scheduler_cycle_duration_seconds", "histogram", "Time taken by scheduling cycles to check every due website.")
+        c.cycles.write(w, "scheduler_cycle_duration_seconds", nil)
+}
+
+// writeSiteGauge writes a gauge derived from the last check of each website.
+// Websites that have not been checked, or for which value reports false, are
+// left out.
+func writeSiteGauge(w *bufio.Writer, websites []*monitor.Website, sites map[int]*siteMetrics, name, help string, value func(*monitor.HistoryEntry) (float64, bool)) {
+        writeHeader(w, name, "gauge", help)
+        for _, website := range websites {
+                site, ok := sites[website.ID]
+                if !ok || site.last == nil {
+                        continue
+                }
+                if v, ok := value(site.last); ok {
+                        writeSample(w, name, siteLabels(website), v)
+                }
+        }
+}
+
+// siteLabels returns the label pairs identifying a website
+func siteLabels(website *monitor.Website) []string {
+        return []string{"id", strconv.Itoa(website.ID), "name", website.Name, "url", website.URL, "group", website.Group}
+}
+
+// writeHeader writes the HELP and TYPE lines of a metric
+func writeHeader(w *bufio.Writer, name, kind, help string) {
+        fmt.Fprintf(w, "# HELP %s_%s %s\n", namespace, name, help)
+        fmt.Fprintf(w, "# TYPE %s_%s %s\n", namespace, name, kind)
+}
+
+// writeSample writes one sample line. labels holds alternating names and values.
+func writeSample(w *bufio.Writer, name string, labels []string, value float64) {
+        w.WriteString(namespace + "_" + name)
+        if len(labels) > 0 {
+                w.WriteByte('{')
+                for i := 0; i+1 < len(labels); i += 2 {
+                        if i > 0 {
+                                w.WriteByte(',')
+                        }
+                        w.WriteString(labels[i] + `="` + escapeLabel(labels[i+1]) + `"`)
+                }
+                w.WriteByte('}')
+        }
+        w.WriteByte(' ')
+        w.WriteString(strconv.FormatFloat(value, 'g', -1, 64))
+        w.WriteByte('\n')
+}
+
+// labelEscaper escapes label values as the exposition format requires
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(value string) string {
+        return labelEscaper.Replace(value)
+}
+
+// boolValue converts a boolean to a 0 or 1 sample value
+func boolValue(b bool) float64 {
+        if b {
+                return 1
+        }
+        return 0
+}
+
+// unixSeconds converts a time to a Unix timestamp, or 0 for the zero time
+func unixSeconds(t time.Time) float64 {
+        if t.IsZero() {
+                return 0
+        }
+        return float64(t.UnixNano()) / 1e9
+}
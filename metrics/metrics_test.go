@@ -0,0 +1,140 @@
+package metrics
+
+import (
+        "bufio"
+        "strings"
+        "testing"
+        "time"
+
+        "website-monitor/monitor"
+)
+
+func TestWrite(t *testing.T) {
+        now := time.Unix(1700000000, 0)
+        m := monitor.NewMonitor(nil)
+        m.AddExistingWebsite(&monitor.Website{ID: 1, Name: "Shop \"EU\" \\ main\nstore", URL: "https://shop.example.com/", Group: "Retail"})
+        m.AddExistingWebsite(&monitor.Website{ID: 2, Name: "API", URL: "https://api.example.com/", Paused: true})
+
+        c := NewCollector(m)
+        c.Observe(&monitor.HistoryEntry{WebsiteID: 1, CheckedAt: now.Add(-2 * time.Minute), StatusCode: 200, Changed: true, DurationMs: 250, BodySize: 1024, CertExpiry: now.Add(time.Hour)})
+        c.Observe(&monitor.HistoryEntry{WebsiteID: 1, CheckedAt: now.Add(-time.Minute), StatusCode: 200, DurationMs: 500, BodySize: 2048, CertExpiry: now.Add(time.Hour)})
+        c.Observe(&monitor.HistoryEntry{WebsiteID: 2, CheckedAt: now.Add(-30 * time.Second), Error: "timed out", ErrorClass: monitor.ErrorClassTimeout, DurationMs: 2000, CertExpiry: now.Add(-24 * time.Hour)})
+        c.ObserveCycle(0.3)
+
+        var out strings.Builder
+        w := bufio.NewWriter(&out)
+        c.write(w, now)
+        w.Flush()
+
+        if got := out.String(); got != wantMetrics {
+                t.Errorf("metrics differ\ngot:\n%s\nwant:\n%s", got, wantMetrics)
+        }
+}
+
+// wantMetrics is the exposition of TestWrite
+const wantMetrics = `# HELP website_monitor_websites Number of monitored websites.
+# TYPE website_monitor_websites gauge
+website_monitor_websites 2
+# HELP website_monitor_paused Whether scheduled checks of the website are paused.
+# TYPE website_monitor_paused gauge
+website_monitor_paused{id="1",name="Shop \"EU\" \\ main\nstore",url="https://shop.example.com/",group="Retail"} 0
+website_monitor_paused{id="2",name="API",url="https://api.example.com/",group=""} 1
+# HELP website_monitor_maintenance Whether the last check ran during a maintenance window.
+# TYPE website_monitor_maintenance gauge
+website_monitor_maintenance{id="1",name="Shop \"EU\" \\ main\nstore",url="https://shop.example.com/",group="Retail"} 0
+website_monitor_maintenance{id="2",name="API",url="https://api.example.com/",group=""} 0
+# HELP website_monitor_up Whether the last check of the website succeeded.
+# TYPE website_monitor_up gauge
+website_monitor_up{id="1",name="Shop \"EU\" \\ main\nstore",url="https://shop.example.com/",group="Retail"} 1
+website_monitor_up{id="2",name="API",url="https://api.example.com/",group=""} 0
+# HELP website_monitor_last_status_code HTTP status code of the last check, 0 if no response was received.
+# TYPE website_monitor_last_status_code gauge
+website_monitor_last_status_code{id="1",name="Shop \"EU\" \\ main\nstore",url="https://shop.example.com/",group="Retail"} 200
+website_monitor_last_status_code{id="2",name="API",url="https://api.example.com/",group=""} 0
+# HELP website_monitor_last_check_timestamp_seconds Unix time of the last check.
+# TYPE website_monitor_last_check_timestamp_seconds gauge
+website_monitor_last_check_timestamp_seconds{id="1",name="Shop \"EU\" \\ main\nstore",url="https://shop.example.com/",group="Retail"} 1.69999994e+09
+website_monitor_last_check_timestamp_seconds{id="2",name="API",url="https://api.example.com/",group=""} 1.69999997e+09
+# HELP website_monitor_body_size_bytes Size of the response body in the last check.
+# TYPE website_monitor_body_size_bytes gauge
+website_monitor_body_size_bytes{id="1",name="Shop \"EU\" \\ main\nstore",url="https://shop.example.com/",group="Retail"} 2048
+website_monitor_body_size_bytes{id="2",name="API",url="https://api.example.com/",group=""} 0
+# HELP website_monitor_tls_cert_expiry_seconds Seconds until the earliest certificate in the chain expires, negative once expired.
+# TYPE website_monitor_tls_cert_expiry_seconds gauge
+website_monitor_tls_cert_expiry_seconds{id="1",name="Shop \"EU\" \\ main\nstore",url="https://shop.example.com/",group="Retail"} 3600
+website_monitor_tls_cert_expiry_seconds{id="2",name="API",url="https://api.example.com/",group=""} -86400
+# HELP website_monitor_checks_total Checks since the service started.
+# TYPE website_monitor_checks_total counter
+website_monitor_checks_total{id="1",name="Shop \"EU\" \\ main\nstore",url="https://shop.example.com/",group="Retail"} 2
+website_monitor_checks_total{id="2",name="API",url="https://api.example.com/",group=""} 1
+# HELP website_monitor_changes_total Checks that detected a content change since the service started.
+# TYPE website_monitor_changes_total counter
+website_monitor_changes_total{id="1",name="Shop \"EU\" \\ main\nstore",url="https://shop.example.com/",group="Retail"} 1
+website_monitor_changes_total{id="2",name="API",url="https://api.example.com/",group=""} 0
+# HELP website_monitor_errors_total Failed checks since the service started, by error class.
+# TYPE website_monitor_errors_total counter
+website_monitor_errors_total{id="2",name="API",url="https://api.example.com/",group="",class="timeout"} 1
+# HELP website_monitor_response_seconds Time taken to fetch the website.
+# TYPE website_monitor_response_seconds histogram
+website_monitor_response_seconds_bucket{id="1",name="Shop \"EU\" \\ main\nstore",url="https://shop.example.com/",group="Retail",le="0.05"} 0
+website_monitor_response_seconds_bucket{id="1",name="Shop \"EU\" \\ main\nstore",url="https://shop.example.com/",group="Retail",le="0.1"} 0
+website_monitor_response_seconds_bucket{id="1",name="Shop \"EU\" \\ main\nstore",url="https://shop.example.com/",group="Retail",le="0.25"} 1
+website_monitor_response_seconds_bucket{id="1",name="Shop \"EU\" \\ main\nstore",url="https://shop.example.com/",group="Retail",le="0.5"} 2
+website_monitor_response_seconds_bucket{id="1",name="Shop \"EU\" \\ main\nstore",url="https://shop.example.com/",group="Retail",le="1"} 2
+website_monitor_response_seconds_bucket{id="1",name="Shop \"EU\" \\ main\nstore",url="https://shop.example.com/",group="Retail",le="2.5"} 2
+website_monitor_response_seconds_bucket{id="1",name="Shop \"EU\" \\ main\nstore",url="https://shop.example.com/",group="Retail",le="5"} 2
+website_monitor_response_seconds_bucket{id="1",name="Shop \"EU\" \\ main\nstore",url="https://shop.example.com/",group="Retail",le="10"} 2
+website_monitor_response_seconds_bucket{id="1",name="Shop \"EU\" \\ main\nstore",url="https://shop.example.com/",group="Retail",le="30"} 2
+website_monitor_response_seconds_bucket{id="1",name="Shop \"EU\" \\ main\nstore",url="https://shop.example.com/",group="Retail",le="+Inf"} 2
+website_monitor_response_seconds_sum{id="1",name="Shop \"EU\" \\ main\nstore",url="https://shop.example.com/",group="Retail"} 0.75
+website_monitor_response_seconds_count{id="1",name="Shop \"EU\" \\ main\nstore",url="https://shop.example.com/",group="Retail"} 2
+website_monitor_response_seconds_bucket{id="2",name="API",url="https://api.example.com/",group="",le="0.05"} 0
+website_monitor_response_seconds_bucket{id="2",name="API",url="https://api.example.com/",group="",le="0.1"} 0
+website_monitor_response_seconds_bucket{id="2",name="API",url="https://api.example.com/",group="",le="0.25"} 0
+website_monitor_response_seconds_bucket{id="2",name="API",url="https://api.example.com/",group="",le="0.5"} 0
+website_monitor_response_seconds_bucket{id="2",name="API",url="https://api.example.com/",group="",le="1"} 0
+website_monitor_response_seconds_bucket{id="2",name="API",url="https://api.example.com/",group="",le="2.5"} 1
+website_monitor_response_seconds_bucket{id="2",name="API",url="https://api.example.com/",group="",le="5"} 1
+website_monitor_response_seconds_bucket{id="2",name="API",url="https://api.example.com/",group="",le="10"} 1
+website_monitor_response_seconds_bucket{id="2",name="API",url="https://api.example.com/",group="",le="30"} 1
+website_monitor_response_seconds_bucket{id="2",name="API",url="https://api.example.com/",group="",le="+Inf"} 1
+website_monitor_response_seconds_sum{id="2",name="API",url="https://api.example.com/",group=""} 2
+website_monitor_response_seconds_count{id="2",name="API",url="https://api.example.com/",group=""} 1
+# HELP website_monitor_check_duration_seconds Time taken by checks of all websites.
+# TYPE website_monitor_check_duration_seconds histogram
+website_monitor_check_duration_seconds_bucket{le="0.05"} 0
+website_monitor_check_duration_seconds_bucket{le="0.1"} 0
+website_monitor_check_duration_seconds_bucket{le="0.25"} 1
+website_monitor_check_duration_seconds_bucket{le="0.5"} 2
+website_monitor_check_duration_seconds_bucket{le="1"} 2
+website_monitor_check_duration_seconds_bucket{le="2.5"} 3
+website_monitor_check_duration_seconds_bucket{le="5"} 3
+website_monitor_check_duration_seconds_bucket{le="10"} 3
+website_monitor_check_duration_seconds_bucket{le="30"} 3
+website_monitor_check_duration_seconds_bucket{le="+Inf"} 3
+website_monitor_check_duration_seconds_sum 2.75
+website_monitor_check_duration_seconds_count 3
+# HELP website_monitor_scheduler_queue_depth Checks requested but not yet completed.
+# TYPE website_monitor_scheduler_queue_depth gauge
+website_monitor_scheduler_queue_depth 0
+# HELP website_monitor_scheduler_cycles_total Completed scheduling cycles.
+# TYPE website_monitor_scheduler_cycles_total counter
+website_monitor_scheduler_cycles_total 0
+# HELP website_monitor_scheduler_last_cycle_timestamp_seconds Unix time the last scheduling cycle completed.
+# TYPE website_monitor_scheduler_last_cycle_timestamp_seconds gauge
+website_monitor_scheduler_last_cycle_timestamp_seconds 0
+# HELP website_monitor_scheduler_cycle_duration_seconds Time taken by scheduling cycles to check every due website.
+# TYPE website_monitor_scheduler_cycle_duration_seconds histogram
+website_monitor_scheduler_cycle_duration_seconds_bucket{le="0.1"} 0
+website_monitor_scheduler_cycle_duration_seconds_bucket{le="0.5"} 1
+website_monitor_scheduler_cycle_duration_seconds_bucket{le="1"} 1
+website_monitor_scheduler_cycle_duration_seconds_bucket{le="5"} 1
+website_monitor_scheduler_cycle_duration_seconds_bucket{le="10"} 1
+website_monitor_scheduler_cycle_duration_seconds_bucket{le="30"} 1
+website_monitor_scheduler_cycle_duration_seconds_bucket{le="60"} 1
+website_monitor_scheduler_cycle_duration_seconds_bucket{le="120"} 1
+website_monitor_scheduler_cycle_duration_seconds_bucket{le="300"} 1
+website_monitor_scheduler_cycle_duration_seconds_bucket{le="+Inf"} 1
+website_monitor_scheduler_cycle_duration_seconds_sum 0.3
+website_monitor_scheduler_cycle_duration_seconds_count 1
+`
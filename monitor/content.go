@@ -0,0 +1,52 @@
+package monitor
+
+import (
+        "bytes"
+        "fmt"
+
+        "github.com/andybalholm/cascadia"
+        "golang.org/x/net/html"
+)
+
+// ValidateSelectors checks that every selector is a valid CSS selector
+func ValidateSelectors(selectors []string) error {
+        for _, selector := range selectors {
+                if _, err := cascadia.Compile(selector); err != nil {
+                        return fmt.Errorf("Invalid selector %q: %v", selector, err)
+                }
+        }
+        return nil
+}
+
+// extractContent returns the part of a page used for change detection. With
+// no selectors this is the whole body; otherwise it is the rendered HTML of
+// every element matched by the selectors, in selector order.
+func extractContent(body []byte, selectors []string) ([]byte, error) {
+        if len(selectors) == 0 {
+                return body, nil
+        }
+
+        doc, err := html.Parse(bytes.NewReader(body))
+        if err != nil {
+                return nil, fmt.Errorf("Failed to parse HTML: %v", err)
+        }
+
+        var content bytes.Buffer
+        for _, selector := range selectors {
+                compiled, err := cascadia.Compile(selector)
+                if err != nil {
+                        return nil, fmt.Errorf("Invalid selector %q: %v", selector, err)
+                }
+
+                nodes := compiled.MatchAll(doc)
+                if len(nodes) == 0 {
+                        return nil, fmt.Errorf("Selector %q matched nothing", selector)
+                }
+                for _, node := range nodes {
+                        if err := html.Render(&content, node); err != nil {
+                                return nil, fmt.Errorf("Failed to render %q: %v", selector, err)
+                        }
+                }
+        }
+        return content.Bytes(), nil
+}
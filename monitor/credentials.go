@@ -0,0 +1,342 @@
+package monitor
+
+import (
+        "crypto/sha256"
+        "encoding/hex"
+        "encoding/json"
+        "errors"
+        "fmt"
+        "io"
+        "net/http"
+        "net/url"
+        "strings"
+        "sync"
+        "time"
+)
+
+// Authentication schemes for AuthConfig.Type
+const (
+        AuthBasic  = "basic"
+        AuthBearer = "bearer"
+        AuthOAuth2 = "oauth2" // OAuth2 client credentials grant
+        AuthForm   = "form"   // Log in with a form and keep the session cookies
+)
+
+// ErrAuth is returned, wrapped, when credentials can't be obtained
+var ErrAuth = errors.New("authentication failed")
+
+// tokenRefreshMargin is how long before expiry a cached token is replaced
+const tokenRefreshMargin = 30 * time.Second
+
+// AuthConfig describes how a website's requests authenticate. Values are
+// request templates; Password, Token and ClientSecret must refer to stored
+// secrets, such as {{secret "name"}}, so credentials are only ever saved
+// encrypted.
+type AuthConfig struct {
+        Type string `json:"type"`
+
+        // Basic and form
+        Username string `json:"username,omitempty"`
+        Password string `json:"password,omitempty"`
+
+        // Bearer
+        Token string `json:"token,omitempty"`
+
+        // OAuth2 client credentials
+        TokenURL         string   `json:"tokenURL,omitempty"`
+        ClientID         string   `json:"clientId,omitempty"`
+        ClientSecret     string   `json:"clientSecret,omitempty"`
+        Scopes           []string `json:"scopes,omitempty"`
+        ClientAuthInBody bool     `json:"clientAuthInBody,omitempty"` // Send client credentials as form fields rather than Basic auth
+
+        // Form login
+        LoginURL      string            `json:"loginURL,omitempty"`      // Page with the login form
+        UsernameField string            `json:"usernameField,omitempty"` // Defaults to DefaultUsernameField
+        PasswordField string            `json:"passwordField,omitempty"` // Defaults to DefaultPasswordField
+        LoginFields   map[string]string `json:"loginFields,omitempty"`   // Extra form fields, as templates
+        SessionMarker string            `json:"sessionMarker,omitempty"` // Text only shown to logged out visitors
+}
+
+// clone returns a copy of the configuration, preserving nil
+func (a *AuthConfig) clone() *AuthConfig {
+        if a == nil {
+                return nil
+        }
+        c := *a
+        c.Scopes = copyStrings(a.Scopes)
+        c.LoginFields = copyMap(a.LoginFields)
+        return &c
+}
+
+// Redacted is the value credentials are replaced with in audit log copies
+const Redacted = "[redacted]"
+
+// redact replaces a credential, keeping whether it was set
+func redact(value string) string {
+        if value == "" {
+                return ""
+        }
+        return Redacted
+}
+
+// redacted returns a copy of the configuration with its password, token,
+// client secret and extra login fields replaced by Redacted
+func (a *AuthConfig) redacted() *AuthConfig {
+        c := a.clone()
+        if c == nil {
+                return nil
+        }
+        c.Password = redact(c.Password)
+        c.Token = redact(c.Token)
+        c.ClientSecret = redact(c.ClientSecret)
+        for name, value := range c.LoginFields {
+                c.LoginFields[name] = redact(value)
+        }
+        return c
+}
+
+// equal reports whether two configurations are the same
+func (a *AuthConfig) equal(b *AuthConfig) bool {
+        if a == nil || b == nil {
+                return a == b
+        }
+        return a.Type == b.Type && a.Username == b.Username && a.Password == b.Password &&
+                a.Token == b.Token && a.TokenURL == b.TokenURL && a.ClientID == b.ClientID &&
+                a.ClientSecret == b.ClientSecret && equalStrings(a.Scopes, b.Scopes) &&
+                a.ClientAuthInBody == b.ClientAuthInBody && a.LoginURL == b.LoginURL &&
+                a.UsernameField == b.UsernameField && a.PasswordField == b.PasswordField &&
+                equalMaps(a.LoginFields, b.LoginFields) && a.SessionMarker == b.SessionMarker
+}
+
+// validate checks the configuration, recording problems
+func (a *AuthConfig) validate(problems *ValidationError) {
+        required := func(field, value string) {
+                if strings.TrimSpace(value) == "" {
+                        problems.add("auth."+field, CodeRequired, fmt.Sprintf("The %s is required for %s authentication", field, a.Type))
+                } else if err := validateTemplate(value); err != nil {
+                        problems.add("auth."+field, CodeInvalid, fmt.Sprintf("Invalid template in %s: %v", field, err))
+                }
+        }
+        secret := func(field, value string) {
+                required(field, value)
+                if value != "" && validateTemplate(value) == nil && !isSecretReference(value) {
+                        problems.add("auth."+field, CodeInvalid, fmt.Sprintf("The %s must only refer to stored secrets, such as {{secret \"name\"}}", field))
+                }
+        }
+
+        a.Type = strings.ToLower(strings.TrimSpace(a.Type))
+        switch a.Type {
+        case AuthBasic:
+                required("username", a.Username)
+                secret("password", a.Password)
+        case AuthBearer:
+                secret("token", a.Token)
+        case AuthOAuth2:
+                if u, err := url.Parse(a.TokenURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+                        problems.add("auth.tokenURL", CodeInvalid, "OAuth2 authentication requires an http or https tokenURL")
+                }
+                required("clientId", a.ClientID)
+                secret("clientSecret", a.ClientSecret)
+        case AuthForm:
+                if u, err := url.Parse(a.LoginURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+                        problems.add("auth.loginURL", CodeInvalid, "Form authentication requires an http or https loginURL")
+                }
+                required("username", a.Username)
+                secret("password", a.Password)
+                a.UsernameField = strings.TrimSpace(a.UsernameField)
+                if a.UsernameField == "" {
+                        a.UsernameField = DefaultUsernameField
+                }
+                a.PasswordField = strings.TrimSpace(a.PasswordField)
+                if a.PasswordField == "" {
+                        a.PasswordField = DefaultPasswordField
+                }
+                for name, value := range a.LoginFields {
+                        if name == "" {
+                                problems.add("auth.loginFields", CodeInvalid, "Login field names cannot be empty")
+                        } else if err := validateTemplate(value); err != nil {
+                                problems.add("auth.loginFields", CodeInvalid, fmt.Sprintf("Invalid template in login field %s: %v", name, err))
+                        }
+                }
+        default:
+                problems.add("auth.type", CodeInvalid, fmt.Sprintf("Authentication type must be %s, %s, %s or %s", AuthBasic, AuthBearer, AuthOAuth2, AuthForm))
+        }
+}
+
+// cachedToken is an OAuth2 access token and when it expires; a zero expiry
+// means the token server didn't say
+type cachedToken struct {
+        token   string
+        expires time.Time
+}
+
+// tokenCache holds OAuth2 access tokens, keyed by the client credentials and
+// scopes they were issued for, so websites sharing a client share its token
+// and rotating the client secret fetches a new one
+type tokenCache struct {
+        mu     sync.Mutex
+        tokens map[string]cachedToken
+}
+
+// tokenKey identifies the credentials a token was issued for
+func tokenKey(tokenURL, clientID, clientSecret string, scopes []string) string {
+        sum := sha256.Sum256([]byte(strings.Join([]string{tokenURL, clientID, clientSecret, strings.Join(scopes, " ")}, "\x00")))
+        return hex.EncodeToString(sum[:])
+}
+
+// get returns a cached token that is not about to expire
+func (c *tokenCache) get(key string, now time.Time) (string, bool) {
+        c.mu.Lock()
+        defer c.mu.Unlock()
+
+        cached, ok := c.tokens[key]
+        if !ok || (!cached.expires.IsZero() && now.Add(tokenRefreshMargin).After(cached.expires)) {
+                return "", false
+        }
+        return cached.token, true
+}
+
+// put caches a token
+func (c *tokenCache) put(key string, token cachedToken) {
+        c.mu.Lock()
+        defer c.mu.Unlock()
+
+        if c.tokens == nil {
+                c.tokens = make(map[string]cachedToken)
+        }
+        c.tokens[key] = token
+}
+
+// drop forgets a token the website rejected, so the next request fetches a
+// new one
+func (c *tokenCache) drop(key string) {
+        c.mu.Lock()
+        defer c.mu.Unlock()
+
+        delete(c.tokens, key)
+}
+
+// authorize adds the website's credentials to a request. For OAuth2 it
+// returns the token cache key, so a rejected token can be dropped.
+func (m *Monitor) authorize(req *http.Request, website *Website, client *http.Client, secret SecretFunc) (string, error) {
+        config := website.Auth
+        if config == nil {
+                return "", nil
+        }
+        render := func(field, value string) (string, error) {
+                rendered, err := renderTemplate(value, secret)
+                if err != nil {
+                        return "", fmt.Errorf("%w: %s: %v", ErrAuth, field, err)
+                }
+                return rendered, nil
+        }
+
+        switch config.Type {
+        case AuthBasic:
+                username, err := render("username", config.Username)
+                if err != nil {
+                        return "", err
+                }
+                password, err := render("password", config.Password)
+                if err != nil {
+                        return "", err
+                }
+                req.SetBasicAuth(username, password)
+                return "", nil
+
+        case AuthBearer:
+                token, err := render("token", config.Token)
+                if err != nil {
+                        return "", err
+                }
+                req.Header.Set("Authorization", "Bearer "+token)
+                return "", nil
+
+        case AuthOAuth2:
+                clientID, err := render("clientId", config.ClientID)
+                if err != nil {
+                        return "", err
+                }
+                clientSecret, err := render("clientSecret", config.ClientSecret)
+                if err != nil {
+                        return "", err
+                }
+
+                key := tokenKey(config.TokenURL, clientID, clientSecret, config.Scopes)
+                token, ok := m.tokens.get(key, time.Now())
+                if !ok {
+                        fetched, err := fetchToken(client, config, clientID, clientSecret)
+                        if err != nil {
+                                return "", err
+                        }
+                        m.tokens.put(key, fetched)
+                        token = fetched.token
+                }
+                req.Header.Set("Authorization", "Bearer "+token)
+                return key, nil
+
+        case AuthForm:
+                // The session cookies are sent by the client's jar
+                return "", nil
+        }
+        return "", fmt.Errorf("%w: unknown authentication type %q", ErrAuth, config.Type)
+}
+
+// fetchToken requests an access token with the OAuth2 client credentials grant
+func fetchToken(client *http.Client, config *AuthConfig, clientID, clientSecret string) (cachedToken, error) {
+        form := url.Values{"grant_type": {"client_credentials"}}
+        if len(config.Scopes) > 0 {
+                form.Set("scope", strings.Join(config.Scopes, " "))
+        }
+        if config.ClientAuthInBody {
+                form.Set("client_id", clientID)
+                form.Set("client_secret", clientSecret)
+        }
+
+        req, err := http.NewRequest(http.MethodPost, config.TokenURL, strings.NewReader(form.Encode()))
+        if err != nil {
+                return cachedToken{}, fmt.Errorf("%w: %v", ErrAuth, err)
+        }
+        req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+        req.Header.Set("Accept", "application/json")
+        if !config.ClientAuthInBody {
+                req.SetBasicAuth(url.QueryEscape(clientID), url.QueryEscape(clientSecret))
+        }
+
+        requested := time.Now()
+        resp, err := client.Do(req)
+        if err != nil {
+                return cachedToken{}, fmt.Errorf("%w: token request: %v", ErrAuth, err)
+        }
+        defer resp.Body.Close()
+
+        body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+        if err != nil {
+                return cachedToken{}, fmt.Errorf("%w: token response: %v", ErrAuth, err)
+        }
+
+        var data struct {
+                AccessToken      string `json:"access_token"`
+                TokenType        string `json:"token_type"`
+                ExpiresIn        int64  `json:"expires_in"`
+                Error            string `json:"error"`
+                ErrorDescription string `json:"error_description"`
+        }
+        json.Unmarshal(body, &data)
+        if resp.StatusCode != http.StatusOK || data.AccessToken == "" {
+                reason := resp.Status
+                if data.Error != "" {
+                        reason += ": " + strings.TrimSpace(data.Error+" "+data.ErrorDescription)
+                }
+                return cachedToken{}, fmt.Errorf("%w: token endpoint returned %s", ErrAuth, reason)
+        }
+        if data.TokenType != "" && !strings.EqualFold(data.TokenType, "bearer") {
+                return cachedToken{}, fmt.Errorf("%w: unsupported token type %q", ErrAuth, data.TokenType)
+        }
+
+        token := cachedToken{token: data.AccessToken}
+        if data.ExpiresIn > 0 {
+                token.expires = requested.Add(time.Duration(data.ExpiresIn) * time.Second)
+        }
+        return token, nil
+}
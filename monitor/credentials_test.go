@@ -0,0 +1,67 @@
+package monitor
+
+import "testing"
+
+// secretTemplates are credential values, and whether they only refer to
+// stored secrets
+var secretTemplates = []struct {
+        value  string
+        secret bool
+}{
+        {`{{secret "api-key"}}`, true},
+        {`{{ secret "api-key" }}`, true},
+        {`{{- secret "api-key" -}}`, true},
+        {`{{secret "user"}}{{secret "pass"}}`, true},
+        {`hunter2`, false},
+        {`{{"hunter2"}}`, false},
+        {`{{/*x*/}}hunter2`, false},
+        {`hunter2{{/*x*/}}`, false},
+        {`{{secret "api-key"}}hunter2`, false},
+        {`{{print "hunter2"}}`, false},
+        {`{{printf "%s" "hunter2"}}`, false},
+        {`{{secret "api-key" | printf "%s2"}}`, false},
+        {`{{$x := "hunter2"}}{{$x}}`, false},
+        {`{{secret (print "api-key")}}`, false},
+        {`{{if true}}hunter2{{end}}`, false},
+        {`{{define "x"}}hunter2{{end}}{{template "x"}}`, false},
+        {`{{.password}}`, false},
+        {`{{now}}`, false},
+        {`{{/* hunter2 */}}`, false},
+}
+
+func TestIsSecretReference(t *testing.T) {
+        for _, test := range secretTemplates {
+                if got := isSecretReference(test.value); got != test.secret {
+                        t.Errorf("isSecretReference(%q) = %v, want %v", test.value, got, test.secret)
+                }
+        }
+}
+
+func TestAuthConfigRequiresSecrets(t *testing.T) {
+        for _, test := range secretTemplates {
+                configs := []*AuthConfig{
+                        {Type: AuthBasic, Username: "user", Password: test.value},
+                        {Type: AuthBearer, Token: test.value},
+                        {Type: AuthOAuth2, TokenURL: "https://auth.example.com/token", ClientID: "id", ClientSecret: test.value},
+                        {Type: AuthForm, LoginURL: "https://example.com/login", Username: "user", Password: test.value},
+                }
+                for _, config := range configs {
+                        problems := &ValidationError{}
+                        config.validate(problems)
+                        if valid := len(problems.Errors) == 0; valid != test.secret {
+                                t.Errorf("%s authentication with %q: valid = %v, want %v (%v)", config.Type, test.value, valid, test.secret, problems.Errors)
+                        }
+                }
+        }
+}
+
+func TestProxyConfigRequiresSecretPassword(t *testing.T) {
+        for _, test := range secretTemplates {
+                config := &ProxyConfig{URL: "http://proxy.example.com:3128", Username: "user", Password: test.value}
+                problems := &ValidationError{}
+                config.validate(problems)
+                if valid := len(problems.Errors) == 0; valid != test.secret {
+                        t.Errorf("proxy password %q: valid = %v, want %v (%v)", test.value, valid, test.secret, problems.Errors)
+                }
+        }
+}
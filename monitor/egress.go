@@ -0,0 +1,261 @@
+package monitor
+
+import (
+        "context"
+        "crypto/tls"
+        "errors"
+        "fmt"
+        "net"
+        "net/http"
+        "net/netip"
+        "net/url"
+        "strings"
+        "syscall"
+        "time"
+)
+
+// ErrEgressDenied is returned, wrapped, when the egress policy refuses a URL
+// or the address it resolves to
+var ErrEgressDenied = errors.New("not allowed by the egress policy")
+
+// DefaultDeniedNetworks are refused unless allowed explicitly: loopback,
+// private, link-local (including cloud metadata endpoints), carrier-grade
+// NAT, unspecified and multicast addresses, and the NAT64 prefixes that
+// translate to IPv4 addresses including those
+var DefaultDeniedNetworks = []string{
+        "0.0.0.0/8",
+        "10.0.0.0/8",
+        "100.64.0.0/10",
+        "127.0.0.0/8",
+        "169.254.0.0/16",
+        "172.16.0.0/12",
+        "192.168.0.0/16",
+        "224.0.0.0/4",
+        "::/128",
+        "::1/128",
+        "64:ff9b::/96",
+        "64:ff9b:1::/48",
+        "fc00::/7",
+        "fe80::/10",
+        "ff00::/8",
+}
+
+// EgressPolicy limits what the monitor may connect to, so that users can't
+// make the server probe internal services. Addresses are checked when
+// connecting, after DNS resolution, so redirects and DNS records pointing
+// inside the network are caught too.
+type EgressPolicy struct {
+        Schemes []string     // Allowed URL schemes
+        Allow   []*net.IPNet // Addresses allowed even if they are denied
+        Deny    []*net.IPNet // Addresses refused unless allowed
+
+        // lookupIPAddr resolves host names; nil uses the default resolver
+        lookupIPAddr func(ctx context.Context, host string) ([]net.IPAddr, error)
+}
+
+// DefaultEgressSchemes are the URL schemes websites may use by default
+var DefaultEgressSchemes = []string{"http", "https"}
+
+// NewEgressPolicy creates a policy from allowed schemes and allowed and
+// denied networks in CIDR notation. Single addresses may omit the prefix
+// length. To allow only some networks, deny 0.0.0.0/0 and ::/0 and allow
+// those networks.
+func NewEgressPolicy(schemes, allow, deny []string) (*EgressPolicy, error) {
+        policy := &EgressPolicy{}
+        for _, scheme := range schemes {
+                if scheme = strings.ToLower(strings.TrimSpace(scheme)); scheme != "" {
+                        policy.Schemes = append(policy.Schemes, scheme)
+                }
+        }
+        if len(policy.Schemes) == 0 {
+                return nil, fmt.Errorf("at least one URL scheme must be allowed")
+        }
+
+        var err error
+        if policy.Allow, err = parseNetworks(allow); err != nil {
+                return nil, err
+        }
+        if policy.Deny, err = parseNetworks(deny); err != nil {
+                return nil, err
+        }
+        return policy, nil
+}
+
+// parseNetworks parses CIDR networks, treating bare addresses as networks of
+// one address
+func parseNetworks(values []string) ([]*net.IPNet, error) {
+        var networks []*net.IPNet
+        for _, value := range values {
+                value = strings.TrimSpace(value)
+                if value == "" {
+                        continue
+                }
+                if !strings.Contains(value, "/") {
+                        ip := net.ParseIP(value)
+                        if ip == nil {
+                                return nil, fmt.Errorf("invalid network %q", value)
+                        }
+                        bits := 128
+                        if ip.To4() != nil {
+                                ip, bits = ip.To4(), 32
+                        }
+                        networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+                        continue
+                }
+                _, network, err := net.ParseCIDR(value)
+                if err != nil {
+                        return nil, fmt.Errorf("invalid network %q", value)
+                }
+                networks = append(networks, network)
+        }
+        return networks, nil
+}
+
+// String describes the policy for logs
+func (p *EgressPolicy) String() string {
+        var allow, deny []string
+        for _, network := range p.Allow {
+                allow = append(allow, network.String())
+        }
+        for _, network := range p.Deny {
+                deny = append(deny, network.String())
+        }
+        return fmt.Sprintf("schemes %s, allow [%s], deny [%s]", strings.Join(p.Schemes, ","), strings.Join(allow, " "), strings.Join(deny, " "))
+}
+
+// CheckIP returns an error if the policy refuses connections to ip. IPv4
+// addresses mapped into IPv6, such as ::ffff:127.0.0.1, are checked as the
+// IPv4 address.
+func (p *EgressPolicy) CheckIP(ip net.IP) error {
+        if addr, ok := netip.AddrFromSlice(ip); ok {
+                ip = net.IP(addr.Unmap().AsSlice())
+        }
+        for _, network := range p.Allow {
+                if network.Contains(ip) {
+                        return nil
+                }
+        }
+        for _, network := range p.Deny {
+                if network.Contains(ip) {
+                        return fmt.Errorf("address %s is %w", ip, ErrEgressDenied)
+                }
+        }
+        return nil
+}
+
+// checkScheme returns an error if the policy refuses the URL's scheme, or
+// if its host is an address the policy refuses
+func (p *EgressPolicy) checkScheme(u *url.URL) error {
+        scheme := strings.ToLower(u.Scheme)
+        allowed := false
+        for _, s := range p.Schemes {
+                allowed = allowed || s == scheme
+        }
+        if !allowed {
+                return fmt.Errorf("URL scheme %q is %w (allowed: %s)", u.Scheme, ErrEgressDenied, strings.Join(p.Schemes, ", "))
+        }
+        if ip := net.ParseIP(u.Hostname()); ip != nil {
+                return p.CheckIP(ip)
+        }
+        return nil
+}
+
+// CheckURL returns an error if the policy refuses the URL: its scheme, a
+// literal address, or any address its host currently resolves to; see
+// CheckHost.
+func (p *EgressPolicy) CheckURL(rawURL string) error {
+        u, err := url.Parse(rawURL)
+        if err != nil {
+                return fmt.Errorf("invalid URL: %v", err)
+        }
+        if err := p.checkScheme(u); err != nil {
+                return err
+        }
+        return p.CheckHost(u.Hostname())
+}
+
+// CheckHost returns an error if the policy refuses a literal address or any
+// address a host name currently resolves to. While any network is denied,
+// hosts that don't resolve are refused too, since a proxy connecting to them
+// may resolve them differently.
+func (p *EgressPolicy) CheckHost(host string) error {
+        if ip := net.ParseIP(host); ip != nil {
+                return p.CheckIP(ip)
+        }
+
+        ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+        defer cancel()
+        addrs, err := p.lookup(ctx, host)
+        if err != nil {
+                if len(p.Deny) == 0 {
+                        return nil
+                }
+                return fmt.Errorf("host %s can't be resolved, so it is %w: %v", host, ErrEgressDenied, err)
+        }
+        for _, addr := range addrs {
+                if err := p.CheckIP(addr.IP); err != nil {
+                        return fmt.Errorf("host %s resolves to %s, which is %w", host, addr.IP, ErrEgressDenied)
+                }
+        }
+        return nil
+}
+
+// lookup resolves a host name to its addresses
+func (p *EgressPolicy) lookup(ctx context.Context, host string) ([]net.IPAddr, error) {
+        if p.lookupIPAddr != nil {
+                return p.lookupIPAddr(ctx, host)
+        }
+        return net.DefaultResolver.LookupIPAddr(ctx, host)
+}
+
+// control refuses connections to addresses outside the policy. It runs
+// after DNS resolution for every connection, including redirects.
+func (p *EgressPolicy) control(network, address string, c syscall.RawConn) error {
+        host, _, err := net.SplitHostPort(address)
+        if err != nil {
+                return err
+        }
+        ip := net.ParseIP(host)
+        if ip == nil {
+                return fmt.Errorf("address %s is %w", host, ErrEgressDenied)
+        }
+        return p.CheckIP(ip)
+}
+
+// checkRedirect refuses redirects to schemes or literal addresses outside
+// the policy, and stops after 10 redirects like the default client
+func (p *EgressPolicy) checkRedirect(req *http.Request, via []*http.Request) error {
+        if len(via) >= 10 {
+                return errors.New("stopped after 10 redirects")
+        }
+        if err := p.checkScheme(req.URL); err != nil {
+                return fmt.Errorf("redirect to %s refused: %w", req.URL, err)
+        }
+        return nil
+}
+
+// requestTimeout limits each request of a check, including reading the
+// response and following its redirects
+const requestTimeout = 30 * time.Second
+
+// newClient returns an HTTP client whose connections and redirects follow
+// the policy, using tlsConfig for HTTPS if it is not nil and connecting
+// through the proxy chosen by proxy, or directly if it is nil; see proxyFunc
+func (p *EgressPolicy) newClient(tlsConfig *tls.Config, proxy func(*http.Request) (*url.URL, error)) *http.Client {
+        dialer := &net.Dialer{
+                Timeout:   30 * time.Second,
+                KeepAlive: 30 * time.Second,
+                Control:   p.control,
+        }
+        transport := http.DefaultTransport.(*http.Transport).Clone()
+        transport.DialContext = dialer.DialContext
+        transport.Proxy = proxy
+        if tlsConfig != nil {
+                transport.TLSClientConfig = tlsConfig
+        }
+        return &http.Client{
+                Timeout:       requestTimeout,
+                Transport:     transport,
+                CheckRedirect: p.checkRedirect,
+        }
+}
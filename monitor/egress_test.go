@@ -0,0 +1,190 @@
+package monitor
+
+import (
+        "context"
+        "errors"
+        "fmt"
+        "net"
+        "net/http"
+        "net/http/httptest"
+        "testing"
+)
+
+// testPolicy returns the default policy allowing the given networks, which
+// resolves host names from hosts rather than DNS
+func testPolicy(t *testing.T, allow []string, hosts map[string]string) *EgressPolicy {
+        t.Helper()
+        policy, err := NewEgressPolicy(DefaultEgressSchemes, allow, DefaultDeniedNetworks)
+        if err != nil {
+                t.Fatal(err)
+        }
+        policy.lookupIPAddr = func(ctx context.Context, host string) ([]net.IPAddr, error) {
+                address, ok := hosts[host]
+                if !ok {
+                        return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+                }
+                return []net.IPAddr{{IP: net.ParseIP(address)}}, nil
+        }
+        return policy
+}
+
+func TestNewEgressPolicy(t *testing.T) {
+        tests := []struct {
+                schemes, allow, deny []string
+                valid                bool
+        }{
+                {[]string{"http", "https"}, nil, DefaultDeniedNetworks, true},
+                {[]string{" HTTPS "}, []string{"10.0.0.1", "fd00::/8", ""}, []string{"0.0.0.0/0", "::/0"}, true},
+                {[]string{""}, nil, nil, false},
+                {nil, nil, nil, false},
+                {[]string{"https"}, []string{"10.0.0.256"}, nil, false},
+                {[]string{"https"}, nil, []string{"10.0.0.0/33"}, false},
+                {[]string{"https"}, nil, []string{"internal.example.com"}, false},
+        }
+        for _, test := range tests {
+                _, err := NewEgressPolicy(test.schemes, test.allow, test.deny)
+                if valid := err == nil; valid != test.valid {
+                        t.Errorf("NewEgressPolicy(%q, %q, %q): valid = %v, want %v (%v)", test.schemes, test.allow, test.deny, valid, test.valid, err)
+                }
+        }
+}
+
+func TestCheckIP(t *testing.T) {
+        policy := testPolicy(t, []string{"10.1.2.3", "fd12:3456::/32"}, nil)
+        tests := []struct {
+                ip      string
+                allowed bool
+        }{
+                {"93.184.216.34", true},
+                {"2606:2800:220:1::1", true},
+                {"127.0.0.1", false},
+                {"::1", false},
+                {"0.0.0.0", false},
+                {"::", false},
+                {"10.0.0.1", false},
+                {"172.16.0.1", false},
+                {"192.168.1.1", false},
+                {"100.64.0.1", false},
+                {"169.254.169.254", false},
+                {"224.0.0.1", false},
+                {"fe80::1", false},
+                {"fd00::1", false},
+                {"ff02::1", false},
+                {"::ffff:127.0.0.1", false},
+                {"::ffff:169.254.169.254", false},
+                {"64:ff9b::7f00:1", false},
+                {"64:ff9b:1::a00:1", false},
+                {"10.1.2.3", true},
+                {"::ffff:10.1.2.3", true},
+                {"10.1.2.4", false},
+                {"fd12:3456::1", true},
+                {"fd12:3457::1", false},
+        }
+        for _, test := range tests {
+                err := policy.CheckIP(net.ParseIP(test.ip))
+                if allowed := err == nil; allowed != test.allowed {
+                        t.Errorf("CheckIP(%s): allowed = %v, want %v (%v)", test.ip, allowed, test.allowed, err)
+                }
+                if err != nil && !errors.Is(err, ErrEgressDenied) {
+                        t.Errorf("CheckIP(%s) = %v, want ErrEgressDenied", test.ip, err)
+                }
+        }
+}
+
+func TestCheckURL(t *testing.T) {
+        hosts := map[string]string{
+                "public.example":   "93.184.216.34",
+                "internal.example": "10.0.0.5",
+                "mapped.example":   "::ffff:192.168.0.1",
+        }
+        policy := testPolicy(t, nil, hosts)
+        tests := []struct {
+                url     string
+                allowed bool
+        }{
+                {"https://public.example/status", true},
+                {"http://93.184.216.34/", true},
+                {"ftp://public.example/", false},
+                {"file:///etc/passwd", false},
+                {"http://127.0.0.1:8080/", false},
+                {"http://[::1]/", false},
+                {"http://[::ffff:127.0.0.1]/", false},
+                {"http://internal.example/", false},
+                {"http://mapped.example/", false},
+                {"http://unknown.example/", false},
+        }
+        for _, test := range tests {
+                err := policy.CheckURL(test.url)
+                if allowed := err == nil; allowed != test.allowed {
+                        t.Errorf("CheckURL(%s): allowed = %v, want %v (%v)", test.url, allowed, test.allowed, err)
+                }
+        }
+
+        // Without denied networks there is nothing to protect
+        open := testPolicy(t, nil, hosts)
+        open.Deny = nil
+        if err := open.CheckURL("http://unknown.example/"); err != nil {
+                t.Errorf("CheckURL of an unresolvable host without denied networks: %v", err)
+        }
+}
+
+func TestClientRefusesDeniedAddressesWhenConnecting(t *testing.T) {
+        server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+                fmt.Fprint(w, "ok")
+        }))
+        defer server.Close()
+
+        // The host names resolve normally when dialing, so only the dial-time
+        // check stands between the client and the loopback address
+        _, err := testPolicy(t, nil, nil).newClient(nil, nil).Get(server.URL)
+        if !errors.Is(err, ErrEgressDenied) {
+                t.Errorf("Get of a loopback address = %v, want ErrEgressDenied", err)
+        }
+
+        resp, err := testPolicy(t, []string{"127.0.0.1"}, nil).newClient(nil, nil).Get(server.URL)
+        if err != nil {
+                t.Fatalf("Get of an allowed loopback address: %v", err)
+        }
+        resp.Body.Close()
+}
+
+func TestClientRefusesDeniedRedirects(t *testing.T) {
+        server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+                http.Redirect(w, r, "http://169.254.169.254/latest/meta-data/", http.StatusFound)
+        }))
+        defer server.Close()
+
+        _, err := testPolicy(t, []string{"127.0.0.1"}, nil).newClient(nil, nil).Get(server.URL)
+        if !errors.Is(err, ErrEgressDenied) {
+                t.Errorf("Get redirected to a metadata endpoint = %v, want ErrEgressDenied", err)
+        }
+}
+
+func TestClientChecksProxiedTargets(t *testing.T) {
+        // The proxy answers every request itself, as if it had fetched it
+        proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+                fmt.Fprint(w, "proxied "+r.URL.Host)
+        }))
+        defer proxy.Close()
+
+        hosts := map[string]string{"public.example": "93.184.216.34", "internal.example": "10.0.0.5"}
+        policy := testPolicy(t, []string{"127.0.0.1"}, hosts)
+        proxyFunc, err := policy.proxyFunc(&ProxyConfig{URL: proxy.URL}, noSecrets)
+        if err != nil {
+                t.Fatal(err)
+        }
+        client := policy.newClient(nil, proxyFunc)
+
+        resp, err := client.Get("http://public.example/")
+        if err != nil {
+                t.Fatalf("Get of a public host through the proxy: %v", err)
+        }
+        resp.Body.Close()
+
+        for _, target := range []string{"http://internal.example/", "http://unknown.example/", "http://10.0.0.5/"} {
+                _, err := client.Get(target)
+                if !errors.Is(err, ErrEgressDenied) {
+                        t.Errorf("Get of %s through the proxy = %v, want ErrEgressDenied", target, err)
+                }
+        }
+}
@@ -0,0 +1,74 @@
+package monitor
+
+import (
+        "context"
+        "crypto/tls"
+        "crypto/x509"
+        "errors"
+        "net"
+        "net/http"
+        "time"
+)
+
+// Classes of check errors, for reporting errors by cause
+const (
+        ErrorClassConfig   = "config"   // The website's own configuration is unusable
+        ErrorClassPolicy   = "policy"   // The egress policy refused the URL or its address
+        ErrorClassAuth     = "auth"     // Credentials could not be obtained
+        ErrorClassDNS      = "dns"      // The host name could not be resolved
+        ErrorClassConnect  = "connect"  // The connection was refused or reset
+        ErrorClassTimeout  = "timeout"  // The request took too long
+        ErrorClassTLS      = "tls"      // The TLS handshake or certificate failed
+        ErrorClassHTTP     = "http"     // The server answered with an error status
+        ErrorClassRedirect = "redirect" // The redirect policy stopped the check
+        ErrorClassContent  = "content"  // The page didn't contain the selected content
+        ErrorClassOther    = "other"
+)
+
+// classifyError maps an error from an HTTP request to an error class
+func classifyError(err error) string {
+        var dnsErr *net.DNSError
+        var netErr net.Error
+        var opErr *net.OpError
+        var certErr *tls.CertificateVerificationError
+        var unknownAuthority x509.UnknownAuthorityError
+        var hostnameErr x509.HostnameError
+        var invalidCert x509.CertificateInvalidError
+        var recordErr tls.RecordHeaderError
+
+        switch {
+        case errors.Is(err, ErrEgressDenied):
+                return ErrorClassPolicy
+        case errors.Is(err, errRequestConfig):
+                return ErrorClassConfig
+        case errors.Is(err, ErrAuth):
+                return ErrorClassAuth
+        case errors.Is(err, ErrRedirectRefused):
+                return ErrorClassRedirect
+        case errors.As(err, &dnsErr):
+                return ErrorClassDNS
+        case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+                return ErrorClassTimeout
+        case errors.As(err, &certErr), errors.As(err, &unknownAuthority), errors.As(err, &hostnameErr),
+                errors.As(err, &invalidCert), errors.As(err, &recordErr):
+                return ErrorClassTLS
+        case errors.As(err, &opErr):
+                return ErrorClassConnect
+        }
+        return ErrorClassOther
+}
+
+// certExpiry returns the earliest expiry in the certificate chain the server
+// presented, or the zero time if the response wasn't over TLS
+func certExpiry(resp *http.Response) time.Time {
+        var earliest time.Time
+        if resp.TLS == nil {
+                return earliest
+        }
+        for _, cert := range resp.TLS.PeerCertificates {
+                if earliest.IsZero() || cert.NotAfter.Before(earliest) {
+                        earliest = cert.NotAfter
+                }
+        }
+        return earliest
+}
@@ -0,0 +1,100 @@
+package monitor
+
+import (
+        "sync"
+        "time"
+)
+
+// Types of events published by the monitor
+const (
+        EventCheckStarted    = "check-started"
+        EventCheckCompleted  = "check-completed"
+        EventChanged         = "changed"
+        EventError           = "error"
+        EventRedirectChanged = "redirect-changed" // The final URL or redirect chain changed
+)
+
+// eventBuffer is how many events a subscriber can fall behind before further
+// events are dropped for it
+const eventBuffer = 64
+
+// Event describes something that happened to a monitored website
+type Event struct {
+        ID        uint64    `json:"id"`
+        Type      string    `json:"type"`
+        WebsiteID int       `json:"websiteId"`
+        Time      time.Time `json:"time"`
+        Website   *Website  `json:"website"`
+}
+
+// eventHub fans events out to subscribers. It has its own lock so publishing
+// never waits on the monitor lock.
+type eventHub struct {
+        mu          sync.Mutex
+        lastID      uint64
+        subscribers map[chan *Event]struct{}
+}
+
+// Subscribe registers for events from the monitor. The returned channel is
+// closed by the cancel function, which must be called once the subscriber is
+// done. Events are dropped for subscribers that fall too far behind.
+func (m *Monitor) Subscribe() (<-chan *Event, func()) {
+        ch := make(chan *Event, eventBuffer)
+
+        m.events.mu.Lock()
+        if m.events.subscribers == nil {
+                m.events.subscribers = make(map[chan *Event]struct{})
+        }
+        m.events.subscribers[ch] = struct{}{}
+        m.events.mu.Unlock()
+
+        var once sync.Once
+        cancel := func() {
+                once.Do(func() {
+                        m.events.mu.Lock()
+                        delete(m.events.subscribers, ch)
+                        m.events.mu.Unlock()
+                        close(ch)
+                })
+        }
+        return ch, cancel
+}
+
+// publish sends an event about a copy of website to every subscriber
+func (m *Monitor) publish(eventType string, website *Website) {
+        m.events.mu.Lock()
+        defer m.events.mu.Unlock()
+
+        if len(m.events.subscribers) == 0 {
+                return
+        }
+
+        m.events.lastID++
+        event := &Event{
+                ID:        m.events.lastID,
+                Type:      eventType,
+                WebsiteID: website.ID,
+                Time:      time.Now(),
+                Website:   website,
+        }
+        for ch := range m.events.subscribers {
+                select {
+                case ch <- event:
+                default:
+                        // Subscriber is not keeping up; drop rather than stall checks
+                }
+        }
+}
+
+// publishResult sends the events for a completed check
+func (m *Monitor) publishResult(website *Website) {
+        m.publish(EventCheckCompleted, website)
+        if website.Error != "" {
+                m.publish(EventError, website)
+        } else if website.HasChanged {
+                m.publish(EventChanged, website)
+        }
+        if website.RedirectChanged {
+                m.publish(EventRedirectChanged, website)
+        }
+}
@@ -0,0 +1,72 @@
+package monitor
+
+import "testing"
+
+func TestSubscribe(t *testing.T) {
+        m := NewMonitor(nil)
+        first, cancelFirst := m.Subscribe()
+        second, cancelSecond := m.Subscribe()
+        defer cancelSecond()
+
+        m.publish(EventChanged, &Website{ID: 7})
+        for i, ch := range []<-chan *Event{first, second} {
+                event := <-ch
+                if event.ID != 1 || event.Type != EventChanged || event.WebsiteID != 7 {
+                        t.Errorf("subscriber %d received %+v", i+1, event)
+                }
+        }
+
+        // Cancelling closes the channel and can be repeated
+        cancelFirst()
+        cancelFirst()
+        if _, ok := <-first; ok {
+                t.Error("channel of a cancelled subscriber is still open")
+        }
+
+        m.publish(EventError, &Website{ID: 8})
+        if event := <-second; event.ID != 2 || event.WebsiteID != 8 {
+                t.Errorf("remaining subscriber received %+v", event)
+        }
+        m.events.mu.Lock()
+        subscribers := len(m.events.subscribers)
+        m.events.mu.Unlock()
+        if subscribers != 1 {
+                t.Errorf("%d subscribers after cancelling one, want 1", subscribers)
+        }
+}
+
+func TestSlowSubscribersDropEvents(t *testing.T) {
+        m := NewMonitor(nil)
+        events, cancel := m.Subscribe()
+        defer cancel()
+
+        // Publishing must not block on a subscriber that doesn't read
+        for i := 0; i < eventBuffer+10; i++ {
+                m.publish(EventCheckStarted, &Website{ID: i})
+        }
+        if len(events) != eventBuffer {
+                t.Errorf("%d events buffered, want %d", len(events), eventBuffer)
+        }
+        if event := <-events; event.WebsiteID != 0 {
+                t.Errorf("first buffered event is for website %d, want the oldest", event.WebsiteID)
+        }
+}
+
+func TestPublishResult(t *testing.T) {
+        m := NewMonitor(nil)
+        events, cancel := m.Subscribe()
+        defer cancel()
+
+        m.publishResult(&Website{ID: 1, Error: "timed out", RedirectChanged: true})
+        m.publishResult(&Website{ID: 2, HasChanged: true})
+
+        want := []string{EventCheckCompleted, EventError, EventRedirectChanged, EventCheckCompleted, EventChanged}
+        for _, eventType := range want {
+                if event := <-events; event.Type != eventType {
+                        t.Errorf("event %d is %s, want %s", event.ID, event.Type, eventType)
+                }
+        }
+        if len(events) != 0 {
+                t.Errorf("%d unexpected events", len(events))
+        }
+}
@@ -0,0 +1,144 @@
+package monitor
+
+import (
+        "strings"
+        "time"
+)
+
+// Group holds the defaults shared by the websites in a group and its
+// subgroups. Groups are hierarchical paths such as "marketing/landing-pages".
+type Group struct {
+        Path            string `json:"path"`
+        IntervalSeconds int    `json:"intervalSeconds"` // Default interval for websites without their own; 0 inherits
+}
+
+// CleanGroup normalizes a group path, trimming spaces and removing empty
+// segments, so "/Team//api/" becomes "Team/api"
+func CleanGroup(path string) string {
+        var segments []string
+        for _, segment := range strings.Split(path, "/") {
+                if segment = strings.TrimSpace(segment); segment != "" {
+                        segments = append(segments, segment)
+                }
+        }
+        return strings.Join(segments, "/")
+}
+
+// groupAncestors returns a group path followed by each of its parents, most
+// specific first
+func groupAncestors(path string) []string {
+        var paths []string
+        for path != "" {
+                paths = append(paths, path)
+                i := strings.LastIndex(path, "/")
+                if i < 0 {
+                        break
+                }
+                path = path[:i]
+        }
+        return paths
+}
+
+// InGroup reports whether the website belongs to group or one of its
+// subgroups. Every website is in the empty group.
+func (w *Website) InGroup(group string) bool {
+        group = CleanGroup(group)
+        return group == "" || w.Group == group || strings.HasPrefix(w.Group, group+"/")
+}
+
+// HasTags reports whether the website has every one of tags
+func (w *Website) HasTags(tags []string) bool {
+        for _, tag := range tags {
+                found := false
+                for _, own := range w.Tags {
+                        if own == tag {
+                                found = true
+                                break
+                        }
+                }
+                if !found {
+                        return false
+                }
+        }
+        return true
+}
+
+// SetGroupSaveFunc sets the function called when group defaults change
+func (m *Monitor) SetGroupSaveFunc(saveFunction func(*Group)) {
+        m.mu.Lock()
+        defer m.mu.Unlock()
+
+        m.groupSaveFunc = saveFunction
+}
+
+// SetGroup stores the defaults of a group and returns a copy of them
+func (m *Monitor) SetGroup(group *Group) *Group {
+        m.mu.Lock()
+        stored := &Group{Path: CleanGroup(group.Path), IntervalSeconds: group.IntervalSeconds}
+        m.groups[stored.Path] = stored
+        snapshot := *stored
+        saveFunc := m.groupSaveFunc
+        m.mu.Unlock()
+
+        if saveFunc != nil {
+                saveFunc(&snapshot)
+        }
+        return &snapshot
+}
+
+// AddExistingGroup adds group defaults that were loaded from the database
+func (m *Monitor) AddExistingGroup(group *Group) {
+        m.mu.Lock()
+        defer m.mu.Unlock()
+
+        m.groups[CleanGroup(group.Path)] = group
+}
+
+// RemoveGroup forgets the defaults of a group. Like RemoveWebsite, deleting
+// them from the database is handled by the caller.
+func (m *Monitor) RemoveGroup(path string) bool {
+        m.mu.Lock()
+        defer m.mu.Unlock()
+
+        path = CleanGroup(path)
+        if _, ok := m.groups[path]; !ok {
+                return false
+        }
+        delete(m.groups, path)
+        return true
+}
+
+// GetGroups returns copies of the stored group defaults
+func (m *Monitor) GetGroups() []*Group {
+        m.mu.RLock()
+        defer m.mu.RUnlock()
+
+        groups := make([]*Group, 0, len(m.groups))
+        for _, group := range m.groups {
+                c := *group
+                groups = append(groups, &c)
+        }
+        return groups
+}
+
+// EffectiveInterval returns how often a website is checked: its own interval,
+// else the interval of its nearest group that sets one, else DefaultInterval
+func (m *Monitor) EffectiveInterval(website *Website) time.Duration {
+        m.mu.RLock()
+        defer m.mu.RUnlock()
+
+        return m.intervalLocked(website)
+}
+
+// intervalLocked implements EffectiveInterval; m.mu must be held
+func (m *Monitor) intervalLocked(website *Website) time.Duration {
+        if website.IntervalSeconds > 0 {
+                return website.Interval()
+        }
+        for _, path := range groupAncestors(website.Group) {
+                if group, ok := m.groups[path]; ok && group.IntervalSeconds > 0 {
+                        return time.Duration(group.IntervalSeconds) * time.Second
+                }
+        }
+        return DefaultInterval
+}
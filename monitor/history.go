@@ -0,0 +1,54 @@
+package monitor
+
+import (
+        "time"
+)
+
+// HistoryRetention is how long check history is kept. It covers the
+// previous calendar month at any time, for SLA reports.
+const HistoryRetention = 62 * 24 * time.Hour
+
+// HistoryEntry records the outcome of a single check of a website
+type HistoryEntry struct {
+        WebsiteID   int          `json:"websiteId"`
+        CheckedAt   time.Time    `json:"checkedAt"`
+        StatusCode  int          `json:"statusCode"`
+        Hash        string       `json:"hash"`
+        Changed     bool         `json:"changed"`
+        Error       string       `json:"error"`
+        DurationMs  int64        `json:"durationMs"`  // Time taken to fetch the website
+        Maintenance bool         `json:"maintenance"` // Whether the check ran during a maintenance window
+        ErrorClass  string       `json:"errorClass,omitempty"`
+        BodySize    int64        `json:"bodySize"`
+        CertExpiry  time.Time    `json:"certExpiry"`       // Zero unless the website was fetched over HTTPS
+        Steps       []StepResult `json:"steps,omitempty"`  // Steps of a transaction check
+        Timing      *Timing      `json:"timing,omitempty"` // Unset if no request was sent
+
+        FinalURL        string     `json:"finalURL,omitempty"`
+        Redirects       []Redirect `json:"redirects,omitempty"`
+        RedirectChanged bool       `json:"redirectChanged,omitempty"`
+}
+
+// newHistoryEntry builds a history entry from a website that has just had a
+// check result applied
+func newHistoryEntry(website *Website, result checkResult) *HistoryEntry {
+        return &HistoryEntry{
+                WebsiteID:   website.ID,
+                CheckedAt:   website.LastChecked,
+                StatusCode:  website.LastStatusCode,
+                Hash:        result.hash,
+                Changed:     website.HasChanged,
+                Error:       website.Error,
+                DurationMs:  result.duration.Milliseconds(),
+                Maintenance: website.Maintenance,
+                ErrorClass:  result.errClass,
+                BodySize:    result.bodySize,
+                CertExpiry:  result.certExpiry,
+                Steps:       result.steps,
+                Timing:      result.timing,
+
+                FinalURL:        result.finalURL,
+                Redirects:       result.redirects,
+                RedirectChanged: website.RedirectChanged,
+        }
+}
@@ -0,0 +1,182 @@
+package monitor
+
+import (
+        "crypto/rand"
+        "encoding/hex"
+        "sync"
+        "time"
+)
+
+// Job and per-website result states
+const (
+        JobQueued  = "queued"
+        JobRunning = "running"
+        JobDone    = "done"
+
+        JobResultPending = "pending"
+        JobResultDone    = "done"
+        JobResultSkipped = "skipped" // Removed before it could be checked
+)
+
+const (
+        // jobConcurrency limits how many websites one job checks at once
+        jobConcurrency = 8
+        // jobRetention is how long finished jobs are kept for status queries
+        jobRetention = time.Hour
+)
+
+// CheckJob is a batch of checks running in the background. Only the user who
+// started it can query it.
+type CheckJob struct {
+        ID         string            `json:"id"`
+        Owner      string            `json:"owner"`     // User who started the job
+        Workspace  string            `json:"workspace"` // Workspace of that user
+        Status     string            `json:"status"`
+        CreatedAt  time.Time         `json:"createdAt"`
+        StartedAt  time.Time         `json:"startedAt"`
+        FinishedAt time.Time         `json:"finishedAt"`
+        Total      int               `json:"total"`
+        Completed  int               `json:"completed"`
+        Changed    int               `json:"changed"`
+        Errored    int               `json:"errored"`
+        Results    []*CheckJobResult `json:"results"`
+}
+
+// CheckJobResult is the outcome of one website in a check job
+type CheckJobResult struct {
+        WebsiteID  int    `json:"websiteId"`
+        Name       string `json:"name"`
+        URL        string `json:"url"`
+        Status     string `json:"status"`
+        StatusCode int    `json:"statusCode"`
+        Changed    bool   `json:"changed"`
+        Error      string `json:"error,omitempty"`
+}
+
+// clone returns a copy of the job that can be read without holding the lock
+func (j *CheckJob) clone() *CheckJob {
+        copied := *j
+        copied.Results = make([]*CheckJobResult, len(j.Results))
+        for i, result := range j.Results {
+                r := *result
+                copied.Results[i] = &r
+        }
+        return &copied
+}
+
+// jobQueue tracks check jobs. It has its own lock so status queries never
+// wait on the monitor lock.
+type jobQueue struct {
+        mu   sync.Mutex
+        jobs map[string]*CheckJob
+}
+
+// newJobID returns a random job identifier
+func newJobID() string {
+        buf := make([]byte, 8)
+        rand.Read(buf)
+        return hex.EncodeToString(buf)
+}
+
+// StartCheckJob checks the given websites in the background for the owner,
+// a user of workspace, and returns a copy of the new job; poll GetCheckJob
+// for its progress.
+func (m *Monitor) StartCheckJob(ids []int, owner, workspace string) *CheckJob {
+        job := &CheckJob{
+                ID:        newJobID(),
+                Owner:     owner,
+                Workspace: workspace,
+                Status:    JobQueued,
+                CreatedAt: time.Now(),
+                Total:     len(ids),
+        }
+        for _, id := range ids {
+                result := &CheckJobResult{WebsiteID: id, Status: JobResultPending}
+                if website := m.GetWebsiteByID(id); website != nil {
+                        result.Name = website.Name
+                        result.URL = website.URL
+                }
+                job.Results = append(job.Results, result)
+        }
+
+        m.jobs.mu.Lock()
+        if m.jobs.jobs == nil {
+                m.jobs.jobs = make(map[string]*CheckJob)
+        }
+        m.pruneJobsLocked(job.CreatedAt)
+        m.jobs.jobs[job.ID] = job
+        snapshot := job.clone()
+        m.jobs.mu.Unlock()
+
+        m.scheduler.queued.Add(int64(len(ids)))
+        go m.runCheckJob(job)
+        return snapshot
+}
+
+// GetCheckJob returns a copy of a check job, or nil if it is unknown, has
+// expired or was started by someone other than the owner of workspace
+func (m *Monitor) GetCheckJob(id, owner, workspace string) *CheckJob {
+        m.jobs.mu.Lock()
+        defer m.jobs.mu.Unlock()
+
+        job, ok := m.jobs.jobs[id]
+        if !ok || job.Owner != owner || job.Workspace != workspace {
+                return nil
+        }
+        return job.clone()
+}
+
+// runCheckJob checks the websites of a job, recording each result as it
+// completes
+func (m *Monitor) runCheckJob(job *CheckJob) {
+        m.jobs.mu.Lock()
+        job.Status = JobRunning
+        job.StartedAt = time.Now()
+        m.jobs.mu.Unlock()
+
+        slots := make(chan struct{}, jobConcurrency)
+        var wg sync.WaitGroup
+        for _, result := range job.Results {
+                wg.Add(1)
+                slots <- struct{}{}
+                go func(result *CheckJobResult) {
+                        defer wg.Done()
+                        defer func() { <-slots }()
+                        defer m.scheduler.queued.Add(-1)
+
+                        website := m.CheckWebsite(result.WebsiteID)
+
+                        m.jobs.mu.Lock()
+                        defer m.jobs.mu.Unlock()
+                        job.Completed++
+                        if website == nil {
+                                result.Status = JobResultSkipped
+                                return
+                        }
+                        result.Status = JobResultDone
+                        result.StatusCode = website.LastStatusCode
+                        result.Changed = website.HasChanged
+                        result.Error = website.Error
+                        if website.Error != "" {
+                                job.Errored++
+                        } else if website.HasChanged {
+                                job.Changed++
+                        }
+                }(result)
+        }
+        wg.Wait()
+
+        m.jobs.mu.Lock()
+        job.Status = JobDone
+        job.FinishedAt = time.Now()
+        m.jobs.mu.Unlock()
+}
+
+// pruneJobsLocked forgets jobs that finished more than jobRetention ago
+func (m *Monitor) pruneJobsLocked(now time.Time) {
+        for id, job := range m.jobs.jobs {
+                if job.Status == JobDone && now.Sub(job.FinishedAt) > jobRetention {
+                        delete(m.jobs.jobs, id)
+                }
+        }
+}
@@ -0,0 +1,111 @@
+package monitor
+
+import (
+        "fmt"
+        "net/http"
+        "net/http/httptest"
+        "testing"
+        "time"
+)
+
+// waitForJob polls a job until done reports true for it
+func waitForJob(t *testing.T, m *Monitor, id string, done func(*CheckJob) bool) *CheckJob {
+        t.Helper()
+        deadline := time.Now().Add(5 * time.Second)
+        for {
+                job := m.GetCheckJob(id, "alice", "default")
+                if job == nil {
+                        t.Fatalf("job %s not found", id)
+                }
+                if done(job) {
+                        return job
+                }
+                if time.Now().After(deadline) {
+                        t.Fatalf("job %s is stuck: %+v", id, job)
+                }
+                time.Sleep(10 * time.Millisecond)
+        }
+}
+
+func TestCheckJobProgress(t *testing.T) {
+        release := make(chan struct{})
+        server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+                switch r.URL.Path {
+                case "/slow":
+                        <-release
+                case "/fail":
+                        w.WriteHeader(http.StatusInternalServerError)
+                }
+                fmt.Fprint(w, "ok")
+        }))
+        defer server.Close()
+
+        m := NewMonitor(nil)
+        m.SetProxy(nil)
+        m.SetEgressPolicy(testPolicy(t, []string{"127.0.0.1", "::1"}, nil))
+        m.AddExistingWebsite(&Website{ID: 1, Name: "fast", URL: server.URL + "/", IsFirstCheck: true})
+        m.AddExistingWebsite(&Website{ID: 2, Name: "slow", URL: server.URL + "/slow", IsFirstCheck: true})
+        m.AddExistingWebsite(&Website{ID: 3, Name: "fail", URL: server.URL + "/fail", IsFirstCheck: true})
+
+        // Website 4 does not exist, so it is skipped
+        started := m.StartCheckJob([]int{1, 2, 3, 4}, "alice", "default")
+        if started.Total != 4 || len(started.Results) != 4 || started.Results[1].Name != "slow" {
+                t.Fatalf("started job = %+v", started)
+        }
+
+        job := waitForJob(t, m, started.ID, func(job *CheckJob) bool { return job.Completed == 3 })
+        if job.Status != JobRunning || job.Results[1].Status != JobResultPending {
+                t.Errorf("job with a check in progress: status %s, slow website %s", job.Status, job.Results[1].Status)
+        }
+
+        close(release)
+        job = waitForJob(t, m, started.ID, func(job *CheckJob) bool { return job.Status == JobDone })
+        if job.Completed != 4 || job.Errored != 1 || job.FinishedAt.IsZero() {
+                t.Errorf("finished job: completed %d, errored %d, finished at %v", job.Completed, job.Errored, job.FinishedAt)
+        }
+        want := []string{JobResultDone, JobResultDone, JobResultDone, JobResultSkipped}
+        for i, result := range job.Results {
+                if result.Status != want[i] {
+                        t.Errorf("website %d: status %s, want %s", result.WebsiteID, result.Status, want[i])
+                }
+        }
+        if job.Results[2].StatusCode != http.StatusInternalServerError || job.Results[2].Error == "" {
+                t.Errorf("failed website: %+v", job.Results[2])
+        }
+}
+
+func TestCheckJobOwner(t *testing.T) {
+        m := NewMonitor(nil)
+        job := m.StartCheckJob(nil, "alice", "default")
+
+        if m.GetCheckJob(job.ID, "alice", "default") == nil {
+                t.Error("owner can't read the job")
+        }
+        if m.GetCheckJob(job.ID, "bob", "default") != nil {
+                t.Error("another user can read the job")
+        }
+        if m.GetCheckJob(job.ID, "alice", "sales") != nil {
+                t.Error("a user of another workspace can read the job")
+        }
+}
+
+func TestCheckJobRetention(t *testing.T) {
+        m := NewMonitor(nil)
+        old := m.StartCheckJob(nil, "alice", "default")
+        recent := m.StartCheckJob(nil, "alice", "default")
+        waitForJob(t, m, old.ID, func(job *CheckJob) bool { return job.Status == JobDone })
+        waitForJob(t, m, recent.ID, func(job *CheckJob) bool { return job.Status == JobDone })
+
+        m.jobs.mu.Lock()
+        m.jobs.jobs[old.ID].FinishedAt = time.Now().Add(-jobRetention - time.Minute)
+        m.jobs.mu.Unlock()
+
+        // Starting a job forgets expired ones
+        m.StartCheckJob(nil, "alice", "default")
+        if m.GetCheckJob(old.ID, "alice", "default") != nil {
+                t.Error("job finished more than the retention ago was kept")
+        }
+        if m.GetCheckJob(recent.ID, "alice", "default") == nil {
+                t.Error("recently finished job was forgotten")
+        }
+}
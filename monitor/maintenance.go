@@ -0,0 +1,138 @@
+package monitor
+
+import (
+        "fmt"
+        "sort"
+        "time"
+)
+
+// MaintenanceWindow is a scheduled period during which websites are still
+// checked but their errors and changes are not alerted on. A window with no
+// websites and no group covers every website.
+type MaintenanceWindow struct {
+        ID          int       `json:"id"`
+        Start       time.Time `json:"start"`
+        End         time.Time `json:"end"`
+        WebsiteIDs  []int     `json:"websiteIds"` // Websites covered by the window
+        Group       string    `json:"group"`      // Group covered by the window, including subgroups
+        Description string    `json:"description"`
+}
+
+// Validate checks the window's times
+func (mw *MaintenanceWindow) Validate() error {
+        if mw.Start.IsZero() || mw.End.IsZero() {
+                return fmt.Errorf("Start and end are required")
+        }
+        if !mw.End.After(mw.Start) {
+                return fmt.Errorf("End must be after start")
+        }
+        return nil
+}
+
+// Covers reports whether the window applies to a website at the given time
+func (mw *MaintenanceWindow) Covers(website *Website, at time.Time) bool {
+        if at.Before(mw.Start) || !at.Before(mw.End) {
+                return false
+        }
+        if len(mw.WebsiteIDs) == 0 && mw.Group == "" {
+                return true
+        }
+        for _, id := range mw.WebsiteIDs {
+                if id == website.ID {
+                        return true
+                }
+        }
+        return mw.Group != "" && website.InGroup(mw.Group)
+}
+
+// clone returns a copy of the window that shares no state with the original
+func (mw *MaintenanceWindow) clone() *MaintenanceWindow {
+        c := *mw
+        c.WebsiteIDs = append([]int(nil), mw.WebsiteIDs...)
+        return &c
+}
+
+// SetMaintenanceSaveFunc sets the function called when a maintenance window is added
+func (m *Monitor) SetMaintenanceSaveFunc(saveFunction func(*MaintenanceWindow)) {
+        m.mu.Lock()
+        defer m.mu.Unlock()
+
+        m.maintenanceSaveFunc = saveFunction
+}
+
+// AddMaintenanceWindow schedules a maintenance window and returns a copy of it
+// with its assigned ID
+func (m *Monitor) AddMaintenanceWindow(window *MaintenanceWindow) *MaintenanceWindow {
+        m.mu.Lock()
+        stored := window.clone()
+        stored.Group = CleanGroup(stored.Group)
+        stored.ID = 1
+        for _, existing := range m.maintenance {
+                if existing.ID >= stored.ID {
+                        stored.ID = existing.ID + 1
+                }
+        }
+        m.maintenance = append(m.maintenance, stored)
+        snapshot := stored.clone()
+        saveFunc := m.maintenanceSaveFunc
+        m.mu.Unlock()
+
+        if saveFunc != nil {
+                saveFunc(snapshot)
+        }
+        return snapshot
+}
+
+// AddExistingMaintenanceWindow adds a maintenance window that was loaded from the database
+func (m *Monitor) AddExistingMaintenanceWindow(window *MaintenanceWindow) {
+        m.mu.Lock()
+        defer m.mu.Unlock()
+
+        m.maintenance = append(m.maintenance, window)
+}
+
+// RemoveMaintenanceWindow cancels a maintenance window. Like RemoveWebsite,
+// deleting it from the database is handled by the caller.
+func (m *Monitor) RemoveMaintenanceWindow(id int) bool {
+        m.mu.Lock()
+        defer m.mu.Unlock()
+
+        for i, window := range m.maintenance {
+                if window.ID == id {
+                        m.maintenance = append(m.maintenance[:i], m.maintenance[i+1:]...)
+                        return true
+                }
+        }
+        return false
+}
+
+// GetMaintenanceWindows returns copies of all maintenance windows ordered by start time
+func (m *Monitor) GetMaintenanceWindows() []*MaintenanceWindow {
+        m.mu.RLock()
+        defer m.mu.RUnlock()
+
+        windows := make([]*MaintenanceWindow, len(m.maintenance))
+        for i, window := range m.maintenance {
+                windows[i] = window.clone()
+        }
+        sort.Slice(windows, func(i, j int) bool { return windows[i].Start.Before(windows[j].Start) })
+        return windows
+}
+
+// InMaintenance reports whether any maintenance window covers a website at the given time
+func (m *Monitor) InMaintenance(website *Website, at time.Time) bool {
+        m.mu.RLock()
+        defer m.mu.RUnlock()
+
+        return m.inMaintenanceLocked(website, at)
+}
+
+// inMaintenanceLocked implements InMaintenance; m.mu must be held
+func (m *Monitor) inMaintenanceLocked(website *Website, at time.Time) bool {
+        for _, window := range m.maintenance {
+                if window.Covers(website, at) {
+                        return true
+                }
+        }
+        return false
+}
@@ -5,10 +5,12 @@ import (
         "crypto/tls"
         "crypto/x509"
         "encoding/hex"
+        "errors"
         "fmt"
         "io"
         "log"
         "net/http"
+        "net/url"
         "os"
         "sync"
         "time"
@@ -16,23 +18,154 @@ import (
 
 // Monitor keeps track of websites and checks for changes
 type Monitor struct {
-        websites  []*Website
-        mu        sync.RWMutex
-        client    *http.Client
-        idCounter int
-        saveFunc  func(*Website) // Function to save website changes to database
+        websites    []*Website
+        mu          sync.RWMutex
+        siteLocks   map[int]*siteLock // Serialize checks and saves of the same website
+        version     uint64            // Last version given to a website snapshot
+        client      *http.Client
+        egress      *EgressPolicy // What checks may connect to
+        proxy       *ProxyConfig  // Global proxy; nil to connect directly
+        tokens      tokenCache    // OAuth2 access tokens
+        sessions    sessionStore  // Form login sessions
+        idCounter   int
+        saveFunc    func(*Website)               // Function to save website changes to database
+        historyFunc func(*HistoryEntry)          // Function to record each completed check
+        secretFunc  SecretFunc                   // Looks up secrets referenced by request templates
+        resumeFunc  func(before, after *Website) // Function to record pauses that ran out
+
+        groups        map[string]*Group // Group defaults by path
+        groupSaveFunc func(*Group)      // Function to save group defaults to database
+
+        maintenance         []*MaintenanceWindow
+        maintenanceSaveFunc func(*MaintenanceWindow) // Function to save maintenance windows to database
+
+        events    eventHub       // Subscribers to check events
+        jobs      jobQueue       // Background check jobs
+        scheduler schedulerState // Queue depth and scheduling cycle statistics
 }
 
-// NewMonitor creates a new website monitor instance
+// checkResult holds the outcome of fetching a website, before it is applied
+type checkResult struct {
+        statusCode int
+        hash       string
+        err        string
+        errClass   string // One of the ErrorClass constants when err is set
+        duration   time.Duration
+        bodySize   int64
+        certExpiry time.Time    // Earliest expiry in the server's certificate chain, for HTTPS
+        steps      []StepResult // Outcome of each step of a transaction check
+        finalURL   string       // Where the request ended up, if there was a response
+        redirects  []Redirect   // Redirects on the way to finalURL
+        timing     *Timing      // Where the time went, if a request was sent
+}
+
+// NewMonitor creates a new website monitor instance. It may connect to any
+// address over the default schemes; servers shared by several users should
+// restrict it with SetEgressPolicy. It connects through the proxy set in the
+// environment, if any; see ProxyFromEnvironment and SetProxy.
 func NewMonitor(saveFunction func(*Website)) *Monitor {
-        return &Monitor{
-                websites: []*Website{},
-                client: &http.Client{
-                        Timeout: 30 * time.Second,
-                },
-                idCounter: 1,
-                saveFunc: saveFunction,
+        proxy, err := ProxyFromEnvironment()
+        if err != nil {
+                log.Printf("Ignoring proxy environment variables: %v", err)
+        }
+        m := &Monitor{
+                websites:   []*Website{},
+                siteLocks:  make(map[int]*siteLock),
+                groups:     make(map[string]*Group),
+                egress:     &EgressPolicy{Schemes: DefaultEgressSchemes},
+                proxy:      proxy,
+                idCounter:  1,
+                saveFunc:   saveFunction,
+                secretFunc: noSecrets,
+        }
+        m.client = m.newClientLocked()
+        return m
+}
+
+// SetEgressPolicy replaces the policy limiting what checks may connect to
+func (m *Monitor) SetEgressPolicy(policy *EgressPolicy) {
+        m.mu.Lock()
+        defer m.mu.Unlock()
+
+        m.egress = policy
+        m.client = m.newClientLocked()
+}
+
+// SetProxy sets the global proxy checks connect through, unless a website
+// has proxy settings of its own; nil connects directly
+func (m *Monitor) SetProxy(proxy *ProxyConfig) error {
+        m.mu.Lock()
+        defer m.mu.Unlock()
+
+        if _, err := m.egress.proxyFunc(proxy, noSecrets); err != nil {
+                return err
         }
+        m.proxy = proxy.clone()
+        m.client = m.newClientLocked()
+        return nil
+}
+
+// newClientLocked returns the client for websites without TLS or proxy
+// settings of their own. The caller must hold m.mu.
+func (m *Monitor) newClientLocked() *http.Client {
+        // The global proxy was checked by SetProxy and has no templates
+        proxy, _ := m.egress.proxyFunc(m.proxy, noSecrets)
+        return m.egress.newClient(nil, proxy)
+}
+
+// CheckURL returns an error if the egress policy refuses a website URL, so
+// it can be rejected before it is added
+func (m *Monitor) CheckURL(rawURL string) error {
+        m.mu.RLock()
+        policy := m.egress
+        m.mu.RUnlock()
+
+        return policy.CheckURL(rawURL)
+}
+
+// CheckProxy returns an error if the egress policy refuses connections to a
+// website's proxy
+func (m *Monitor) CheckProxy(proxy *ProxyConfig) error {
+        if proxy == nil || proxy.Direct {
+                return nil
+        }
+        u, err := parseProxyURL(proxy.URL)
+        if err != nil {
+                return err
+        }
+
+        m.mu.RLock()
+        policy := m.egress
+        m.mu.RUnlock()
+
+        return policy.CheckHost(u.Hostname())
+}
+
+// SetHistoryFunc sets the function called with the outcome of every check
+func (m *Monitor) SetHistoryFunc(historyFunction func(*HistoryEntry)) {
+        m.mu.Lock()
+        defer m.mu.Unlock()
+
+        m.historyFunc = historyFunction
+}
+
+// SetResumeFunc sets the function called when a website resumes by itself
+// because its pause ran out, with the website before and after, so the
+// change can be recorded like those made by users
+func (m *Monitor) SetResumeFunc(resumeFunction func(before, after *Website)) {
+        m.mu.Lock()
+        defer m.mu.Unlock()
+
+        m.resumeFunc = resumeFunction
+}
+
+// SetSecretFunc sets the function that looks up secrets referenced by the
+// request templates of websites
+func (m *Monitor) SetSecretFunc(secretFunction SecretFunc) {
+        m.mu.Lock()
+        defer m.mu.Unlock()
+
+        m.secretFunc = secretFunction
 }
 
 // AddWebsite adds a new website to monitor
@@ -42,42 +175,101 @@ func (m *Monitor) AddWebsite(url, name string) *Website {
 
 // AddWebsiteWithPKI adds a new website with PKI configuration to monitor
 func (m *Monitor) AddWebsiteWithPKI(url, name string, usePKI bool, clientCertPath, clientKeyPath string, skipTLSVerify bool, customRootCAPath string) *Website {
-        m.mu.Lock()
-        defer m.mu.Unlock()
-
-        website := &Website{
-                ID:               m.idCounter,
+        return m.AddConfiguredWebsite(&Website{
                 URL:              url,
                 Name:             name,
-                LastChecked:      time.Time{},
-                LastHash:         "",
-                HasChanged:       false,
-                IsFirstCheck:     true,
-                LastStatusCode:   0,
-                Error:            "",
                 UsePKI:           usePKI,
                 ClientCertPath:   clientCertPath,
                 ClientKeyPath:    clientKeyPath,
                 SkipTLSVerify:    skipTLSVerify,
                 CustomRootCAPath: customRootCAPath,
+        })
+}
+
+// AddConfiguredWebsite adds a new website to monitor using the configuration
+// fields of config, and returns a copy of the added website
+func (m *Monitor) AddConfiguredWebsite(config *Website) *Website {
+        website, _ := m.AddWebsiteWithID(0, config)
+        return website
+}
+
+// AddWebsiteWithID adds a new website to monitor under a specific ID, as when
+// importing websites from another instance. An ID of zero assigns the next
+// free ID. It fails if the ID is already in use.
+func (m *Monitor) AddWebsiteWithID(id int, config *Website) (*Website, error) {
+        m.mu.Lock()
+        if id == 0 {
+                id = m.idCounter
+        } else if id < 0 {
+                m.mu.Unlock()
+                return nil, fmt.Errorf("invalid website ID %d", id)
+        } else if m.findLocked(id) != nil {
+                m.mu.Unlock()
+                return nil, fmt.Errorf("website ID %d is already in use", id)
         }
 
+        website := NewWebsite(id, config)
         m.websites = append(m.websites, website)
-        m.idCounter++
-
-        // Save website to database if save function is provided
-        if m.saveFunc != nil {
-                m.saveFunc(website)
+        if id >= m.idCounter {
+                m.idCounter = id + 1
         }
+        snapshot := m.snapshotLocked(website)
+        m.mu.Unlock()
+
+        m.persist(snapshot)
 
         // Immediately check the website
-        go m.CheckWebsite(website)
+        go m.CheckWebsite(snapshot.ID)
 
-        return website
+        return snapshot, nil
 }
 
-// RemoveWebsite removes a website from monitoring
+// UpdateWebsite replaces the configuration of a website with the configuration
+// fields of config. It returns a copy of the updated website, or nil if no
+// website with that ID is being monitored.
+func (m *Monitor) UpdateWebsite(id int, config *Website) *Website {
+        m.mu.Lock()
+        website := m.findLocked(id)
+        if website == nil {
+                m.mu.Unlock()
+                return nil
+        }
+        website.ApplyConfig(config)
+        snapshot := m.snapshotLocked(website)
+        m.mu.Unlock()
+
+        m.persist(snapshot)
+
+        return snapshot
+}
+
+// SetOwner changes the user who owns a website. It returns a copy of the
+// updated website, or nil if no website with that ID is being monitored.
+func (m *Monitor) SetOwner(id int, owner string) *Website {
+        m.mu.Lock()
+        website := m.findLocked(id)
+        if website == nil {
+                m.mu.Unlock()
+                return nil
+        }
+        website.Owner = owner
+        snapshot := m.snapshotLocked(website)
+        m.mu.Unlock()
+
+        m.persist(snapshot)
+
+        return snapshot
+}
+
+// RemoveWebsite removes a website from monitoring. It waits for a save of
+// the website in progress, and later saves are skipped, so once it returns
+// the website can be deleted from the database without coming back.
 func (m *Monitor) RemoveWebsite(id int) bool {
+        lock := m.acquireSite(id)
+        defer m.releaseSite(id, lock)
+        lock.save.Lock()
+        defer lock.save.Unlock()
+
         m.mu.Lock()
         defer m.mu.Unlock()
 
@@ -85,7 +277,8 @@ func (m *Monitor) RemoveWebsite(id int) bool {
                 if website.ID == id {
                         // Remove the website from the slice
                         m.websites = append(m.websites[:i], m.websites[i+1:]...)
-                        
+                        m.sessions.remove(id)
+
                         // This function doesn't use website.saveFunc because
                         // we can't access individual websites once they're deleted,
                         // so this is handled externally in the handlers package
@@ -95,23 +288,50 @@ func (m *Monitor) RemoveWebsite(id int) bool {
         return false
 }
 
-// GetWebsites returns all monitored websites
+// GetWebsites returns copies of all monitored websites
 func (m *Monitor) GetWebsites() []*Website {
         m.mu.RLock()
         defer m.mu.RUnlock()
 
-        // Create a copy to avoid race conditions
+        // Return copies so callers can read them without holding the lock
         websites := make([]*Website, len(m.websites))
-        copy(websites, m.websites)
+        for i, website := range m.websites {
+                websites[i] = website.clone()
+        }
 
         return websites
 }
 
-// GetWebsiteByID returns a website by its ID
+// GetWebsiteByID returns a copy of a website by its ID
 func (m *Monitor) GetWebsiteByID(id int) *Website {
         m.mu.RLock()
         defer m.mu.RUnlock()
 
+        if website := m.findLocked(id); website != nil {
+                return website.clone()
+        }
+        return nil
+}
+
+// FindDuplicate returns a copy of a monitored website, other than the one
+// with ID exceptID, whose URL matches rawURL as compared by URLKey, or nil if
+// there is none
+func (m *Monitor) FindDuplicate(rawURL string, exceptID int) *Website {
+        key := URLKey(rawURL)
+
+        m.mu.RLock()
+        defer m.mu.RUnlock()
+
+        for _, website := range m.websites {
+                if website.ID != exceptID && URLKey(website.URL) == key {
+                        return website.clone()
+                }
+        }
+        return nil
+}
+
+// findLocked returns the stored website with the given ID; m.mu must be held
+func (m *Monitor) findLocked(id int) *Website {
         for _, website := range m.websites {
                 if website.ID == id {
                         return website
@@ -120,96 +340,252 @@ func (m *Monitor) GetWebsiteByID(id int) *Website {
         return nil
 }
 
-// CheckWebsite performs a check on a single website
-func (m *Monitor) CheckWebsite(website *Website) {
+// siteLock serializes work on one website. Checks hold check for their whole
+// duration; save is held while a snapshot is saved or the website removed.
+type siteLock struct {
+        check sync.Mutex
+        save  sync.Mutex
+        refs  int    // Callers holding or waiting for the locks; guarded by Monitor.mu
+        saved uint64 // Version of the last snapshot saved; guarded by save
+}
+
+// acquireSite returns the locks of the given website, keeping them until
+// the matching releaseSite
+func (m *Monitor) acquireSite(id int) *siteLock {
+        m.mu.Lock()
+        defer m.mu.Unlock()
+
+        lock, ok := m.siteLocks[id]
+        if !ok {
+                lock = &siteLock{}
+                m.siteLocks[id] = lock
+        }
+        lock.refs++
+        return lock
+}
+
+// releaseSite gives up the locks from acquireSite, forgetting them once
+// nobody uses them and the website has been removed
+func (m *Monitor) releaseSite(id int, lock *siteLock) {
+        m.mu.Lock()
+        defer m.mu.Unlock()
+
+        lock.refs--
+        if lock.refs == 0 && m.findLocked(id) == nil {
+                delete(m.siteLocks, id)
+        }
+}
+
+// snapshotLocked returns a copy of a website that was just changed, with a
+// new version for persist; m.mu must be held
+func (m *Monitor) snapshotLocked(website *Website) *Website {
+        m.version++
+        website.version = m.version
+        return website.clone()
+}
+
+// persist saves a snapshot taken by snapshotLocked. Saves of a website are
+// serialized and skip snapshots older than the last one saved, so the
+// database ends up with the latest state whatever order callers get here in.
+// Nothing is saved once the website has been removed.
+func (m *Monitor) persist(snapshot *Website) {
+        if m.saveFunc == nil {
+                return
+        }
+        lock := m.acquireSite(snapshot.ID)
+        defer m.releaseSite(snapshot.ID, lock)
+        lock.save.Lock()
+        defer lock.save.Unlock()
+
+        m.mu.RLock()
+        removed := m.findLocked(snapshot.ID) == nil
+        m.mu.RUnlock()
+        if removed || snapshot.version <= lock.saved {
+                return
+        }
+        m.saveFunc(snapshot)
+        lock.saved = snapshot.version
+}
+
+// CheckWebsite performs a check on a single website and returns the updated
+// website, or nil if no website with that ID is being monitored.
+//
+// The fetch runs without holding the monitor lock; the result is applied to
+// the stored website in one short critical section once it is complete.
+func (m *Monitor) CheckWebsite(id int) *Website {
+        lock := m.acquireSite(id)
+        defer m.releaseSite(id, lock)
+        lock.check.Lock()
+        defer lock.check.Unlock()
+
+        website := m.GetWebsiteByID(id)
+        if website == nil {
+                return nil
+        }
+
         log.Printf("Checking website: %s (%s)", website.Name, website.URL)
+        m.publish(EventCheckStarted, website)
+        result := m.fetch(website)
+
+        m.mu.Lock()
+        stored := m.findLocked(id)
+        if stored == nil {
+                // Removed while the check was running; don't write it back to the database
+                m.mu.Unlock()
+                return nil
+        }
+        now := time.Now()
+        stored.applyResult(result, now)
+        stored.Maintenance = m.inMaintenanceLocked(stored, now)
+        snapshot := m.snapshotLocked(stored)
+        historyFunc := m.historyFunc
+        m.mu.Unlock()
+
+        m.persist(snapshot)
+        if historyFunc != nil {
+                historyFunc(newHistoryEntry(snapshot, result))
+        }
+        m.publishResult(snapshot)
+
+        if snapshot.Error == "" {
+                log.Printf("Check completed for %s - Changed: %v", snapshot.URL, snapshot.HasChanged)
+        }
+        return snapshot
+}
+
+// fetch requests the website and hashes its content. It does not touch
+// monitor state, so it is safe to call without holding any lock.
+func (m *Monitor) fetch(website *Website) checkResult {
+        start := time.Now()
+        trace := &checkTrace{}
+        result := m.doFetch(website, trace)
+        result.duration = time.Since(start)
+        if result.timing = trace.timing(); result.timing != nil {
+                result.timing.TotalMs = milliseconds(result.duration)
+        }
+        return result
+}
 
-        var resp *http.Response
-        var err error
+// doFetch performs the request for fetch, recording its timing in trace
+func (m *Monitor) doFetch(website *Website, trace *checkTrace) checkResult {
+        m.mu.RLock()
+        client, policy, secret, proxy := m.client, m.egress, m.secretFunc, m.proxy
+        m.mu.RUnlock()
+
+        // Refuse URLs the policy no longer allows before connecting
+        if u, err := url.Parse(website.URL); err == nil {
+                if err := policy.checkScheme(u); err != nil {
+                        log.Printf("Refused to check %s: %v", website.URL, err)
+                        return checkResult{err: err.Error(), errClass: ErrorClassPolicy}
+                }
+        }
 
-        if website.UsePKI {
-                // Configure TLS for this specific website
-                client, err := createClientWithPKI(website)
+        if website.UsePKI || website.Proxy != nil {
+                // Configure TLS and the proxy for this specific website
+                proxyFunc, err := policy.proxyFunc(websiteProxy(proxy, website), secret)
                 if err != nil {
-                        m.mu.Lock()
-                        website.LastChecked = time.Now()
-                        website.Error = "PKI configuration error: " + err.Error()
-                        website.LastStatusCode = 0
-                        website.HasChanged = false
-                        if m.saveFunc != nil {
-                                m.saveFunc(website)
+                        log.Printf("Proxy configuration error for %s: %v", website.URL, err)
+                        return checkResult{err: "Proxy configuration error: " + err.Error(), errClass: ErrorClassConfig}
+                }
+                var tlsConfig *tls.Config
+                if website.UsePKI {
+                        if tlsConfig, err = pkiTLSConfig(website); err != nil {
+                                log.Printf("PKI configuration error for %s: %v", website.URL, err)
+                                return checkResult{err: "PKI configuration error: " + err.Error(), errClass: ErrorClassConfig}
                         }
-                        m.mu.Unlock()
-                        log.Printf("PKI configuration error for %s: %v", website.URL, err)
-                        return
                 }
-                
-                // Use the custom client to make the request
-                resp, err = client.Get(website.URL)
-        } else {
-                // Use the default client for non-PKI websites
-                resp, err = m.client.Get(website.URL)
+                client = policy.newClient(tlsConfig, proxyFunc)
         }
-        
-        m.mu.Lock()
-        defer m.mu.Unlock()
 
-        website.LastChecked = time.Now()
-        
+        if website.Redirects != nil {
+                client = withRedirects(client, website.Redirects, policy)
+        }
+        client = trace.client(client)
+        if len(website.Steps) > 0 {
+                return m.runSteps(client, website, secret, policy)
+        }
+
+        resp, err := m.send(client, website, secret)
         if err != nil {
-                website.Error = err.Error()
-                website.LastStatusCode = 0
-                website.HasChanged = false
+                // Query parameters may hold secrets, so report the configured URL
+                var urlErr *url.Error
+                if errors.As(err, &urlErr) {
+                        urlErr.URL = website.URL
+                }
                 log.Printf("Error checking %s: %v", website.URL, err)
-                return
+                return checkResult{err: err.Error(), errClass: classifyError(err)}
         }
         defer resp.Body.Close()
 
-        website.LastStatusCode = resp.StatusCode
-        
-        if resp.StatusCode != http.StatusOK {
-                website.Error = "Received status: " + resp.Status
-                website.HasChanged = false
+        result := checkResult{statusCode: resp.StatusCode, certExpiry: certExpiry(resp)}
+        result.finalURL, result.redirects = redirectChain(resp, website.URL)
+
+        // Any success status will do, since POST and PUT endpoints often
+        // answer 201 or 204. Redirects are the result when they aren't followed.
+        notFollowed := resp.StatusCode >= 300 && resp.StatusCode <= 399 && website.Redirects.mode() == RedirectNone
+        if (resp.StatusCode < 200 || resp.StatusCode > 299) && !notFollowed {
                 log.Printf("Error status for %s: %s", website.URL, resp.Status)
-                return
+                result.err = "Received status: " + resp.Status
+                result.errClass = ErrorClassHTTP
+                return result
         }
 
         // Read the body content
         body, err := io.ReadAll(resp.Body)
+        result.bodySize = int64(len(body))
         if err != nil {
-                website.Error = "Failed to read response: " + err.Error()
-                website.HasChanged = false
                 log.Printf("Error reading body from %s: %v", website.URL, err)
-                return
+                result.err = "Failed to read response: " + err.Error()
+                result.errClass = classifyError(err)
+                return result
+        }
+
+        // Limit change detection to the selected parts of the page
+        content, err := extractContent(body, website.Selectors)
+        if err != nil {
+                log.Printf("Error extracting content from %s: %v", website.URL, err)
+                result.err = err.Error()
+                result.errClass = ErrorClassContent
+                return result
         }
 
         // Calculate MD5 hash of the content
-        hash := md5.Sum(body)
-        currentHash := hex.EncodeToString(hash[:])
+        hash := md5.Sum(content)
+        result.hash = hex.EncodeToString(hash[:])
+        return result
+}
 
-        // Check if content has changed
-        if website.IsFirstCheck {
-                website.IsFirstCheck = false
-                website.HasChanged = false
-        } else if website.LastHash != currentHash {
-                website.HasChanged = true
-        } else {
-                website.HasChanged = false
+// send builds, authenticates and sends the request that checks a website.
+// When an OAuth2 token is rejected, it fetches a new one and retries once.
+func (m *Monitor) send(client *http.Client, website *Website, secret SecretFunc) (*http.Response, error) {
+        if website.Auth != nil && website.Auth.Type == AuthForm {
+                return m.sendWithSession(client, website, secret)
         }
+        for attempt := 1; ; attempt++ {
+                req, err := newRequest(website, secret)
+                if err != nil {
+                        return nil, fmt.Errorf("%w: %v", errRequestConfig, err)
+                }
+                tokenKey, err := m.authorize(req, website, client, secret)
+                if err != nil {
+                        return nil, err
+                }
 
-        website.LastHash = currentHash
-        website.Error = ""
-        
-        // Save website to database if save function is provided
-        if m.saveFunc != nil {
-                m.saveFunc(website)
+                resp, err := client.Do(req)
+                if err != nil || resp.StatusCode != http.StatusUnauthorized || tokenKey == "" {
+                        return resp, err
+                }
+                m.tokens.drop(tokenKey)
+                if attempt == 2 {
+                        return resp, nil
+                }
+                resp.Body.Close()
         }
-        
-        log.Printf("Check completed for %s - Changed: %v", website.URL, website.HasChanged)
 }
 
-// createClientWithPKI creates an HTTP client with PKI authentication for a specific website
-func createClientWithPKI(website *Website) (*http.Client, error) {
+// pkiTLSConfig creates the TLS configuration for PKI authentication of a
+// specific website
+func pkiTLSConfig(website *Website) (*tls.Config, error) {
         // Start with default TLS config
         tlsConfig := &tls.Config{
                 MinVersion: tls.VersionTLS12,
@@ -244,30 +620,113 @@ func createClientWithPKI(website *Website) (*http.Client, error) {
                 tlsConfig.InsecureSkipVerify = true
         }
         
-        // Create and return a custom HTTP client with the configured TLS
-        return &http.Client{
-                Timeout: 30 * time.Second,
-                Transport: &http.Transport{
-                        TLSClientConfig: tlsConfig,
-                },
-        }, nil
+        return tlsConfig, nil
 }
 
-// CheckAllWebsites checks all monitored websites for changes
+// CheckAllWebsites checks all monitored websites that are not paused for changes
 func (m *Monitor) CheckAllWebsites() {
-        websites := m.GetWebsites() // Get a copy to avoid holding the lock
+        now := time.Now()
+
+        var ids []int
+        for _, website := range m.GetWebsites() {
+                if !website.IsPaused(now) {
+                        ids = append(ids, website.ID)
+                }
+        }
+
+        m.CheckWebsites(ids)
+        log.Printf("Completed checking all %d websites", len(ids))
+}
+
+// CheckWebsites checks the given websites concurrently and returns the
+// updated websites, skipping any that are no longer monitored
+func (m *Monitor) CheckWebsites(ids []int) []*Website {
+        results := make([]*Website, len(ids))
+        m.scheduler.queued.Add(int64(len(ids)))
 
         var wg sync.WaitGroup
-        for _, website := range websites {
+        for i, id := range ids {
                 wg.Add(1)
-                go func(w *Website) {
+                go func(i, id int) {
                         defer wg.Done()
-                        m.CheckWebsite(w)
-                }(website)
+                        defer m.scheduler.queued.Add(-1)
+                        results[i] = m.CheckWebsite(id)
+                }(i, id)
         }
-
         wg.Wait()
-        log.Printf("Completed checking all %d websites", len(websites))
+
+        checked := make([]*Website, 0, len(results))
+        for _, website := range results {
+                if website != nil {
+                        checked = append(checked, website)
+                }
+        }
+        return checked
+}
+
+// SetPaused pauses or resumes scheduled checks of a website. A pause with a
+// non-zero until ends automatically at that time. It returns a copy of the
+// updated website, or nil if no website with that ID is being monitored.
+func (m *Monitor) SetPaused(id int, paused bool, until time.Time) *Website {
+        m.mu.Lock()
+        website := m.findLocked(id)
+        if website == nil {
+                m.mu.Unlock()
+                return nil
+        }
+        website.Paused = paused
+        website.PausedUntil = time.Time{}
+        if paused {
+                website.PausedUntil = until
+        }
+        snapshot := m.snapshotLocked(website)
+        m.mu.Unlock()
+
+        m.persist(snapshot)
+
+        return snapshot
+}
+
+// CheckDueWebsites checks the websites whose interval has elapsed since their
+// last check
+func (m *Monitor) CheckDueWebsites() {
+        now := time.Now()
+
+        var due []int
+        var dueWebsites []*Website
+        var paused, resumed []*Website
+        m.mu.Lock()
+        for _, website := range m.websites {
+                // Clear pauses that have run out
+                if website.Paused && !website.IsPaused(now) {
+                        paused = append(paused, website.clone())
+                        website.Paused = false
+                        website.PausedUntil = time.Time{}
+                        resumed = append(resumed, m.snapshotLocked(website))
+                }
+                if website.IsDue(now, m.intervalLocked(website)) {
+                        due = append(due, website.ID)
+                        dueWebsites = append(dueWebsites, website)
+                }
+        }
+        budget := cycleBudget(dueWebsites)
+        resumeFunc := m.resumeFunc
+        m.mu.Unlock()
+        m.startCycle(now, budget)
+
+        for i, website := range resumed {
+                log.Printf("Pause of %s ended, resuming checks", website.URL)
+                m.persist(website)
+                if resumeFunc != nil {
+                        resumeFunc(paused[i], website)
+                }
+        }
+
+        m.CheckWebsites(due)
+        m.completeCycle(now, len(due))
+        if len(due) > 0 {
+                log.Printf("Completed checking %d due websites", len(due))
+        }
 }
 
 // AddExistingWebsite adds a website that was loaded from the database
@@ -282,6 +741,6 @@ func (m *Monitor) AddExistingWebsite(website *Website) {
 func (m *Monitor) SetIDCounter(id int) {
         m.mu.Lock()
         defer m.mu.Unlock()
-        
+
         m.idCounter = id
 }
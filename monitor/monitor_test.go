@@ -0,0 +1,206 @@
+package monitor
+
+import (
+        "fmt"
+        "net/http"
+        "net/http/httptest"
+        "sync"
+        "testing"
+        "time"
+)
+
+// fakeStore records the websites saved by a monitor, like the database
+type fakeStore struct {
+        mu       sync.Mutex
+        websites map[int]*Website
+        deleted  map[int]bool
+        revived  []int // Websites saved after being deleted
+}
+
+func newFakeStore() *fakeStore {
+        return &fakeStore{websites: map[int]*Website{}, deleted: map[int]bool{}}
+}
+
+func (s *fakeStore) save(website *Website) {
+        s.mu.Lock()
+        defer s.mu.Unlock()
+
+        if s.deleted[website.ID] {
+                s.revived = append(s.revived, website.ID)
+        }
+        s.websites[website.ID] = website
+}
+
+func (s *fakeStore) delete(id int) {
+        s.mu.Lock()
+        defer s.mu.Unlock()
+
+        delete(s.websites, id)
+        s.deleted[id] = true
+}
+
+func (s *fakeStore) revivedIDs() []int {
+        s.mu.Lock()
+        defer s.mu.Unlock()
+
+        return append([]int(nil), s.revived...)
+}
+
+func (s *fakeStore) get(id int) *Website {
+        s.mu.Lock()
+        defer s.mu.Unlock()
+
+        return s.websites[id]
+}
+
+func TestPersistSkipsOlderSnapshots(t *testing.T) {
+        store := newFakeStore()
+        m := NewMonitor(store.save)
+        m.AddExistingWebsite(&Website{ID: 1, URL: "http://example.com/", Name: "old"})
+
+        m.mu.Lock()
+        website := m.findLocked(1)
+        older := m.snapshotLocked(website)
+        website.Name = "new"
+        newer := m.snapshotLocked(website)
+        m.mu.Unlock()
+
+        // The newer snapshot reaches the store first, as when a check that
+        // finished before an update is slower to save
+        m.persist(newer)
+        m.persist(older)
+
+        if got := store.get(1).Name; got != "new" {
+                t.Errorf("saved name = %q, want %q", got, "new")
+        }
+}
+
+func TestPersistSkipsRemovedWebsites(t *testing.T) {
+        store := newFakeStore()
+        m := NewMonitor(store.save)
+        m.AddExistingWebsite(&Website{ID: 1, URL: "http://example.com/"})
+
+        m.mu.Lock()
+        snapshot := m.snapshotLocked(m.findLocked(1))
+        m.mu.Unlock()
+
+        if !m.RemoveWebsite(1) {
+                t.Fatal("RemoveWebsite returned false")
+        }
+        store.delete(1)
+        m.persist(snapshot)
+
+        if len(store.revivedIDs()) > 0 {
+                t.Errorf("removed website was saved again")
+        }
+        if _, ok := m.siteLocks[1]; ok {
+                t.Errorf("locks of the removed website were kept")
+        }
+}
+
+func TestConcurrentCheckUpdateAndRemove(t *testing.T) {
+        server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+                time.Sleep(5 * time.Millisecond)
+                fmt.Fprint(w, "ok")
+        }))
+        defer server.Close()
+
+        store := newFakeStore()
+        m := NewMonitor(store.save)
+        m.SetProxy(nil)
+
+        const websites = 8
+        var ids []int
+        for i := 0; i < websites; i++ {
+                ids = append(ids, m.AddConfiguredWebsite(&Website{URL: server.URL + fmt.Sprintf("/%d", i)}).ID)
+        }
+
+        var wg sync.WaitGroup
+        for round := 0; round < 5; round++ {
+                for _, id := range ids {
+                        wg.Add(3)
+                        go func(id int) {
+                                defer wg.Done()
+                                m.CheckWebsite(id)
+                        }(id)
+                        go func(id, round int) {
+                                defer wg.Done()
+                                m.UpdateWebsite(id, &Website{URL: server.URL + fmt.Sprintf("/%d", id), Name: fmt.Sprintf("round %d", round)})
+                        }(id, round)
+                        go func(id int) {
+                                defer wg.Done()
+                                m.SetPaused(id, true, time.Time{})
+                        }(id)
+                }
+        }
+
+        // Remove half of the websites while checks are still running
+        for _, id := range ids[:websites/2] {
+                wg.Add(1)
+                go func(id int) {
+                        defer wg.Done()
+                        if m.RemoveWebsite(id) {
+                                store.delete(id)
+                        }
+                }(id)
+        }
+        wg.Wait()
+
+        // Checks started when the websites were added may still be running
+        deadline := time.Now().Add(5 * time.Second)
+        for {
+                m.mu.RLock()
+                busy := false
+                for _, lock := range m.siteLocks {
+                        busy = busy || lock.refs > 0
+                }
+                m.mu.RUnlock()
+                if !busy || time.Now().After(deadline) {
+                        break
+                }
+                time.Sleep(10 * time.Millisecond)
+        }
+
+        if revived := store.revivedIDs(); len(revived) > 0 {
+                t.Errorf("removed websites %v were saved again", revived)
+        }
+        for _, id := range ids[websites/2:] {
+                current := m.GetWebsiteByID(id)
+                saved := store.get(id)
+                if saved == nil {
+                        t.Fatalf("website %d was never saved", id)
+                }
+                if saved.Name != current.Name || saved.Paused != current.Paused || !saved.LastChecked.Equal(current.LastChecked) {
+                        t.Errorf("website %d: saved %q paused=%v checked %v, in memory %q paused=%v checked %v",
+                                id, saved.Name, saved.Paused, saved.LastChecked, current.Name, current.Paused, current.LastChecked)
+                }
+        }
+}
+
+func TestCycleBudget(t *testing.T) {
+        steps := func(n int) []Step {
+                return make([]Step, n)
+        }
+        tests := []struct {
+                name    string
+                website *Website
+                want    time.Duration
+        }{
+                {"single request", &Website{}, 2 * requestTimeout},
+                {"steps", &Website{Steps: steps(5)}, 10 * requestTimeout},
+                {"OAuth2 fetch and retry", &Website{Auth: &AuthConfig{Type: AuthOAuth2}}, 8 * requestTimeout},
+                {"OAuth2 steps", &Website{Steps: steps(3), Auth: &AuthConfig{Type: AuthOAuth2}}, 12 * requestTimeout},
+                {"form login after expiry", &Website{Auth: &AuthConfig{Type: AuthForm}}, 8 * requestTimeout},
+        }
+
+        for _, test := range tests {
+                t.Run(test.name, func(t *testing.T) {
+                        if got := cycleBudget([]*Website{{}, test.website}); got != test.want {
+                                t.Errorf("cycleBudget() = %s, want %s", got, test.want)
+                        }
+                })
+        }
+        if got := cycleBudget(nil); got != 0 {
+                t.Errorf("cycleBudget(nil) = %s, want 0", got)
+        }
+}
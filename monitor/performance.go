@@ -0,0 +1,170 @@
+package monitor
+
+import (
+        "math"
+        "sort"
+        "time"
+)
+
+// Percentiles summarizes a set of durations in milliseconds
+type Percentiles struct {
+        Min  float64 `json:"min"`
+        P50  float64 `json:"p50"`
+        P90  float64 `json:"p90"`
+        P95  float64 `json:"p95"`
+        P99  float64 `json:"p99"`
+        Max  float64 `json:"max"`
+        Mean float64 `json:"mean"`
+}
+
+// PerformanceStats summarizes the timing of a set of checks. The DNS,
+// connect and TLS percentiles only cover the checks that opened a connection
+// rather than reusing a kept-alive one.
+type PerformanceStats struct {
+        Checks      int         `json:"checks"`
+        SetupChecks int         `json:"setupChecks"` // Checks that opened a connection
+        Total       Percentiles `json:"total"`
+        DNS         Percentiles `json:"dns"`
+        Connect     Percentiles `json:"connect"`
+        TLS         Percentiles `json:"tls"`
+        TTFB        Percentiles `json:"ttfb"`
+        Transfer    Percentiles `json:"transfer"`
+}
+
+// PerformanceBucket is one interval of a performance trend
+type PerformanceBucket struct {
+        Start    time.Time `json:"start"`
+        Checks   int       `json:"checks"`
+        TotalP50 float64   `json:"totalP50"`
+        TotalP95 float64   `json:"totalP95"`
+        TTFBP50  float64   `json:"ttfbP50"`
+}
+
+// PerformanceReport describes how fast a website answered over a period:
+// percentiles of each phase of its checks, and their trend
+type PerformanceReport struct {
+        WebsiteID int                 `json:"websiteId"`
+        Since     time.Time           `json:"since"`
+        Until     time.Time           `json:"until"`
+        Stats     PerformanceStats    `json:"stats"`
+        Trend     []PerformanceBucket `json:"trend"`
+
+        // Change of the median check duration from the first to the second half
+        // of the period, in percent; unset unless both halves have checks.
+        // Positive values mean the website got slower.
+        ChangePercent *float64 `json:"changePercent,omitempty"`
+}
+
+// NewPerformanceReport computes the performance of a website from its check
+// history between since and until, splitting the period into buckets for
+// the trend. Only successful checks with timing are counted, since failures
+// such as timeouts would distort the response times.
+func NewPerformanceReport(websiteID int, entries []*HistoryEntry, since, until time.Time, buckets int) *PerformanceReport {
+        report := &PerformanceReport{WebsiteID: websiteID, Since: since, Until: until, Trend: []PerformanceBucket{}}
+
+        var timed []*HistoryEntry
+        for _, entry := range entries {
+                if entry.Timing != nil && entry.Error == "" && !entry.CheckedAt.Before(since) && entry.CheckedAt.Before(until) {
+                        timed = append(timed, entry)
+                }
+        }
+        report.Stats = performanceStats(timed)
+
+        if buckets < 1 {
+                buckets = 1
+        }
+        width := until.Sub(since) / time.Duration(buckets)
+        if width <= 0 {
+                return report
+        }
+        grouped := make([][]*HistoryEntry, buckets)
+        for _, entry := range timed {
+                i := int(entry.CheckedAt.Sub(since) / width)
+                if i >= buckets {
+                        i = buckets - 1
+                }
+                grouped[i] = append(grouped[i], entry)
+        }
+        for i, group := range grouped {
+                stats := performanceStats(group)
+                report.Trend = append(report.Trend, PerformanceBucket{
+                        Start:    since.Add(time.Duration(i) * width),
+                        Checks:   stats.Checks,
+                        TotalP50: stats.Total.P50,
+                        TotalP95: stats.Total.P95,
+                        TTFBP50:  stats.TTFB.P50,
+                })
+        }
+
+        middle := since.Add(until.Sub(since) / 2)
+        var first, second []*HistoryEntry
+        for _, entry := range timed {
+                if entry.CheckedAt.Before(middle) {
+                        first = append(first, entry)
+                } else {
+                        second = append(second, entry)
+                }
+        }
+        before, after := performanceStats(first).Total.P50, performanceStats(second).Total.P50
+        if len(first) > 0 && len(second) > 0 && before > 0 {
+                change := math.Round((after-before)/before*1000) / 10
+                report.ChangePercent = &change
+        }
+        return report
+}
+
+// performanceStats computes the percentiles of each phase of checks
+func performanceStats(entries []*HistoryEntry) PerformanceStats {
+        phases := make([][]float64, 6)
+        setupChecks := 0
+        for _, entry := range entries {
+                timing := entry.Timing
+                phases[0] = append(phases[0], timing.TotalMs)
+                if timing.measuredSetup() {
+                        setupChecks++
+                        phases[1] = append(phases[1], timing.DNSMs)
+                        phases[2] = append(phases[2], timing.ConnectMs)
+                        phases[3] = append(phases[3], timing.TLSMs)
+                }
+                phases[4] = append(phases[4], timing.TTFBMs)
+                phases[5] = append(phases[5], timing.TransferMs)
+        }
+        return PerformanceStats{
+                Checks:      len(entries),
+                SetupChecks: setupChecks,
+                Total:       percentiles(phases[0]),
+                DNS:         percentiles(phases[1]),
+                Connect:     percentiles(phases[2]),
+                TLS:         percentiles(phases[3]),
+                TTFB:        percentiles(phases[4]),
+                Transfer:    percentiles(phases[5]),
+        }
+}
+
+// percentiles summarizes values with the nearest-rank method
+func percentiles(values []float64) Percentiles {
+        if len(values) == 0 {
+                return Percentiles{}
+        }
+        sort.Float64s(values)
+        rank := func(p float64) float64 {
+                i := int(math.Ceil(p/100*float64(len(values)))) - 1
+                if i < 0 {
+                        i = 0
+                }
+                return values[i]
+        }
+        sum := 0.0
+        for _, value := range values {
+                sum += value
+        }
+        return Percentiles{
+                Min:  values[0],
+                P50:  rank(50),
+                P90:  rank(90),
+                P95:  rank(95),
+                P99:  rank(99),
+                Max:  values[len(values)-1],
+                Mean: math.Round(sum/float64(len(values))*1000) / 1000,
+        }
+}
@@ -0,0 +1,279 @@
+package monitor
+
+import (
+        "fmt"
+        "net"
+        "net/http"
+        "net/url"
+        "os"
+        "strings"
+)
+
+// ProxySchemes are the proxy URL schemes checks may connect through: HTTP
+// and HTTPS proxies, which tunnel HTTPS with CONNECT, and SOCKS5, where
+// socks5h leaves resolving host names to the proxy
+var ProxySchemes = []string{"http", "https", "socks5", "socks5h"}
+
+// ProxyConfig describes the proxy checks connect through. The monitor has a
+// global proxy, which a website may replace with its own or bypass.
+type ProxyConfig struct {
+        URL      string   `json:"url,omitempty"`      // Proxy URL such as http://proxy.example.com:3128
+        Username string   `json:"username,omitempty"` // Template; the proxy user, if it requires authentication
+        Password string   `json:"password,omitempty"` // Must refer to a stored secret, such as {{secret "name"}}
+        NoProxy  []string `json:"noProxy,omitempty"`  // Hosts, domains and networks reached without the proxy
+        Direct   bool     `json:"direct,omitempty"`   // Connect directly, ignoring the global proxy
+}
+
+// NewProxyConfig creates the global proxy configuration from a proxy URL,
+// which may include credentials, and a no-proxy list. An empty URL means no
+// proxy.
+func NewProxyConfig(rawURL string, noProxy []string) (*ProxyConfig, error) {
+        if strings.TrimSpace(rawURL) == "" {
+                return nil, nil
+        }
+        u, err := parseProxyURL(rawURL)
+        if err != nil {
+                return nil, err
+        }
+        config := &ProxyConfig{URL: u.String()}
+        for _, entry := range noProxy {
+                if entry = strings.TrimSpace(entry); entry != "" {
+                        if err := validateNoProxy(entry); err != nil {
+                                return nil, err
+                        }
+                        config.NoProxy = append(config.NoProxy, entry)
+                }
+        }
+        return config, nil
+}
+
+// ProxyFromEnvironment returns the proxy set by the HTTPS_PROXY or HTTP_PROXY
+// environment variables, or their lowercase forms, reaching the hosts in
+// NO_PROXY directly. It returns nil if no proxy is set.
+func ProxyFromEnvironment() (*ProxyConfig, error) {
+        getenv := func(names ...string) string {
+                for _, name := range names {
+                        if value := os.Getenv(name); value != "" {
+                                return value
+                        }
+                }
+                return ""
+        }
+        rawURL := getenv("HTTPS_PROXY", "https_proxy", "HTTP_PROXY", "http_proxy")
+        return NewProxyConfig(rawURL, strings.Split(getenv("NO_PROXY", "no_proxy"), ","))
+}
+
+// String describes the proxy for logs, without its password
+func (c *ProxyConfig) String() string {
+        if c == nil {
+                return "none"
+        }
+        if c.Direct {
+                return "direct"
+        }
+        description := c.URL
+        if u, err := url.Parse(c.URL); err == nil {
+                description = u.Redacted()
+        }
+        if len(c.NoProxy) > 0 {
+                description += fmt.Sprintf(" (except %s)", strings.Join(c.NoProxy, ", "))
+        }
+        return description
+}
+
+// parseProxyURL parses a proxy URL, adding the http scheme if it is missing
+func parseProxyURL(rawURL string) (*url.URL, error) {
+        rawURL = strings.TrimSpace(rawURL)
+        if !strings.Contains(rawURL, "://") {
+                rawURL = "http://" + rawURL
+        }
+        u, err := url.Parse(rawURL)
+        if err != nil {
+                return nil, fmt.Errorf("invalid proxy URL: %v", err)
+        }
+        u.Scheme = strings.ToLower(u.Scheme)
+        known := false
+        for _, scheme := range ProxySchemes {
+                known = known || scheme == u.Scheme
+        }
+        if !known {
+                return nil, fmt.Errorf("proxy URL scheme must be one of %s", strings.Join(ProxySchemes, ", "))
+        }
+        if u.Hostname() == "" {
+                return nil, fmt.Errorf("proxy URL needs a host")
+        }
+        if (u.Path != "" && u.Path != "/") || u.RawQuery != "" {
+                return nil, fmt.Errorf("proxy URL must not have a path or query")
+        }
+        u.Path = ""
+        return u, nil
+}
+
+// validateNoProxy checks a no-proxy entry: "*", a host or domain, or an
+// address or network in CIDR notation
+func validateNoProxy(entry string) error {
+        if strings.Contains(entry, "/") {
+                if _, _, err := net.ParseCIDR(entry); err != nil {
+                        return fmt.Errorf("invalid no-proxy network %q", entry)
+                }
+        } else if strings.ContainsAny(entry, " :@") && net.ParseIP(entry) == nil {
+                return fmt.Errorf("invalid no-proxy host %q", entry)
+        }
+        return nil
+}
+
+// clone returns a copy of the configuration, preserving nil
+func (c *ProxyConfig) clone() *ProxyConfig {
+        if c == nil {
+                return nil
+        }
+        copied := *c
+        copied.NoProxy = copyStrings(c.NoProxy)
+        return &copied
+}
+
+// equal reports whether two configurations are the same
+func (c *ProxyConfig) equal(o *ProxyConfig) bool {
+        if c == nil || o == nil {
+                return c == o
+        }
+        return c.URL == o.URL && c.Username == o.Username && c.Password == o.Password &&
+                equalStrings(c.NoProxy, o.NoProxy) && c.Direct == o.Direct
+}
+
+// redacted returns a copy of the configuration with its password replaced
+// by Redacted
+func (c *ProxyConfig) redacted() *ProxyConfig {
+        r := c.clone()
+        if r != nil {
+                r.Password = redact(r.Password)
+        }
+        return r
+}
+
+// validate normalizes a website's proxy configuration and checks it,
+// recording problems. Unlike the global proxy, credentials may not be part of
+// the URL, so that passwords are only saved as secrets.
+func (c *ProxyConfig) validate(problems *ValidationError) {
+        if c.Direct {
+                if c.URL != "" || c.Username != "" || c.Password != "" || len(c.NoProxy) > 0 {
+                        problems.add("proxy", CodeInvalid, "A direct connection can't have proxy settings")
+                }
+                return
+        }
+
+        if u, err := parseProxyURL(c.URL); c.URL == "" {
+                problems.add("proxy.url", CodeRequired, "The proxy URL is required, or set direct to bypass the global proxy")
+        } else if err != nil {
+                problems.add("proxy.url", CodeInvalid, "Invalid proxy: "+err.Error())
+        } else if u.User != nil {
+                problems.add("proxy.url", CodeInvalid, "Set the proxy username and password fields rather than credentials in the URL")
+        } else {
+                c.URL = u.String()
+        }
+
+        if err := validateTemplate(c.Username); err != nil {
+                problems.add("proxy.username", CodeInvalid, fmt.Sprintf("Invalid template in username: %v", err))
+        }
+        if c.Password != "" {
+                if c.Username == "" {
+                        problems.add("proxy.username", CodeRequired, "The username is required with a proxy password")
+                }
+                if err := validateTemplate(c.Password); err != nil {
+                        problems.add("proxy.password", CodeInvalid, fmt.Sprintf("Invalid template in password: %v", err))
+                } else if !isSecretReference(c.Password) {
+                        problems.add("proxy.password", CodeInvalid, "The password must only refer to stored secrets, such as {{secret \"name\"}}")
+                }
+        }
+        for _, entry := range c.NoProxy {
+                if err := validateNoProxy(strings.TrimSpace(entry)); err != nil {
+                        problems.add("proxy.noProxy", CodeInvalid, fmt.Sprintf("Invalid no-proxy entry %q", entry))
+                }
+        }
+}
+
+// proxyURL returns the proxy URL with the credentials, rendering their
+// templates
+func (c *ProxyConfig) proxyURL(secret SecretFunc) (*url.URL, error) {
+        u, err := parseProxyURL(c.URL)
+        if err != nil {
+                return nil, err
+        }
+        if c.Username == "" {
+                return u, nil
+        }
+        username, err := renderTemplate(c.Username, secret)
+        if err != nil {
+                return nil, fmt.Errorf("proxy username: %v", err)
+        }
+        if c.Password == "" {
+                u.User = url.User(username)
+                return u, nil
+        }
+        password, err := renderTemplate(c.Password, secret)
+        if err != nil {
+                return nil, fmt.Errorf("proxy password: %v", err)
+        }
+        u.User = url.UserPassword(username, password)
+        return u, nil
+}
+
+// bypassProxy reports whether requests to host skip the proxy. Entries match
+// every host ("*"), a host and its subdomains ("example.com" or
+// ".example.com"), or literal addresses in a network ("10.0.0.0/8").
+func bypassProxy(host string, noProxy []string) bool {
+        host = strings.ToLower(strings.TrimSuffix(host, "."))
+        ip := net.ParseIP(host)
+        for _, entry := range noProxy {
+                entry = strings.ToLower(strings.TrimSpace(entry))
+                switch {
+                case entry == "":
+                case entry == "*":
+                        return true
+                case strings.Contains(entry, "/"):
+                        if _, network, err := net.ParseCIDR(entry); err == nil && ip != nil && network.Contains(ip) {
+                                return true
+                        }
+                default:
+                        entry = strings.TrimPrefix(entry, ".")
+                        if host == entry || strings.HasSuffix(host, "."+entry) {
+                                return true
+                        }
+                }
+        }
+        return false
+}
+
+// websiteProxy returns the proxy configuration checks of a website use: its
+// own if it has one, which may bypass the global one, or else the global one
+func websiteProxy(global *ProxyConfig, website *Website) *ProxyConfig {
+        if website.Proxy != nil {
+                return website.Proxy
+        }
+        return global
+}
+
+// proxyFunc returns the Proxy function of a transport using config, or nil
+// to connect directly. The policy checks the proxy's address when connecting
+// to it; since the proxy connects to the website, the addresses the
+// website's host resolves to are checked before each request through it.
+func (p *EgressPolicy) proxyFunc(config *ProxyConfig, secret SecretFunc) (func(*http.Request) (*url.URL, error), error) {
+        if config == nil || config.Direct || config.URL == "" {
+                return nil, nil
+        }
+        proxyURL, err := config.proxyURL(secret)
+        if err != nil {
+                return nil, err
+        }
+        noProxy := copyStrings(config.NoProxy)
+
+        return func(req *http.Request) (*url.URL, error) {
+                if bypassProxy(req.URL.Hostname(), noProxy) {
+                        return nil, nil
+                }
+                if err := p.CheckURL(req.URL.String()); err != nil {
+                        return nil, err
+                }
+                return proxyURL, nil
+        }, nil
+}
@@ -0,0 +1,152 @@
+package monitor
+
+import (
+        "errors"
+        "fmt"
+        "net/http"
+        "strings"
+)
+
+// Redirect modes for RedirectPolicy.Mode
+const (
+        RedirectFollow   = "follow"    // Follow redirects anywhere the egress policy allows
+        RedirectNone     = "none"      // Don't follow redirects; the redirect response is the result
+        RedirectSameHost = "same-host" // Follow redirects to the website's host only
+)
+
+// DefaultMaxRedirects is how many redirects are followed when a website
+// doesn't set a limit, and MaxRedirects the highest limit it may set
+const (
+        DefaultMaxRedirects = 10
+        MaxRedirects        = 30
+)
+
+// ErrRedirectRefused is returned, wrapped, when the redirect policy stops a
+// check
+var ErrRedirectRefused = errors.New("redirect refused by the redirect policy")
+
+// RedirectPolicy controls which redirects a website's checks follow
+type RedirectPolicy struct {
+        Mode    string `json:"mode,omitempty"`    // RedirectFollow, RedirectNone or RedirectSameHost; empty follows
+        MaxHops int    `json:"maxHops,omitempty"` // Most redirects followed; 0 uses DefaultMaxRedirects
+}
+
+// Redirect is one hop of a redirect chain: a URL that answered with a
+// redirect, and the status it answered with
+type Redirect struct {
+        URL        string `json:"url"`
+        StatusCode int    `json:"statusCode"`
+}
+
+// mode returns the redirect mode, treating a nil policy as following
+func (r *RedirectPolicy) mode() string {
+        if r == nil || r.Mode == "" {
+                return RedirectFollow
+        }
+        return r.Mode
+}
+
+// maxHops returns how many redirects may be followed
+func (r *RedirectPolicy) maxHops() int {
+        if r == nil || r.MaxHops == 0 {
+                return DefaultMaxRedirects
+        }
+        return r.MaxHops
+}
+
+// clone returns a copy of the policy, preserving nil
+func (r *RedirectPolicy) clone() *RedirectPolicy {
+        if r == nil {
+                return nil
+        }
+        c := *r
+        return &c
+}
+
+// equal reports whether two policies follow the same redirects, treating a
+// nil policy like an empty one
+func (r *RedirectPolicy) equal(o *RedirectPolicy) bool {
+        return r.mode() == o.mode() && r.maxHops() == o.maxHops()
+}
+
+// validate normalizes the policy and checks it, recording problems
+func (r *RedirectPolicy) validate(problems *ValidationError) {
+        r.Mode = strings.ToLower(strings.TrimSpace(r.Mode))
+        switch r.Mode {
+        case "", RedirectFollow, RedirectNone, RedirectSameHost:
+        default:
+                problems.add("redirects.mode", CodeInvalid, fmt.Sprintf("Redirect mode must be %s, %s or %s", RedirectFollow, RedirectNone, RedirectSameHost))
+        }
+        if r.MaxHops < 0 || r.MaxHops > MaxRedirects {
+                problems.add("redirects.maxHops", CodeInvalid, fmt.Sprintf("Maximum redirects must be between 0 and %d", MaxRedirects))
+        }
+}
+
+// redirectFunc returns the CheckRedirect function of a client following
+// redirects according to redirects and the egress policy
+func (p *EgressPolicy) redirectFunc(redirects *RedirectPolicy) func(*http.Request, []*http.Request) error {
+        mode, maxHops := redirects.mode(), redirects.maxHops()
+
+        return func(req *http.Request, via []*http.Request) error {
+                switch mode {
+                case RedirectNone:
+                        return http.ErrUseLastResponse
+                case RedirectSameHost:
+                        if !strings.EqualFold(req.URL.Hostname(), via[0].URL.Hostname()) {
+                                return fmt.Errorf("%w: not following redirect to %s", ErrRedirectRefused, req.URL.Hostname())
+                        }
+                }
+                if len(via) > maxHops {
+                        return fmt.Errorf("%w: stopped after %d redirects", ErrRedirectRefused, maxHops)
+                }
+                if err := p.checkScheme(req.URL); err != nil {
+                        return fmt.Errorf("redirect to %s refused: %w", req.URL, err)
+                }
+                return nil
+        }
+}
+
+// withRedirects returns a copy of client following the website's redirect
+// policy
+func withRedirects(client *http.Client, redirects *RedirectPolicy, policy *EgressPolicy) *http.Client {
+        c := *client
+        c.CheckRedirect = policy.redirectFunc(redirects)
+        return &c
+}
+
+// redirectChain returns the final URL of a response and the redirects that
+// led to it. A redirect that was not followed is part of the chain, and the
+// final URL is where it pointed. The first request is reported as
+// requestedURL, since its query may hold secrets.
+func redirectChain(resp *http.Response, requestedURL string) (string, []Redirect) {
+        var chain []Redirect
+        for req := resp.Request; req.Response != nil; req = req.Response.Request {
+                chain = append([]Redirect{{URL: req.Response.Request.URL.String(), StatusCode: req.Response.StatusCode}}, chain...)
+        }
+        final := resp.Request.URL.String()
+        if len(chain) == 0 {
+                final = requestedURL
+        }
+
+        if location, err := resp.Location(); err == nil && resp.StatusCode >= 300 && resp.StatusCode <= 399 {
+                chain = append(chain, Redirect{URL: final, StatusCode: resp.StatusCode})
+                final = location.String()
+        }
+        if len(chain) > 0 {
+                chain[0].URL = requestedURL
+        }
+        return final, chain
+}
+
+// equalRedirects reports whether two redirect chains are the same
+func equalRedirects(a, b []Redirect) bool {
+        if len(a) != len(b) {
+                return false
+        }
+        for i := range a {
+                if a[i] != b[i] {
+                        return false
+                }
+        }
+        return true
+}
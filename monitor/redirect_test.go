@@ -0,0 +1,169 @@
+package monitor
+
+import (
+        "fmt"
+        "net/http"
+        "net/http/httptest"
+        "strings"
+        "testing"
+)
+
+// redirectServer serves /a redirecting to /b, /b redirecting to /final, and
+// /away redirecting to the same server under another host name
+func redirectServer(t *testing.T) *httptest.Server {
+        t.Helper()
+        var server *httptest.Server
+        server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+                switch r.URL.Path {
+                case "/a":
+                        http.Redirect(w, r, "/b", http.StatusFound)
+                case "/b":
+                        http.Redirect(w, r, "/final", http.StatusMovedPermanently)
+                case "/away":
+                        http.Redirect(w, r, strings.Replace(server.URL, "127.0.0.1", "localhost", 1)+"/final", http.StatusFound)
+                default:
+                        fmt.Fprint(w, "ok")
+                }
+        }))
+        t.Cleanup(server.Close)
+        return server
+}
+
+// checkWithRedirects checks a website at path on server with the given
+// redirect policy
+func checkWithRedirects(t *testing.T, server *httptest.Server, path string, redirects *RedirectPolicy) *Website {
+        t.Helper()
+        m := NewMonitor(nil)
+        m.SetProxy(nil)
+        m.SetEgressPolicy(testPolicy(t, []string{"127.0.0.1", "::1"}, nil))
+        m.AddExistingWebsite(&Website{ID: 1, URL: server.URL + path, Redirects: redirects, IsFirstCheck: true})
+        return m.CheckWebsite(1)
+}
+
+func TestRedirectPolicies(t *testing.T) {
+        server := redirectServer(t)
+
+        tests := []struct {
+                name      string
+                path      string
+                redirects *RedirectPolicy
+                final     string // Path of the final URL
+                chain     []Redirect
+                err       string // Part of the error, if the check fails
+        }{
+                {
+                        name:  "follow by default",
+                        path:  "/a",
+                        final: "/final",
+                        chain: []Redirect{{"/a", http.StatusFound}, {"/b", http.StatusMovedPermanently}},
+                },
+                {
+                        name:      "none",
+                        path:      "/a",
+                        redirects: &RedirectPolicy{Mode: RedirectNone},
+                        final:     "/b",
+                        chain:     []Redirect{{"/a", http.StatusFound}},
+                },
+                {
+                        name:      "too many hops",
+                        path:      "/a",
+                        redirects: &RedirectPolicy{MaxHops: 1},
+                        err:       "stopped after 1 redirects",
+                },
+                {
+                        name:      "same host",
+                        path:      "/a",
+                        redirects: &RedirectPolicy{Mode: RedirectSameHost},
+                        final:     "/final",
+                        chain:     []Redirect{{"/a", http.StatusFound}, {"/b", http.StatusMovedPermanently}},
+                },
+                {
+                        name:      "same host refuses another host",
+                        path:      "/away",
+                        redirects: &RedirectPolicy{Mode: RedirectSameHost},
+                        err:       "not following redirect to localhost",
+                },
+                {
+                        name:  "no redirects",
+                        path:  "/final",
+                        final: "/final",
+                },
+        }
+
+        for _, test := range tests {
+                t.Run(test.name, func(t *testing.T) {
+                        website := checkWithRedirects(t, server, test.path, test.redirects)
+
+                        if test.err != "" {
+                                if !strings.Contains(website.Error, test.err) {
+                                        t.Errorf("error = %q, want it to mention %q", website.Error, test.err)
+                                }
+                                return
+                        }
+                        if website.Error != "" {
+                                t.Fatalf("check failed: %s", website.Error)
+                        }
+                        if website.FinalURL != server.URL+test.final {
+                                t.Errorf("final URL = %s, want %s", website.FinalURL, server.URL+test.final)
+                        }
+                        if len(website.RedirectChain) != len(test.chain) {
+                                t.Fatalf("redirect chain = %+v, want %+v", website.RedirectChain, test.chain)
+                        }
+                        for i, want := range test.chain {
+                                want.URL = server.URL + want.URL
+                                if website.RedirectChain[i] != want {
+                                        t.Errorf("redirect %d = %+v, want %+v", i, website.RedirectChain[i], want)
+                                }
+                        }
+                })
+        }
+}
+
+func TestRedirectChanges(t *testing.T) {
+        target := "/one"
+        server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+                if r.URL.Path == "/" {
+                        http.Redirect(w, r, target, http.StatusFound)
+                        return
+                }
+                fmt.Fprint(w, "ok")
+        }))
+        defer server.Close()
+
+        m := NewMonitor(nil)
+        m.SetProxy(nil)
+        m.SetEgressPolicy(testPolicy(t, []string{"127.0.0.1", "::1"}, nil))
+        m.AddExistingWebsite(&Website{ID: 1, URL: server.URL + "/", IsFirstCheck: true})
+
+        for i, want := range []bool{false, false, true, false} {
+                if i == 2 {
+                        target = "/two"
+                }
+                if website := m.CheckWebsite(1); website.RedirectChanged != want {
+                        t.Errorf("check %d: redirect changed = %v, want %v (final URL %s)", i+1, website.RedirectChanged, want, website.FinalURL)
+                }
+        }
+}
+
+func TestRedirectPolicyValidation(t *testing.T) {
+        tests := []struct {
+                policy RedirectPolicy
+                valid  bool
+        }{
+                {RedirectPolicy{}, true},
+                {RedirectPolicy{Mode: " Same-Host "}, true},
+                {RedirectPolicy{Mode: RedirectNone, MaxHops: MaxRedirects}, true},
+                {RedirectPolicy{Mode: "sometimes"}, false},
+                {RedirectPolicy{MaxHops: -1}, false},
+                {RedirectPolicy{MaxHops: MaxRedirects + 1}, false},
+        }
+
+        for _, test := range tests {
+                policy := test.policy
+                problems := &ValidationError{}
+                policy.validate(problems)
+                if valid := len(problems.Errors) == 0; valid != test.valid {
+                        t.Errorf("%+v valid = %v, want %v: %v", test.policy, valid, test.valid, problems)
+                }
+        }
+}
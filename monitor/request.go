@@ -0,0 +1,239 @@
+package monitor
+
+import (
+        "bytes"
+        "encoding/json"
+        "errors"
+        "fmt"
+        "io"
+        "net/http"
+        "net/url"
+        "regexp"
+        "strings"
+        "text/template"
+        "text/template/parse"
+        "time"
+
+        "golang.org/x/net/http/httpguts"
+)
+
+// CheckMethods are the HTTP methods a website may be checked with
+var CheckMethods = []string{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"}
+
+// ErrSecretNotFound is returned when a template references an unknown secret
+var ErrSecretNotFound = errors.New("secret not found")
+
+// errRequestConfig is returned, wrapped, when a website's request can't be
+// built from its configuration
+var errRequestConfig = errors.New("Request configuration error")
+
+// secretNamePattern is the form of secret names
+var secretNamePattern = regexp.MustCompile(`^[A-Za-z0-9_.-]{1,64}$`)
+
+// Secret is a named value, such as an API key, that request templates refer
+// to with {{secret "name"}} so it never appears in website configurations
+type Secret struct {
+        Name      string    `json:"name"`
+        Value     string    `json:"value,omitempty"` // Never sent to API clients
+        UpdatedAt time.Time `json:"updatedAt"`
+        UpdatedBy string    `json:"updatedBy"`
+}
+
+// ValidateSecretName checks that a secret name is 1-64 letters, digits,
+// dots, dashes or underscores
+func ValidateSecretName(name string) error {
+        if !secretNamePattern.MatchString(name) {
+                return fmt.Errorf("Invalid secret name %q: use 1-64 letters, digits, dots, dashes or underscores", name)
+        }
+        return nil
+}
+
+// SecretFunc returns the value of a stored secret, or an error wrapping
+// ErrSecretNotFound
+type SecretFunc func(name string) (string, error)
+
+// noSecrets is used when no secret store is configured
+func noSecrets(name string) (string, error) {
+        return "", fmt.Errorf("%w: %s", ErrSecretNotFound, name)
+}
+
+// templateFuncs returns the functions available to request templates:
+// secret looks up a stored secret, now returns the current time and json
+// quotes a value for use in a JSON body
+func templateFuncs(secret SecretFunc) template.FuncMap {
+        return template.FuncMap{
+                "secret": secret,
+                "now":    time.Now,
+                "json": func(v interface{}) (string, error) {
+                        buf, err := json.Marshal(v)
+                        return string(buf), err
+                },
+        }
+}
+
+// renderTemplate expands a header, query parameter or body template
+func renderTemplate(text string, secret SecretFunc) (string, error) {
+        return expandTemplate(text, secret, nil)
+}
+
+// expandTemplate expands a template in which {{.name}} refers to vars, such
+// as the variables extracted by the earlier steps of a transaction. Referring
+// to a variable that isn't set is an error.
+func expandTemplate(text string, secret SecretFunc, vars map[string]string) (string, error) {
+        if !strings.Contains(text, "{{") {
+                return text, nil
+        }
+        // Report failed secret lookups plainly rather than as template errors
+        var lookupErr error
+        lookup := func(name string) (string, error) {
+                value, err := secret(name)
+                if err != nil && lookupErr == nil {
+                        lookupErr = err
+                }
+                return value, err
+        }
+
+        tmpl, err := template.New("").Funcs(templateFuncs(lookup)).Option("missingkey=error").Parse(text)
+        if err != nil {
+                return "", err
+        }
+        if vars == nil {
+                vars = map[string]string{}
+        }
+        var buf bytes.Buffer
+        if err := tmpl.Execute(&buf, vars); err != nil {
+                if lookupErr != nil {
+                        return "", lookupErr
+                }
+                return "", err
+        }
+        return buf.String(), nil
+}
+
+// validateTemplate checks that text parses as a request template
+func validateTemplate(text string) error {
+        _, err := template.New("").Funcs(templateFuncs(noSecrets)).Parse(text)
+        return err
+}
+
+// isSecretReference reports whether text is a template whose output only
+// comes from stored secrets, such as {{secret "name"}} or several of them in
+// a row, with no literal text or other values around them
+func isSecretReference(text string) bool {
+        tmpl, err := template.New("").Funcs(templateFuncs(noSecrets)).Parse(text)
+        if err != nil || tmpl.Tree == nil || len(tmpl.Tree.Root.Nodes) == 0 {
+                return false
+        }
+        for _, node := range tmpl.Tree.Root.Nodes {
+                action, ok := node.(*parse.ActionNode)
+                if !ok || len(action.Pipe.Decl) > 0 || len(action.Pipe.Cmds) != 1 {
+                        return false
+                }
+                args := action.Pipe.Cmds[0].Args
+                if len(args) != 2 {
+                        return false
+                }
+                function, ok := args[0].(*parse.IdentifierNode)
+                if !ok || function.Ident != "secret" {
+                        return false
+                }
+                if _, ok := args[1].(*parse.StringNode); !ok {
+                        return false
+                }
+        }
+        return true
+}
+
+// validateRequest normalizes the method of the website and checks its
+// request fields, recording problems
+func (w *Website) validateRequest(problems *ValidationError) {
+        w.Method = strings.ToUpper(strings.TrimSpace(w.Method))
+        if w.Method == "GET" {
+                w.Method = ""
+        }
+        if w.Method != "" {
+                known := false
+                for _, method := range CheckMethods {
+                        known = known || method == w.Method
+                }
+                if !known {
+                        problems.add("method", CodeInvalid, fmt.Sprintf("Method must be one of %s", strings.Join(CheckMethods, ", ")))
+                }
+        }
+
+        for name, value := range w.Headers {
+                if !httpguts.ValidHeaderFieldName(name) {
+                        problems.add("headers", CodeInvalid, fmt.Sprintf("Invalid header name %q", name))
+                } else if err := validateTemplate(value); err != nil {
+                        problems.add("headers", CodeInvalid, fmt.Sprintf("Invalid template in header %s: %v", name, err))
+                }
+        }
+        for name, value := range w.Query {
+                if name == "" {
+                        problems.add("query", CodeInvalid, "Query parameter names cannot be empty")
+                } else if err := validateTemplate(value); err != nil {
+                        problems.add("query", CodeInvalid, fmt.Sprintf("Invalid template in query parameter %s: %v", name, err))
+                }
+        }
+        if err := validateTemplate(w.Body); err != nil {
+                problems.add("body", CodeInvalid, fmt.Sprintf("Invalid body template: %v", err))
+        }
+        if w.Body != "" && (w.Method == "" || w.Method == "HEAD") {
+                problems.add("body", CodeInvalid, "A body requires a method such as POST or PUT")
+        }
+}
+
+// newRequest builds the request that checks a website, expanding its header,
+// query parameter and body templates. The request URL may contain secrets, so
+// errors should mention website.URL rather than the request's URL.
+func newRequest(website *Website, secret SecretFunc) (*http.Request, error) {
+        u, err := url.Parse(website.URL)
+        if err != nil {
+                return nil, err
+        }
+        if len(website.Query) > 0 {
+                query := u.Query()
+                for name, value := range website.Query {
+                        rendered, err := renderTemplate(value, secret)
+                        if err != nil {
+                                return nil, fmt.Errorf("query parameter %s: %v", name, err)
+                        }
+                        query.Set(name, rendered)
+                }
+                u.RawQuery = query.Encode()
+        }
+
+        body, err := renderTemplate(website.Body, secret)
+        if err != nil {
+                return nil, fmt.Errorf("body: %v", err)
+        }
+
+        method := website.Method
+        if method == "" {
+                method = http.MethodGet
+        }
+        var reader io.Reader
+        if body != "" {
+                reader = strings.NewReader(body)
+        }
+        req, err := http.NewRequest(method, u.String(), reader)
+        if err != nil {
+                return nil, err
+        }
+        if body != "" && json.Valid([]byte(body)) {
+                req.Header.Set("Content-Type", "application/json")
+        }
+
+        for name, value := range website.Headers {
+                rendered, err := renderTemplate(value, secret)
+                if err != nil {
+                        return nil, fmt.Errorf("header %s: %v", name, err)
+                }
+                if strings.EqualFold(name, "Host") {
+                        req.Host = rendered
+                        continue
+                }
+                req.Header.Set(name, rendered)
+        }
+        return req, nil
+}
@@ -0,0 +1,99 @@
+package monitor
+
+import (
+        "sync"
+        "sync/atomic"
+        "time"
+)
+
+// SchedulerStats describes the state of scheduled checking
+type SchedulerStats struct {
+        QueueDepth         int       `json:"queueDepth"` // Checks requested but not yet completed
+        Cycles             int64     `json:"cycles"`
+        LastCycleStarted   time.Time `json:"lastCycleStarted"`
+        LastCycleCompleted time.Time `json:"lastCycleCompleted"`
+        LastCycleDuration  float64   `json:"lastCycleDurationSeconds"`
+        LastCycleChecked   int       `json:"lastCycleChecked"`
+        CycleBudget        float64   `json:"cycleBudgetSeconds"` // Longest the current or last cycle can take
+}
+
+// schedulerState tracks checks in flight and scheduling cycles. It has its
+// own lock so reading it never waits on the monitor lock.
+type schedulerState struct {
+        queued atomic.Int64
+
+        mu    sync.Mutex
+        stats SchedulerStats
+}
+
+// SchedulerStats returns the current scheduler statistics
+func (m *Monitor) SchedulerStats() SchedulerStats {
+        m.scheduler.mu.Lock()
+        stats := m.scheduler.stats
+        m.scheduler.mu.Unlock()
+
+        stats.QueueDepth = int(m.scheduler.queued.Load())
+        return stats
+}
+
+// startCycle records the start of a scheduling cycle whose checks can take
+// up to budget
+func (m *Monitor) startCycle(started time.Time, budget time.Duration) {
+        m.scheduler.mu.Lock()
+        defer m.scheduler.mu.Unlock()
+
+        m.scheduler.stats.LastCycleStarted = started
+        m.scheduler.stats.CycleBudget = budget.Seconds()
+}
+
+// maxCheckDuration is the longest a check of the website can take when each
+// of its requests runs until the client times out. Authentication adds
+// requests: an OAuth2 token is fetched before each request and again after
+// a rejection, and an expired form login session costs the login page, the
+// login form and a retry.
+func (w *Website) maxCheckDuration() time.Duration {
+        requests := 1
+        if len(w.Steps) > 0 {
+                requests = len(w.Steps)
+        }
+        if w.Auth != nil {
+                switch w.Auth.Type {
+                case AuthOAuth2:
+                        if len(w.Steps) > 0 {
+                                requests *= 2
+                        } else {
+                                requests = 4
+                        }
+                case AuthForm:
+                        requests = 4
+                }
+        }
+        return time.Duration(requests) * requestTimeout
+}
+
+// cycleBudget is how long checking the websites can take. They are checked
+// concurrently, but each may first wait for a manual check of the same
+// website, so it is twice the slowest check.
+func cycleBudget(websites []*Website) time.Duration {
+        var slowest time.Duration
+        for _, website := range websites {
+                if d := website.maxCheckDuration(); d > slowest {
+                        slowest = d
+                }
+        }
+        return 2 * slowest
+}
+
+// completeCycle records the end of a scheduling cycle that checked the given
+// number of websites
+func (m *Monitor) completeCycle(started time.Time, checked int) {
+        completed := time.Now()
+
+        m.scheduler.mu.Lock()
+        defer m.scheduler.mu.Unlock()
+
+        m.scheduler.stats.Cycles++
+        m.scheduler.stats.LastCycleCompleted = completed
+        m.scheduler.stats.LastCycleDuration = completed.Sub(started).Seconds()
+        m.scheduler.stats.LastCycleChecked = checked
+}
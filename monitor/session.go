@@ -0,0 +1,287 @@
+package monitor
+
+import (
+        "bytes"
+        "crypto/sha256"
+        "encoding/hex"
+        "fmt"
+        "io"
+        "log"
+        "net/http"
+        "net/http/cookiejar"
+        "net/url"
+        "sort"
+        "strings"
+        "sync"
+
+        "golang.org/x/net/html"
+)
+
+// Default names of the form fields a form login fills in
+const (
+        DefaultUsernameField = "username"
+        DefaultPasswordField = "password"
+)
+
+// maxLoginPageSize limits how much of a login page is read for its form
+const maxLoginPageSize = 1 << 20
+
+// loginSession holds the cookies of a website's form login. Checks of the
+// same website are serialized, so a session is only used by one check at a
+// time.
+type loginSession struct {
+        configKey string         // Identifies the login configuration the session was made with
+        jar       http.CookieJar // Nil until logged in
+}
+
+// sessionStore holds the login sessions of websites by ID
+type sessionStore struct {
+        mu       sync.Mutex
+        sessions map[int]*loginSession
+}
+
+// get returns the website's session, starting a new one if its login
+// configuration changed
+func (s *sessionStore) get(website *Website) *loginSession {
+        key := website.Auth.sessionKey()
+
+        s.mu.Lock()
+        defer s.mu.Unlock()
+
+        session, ok := s.sessions[website.ID]
+        if !ok || session.configKey != key {
+                if s.sessions == nil {
+                        s.sessions = make(map[int]*loginSession)
+                }
+                session = &loginSession{configKey: key}
+                s.sessions[website.ID] = session
+        }
+        return session
+}
+
+// remove forgets the session of a website
+func (s *sessionStore) remove(id int) {
+        s.mu.Lock()
+        defer s.mu.Unlock()
+
+        delete(s.sessions, id)
+}
+
+// sessionKey identifies the settings a form login session depends on
+func (a *AuthConfig) sessionKey() string {
+        names := make([]string, 0, len(a.LoginFields))
+        for name := range a.LoginFields {
+                names = append(names, name)
+        }
+        sort.Strings(names)
+        parts := []string{a.LoginURL, a.Username, a.Password, a.UsernameField, a.PasswordField}
+        for _, name := range names {
+                parts = append(parts, name, a.LoginFields[name])
+        }
+        sum := sha256.Sum256([]byte(strings.Join(parts, "\x00")))
+        return hex.EncodeToString(sum[:])
+}
+
+// withJar returns a copy of client that keeps cookies in jar
+func withJar(client *http.Client, jar http.CookieJar) *http.Client {
+        c := *client
+        c.Jar = jar
+        return &c
+}
+
+// login starts a new session: it loads the login page for its cookies and
+// the hidden fields of its login form, such as CSRF tokens, then posts the
+// credentials to the form's action
+func (s *loginSession) login(client *http.Client, config *AuthConfig, secret SecretFunc) error {
+        jar, err := cookiejar.New(nil)
+        if err != nil {
+                return err
+        }
+        client = withJar(client, jar)
+
+        resp, err := client.Get(config.LoginURL)
+        if err != nil {
+                return fmt.Errorf("%w: loading login page: %v", ErrAuth, err)
+        }
+        page, err := io.ReadAll(io.LimitReader(resp.Body, maxLoginPageSize))
+        resp.Body.Close()
+        if err != nil {
+                return fmt.Errorf("%w: loading login page: %v", ErrAuth, err)
+        }
+        if resp.StatusCode >= 400 {
+                return fmt.Errorf("%w: login page returned %s", ErrAuth, resp.Status)
+        }
+
+        action, fields := loginForm(page)
+        target := resp.Request.URL
+        if action != "" {
+                if resolved, err := target.Parse(action); err == nil {
+                        target = resolved
+                }
+        }
+
+        render := func(field, value string) (string, error) {
+                rendered, err := renderTemplate(value, secret)
+                if err != nil {
+                        return "", fmt.Errorf("%w: %s: %v", ErrAuth, field, err)
+                }
+                return rendered, nil
+        }
+        for name, value := range config.LoginFields {
+                rendered, err := render(name, value)
+                if err != nil {
+                        return err
+                }
+                fields.Set(name, rendered)
+        }
+        username, err := render("username", config.Username)
+        if err != nil {
+                return err
+        }
+        password, err := render("password", config.Password)
+        if err != nil {
+                return err
+        }
+        fields.Set(config.UsernameField, username)
+        fields.Set(config.PasswordField, password)
+
+        resp, err = client.PostForm(target.String(), fields)
+        if err != nil {
+                return fmt.Errorf("%w: posting login form: %v", ErrAuth, err)
+        }
+        body, err := io.ReadAll(io.LimitReader(resp.Body, maxLoginPageSize))
+        resp.Body.Close()
+        if err != nil {
+                return fmt.Errorf("%w: posting login form: %v", ErrAuth, err)
+        }
+        if resp.StatusCode >= 400 {
+                return fmt.Errorf("%w: login returned %s", ErrAuth, resp.Status)
+        }
+        if config.SessionMarker != "" && bytes.Contains(body, []byte(config.SessionMarker)) {
+                return fmt.Errorf("%w: still logged out after logging in; check the credentials", ErrAuth)
+        }
+
+        s.jar = jar
+        return nil
+}
+
+// sendWithSession sends the request that checks a website in its login
+// session, logging in first when there is no session yet, and once more when
+// the response shows the session has expired
+func (m *Monitor) sendWithSession(client *http.Client, website *Website, secret SecretFunc) (*http.Response, error) {
+        session := m.sessions.get(website)
+        for {
+                fresh := session.jar == nil
+                if fresh {
+                        if err := session.login(client, website.Auth, secret); err != nil {
+                                return nil, err
+                        }
+                }
+
+                req, err := newRequest(website, secret)
+                if err != nil {
+                        return nil, fmt.Errorf("%w: %v", errRequestConfig, err)
+                }
+                resp, err := withJar(client, session.jar).Do(req)
+                if err != nil {
+                        return nil, err
+                }
+                expired, err := session.expired(resp, website.Auth)
+                if err != nil || !expired {
+                        return resp, err
+                }
+                resp.Body.Close()
+                session.jar = nil
+                if fresh {
+                        return nil, fmt.Errorf("%w: logged out again right after logging in", ErrAuth)
+                }
+                log.Printf("Session for %s expired, logging in again", website.URL)
+        }
+}
+
+// expired reports whether a response shows the session has expired: it was
+// redirected to the login page, or redirects there without being followed,
+// or contains the session marker. It reads the body to
+// look for the marker and replaces it, so the response can still be read.
+func (s *loginSession) expired(resp *http.Response, config *AuthConfig) (bool, error) {
+        // Request.Response is set on requests made by following a redirect
+        if login, err := url.Parse(config.LoginURL); err == nil && resp.Request != nil {
+                isLogin := func(u *url.URL) bool {
+                        return strings.EqualFold(u.Host, login.Host) && u.Path == login.Path
+                }
+                if resp.Request.Response != nil && isLogin(resp.Request.URL) {
+                        return true, nil
+                }
+                if location, err := resp.Location(); err == nil && isLogin(location) {
+                        return true, nil
+                }
+        }
+        if config.SessionMarker == "" {
+                return false, nil
+        }
+
+        body, err := io.ReadAll(resp.Body)
+        resp.Body.Close()
+        resp.Body = io.NopCloser(bytes.NewReader(body))
+        if err != nil {
+                return false, err
+        }
+        return bytes.Contains(body, []byte(config.SessionMarker)), nil
+}
+
+// loginForm finds the first form with a password field on a page, and
+// returns its action and the values of its hidden fields
+func loginForm(page []byte) (string, url.Values) {
+        doc, err := html.Parse(bytes.NewReader(page))
+        if err != nil {
+                return "", url.Values{}
+        }
+
+        var forms []*html.Node
+        var walk func(*html.Node)
+        walk = func(n *html.Node) {
+                if n.Type == html.ElementNode && n.Data == "form" {
+                        forms = append(forms, n)
+                }
+                for c := n.FirstChild; c != nil; c = c.NextSibling {
+                        walk(c)
+                }
+        }
+        walk(doc)
+
+        for _, form := range forms {
+                fields := url.Values{}
+                hasPassword := false
+                var inputs func(*html.Node)
+                inputs = func(n *html.Node) {
+                        if n.Type == html.ElementNode && n.Data == "input" {
+                                switch strings.ToLower(attr(n, "type")) {
+                                case "password":
+                                        hasPassword = true
+                                case "hidden":
+                                        if name := attr(n, "name"); name != "" {
+                                                fields.Add(name, attr(n, "value"))
+                                        }
+                                }
+                        }
+                        for c := n.FirstChild; c != nil; c = c.NextSibling {
+                                inputs(c)
+                        }
+                }
+                inputs(form)
+                if hasPassword {
+                        return attr(form, "action"), fields
+                }
+        }
+        return "", url.Values{}
+}
+
+// attr returns the value of an HTML attribute, or "" if it is missing
+func attr(n *html.Node, name string) string {
+        for _, a := range n.Attr {
+                if a.Key == name {
+                        return a.Val
+                }
+        }
+        return ""
+}
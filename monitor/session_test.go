@@ -0,0 +1,156 @@
+package monitor
+
+import (
+        "fmt"
+        "net/http"
+        "net/http/httptest"
+        "strconv"
+        "strings"
+        "sync"
+        "testing"
+)
+
+// sessionServer serves an account page behind a form login with a CSRF
+// token. Its sessions can be expired, after which the account page redirects
+// to the login page, or shows the login marker if marker is set.
+type sessionServer struct {
+        *httptest.Server
+        marker bool
+
+        mu       sync.Mutex
+        logins   int             // Login forms posted
+        sessions map[string]bool // Valid session cookies
+        seen     []string        // Session cookies the account page was requested with
+}
+
+func newSessionServer(t *testing.T, marker bool) *sessionServer {
+        t.Helper()
+        s := &sessionServer{marker: marker, sessions: map[string]bool{}}
+        s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+        t.Cleanup(s.Close)
+        return s
+}
+
+func (s *sessionServer) serve(w http.ResponseWriter, r *http.Request) {
+        s.mu.Lock()
+        defer s.mu.Unlock()
+
+        switch {
+        case r.URL.Path == "/login" && r.Method == "GET":
+                fmt.Fprint(w, `<p>Please log in</p><form method="post" action="/login"><input type="hidden" name="csrf" value="abc123"><input name="username"><input type="password" name="password"></form>`)
+        case r.URL.Path == "/login" && r.Method == "POST":
+                s.logins++
+                if r.FormValue("csrf") != "abc123" || r.FormValue("username") != "alice" || r.FormValue("password") != "hunter2" {
+                        fmt.Fprint(w, "Wrong password")
+                        return
+                }
+                session := strconv.Itoa(s.logins)
+                s.sessions[session] = true
+                http.SetCookie(w, &http.Cookie{Name: "session", Value: session, Path: "/"})
+                http.Redirect(w, r, "/welcome", http.StatusSeeOther)
+        case r.URL.Path == "/welcome":
+                fmt.Fprint(w, "Welcome")
+        case r.URL.Path == "/account":
+                cookie, err := r.Cookie("session")
+                if err == nil {
+                        s.seen = append(s.seen, cookie.Value)
+                }
+                if err != nil || !s.sessions[cookie.Value] {
+                        if s.marker {
+                                fmt.Fprint(w, "<p>Please log in</p>")
+                                return
+                        }
+                        http.Redirect(w, r, "/login", http.StatusFound)
+                        return
+                }
+                fmt.Fprint(w, "<h1>Alice</h1>")
+        default:
+                http.NotFound(w, r)
+        }
+}
+
+// expire ends every session
+func (s *sessionServer) expire() {
+        s.mu.Lock()
+        defer s.mu.Unlock()
+        s.sessions = map[string]bool{}
+}
+
+// state returns the number of logins and the session cookies the account
+// page was requested with
+func (s *sessionServer) state() (int, []string) {
+        s.mu.Lock()
+        defer s.mu.Unlock()
+        return s.logins, append([]string(nil), s.seen...)
+}
+
+// formLoginMonitor returns a monitor of the account page of server, logging
+// in with password as the stored secret "password"
+func formLoginMonitor(t *testing.T, server *sessionServer, password string) *Monitor {
+        t.Helper()
+        m := NewMonitor(nil)
+        m.SetProxy(nil)
+        m.SetEgressPolicy(testPolicy(t, []string{"127.0.0.1", "::1"}, nil))
+        m.SetSecretFunc(func(name string) (string, error) {
+                return password, nil
+        })
+
+        website := &Website{URL: server.URL + "/account", Auth: &AuthConfig{
+                Type:     AuthForm,
+                LoginURL: server.URL + "/login",
+                Username: "alice",
+                Password: `{{secret "password"}}`,
+        }}
+        if server.marker {
+                website.Auth.SessionMarker = "Please log in"
+        }
+        if err := website.Validate(); err != nil {
+                t.Fatalf("Validate: %v", err)
+        }
+        website.ID = 1
+        website.IsFirstCheck = true
+        m.AddExistingWebsite(website)
+        return m
+}
+
+func TestFormLoginSession(t *testing.T) {
+        for _, marker := range []bool{false, true} {
+                t.Run(fmt.Sprintf("marker=%v", marker), func(t *testing.T) {
+                        server := newSessionServer(t, marker)
+                        m := formLoginMonitor(t, server, "hunter2")
+
+                        check := func(name string) {
+                                t.Helper()
+                                if website := m.CheckWebsite(1); website.Error != "" {
+                                        t.Fatalf("%s: %s", name, website.Error)
+                                }
+                        }
+
+                        check("first check")
+                        check("second check")
+                        if logins, seen := server.state(); logins != 1 || strings.Join(seen, ",") != "1,1" {
+                                t.Fatalf("before expiry: %d logins, sessions %v; want 1 login reused by both checks", logins, seen)
+                        }
+
+                        server.expire()
+                        check("check after expiry")
+                        check("check after logging in again")
+                        if logins, seen := server.state(); logins != 2 || strings.Join(seen, ",") != "1,1,1,2,2" {
+                                t.Errorf("after expiry: %d logins, sessions %v; want exactly one more login, reused afterwards", logins, seen)
+                        }
+                })
+        }
+}
+
+func TestFormLoginWithWrongPassword(t *testing.T) {
+        server := newSessionServer(t, false)
+        m := formLoginMonitor(t, server, "wrong")
+
+        website := m.CheckWebsite(1)
+        if !strings.Contains(website.Error, "logged out again right after logging in") {
+                t.Errorf("error = %q, want a failed login", website.Error)
+        }
+        if logins, _ := server.state(); logins != 1 {
+                t.Errorf("%d logins, want a single attempt", logins)
+        }
+}
@@ -0,0 +1,181 @@
+package monitor
+
+import (
+        "crypto/tls"
+        "io"
+        "net/http"
+        "net/http/httptrace"
+        "sync"
+        "time"
+)
+
+// Timing breaks down where the time of a check went, in milliseconds. DNS,
+// connect and TLS are summed over the connections the check opened; they are
+// zero when it only reused kept-alive connections, as ReusedConnections
+// tells. TTFB runs from sending a request to the first byte of its response,
+// connection setup included, and transfer from there to the end of the body;
+// both are summed over the requests of the check, such as redirects, a form
+// login, fetching an OAuth2 token or the steps of a transaction. Tokens are
+// cached, so only checks that fetch one include it. Total is the whole check,
+// like HistoryEntry.DurationMs but finer.
+type Timing struct {
+        TotalMs    float64 `json:"totalMs"`
+        DNSMs      float64 `json:"dnsMs"`
+        ConnectMs  float64 `json:"connectMs"`
+        TLSMs      float64 `json:"tlsMs"`
+        TTFBMs     float64 `json:"ttfbMs"`
+        TransferMs float64 `json:"transferMs"`
+
+        NewConnections    int `json:"newConnections"`
+        ReusedConnections int `json:"reusedConnections"`
+}
+
+// measuredSetup reports whether the check opened a connection, so that its
+// DNS, connect and TLS times describe connection setup. Checks recorded
+// before connections were counted always opened new ones.
+func (t *Timing) measuredSetup() bool {
+        return t.NewConnections > 0 || t.ReusedConnections == 0
+}
+
+// checkTrace collects the timing of the requests of one check
+type checkTrace struct {
+        mu                                sync.Mutex
+        requests                          int
+        newConns, reusedConns             int
+        dns, connect, tls, ttfb, transfer time.Duration
+}
+
+// client returns a copy of client whose requests are traced. Connections are
+// kept alive as usual; the trace counts which ones were reused.
+func (t *checkTrace) client(client *http.Client) *http.Client {
+        c := *client
+        base := c.Transport
+        if base == nil {
+                base = http.DefaultTransport
+        }
+        c.Transport = &tracingTransport{base: base, trace: t}
+        return &c
+}
+
+// timing returns the collected timing, or nil if no request was sent
+func (t *checkTrace) timing() *Timing {
+        t.mu.Lock()
+        defer t.mu.Unlock()
+
+        if t.requests == 0 {
+                return nil
+        }
+        return &Timing{
+                DNSMs:      milliseconds(t.dns),
+                ConnectMs:  milliseconds(t.connect),
+                TLSMs:      milliseconds(t.tls),
+                TTFBMs:     milliseconds(t.ttfb),
+                TransferMs: milliseconds(t.transfer),
+
+                NewConnections:    t.newConns,
+                ReusedConnections: t.reusedConns,
+        }
+}
+
+// milliseconds converts a duration to milliseconds, keeping microseconds
+func milliseconds(d time.Duration) float64 {
+        return float64(d.Microseconds()) / 1000
+}
+
+// tracingTransport records the timing of the requests it sends in a
+// checkTrace
+type tracingTransport struct {
+        base  http.RoundTripper
+        trace *checkTrace
+}
+
+// RoundTrip sends a request with an httptrace.ClientTrace attached, and
+// wraps the response body to time its transfer
+func (t *tracingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+        trace := t.trace
+        var dnsStart, tlsStart, firstByte time.Time
+        connectStarts := make(map[string]time.Time) // Dials may race to several addresses
+
+        // Hooks may run on the transport's dialing goroutines
+        locked := func(f func()) {
+                trace.mu.Lock()
+                defer trace.mu.Unlock()
+                f()
+        }
+        clientTrace := &httptrace.ClientTrace{
+                DNSStart: func(httptrace.DNSStartInfo) {
+                        locked(func() { dnsStart = time.Now() })
+                },
+                DNSDone: func(httptrace.DNSDoneInfo) {
+                        locked(func() { trace.dns += time.Since(dnsStart) })
+                },
+                ConnectStart: func(network, addr string) {
+                        locked(func() { connectStarts[network+" "+addr] = time.Now() })
+                },
+                ConnectDone: func(network, addr string, err error) {
+                        locked(func() {
+                                if err == nil {
+                                        trace.connect += time.Since(connectStarts[network+" "+addr])
+                                }
+                        })
+                },
+                TLSHandshakeStart: func() {
+                        locked(func() { tlsStart = time.Now() })
+                },
+                TLSHandshakeDone: func(tls.ConnectionState, error) {
+                        locked(func() { trace.tls += time.Since(tlsStart) })
+                },
+                GotConn: func(info httptrace.GotConnInfo) {
+                        locked(func() {
+                                if info.Reused {
+                                        trace.reusedConns++
+                                } else {
+                                        trace.newConns++
+                                }
+                        })
+                },
+                GotFirstResponseByte: func() {
+                        locked(func() { firstByte = time.Now() })
+                },
+        }
+
+        start := time.Now()
+        req = req.Clone(httptrace.WithClientTrace(req.Context(), clientTrace))
+        resp, err := t.base.RoundTrip(req)
+
+        trace.mu.Lock()
+        defer trace.mu.Unlock()
+        trace.requests++
+        if err != nil || firstByte.IsZero() {
+                return resp, err
+        }
+        trace.ttfb += firstByte.Sub(start)
+        received := firstByte
+        resp.Body = &tracedBody{ReadCloser: resp.Body, done: func() {
+                locked(func() { trace.transfer += time.Since(received) })
+        }}
+        return resp, nil
+}
+
+// tracedBody calls done when its body has been read to the end or closed,
+// whichever comes first
+type tracedBody struct {
+        io.ReadCloser
+        once sync.Once
+        done func()
+}
+
+// Read reads from the body, finishing the transfer at EOF or an error
+func (b *tracedBody) Read(p []byte) (int, error) {
+        n, err := b.ReadCloser.Read(p)
+        if err != nil {
+                b.once.Do(b.done)
+        }
+        return n, err
+}
+
+// Close finishes the transfer and closes the body
+func (b *tracedBody) Close() error {
+        b.once.Do(b.done)
+        return b.ReadCloser.Close()
+}
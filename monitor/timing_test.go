@@ -0,0 +1,111 @@
+package monitor
+
+import (
+        "fmt"
+        "io"
+        "net/http"
+        "net/http/httptest"
+        "testing"
+        "time"
+)
+
+func TestCheckTraceCountsReusedConnections(t *testing.T) {
+        server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+                fmt.Fprint(w, "ok")
+        }))
+        defer server.Close()
+
+        policy := &EgressPolicy{Schemes: DefaultEgressSchemes}
+        client := policy.newClient(nil, nil)
+        check := func() *Timing {
+                trace := &checkTrace{}
+                resp, err := trace.client(client).Get(server.URL)
+                if err != nil {
+                        t.Fatal(err)
+                }
+                io.Copy(io.Discard, resp.Body)
+                resp.Body.Close()
+                return trace.timing()
+        }
+
+        first := check()
+        if first.NewConnections != 1 || first.ReusedConnections != 0 {
+                t.Errorf("first check opened %d and reused %d connections, want 1 and 0", first.NewConnections, first.ReusedConnections)
+        }
+        if first.ConnectMs <= 0 || !first.measuredSetup() {
+                t.Errorf("first check connect = %vms, want the connection setup measured", first.ConnectMs)
+        }
+
+        second := check()
+        if second.NewConnections != 0 || second.ReusedConnections != 1 {
+                t.Errorf("second check opened %d and reused %d connections, want 0 and 1", second.NewConnections, second.ReusedConnections)
+        }
+        if second.DNSMs != 0 || second.ConnectMs != 0 || second.TLSMs != 0 || second.measuredSetup() {
+                t.Errorf("second check dns %vms connect %vms tls %vms, want no connection setup", second.DNSMs, second.ConnectMs, second.TLSMs)
+        }
+}
+
+func TestPerformanceStatsLeaveOutReusedConnections(t *testing.T) {
+        at := time.Date(2026, 9, 1, 0, 0, 0, 0, time.UTC)
+        entries := []*HistoryEntry{
+                {CheckedAt: at, Timing: &Timing{TotalMs: 100, ConnectMs: 40, TTFBMs: 90, NewConnections: 1}},
+                {CheckedAt: at, Timing: &Timing{TotalMs: 50, TTFBMs: 45, ReusedConnections: 1}},
+                {CheckedAt: at, Timing: &Timing{TotalMs: 120, ConnectMs: 60, TTFBMs: 100}}, // Recorded before connections were counted
+        }
+
+        stats := performanceStats(entries)
+        if stats.Checks != 3 || stats.SetupChecks != 2 {
+                t.Errorf("checks = %d, setup checks = %d, want 3 and 2", stats.Checks, stats.SetupChecks)
+        }
+        if stats.Connect.Min != 40 || stats.Connect.Max != 60 {
+                t.Errorf("connect from %v to %v, want 40 to 60", stats.Connect.Min, stats.Connect.Max)
+        }
+        if stats.Total.Min != 50 || stats.TTFB.Min != 45 {
+                t.Errorf("total from %v, ttfb from %v, want 50 and 45", stats.Total.Min, stats.TTFB.Min)
+        }
+}
+
+func TestTimingIncludesTokenFetches(t *testing.T) {
+        const tokenDelay = 50 * time.Millisecond
+        server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+                if r.URL.Path == "/token" {
+                        time.Sleep(tokenDelay)
+                        fmt.Fprint(w, `{"access_token":"tok","token_type":"Bearer","expires_in":3600}`)
+                        return
+                }
+                if r.Header.Get("Authorization") != "Bearer tok" {
+                        http.Error(w, "Unauthorized", http.StatusUnauthorized)
+                        return
+                }
+                fmt.Fprint(w, "ok")
+        }))
+        defer server.Close()
+
+        m := NewMonitor(nil)
+        m.SetProxy(nil)
+        m.SetEgressPolicy(testPolicy(t, []string{"127.0.0.1", "::1"}, nil))
+        m.SetSecretFunc(func(name string) (string, error) { return "s3cret", nil })
+        website := &Website{ID: 1, URL: server.URL + "/", Auth: &AuthConfig{
+                Type:         AuthOAuth2,
+                TokenURL:     server.URL + "/token",
+                ClientID:     "monitor",
+                ClientSecret: `{{secret "client"}}`,
+        }}
+
+        // The first check fetches the token, the second uses the cached one
+        first := m.fetch(website)
+        if first.err != "" {
+                t.Fatal(first.err)
+        }
+        if requests := first.timing.NewConnections + first.timing.ReusedConnections; requests != 2 {
+                t.Errorf("first check sent %d requests, want the token request and the check", requests)
+        }
+        if first.timing.TTFBMs < milliseconds(tokenDelay) {
+                t.Errorf("first check TTFB = %vms, want the token request's %s included", first.timing.TTFBMs, tokenDelay)
+        }
+
+        second := m.fetch(website)
+        if requests := second.timing.NewConnections + second.timing.ReusedConnections; second.err != "" || requests != 1 {
+                t.Errorf("second check sent %d requests (error %q), want only the check", requests, second.err)
+        }
+}
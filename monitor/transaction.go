@@ -0,0 +1,490 @@
+package monitor
+
+import (
+        "bytes"
+        "crypto/md5"
+        "encoding/hex"
+        "errors"
+        "fmt"
+        "io"
+        "log"
+        "net/http"
+        "net/http/cookiejar"
+        "net/url"
+        "regexp"
+        "strings"
+        "time"
+
+        "github.com/andybalholm/cascadia"
+        "golang.org/x/net/html"
+        "golang.org/x/net/http/httpguts"
+)
+
+// MaxSteps is the most steps a transaction check may have
+const MaxSteps = 20
+
+// variableNamePattern is the form of variable names, which templates refer to
+// as {{.name}}
+var variableNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]{0,63}$`)
+
+// Step is one request of a transaction check. The URL, header, form and body
+// values are templates that may refer to stored secrets with {{secret "name"}}
+// and to variables extracted by earlier steps with {{.name}}.
+type Step struct {
+        Name    string            `json:"name,omitempty"`
+        Method  string            `json:"method,omitempty"`  // Defaults to POST when the step has a form or body, GET otherwise
+        URL     string            `json:"url,omitempty"`     // Resolved against the previous step's page; empty fetches the website's URL
+        Headers map[string]string `json:"headers,omitempty"` // Added to the website's headers
+        Form    map[string]string `json:"form,omitempty"`    // Fields sent URL-encoded as the body
+        Body    string            `json:"body,omitempty"`
+        Extract []Extract         `json:"extract,omitempty"` // Variables taken from the response
+
+        // Assertions on the response. Without ExpectStatus any 2xx status passes.
+        ExpectStatus   int    `json:"expectStatus,omitempty"`
+        ExpectText     string `json:"expectText,omitempty"`     // Text the response must contain
+        ExpectSelector string `json:"expectSelector,omitempty"` // CSS selector that must match an element
+}
+
+// Extract sets a variable from a step's response, either from the first
+// match of a regular expression (its first group, if it has one) or from the
+// first element matching a CSS selector (its text, or the value of Attr)
+type Extract struct {
+        Var      string `json:"var"`
+        Regex    string `json:"regex,omitempty"`
+        Selector string `json:"selector,omitempty"`
+        Attr     string `json:"attr,omitempty"`
+}
+
+// StepResult reports how one step of a transaction check went. Steps after a
+// failed step are not run and have no result.
+type StepResult struct {
+        Name       string `json:"name"`
+        URL        string `json:"url"` // Final URL of the step, without its query, which may hold secrets
+        StatusCode int    `json:"statusCode"`
+        DurationMs int64  `json:"durationMs"`
+        Error      string `json:"error,omitempty"`
+}
+
+// name returns the step's name, or its position if it has none
+func (s *Step) name(index int) string {
+        if s.Name != "" {
+                return s.Name
+        }
+        return fmt.Sprintf("step %d", index+1)
+}
+
+// method returns the HTTP method of the step
+func (s *Step) method() string {
+        switch {
+        case s.Method != "":
+                return s.Method
+        case len(s.Form) > 0 || s.Body != "":
+                return http.MethodPost
+        }
+        return http.MethodGet
+}
+
+// clone returns a copy of the step that shares no state with the original
+func (s Step) clone() Step {
+        s.Headers = copyMap(s.Headers)
+        s.Form = copyMap(s.Form)
+        s.Extract = append([]Extract(nil), s.Extract...)
+        return s
+}
+
+// equal reports whether two steps are the same
+func (s *Step) equal(o *Step) bool {
+        if len(s.Extract) != len(o.Extract) {
+                return false
+        }
+        for i := range s.Extract {
+                if s.Extract[i] != o.Extract[i] {
+                        return false
+                }
+        }
+        return s.Name == o.Name && s.Method == o.Method && s.URL == o.URL &&
+                equalMaps(s.Headers, o.Headers) && equalMaps(s.Form, o.Form) && s.Body == o.Body &&
+                s.ExpectStatus == o.ExpectStatus && s.ExpectText == o.ExpectText &&
+                s.ExpectSelector == o.ExpectSelector
+}
+
+// copySteps returns a deep copy of a step list, preserving nil
+func copySteps(steps []Step) []Step {
+        if steps == nil {
+                return nil
+        }
+        c := make([]Step, len(steps))
+        for i, step := range steps {
+                c[i] = step.clone()
+        }
+        return c
+}
+
+// equalSteps reports whether two step lists are the same
+func equalSteps(a, b []Step) bool {
+        if len(a) != len(b) {
+                return false
+        }
+        for i := range a {
+                if !a[i].equal(&b[i]) {
+                        return false
+                }
+        }
+        return true
+}
+
+// validateSteps normalizes the methods of the website's steps and checks
+// them, recording problems
+func (w *Website) validateSteps(problems *ValidationError) {
+        if len(w.Steps) == 0 {
+                return
+        }
+        if len(w.Steps) > MaxSteps {
+                problems.add("steps", CodeInvalid, fmt.Sprintf("A transaction can have at most %d steps", MaxSteps))
+        }
+        if w.Method != "" || w.Body != "" || len(w.Query) > 0 {
+                problems.add("steps", CodeInvalid, "Set the method, query and body of each step rather than of the website")
+        }
+        if w.Auth != nil && w.Auth.Type == AuthForm {
+                problems.add("steps", CodeInvalid, "Form authentication can't be combined with steps; log in with a step instead")
+        }
+
+        for i := range w.Steps {
+                step := &w.Steps[i]
+                invalid := func(format string, args ...interface{}) {
+                        problems.add("steps", CodeInvalid, fmt.Sprintf("Step %d: ", i+1)+fmt.Sprintf(format, args...))
+                }
+                template := func(what, text string) {
+                        if err := validateTemplate(text); err != nil {
+                                invalid("invalid template in %s: %v", what, err)
+                        }
+                }
+
+                step.Method = strings.ToUpper(strings.TrimSpace(step.Method))
+                if step.Method != "" {
+                        known := false
+                        for _, method := range CheckMethods {
+                                known = known || method == step.Method
+                        }
+                        if !known {
+                                invalid("method must be one of %s", strings.Join(CheckMethods, ", "))
+                        }
+                }
+                if (len(step.Form) > 0 || step.Body != "") && (step.Method == "GET" || step.Method == "HEAD") {
+                        invalid("a form or body requires a method such as POST or PUT")
+                }
+                if len(step.Form) > 0 && step.Body != "" {
+                        invalid("set either a form or a body, not both")
+                }
+
+                template("url", step.URL)
+                if !strings.Contains(step.URL, "{{") {
+                        if u, err := url.Parse(step.URL); err != nil {
+                                invalid("invalid URL: %v", err)
+                        } else if u.IsAbs() && u.Scheme != "http" && u.Scheme != "https" {
+                                invalid("URL must use http or https")
+                        }
+                }
+                for name, value := range step.Headers {
+                        if !httpguts.ValidHeaderFieldName(name) {
+                                invalid("invalid header name %q", name)
+                        } else {
+                                template("header "+name, value)
+                        }
+                }
+                for name, value := range step.Form {
+                        if name == "" {
+                                invalid("form field names cannot be empty")
+                        } else {
+                                template("form field "+name, value)
+                        }
+                }
+                template("body", step.Body)
+
+                if step.ExpectStatus != 0 && (step.ExpectStatus < 100 || step.ExpectStatus > 599) {
+                        invalid("expected status must be between 100 and 599")
+                }
+                if step.ExpectSelector != "" {
+                        if err := ValidateSelectors([]string{step.ExpectSelector}); err != nil {
+                                invalid("%v", err)
+                        }
+                }
+
+                for _, extract := range step.Extract {
+                        if !variableNamePattern.MatchString(extract.Var) {
+                                invalid("invalid variable name %q: use letters, digits and underscores, starting with a letter", extract.Var)
+                        }
+                        switch {
+                        case (extract.Regex == "") == (extract.Selector == ""):
+                                invalid("variable %s needs either a regex or a selector", extract.Var)
+                        case extract.Regex != "":
+                                if _, err := regexp.Compile(extract.Regex); err != nil {
+                                        invalid("invalid regex for variable %s: %v", extract.Var, err)
+                                }
+                        default:
+                                if err := ValidateSelectors([]string{extract.Selector}); err != nil {
+                                        invalid("%v", err)
+                                }
+                        }
+                }
+        }
+}
+
+// stepError is a failed step of a transaction, with the class of its error
+type stepError struct {
+        class string
+        err   error
+}
+
+func (e *stepError) Error() string { return e.err.Error() }
+func (e *stepError) Unwrap() error { return e.err }
+
+// runSteps performs a transaction check: it runs the website's steps in
+// order, sharing cookies between them and passing on extracted variables, and
+// stops at the first step that fails. The result describes the last page, so
+// change detection and selectors apply to the end of the flow.
+func (m *Monitor) runSteps(client *http.Client, website *Website, secret SecretFunc, policy *EgressPolicy) checkResult {
+        jar, err := cookiejar.New(nil)
+        if err != nil {
+                return checkResult{err: err.Error(), errClass: ErrorClassOther}
+        }
+        client = withJar(client, jar)
+
+        var result checkResult
+        vars := map[string]string{}
+        base, _ := url.Parse(website.URL)
+        var body []byte
+
+        for i := range website.Steps {
+                step := &website.Steps[i]
+                stepResult := StepResult{Name: step.name(i)}
+                start := time.Now()
+
+                var resp *http.Response
+                resp, body, err = m.runStep(client, website, step, base, vars, secret, policy)
+                stepResult.DurationMs = time.Since(start).Milliseconds()
+                if resp != nil {
+                        stepResult.URL = redactURL(resp.Request.URL)
+                        stepResult.StatusCode = resp.StatusCode
+                        base = resp.Request.URL
+                        result.statusCode = resp.StatusCode
+                        if expiry := certExpiry(resp); !expiry.IsZero() && (result.certExpiry.IsZero() || expiry.Before(result.certExpiry)) {
+                                result.certExpiry = expiry
+                        }
+                }
+                if err != nil {
+                        stepResult.Error = err.Error()
+                        result.steps = append(result.steps, stepResult)
+
+                        class := classifyError(err)
+                        var failed *stepError
+                        if errors.As(err, &failed) {
+                                class = failed.class
+                        }
+                        if step.Name != "" {
+                                result.err = fmt.Sprintf("Step %d (%s): %v", i+1, step.Name, err)
+                        } else {
+                                result.err = fmt.Sprintf("Step %d: %v", i+1, err)
+                        }
+                        result.errClass = class
+                        log.Printf("Transaction check of %s failed: %s", website.URL, result.err)
+                        return result
+                }
+                result.steps = append(result.steps, stepResult)
+        }
+
+        result.bodySize = int64(len(body))
+        content, err := extractContent(body, website.Selectors)
+        if err != nil {
+                result.err = err.Error()
+                result.errClass = ErrorClassContent
+                return result
+        }
+        hash := md5.Sum(content)
+        result.hash = hex.EncodeToString(hash[:])
+        return result
+}
+
+// runStep sends one step's request and checks its response, setting the
+// variables it extracts. It returns the response, whose body has been read
+// and closed, along with the body.
+func (m *Monitor) runStep(client *http.Client, website *Website, step *Step, base *url.URL, vars map[string]string, secret SecretFunc, policy *EgressPolicy) (*http.Response, []byte, error) {
+        render := func(what, text string) (string, error) {
+                rendered, err := expandTemplate(text, secret, vars)
+                if err != nil {
+                        return "", fmt.Errorf("%w: %s: %v", errRequestConfig, what, err)
+                }
+                return rendered, nil
+        }
+
+        target := website.URL
+        if step.URL != "" {
+                rendered, err := render("url", step.URL)
+                if err != nil {
+                        return nil, nil, err
+                }
+                u, err := base.Parse(rendered)
+                if err != nil {
+                        return nil, nil, fmt.Errorf("%w: url: %v", errRequestConfig, err)
+                }
+                target = u.String()
+        }
+        u, err := url.Parse(target)
+        if err != nil {
+                return nil, nil, fmt.Errorf("%w: url: %v", errRequestConfig, err)
+        }
+        if err := policy.checkScheme(u); err != nil {
+                return nil, nil, err
+        }
+
+        var reader io.Reader
+        contentType := ""
+        switch {
+        case len(step.Form) > 0:
+                form := url.Values{}
+                for name, value := range step.Form {
+                        rendered, err := render("form field "+name, value)
+                        if err != nil {
+                                return nil, nil, err
+                        }
+                        form.Set(name, rendered)
+                }
+                reader = strings.NewReader(form.Encode())
+                contentType = "application/x-www-form-urlencoded"
+        case step.Body != "":
+                rendered, err := render("body", step.Body)
+                if err != nil {
+                        return nil, nil, err
+                }
+                reader = strings.NewReader(rendered)
+        }
+
+        req, err := http.NewRequest(step.method(), target, reader)
+        if err != nil {
+                return nil, nil, fmt.Errorf("%w: %v", errRequestConfig, err)
+        }
+        if contentType != "" {
+                req.Header.Set("Content-Type", contentType)
+        }
+        headers := copyMap(website.Headers)
+        if headers == nil {
+                headers = map[string]string{}
+        }
+        for name, value := range step.Headers {
+                headers[name] = value
+        }
+        for name, value := range headers {
+                rendered, err := render("header "+name, value)
+                if err != nil {
+                        return nil, nil, err
+                }
+                if strings.EqualFold(name, "Host") {
+                        req.Host = rendered
+                        continue
+                }
+                req.Header.Set(name, rendered)
+        }
+        if _, err := m.authorize(req, website, client, secret); err != nil {
+                return nil, nil, err
+        }
+
+        resp, err := client.Do(req)
+        if err != nil {
+                // Query parameters may hold secrets, so don't report the request URL
+                var urlErr *url.Error
+                if errors.As(err, &urlErr) {
+                        urlErr.URL = redactURL(u)
+                }
+                return nil, nil, err
+        }
+        body, err := io.ReadAll(resp.Body)
+        resp.Body.Close()
+        if err != nil {
+                return resp, nil, fmt.Errorf("failed to read response: %w", err)
+        }
+
+        if step.ExpectStatus != 0 && resp.StatusCode != step.ExpectStatus {
+                return resp, body, &stepError{ErrorClassHTTP, fmt.Errorf("expected status %d, received %s", step.ExpectStatus, resp.Status)}
+        }
+        if step.ExpectStatus == 0 && (resp.StatusCode < 200 || resp.StatusCode > 299) {
+                return resp, body, &stepError{ErrorClassHTTP, fmt.Errorf("received status %s", resp.Status)}
+        }
+        if step.ExpectText != "" && !bytes.Contains(body, []byte(step.ExpectText)) {
+                return resp, body, &stepError{ErrorClassContent, fmt.Errorf("response does not contain %q", step.ExpectText)}
+        }
+
+        var doc *html.Node
+        parse := func() (*html.Node, error) {
+                if doc == nil {
+                        parsed, err := html.Parse(bytes.NewReader(body))
+                        if err != nil {
+                                return nil, &stepError{ErrorClassContent, fmt.Errorf("failed to parse HTML: %v", err)}
+                        }
+                        doc = parsed
+                }
+                return doc, nil
+        }
+        if step.ExpectSelector != "" {
+                doc, err := parse()
+                if err != nil {
+                        return resp, body, err
+                }
+                if cascadia.MustCompile(step.ExpectSelector).MatchFirst(doc) == nil {
+                        return resp, body, &stepError{ErrorClassContent, fmt.Errorf("selector %q matched nothing", step.ExpectSelector)}
+                }
+        }
+
+        for _, extract := range step.Extract {
+                if extract.Regex != "" {
+                        match := regexp.MustCompile(extract.Regex).FindSubmatch(body)
+                        if match == nil {
+                                return resp, body, &stepError{ErrorClassContent, fmt.Errorf("regex for variable %s matched nothing", extract.Var)}
+                        }
+                        value := match[0]
+                        if len(match) > 1 {
+                                value = match[1]
+                        }
+                        vars[extract.Var] = string(value)
+                        continue
+                }
+                doc, err := parse()
+                if err != nil {
+                        return resp, body, err
+                }
+                node := cascadia.MustCompile(extract.Selector).MatchFirst(doc)
+                if node == nil {
+                        return resp, body, &stepError{ErrorClassContent, fmt.Errorf("selector for variable %s matched nothing", extract.Var)}
+                }
+                if extract.Attr != "" {
+                        vars[extract.Var] = attr(node, extract.Attr)
+                } else {
+                        vars[extract.Var] = strings.TrimSpace(nodeText(node))
+                }
+        }
+        return resp, body, nil
+}
+
+// redactURL returns a URL without its query or user information, which may
+// hold secrets
+func redactURL(u *url.URL) string {
+        redacted := *u
+        redacted.RawQuery = ""
+        redacted.User = nil
+        return redacted.String()
+}
+
+// nodeText returns the text content of an HTML node
+func nodeText(n *html.Node) string {
+        var text strings.Builder
+        var walk func(*html.Node)
+        walk = func(n *html.Node) {
+                if n.Type == html.TextNode {
+                        text.WriteString(n.Data)
+                }
+                for c := n.FirstChild; c != nil; c = c.NextSibling {
+                        walk(c)
+                }
+        }
+        walk(n)
+        return text.String()
+}
@@ -0,0 +1,196 @@
+package monitor
+
+import (
+        "fmt"
+        "net/http"
+        "net/http/httptest"
+        "strings"
+        "testing"
+)
+
+// loginServer serves a login form with a CSRF token, which accepts the
+// password "hunter2" and sets a session cookie for the account page
+func loginServer(t *testing.T) *httptest.Server {
+        t.Helper()
+        server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+                switch {
+                case r.URL.Path == "/login" && r.Method == "GET":
+                        fmt.Fprint(w, `<form method="post"><input name="csrf" value="abc123"><input name="password"></form>`)
+                case r.URL.Path == "/login" && r.Method == "POST":
+                        if r.FormValue("csrf") != "abc123" || r.FormValue("password") != "hunter2" {
+                                fmt.Fprint(w, "Wrong password")
+                                return
+                        }
+                        http.SetCookie(w, &http.Cookie{Name: "session", Value: "alice"})
+                        http.Redirect(w, r, "/account?welcome=1", http.StatusSeeOther)
+                case r.URL.Path == "/account":
+                        if cookie, err := r.Cookie("session"); err != nil || cookie.Value != "alice" {
+                                http.Error(w, "Log in first", http.StatusUnauthorized)
+                                return
+                        }
+                        fmt.Fprint(w, `<h1 class="name">Alice</h1><p>Order 42 shipped</p>`)
+                default:
+                        http.NotFound(w, r)
+                }
+        }))
+        t.Cleanup(server.Close)
+        return server
+}
+
+// loginSteps logs in with the password stored as the secret "password" and
+// checks the account page
+func loginSteps() []Step {
+        return []Step{
+                {
+                        Name:    "form",
+                        URL:     "/login",
+                        Extract: []Extract{{Var: "csrf", Selector: `input[name="csrf"]`, Attr: "value"}},
+                },
+                {
+                        Name:       "log in",
+                        URL:        "/login",
+                        Form:       map[string]string{"csrf": "{{.csrf}}", "password": `{{secret "password"}}`},
+                        ExpectText: "Alice",
+                        Extract:    []Extract{{Var: "order", Regex: `Order (\d+)`}},
+                },
+                {
+                        Name:           "order",
+                        URL:            "/account?order={{.order}}",
+                        ExpectSelector: "h1.name",
+                },
+        }
+}
+
+// checkSteps runs a transaction check of steps against server, with
+// password as the stored secret "password"
+func checkSteps(t *testing.T, server *httptest.Server, steps []Step, password string) *Website {
+        t.Helper()
+        m := NewMonitor(nil)
+        m.SetProxy(nil)
+        m.SetEgressPolicy(testPolicy(t, []string{"127.0.0.1", "::1"}, nil))
+        m.SetSecretFunc(func(name string) (string, error) {
+                if name != "password" {
+                        return "", fmt.Errorf("secret %q not found", name)
+                }
+                return password, nil
+        })
+
+        website := &Website{URL: server.URL + "/", Steps: steps}
+        if err := website.Validate(); err != nil {
+                t.Fatalf("Validate: %v", err)
+        }
+        website.ID = 1
+        website.IsFirstCheck = true
+        m.AddExistingWebsite(website)
+        return m.CheckWebsite(1)
+}
+
+func TestTransactionCheck(t *testing.T) {
+        server := loginServer(t)
+        website := checkSteps(t, server, loginSteps(), "hunter2")
+
+        if website.Error != "" {
+                t.Fatalf("check failed: %s", website.Error)
+        }
+        want := []StepResult{
+                {Name: "form", URL: server.URL + "/login", StatusCode: 200},
+                {Name: "log in", URL: server.URL + "/account", StatusCode: 200},
+                {Name: "order", URL: server.URL + "/account", StatusCode: 200},
+        }
+        if len(website.StepResults) != len(want) {
+                t.Fatalf("step results = %+v, want %+v", website.StepResults, want)
+        }
+        for i, result := range website.StepResults {
+                result.DurationMs = 0
+                if result != want[i] {
+                        t.Errorf("step %d = %+v, want %+v", i+1, result, want[i])
+                }
+        }
+        if website.LastHash == "" {
+                t.Errorf("the final page was not hashed")
+        }
+}
+
+func TestTransactionCheckStopsAtTheFailedStep(t *testing.T) {
+        server := loginServer(t)
+        website := checkSteps(t, server, loginSteps(), "wrong")
+
+        want := `Step 2 (log in): response does not contain "Alice"`
+        if website.Error != want {
+                t.Errorf("error = %q, want %q", website.Error, want)
+        }
+        if len(website.StepResults) != 2 || website.StepResults[1].Error == "" {
+                t.Errorf("step results = %+v, want the second step to fail and the third not to run", website.StepResults)
+        }
+        if strings.Contains(website.Error, "wrong") {
+                t.Errorf("error reveals the secret: %s", website.Error)
+        }
+}
+
+func TestTransactionCheckFailures(t *testing.T) {
+        server := loginServer(t)
+
+        tests := []struct {
+                name string
+                step Step
+                err  string
+        }{
+                {"unexpected status", Step{URL: "/account"}, "Step 1: received status 401 Unauthorized"},
+                {"expected status", Step{URL: "/account", ExpectStatus: 401}, ""},
+                {"other expected status", Step{URL: "/login", ExpectStatus: 201}, "Step 1: expected status 201, received 200 OK"},
+                {"missing selector", Step{URL: "/login", ExpectSelector: "h1"}, `Step 1: selector "h1" matched nothing`},
+                {"missing variable", Step{URL: "/login", Extract: []Extract{{Var: "token", Regex: `token=(\w+)`}}}, "Step 1: regex for variable token matched nothing"},
+                {"unknown secret", Step{URL: `/login?key={{secret "api"}}`}, `secret "api" not found`},
+        }
+
+        for _, test := range tests {
+                t.Run(test.name, func(t *testing.T) {
+                        website := checkSteps(t, server, []Step{test.step}, "hunter2")
+                        if test.err == "" && website.Error != "" {
+                                t.Errorf("check failed: %s", website.Error)
+                        }
+                        if !strings.Contains(website.Error, test.err) {
+                                t.Errorf("error = %q, want it to contain %q", website.Error, test.err)
+                        }
+                })
+        }
+}
+
+func TestValidateSteps(t *testing.T) {
+        tests := []struct {
+                name    string
+                website Website
+                err     string // Part of the validation error; empty if valid
+        }{
+                {"valid", Website{Steps: loginSteps()}, ""},
+                {"website method", Website{Method: "POST", Steps: []Step{{}}}, "Set the method, query and body of each step"},
+                {"form authentication", Website{Auth: &AuthConfig{Type: AuthForm}, Steps: []Step{{}}}, "Form authentication can't be combined with steps"},
+                {"too many steps", Website{Steps: make([]Step, MaxSteps+1)}, fmt.Sprintf("at most %d steps", MaxSteps)},
+                {"unknown method", Website{Steps: []Step{{Method: "fetch"}}}, "Step 1: method must be one of"},
+                {"GET with a form", Website{Steps: []Step{{Method: "get", Form: map[string]string{"a": "b"}}}}, "Step 1: a form or body requires a method"},
+                {"form and body", Website{Steps: []Step{{Form: map[string]string{"a": "b"}, Body: "c"}}}, "Step 1: set either a form or a body"},
+                {"other scheme", Website{Steps: []Step{{URL: "ftp://example.com/"}}}, "Step 1: URL must use http or https"},
+                {"invalid template", Website{Steps: []Step{{}, {Body: "{{.token"}}}, "Step 2: invalid template in body"},
+                {"invalid variable", Website{Steps: []Step{{Extract: []Extract{{Var: "1st", Regex: "."}}}}}, `Step 1: invalid variable name "1st"`},
+                {"regex and selector", Website{Steps: []Step{{Extract: []Extract{{Var: "a", Regex: ".", Selector: "p"}}}}}, "Step 1: variable a needs either a regex or a selector"},
+                {"invalid regex", Website{Steps: []Step{{Extract: []Extract{{Var: "a", Regex: "("}}}}}, "Step 1: invalid regex for variable a"},
+                {"expected status", Website{Steps: []Step{{ExpectStatus: 99}}}, "Step 1: expected status must be between 100 and 599"},
+        }
+
+        for _, test := range tests {
+                t.Run(test.name, func(t *testing.T) {
+                        website := test.website
+                        website.URL = "https://example.com/"
+                        err := website.Validate()
+                        if test.err == "" {
+                                if err != nil {
+                                        t.Errorf("Validate = %v, want no error", err)
+                                }
+                                return
+                        }
+                        if err == nil || !strings.Contains(err.Error(), test.err) {
+                                t.Errorf("Validate = %v, want an error containing %q", err, test.err)
+                        }
+                })
+        }
+}
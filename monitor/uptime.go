@@ -0,0 +1,201 @@
+package monitor
+
+import (
+        "math"
+        "time"
+)
+
+// Limits on how much of a report period checks must cover
+const (
+        // MaxCheckGap is how many check intervals one check's outcome is taken
+        // to last at most. Beyond that, as while a website is paused or the
+        // monitor is down, nothing is known about the website.
+        MaxCheckGap = 2
+
+        // MinCoveragePercent is the share of a period checks must cover for
+        // an SLA to be judged met or missed
+        MinCoveragePercent = 95.0
+)
+
+// Incident is a period during which a website's checks failed, from the
+// first failed check to the next successful one, or to where a gap in the
+// checks begins
+type Incident struct {
+        Start           time.Time `json:"start"`
+        End             time.Time `json:"end"` // End of the report period while ongoing
+        DurationSeconds float64   `json:"durationSeconds"`
+        Ongoing         bool      `json:"ongoing"` // Not resolved by the end of the report period
+        FailedChecks    int       `json:"failedChecks"`
+        Error           string    `json:"error"` // Error of the first failed check
+        ErrorClass      string    `json:"errorClass,omitempty"`
+}
+
+// UptimeReport describes a website's availability over a period
+type UptimeReport struct {
+        WebsiteID int       `json:"websiteId"`
+        Name      string    `json:"name"`
+        URL       string    `json:"url"`
+        Since     time.Time `json:"since"`
+        Until     time.Time `json:"until"`
+
+        // Percentage of the monitored time the website was up, excluding
+        // maintenance; null if there were no checks in the period
+        UptimePercent *float64 `json:"uptimePercent"`
+
+        Checks             int        `json:"checks"`
+        FailedChecks       int        `json:"failedChecks"`
+        MonitoredSeconds   float64    `json:"monitoredSeconds"`   // Covered by checks; see MaxCheckGap
+        DowntimeSeconds    float64    `json:"downtimeSeconds"`    // Outside maintenance windows
+        MaintenanceSeconds float64    `json:"maintenanceSeconds"` // Excluded from the uptime
+        Incidents          []Incident `json:"incidents"`
+
+        // How well checks cover the period. FirstCheck and LastCheck are zero
+        // without checks; Complete reports whether the coverage reaches
+        // MinCoveragePercent.
+        IntervalSeconds int       `json:"intervalSeconds"`
+        FirstCheck      time.Time `json:"firstCheck"`
+        LastCheck       time.Time `json:"lastCheck"`
+        ExpectedChecks  int       `json:"expectedChecks"`
+        CoveragePercent float64   `json:"coveragePercent"`
+        Complete        bool      `json:"complete"`
+}
+
+// NewUptimeReport computes a website's uptime between since and until from
+// its check history in chronological order, for a website checked every
+// interval. Each check's outcome is taken to last until the next check, but
+// no longer than MaxCheckGap intervals; time not covered by checks, such as
+// before the first check in the period, counts neither as up nor as down.
+// Checks during maintenance windows neither count as downtime nor start or
+// end incidents.
+func NewUptimeReport(website *Website, entries []*HistoryEntry, since, until time.Time, interval time.Duration) *UptimeReport {
+        if interval <= 0 {
+                interval = DefaultInterval
+        }
+        report := &UptimeReport{
+                WebsiteID:       website.ID,
+                Name:            website.Name,
+                URL:             website.URL,
+                Since:           since,
+                Until:           until,
+                Incidents:       []Incident{},
+                IntervalSeconds: int(interval / time.Second),
+                ExpectedChecks:  int(until.Sub(since) / interval),
+        }
+
+        var inPeriod []*HistoryEntry
+        for _, entry := range entries {
+                if !entry.CheckedAt.Before(since) && entry.CheckedAt.Before(until) {
+                        inPeriod = append(inPeriod, entry)
+                }
+        }
+
+        var incident *Incident
+        closeIncident := func(end time.Time, ongoing bool) {
+                incident.End = end
+                incident.DurationSeconds = end.Sub(incident.Start).Seconds()
+                incident.Ongoing = ongoing
+                report.Incidents = append(report.Incidents, *incident)
+                incident = nil
+        }
+
+        maxGap := MaxCheckGap * interval
+        for i, entry := range inPeriod {
+                next := until
+                if i+1 < len(inPeriod) {
+                        next = inPeriod[i+1].CheckedAt
+                }
+                covered := next
+                if gap := next.Sub(entry.CheckedAt); gap > maxGap {
+                        covered = entry.CheckedAt.Add(maxGap)
+                }
+                lasted := covered.Sub(entry.CheckedAt).Seconds()
+                report.Checks++
+                report.MonitoredSeconds += lasted
+
+                switch {
+                case entry.Maintenance:
+                        report.MaintenanceSeconds += lasted
+                case entry.Error != "":
+                        report.FailedChecks++
+                        report.DowntimeSeconds += lasted
+                        if incident == nil {
+                                incident = &Incident{Start: entry.CheckedAt, Error: entry.Error, ErrorClass: entry.ErrorClass}
+                        }
+                        incident.FailedChecks++
+                case incident != nil:
+                        closeIncident(entry.CheckedAt, false)
+                }
+
+                // Nothing is known about the website during a gap
+                if incident != nil && covered.Before(next) {
+                        closeIncident(covered, false)
+                }
+        }
+        if incident != nil {
+                closeIncident(until, true)
+        }
+
+        if len(inPeriod) > 0 {
+                report.FirstCheck = inPeriod[0].CheckedAt
+                report.LastCheck = inPeriod[len(inPeriod)-1].CheckedAt
+        }
+        if period := until.Sub(since).Seconds(); period > 0 {
+                report.CoveragePercent = roundPercent(report.MonitoredSeconds / period * 100)
+        }
+        report.Complete = report.CoveragePercent >= MinCoveragePercent
+
+        if available := report.MonitoredSeconds - report.MaintenanceSeconds; available > 0 {
+                uptime := roundPercent((available - report.DowntimeSeconds) / available * 100)
+                report.UptimePercent = &uptime
+        } else if report.Checks > 0 {
+                // Only checked during maintenance
+                uptime := 100.0
+                report.UptimePercent = &uptime
+        }
+        return report
+}
+
+// SLAReport is the uptime of a set of websites over a calendar month,
+// compared with a target uptime
+type SLAReport struct {
+        Month         string       `json:"month"` // Such as "2026-09"
+        Since         time.Time    `json:"since"`
+        Until         time.Time    `json:"until"` // End of the month, or when the report was made if earlier
+        TargetPercent float64      `json:"targetPercent"`
+        Websites      []*SLAResult `json:"websites"`
+}
+
+// SLAResult is one website's uptime in an SLA report
+type SLAResult struct {
+        *UptimeReport
+
+        // Whether the uptime reached the target; null when checks don't cover
+        // enough of the period to tell
+        Met *bool `json:"met"`
+}
+
+// NewSLAResult compares an uptime report with a target uptime percentage
+func NewSLAResult(report *UptimeReport, targetPercent float64) *SLAResult {
+        result := &SLAResult{UptimeReport: report}
+        if report.Complete && report.UptimePercent != nil {
+                met := *report.UptimePercent >= targetPercent
+                result.Met = &met
+        }
+        return result
+}
+
+// LongestIncident returns the duration of the report's longest incident in
+// seconds, or zero if there were none
+func (r *UptimeReport) LongestIncident() float64 {
+        longest := 0.0
+        for _, incident := range r.Incidents {
+                longest = math.Max(longest, incident.DurationSeconds)
+        }
+        return longest
+}
+
+// roundPercent rounds a percentage down to three decimals, so that any
+// downtime shows as less than 100%
+func roundPercent(percent float64) float64 {
+        return math.Floor(percent*1000) / 1000
+}
@@ -0,0 +1,227 @@
+package monitor
+
+import (
+        "testing"
+        "time"
+)
+
+// checks builds a history of checks at the given minutes after start. Each
+// outcome is "up", "down", "maint" (up during maintenance) or "maint-down".
+func checks(start time.Time, minutes []int, outcomes []string) []*HistoryEntry {
+        var entries []*HistoryEntry
+        for i, minute := range minutes {
+                entry := &HistoryEntry{WebsiteID: 1, CheckedAt: start.Add(time.Duration(minute) * time.Minute)}
+                switch outcomes[i] {
+                case "down":
+                        entry.Error = "Received status: 503 Service Unavailable"
+                case "maint":
+                        entry.Maintenance = true
+                case "maint-down":
+                        entry.Maintenance = true
+                        entry.Error = "Received status: 503 Service Unavailable"
+                }
+                entries = append(entries, entry)
+        }
+        return entries
+}
+
+// minutes returns the minutes from 0 to n-1
+func minutes(n int) []int {
+        m := make([]int, n)
+        for i := range m {
+                m[i] = i
+        }
+        return m
+}
+
+// repeat returns n copies of an outcome
+func repeat(outcome string, n int) []string {
+        r := make([]string, n)
+        for i := range r {
+                r[i] = outcome
+        }
+        return r
+}
+
+func TestNewUptimeReport(t *testing.T) {
+        start := time.Date(2026, 9, 1, 0, 0, 0, 0, time.UTC)
+        until := start.Add(10 * time.Minute)
+
+        type incident struct {
+                start, end int // Minutes after start
+                ongoing    bool
+        }
+        tests := []struct {
+                name        string
+                minutes     []int
+                outcomes    []string
+                uptime      float64 // -1 for no uptime
+                downtime    float64 // Seconds
+                maintenance float64 // Seconds
+                coverage    float64
+                complete    bool
+                incidents   []incident
+        }{
+                {
+                        name:     "always up",
+                        minutes:  minutes(10),
+                        outcomes: repeat("up", 10),
+                        uptime:   100,
+                        coverage: 100,
+                        complete: true,
+                },
+                {
+                        name:      "resolved incident",
+                        minutes:   minutes(10),
+                        outcomes:  []string{"up", "up", "up", "down", "down", "up", "up", "up", "up", "up"},
+                        uptime:    80,
+                        downtime:  120,
+                        coverage:  100,
+                        complete:  true,
+                        incidents: []incident{{3, 5, false}},
+                },
+                {
+                        name:      "ongoing incident",
+                        minutes:   minutes(10),
+                        outcomes:  append(repeat("up", 9), "down"),
+                        uptime:    90,
+                        downtime:  60,
+                        coverage:  100,
+                        complete:  true,
+                        incidents: []incident{{9, 10, true}},
+                },
+                {
+                        name:        "failures during maintenance",
+                        minutes:     minutes(10),
+                        outcomes:    []string{"up", "up", "up", "maint-down", "maint-down", "up", "up", "up", "up", "up"},
+                        uptime:      100,
+                        maintenance: 120,
+                        coverage:    100,
+                        complete:    true,
+                },
+                {
+                        name:        "maintenance doesn't end an incident",
+                        minutes:     minutes(10),
+                        outcomes:    []string{"up", "down", "maint", "down", "up", "up", "up", "up", "up", "up"},
+                        uptime:      77.777,
+                        downtime:    120,
+                        maintenance: 60,
+                        coverage:    100,
+                        complete:    true,
+                        incidents:   []incident{{1, 4, false}},
+                },
+                {
+                        name:     "gap while paused is not counted",
+                        minutes:  []int{0, 1, 2, 8, 9},
+                        outcomes: repeat("up", 5),
+                        uptime:   100,
+                        coverage: 60,
+                },
+                {
+                        name:      "incident ends where a gap begins",
+                        minutes:   []int{0, 1, 2, 8, 9},
+                        outcomes:  []string{"up", "up", "down", "up", "up"},
+                        uptime:    66.666,
+                        downtime:  120,
+                        coverage:  60,
+                        incidents: []incident{{2, 4, false}},
+                },
+                {
+                        name:     "checks start late in the period",
+                        minutes:  []int{7, 8, 9},
+                        outcomes: repeat("up", 3),
+                        uptime:   100,
+                        coverage: 30,
+                },
+                {
+                        name:     "no checks",
+                        uptime:   -1,
+                        coverage: 0,
+                },
+                {
+                        name:     "checks outside the period are ignored",
+                        minutes:  []int{-5, -1, 10, 12},
+                        outcomes: []string{"down", "down", "down", "down"},
+                        uptime:   -1,
+                        coverage: 0,
+                },
+        }
+
+        for _, test := range tests {
+                t.Run(test.name, func(t *testing.T) {
+                        entries := checks(start, test.minutes, test.outcomes)
+                        report := NewUptimeReport(&Website{ID: 1}, entries, start, until, time.Minute)
+
+                        if test.uptime < 0 {
+                                if report.UptimePercent != nil {
+                                        t.Errorf("uptime = %v, want none", *report.UptimePercent)
+                                }
+                        } else if report.UptimePercent == nil || *report.UptimePercent != test.uptime {
+                                t.Errorf("uptime = %v, want %v", report.UptimePercent, test.uptime)
+                        }
+                        if report.DowntimeSeconds != test.downtime {
+                                t.Errorf("downtime = %v, want %v", report.DowntimeSeconds, test.downtime)
+                        }
+                        if report.MaintenanceSeconds != test.maintenance {
+                                t.Errorf("maintenance = %v, want %v", report.MaintenanceSeconds, test.maintenance)
+                        }
+                        if report.CoveragePercent != test.coverage || report.Complete != test.complete {
+                                t.Errorf("coverage = %v complete %v, want %v complete %v", report.CoveragePercent, report.Complete, test.coverage, test.complete)
+                        }
+                        if report.ExpectedChecks != 10 {
+                                t.Errorf("expected checks = %d, want 10", report.ExpectedChecks)
+                        }
+
+                        if len(report.Incidents) != len(test.incidents) {
+                                t.Fatalf("incidents = %+v, want %+v", report.Incidents, test.incidents)
+                        }
+                        for i, want := range test.incidents {
+                                got := report.Incidents[i]
+                                wantStart := start.Add(time.Duration(want.start) * time.Minute)
+                                wantEnd := start.Add(time.Duration(want.end) * time.Minute)
+                                if !got.Start.Equal(wantStart) || !got.End.Equal(wantEnd) || got.Ongoing != want.ongoing {
+                                        t.Errorf("incident %d = %v to %v ongoing %v, want %v to %v ongoing %v",
+                                                i, got.Start, got.End, got.Ongoing, wantStart, wantEnd, want.ongoing)
+                                }
+                                if got.DurationSeconds != wantEnd.Sub(wantStart).Seconds() {
+                                        t.Errorf("incident %d lasted %vs", i, got.DurationSeconds)
+                                }
+                        }
+                })
+        }
+}
+
+func TestNewSLAResult(t *testing.T) {
+        start := time.Date(2026, 9, 1, 0, 0, 0, 0, time.UTC)
+        until := start.Add(10 * time.Minute)
+
+        tests := []struct {
+                name     string
+                minutes  []int
+                outcomes []string
+                met      string // "true", "false" or "null"
+        }{
+                {"above target", minutes(10), repeat("up", 10), "true"},
+                {"below target", minutes(10), append(repeat("up", 9), "down"), "false"},
+                {"partial coverage", []int{7, 8, 9}, repeat("up", 3), "null"},
+                {"no checks", nil, nil, "null"},
+        }
+
+        for _, test := range tests {
+                t.Run(test.name, func(t *testing.T) {
+                        report := NewUptimeReport(&Website{ID: 1}, checks(start, test.minutes, test.outcomes), start, until, time.Minute)
+                        result := NewSLAResult(report, 99.9)
+
+                        got := "null"
+                        if result.Met != nil {
+                                got = "false"
+                                if *result.Met {
+                                        got = "true"
+                                }
+                        }
+                        if got != test.met {
+                                t.Errorf("met = %s, want %s", got, test.met)
+                        }
+                })
+        }
+}
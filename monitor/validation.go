@@ -0,0 +1,135 @@
+package monitor
+
+import (
+        "errors"
+        "fmt"
+        "net"
+        "net/url"
+        "strconv"
+        "strings"
+
+        "golang.org/x/net/idna"
+)
+
+// Validation error codes
+const (
+        CodeRequired  = "required"
+        CodeInvalid   = "invalid"
+        CodeDuplicate = "duplicate"
+        CodePolicy    = "policy"
+)
+
+// FieldError describes a problem with one field of a website configuration
+type FieldError struct {
+        Field   string `json:"field"`
+        Code    string `json:"code"`
+        Message string `json:"message"`
+}
+
+// ValidationError lists every problem found in a website configuration
+type ValidationError struct {
+        Errors []FieldError `json:"errors"`
+}
+
+// NewValidationError returns a validation error with a single problem
+func NewValidationError(field, code, message string) *ValidationError {
+        return &ValidationError{Errors: []FieldError{{Field: field, Code: code, Message: message}}}
+}
+
+func (e *ValidationError) Error() string {
+        messages := make([]string, len(e.Errors))
+        for i, fieldErr := range e.Errors {
+                messages[i] = fieldErr.Message
+        }
+        return strings.Join(messages, "; ")
+}
+
+// add records a problem with a field
+func (e *ValidationError) add(field, code, message string) {
+        e.Errors = append(e.Errors, FieldError{Field: field, Code: code, Message: message})
+}
+
+// err returns the validation error, or nil if no problems were recorded
+func (e *ValidationError) err() error {
+        if len(e.Errors) == 0 {
+                return nil
+        }
+        return e
+}
+
+// NormalizeURL validates a website URL and returns it in canonical form:
+// http or https (https is assumed when the scheme is missing), a lowercase
+// punycode host, no default port, no fragment, and "/" for an empty path.
+// Errors are *ValidationError values for the "url" field.
+func NormalizeURL(rawURL string) (string, error) {
+        rawURL = strings.TrimSpace(rawURL)
+        if rawURL == "" {
+                return "", NewValidationError("url", CodeRequired, "URL is required")
+        }
+        if !strings.Contains(rawURL, "://") {
+                rawURL = "https://" + rawURL
+        }
+
+        u, err := url.Parse(rawURL)
+        if err != nil {
+                var urlErr *url.Error
+                if errors.As(err, &urlErr) {
+                        err = urlErr.Err
+                }
+                return "", NewValidationError("url", CodeInvalid, fmt.Sprintf("URL is not valid: %v", err))
+        }
+
+        u.Scheme = strings.ToLower(u.Scheme)
+        if u.Scheme != "http" && u.Scheme != "https" {
+                return "", NewValidationError("url", CodeInvalid, fmt.Sprintf("URL scheme must be http or https, not %q", u.Scheme))
+        }
+
+        host := strings.TrimSuffix(u.Hostname(), ".")
+        if host == "" {
+                return "", NewValidationError("url", CodeInvalid, "URL must include a host")
+        }
+        if ip := net.ParseIP(host); ip == nil {
+                host, err = idna.Lookup.ToASCII(strings.ToLower(host))
+                if err != nil {
+                        return "", NewValidationError("url", CodeInvalid, fmt.Sprintf("URL host is not valid: %v", err))
+                }
+        } else if strings.Contains(host, ":") {
+                host = "[" + strings.ToLower(host) + "]"
+        }
+
+        port := u.Port()
+        if port != "" {
+                if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+                        return "", NewValidationError("url", CodeInvalid, fmt.Sprintf("URL port %q is not valid", port))
+                }
+                if (u.Scheme == "http" && port == "80") || (u.Scheme == "https" && port == "443") {
+                        port = ""
+                }
+        }
+        if port != "" {
+                host += ":" + port
+        }
+
+        u.Host = host
+        u.Fragment = ""
+        u.RawFragment = ""
+        if u.Path == "" {
+                u.Path = "/"
+                u.RawPath = ""
+        }
+        return u.String(), nil
+}
+
+// URLKey returns the key under which URLs are compared to find duplicate
+// websites. URLs that normalize the same, or differ only by a trailing
+// slash, share a key.
+func URLKey(rawURL string) string {
+        normalized, err := NormalizeURL(rawURL)
+        if err != nil {
+                return strings.TrimSpace(rawURL)
+        }
+        u, _ := url.Parse(normalized)
+        u.Path = strings.TrimRight(u.Path, "/")
+        u.RawPath = ""
+        return u.String()
+}
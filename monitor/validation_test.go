@@ -0,0 +1,98 @@
+package monitor
+
+import (
+        "errors"
+        "testing"
+)
+
+func TestNormalizeURL(t *testing.T) {
+        tests := []struct {
+                raw  string
+                want string
+                code string // Validation error code, if the URL is rejected
+        }{
+                {"example.com", "https://example.com/", ""},
+                {"  HTTP://Example.COM:80/Path#top  ", "http://example.com/Path", ""},
+                {"https://example.com:443", "https://example.com/", ""},
+                {"https://example.com:8443/a?b=c", "https://example.com:8443/a?b=c", ""},
+                {"https://example.com./", "https://example.com/", ""},
+                {"https://bücher.example/", "https://xn--bcher-kva.example/", ""},
+                {"http://[2001:DB8::1]:80/", "http://[2001:db8::1]/", ""},
+                {"http://192.0.2.1:8080", "http://192.0.2.1:8080/", ""},
+                {"", "", CodeRequired},
+                {"ftp://example.com/", "", CodeInvalid},
+                {"javascript://alert(1)", "", CodeInvalid},
+                {"https://", "", CodeInvalid},
+                {"https://example.com:0/", "", CodeInvalid},
+                {"https://example.com:70000/", "", CodeInvalid},
+                {"http://exa mple.com/", "", CodeInvalid},
+        }
+
+        for _, test := range tests {
+                got, err := NormalizeURL(test.raw)
+                if test.code == "" {
+                        if err != nil || got != test.want {
+                                t.Errorf("NormalizeURL(%q) = %q, %v, want %q", test.raw, got, err, test.want)
+                        }
+                        continue
+                }
+                var validationErr *ValidationError
+                if !errors.As(err, &validationErr) || len(validationErr.Errors) != 1 {
+                        t.Errorf("NormalizeURL(%q) = %q, %v, want a validation error", test.raw, got, err)
+                        continue
+                }
+                if fieldErr := validationErr.Errors[0]; fieldErr.Field != "url" || fieldErr.Code != test.code {
+                        t.Errorf("NormalizeURL(%q) error = %+v, want code %s for the url field", test.raw, fieldErr, test.code)
+                }
+        }
+}
+
+func TestFindDuplicate(t *testing.T) {
+        m := NewMonitor(nil)
+        m.AddExistingWebsite(&Website{ID: 1, URL: "https://example.com/status"})
+        m.AddExistingWebsite(&Website{ID: 2, URL: "https://example.org/"})
+
+        tests := []struct {
+                url    string
+                except int
+                want   int // ID of the duplicate, or zero
+        }{
+                {"https://example.com/status", 0, 1},
+                {"https://example.com/status/", 0, 1},
+                {"EXAMPLE.com:443/status#section", 0, 1},
+                {"https://example.org", 0, 2},
+                {"http://example.org/", 0, 0},
+                {"https://example.com/Status", 0, 0},
+                {"https://example.com/status?page=2", 0, 0},
+                {"https://example.com/status", 1, 0},
+        }
+
+        for _, test := range tests {
+                got := 0
+                if duplicate := m.FindDuplicate(test.url, test.except); duplicate != nil {
+                        got = duplicate.ID
+                }
+                if got != test.want {
+                        t.Errorf("FindDuplicate(%q, %d) = %d, want %d", test.url, test.except, got, test.want)
+                }
+        }
+}
+
+func TestValidateReportsEveryProblem(t *testing.T) {
+        website := &Website{URL: "ftp://example.com/", IntervalSeconds: -1, Selectors: []string{"[["}}
+        err := website.Validate()
+
+        var validationErr *ValidationError
+        if !errors.As(err, &validationErr) {
+                t.Fatalf("Validate = %v, want a *ValidationError", err)
+        }
+        fields := map[string]bool{}
+        for _, fieldErr := range validationErr.Errors {
+                fields[fieldErr.Field] = true
+        }
+        for _, field := range []string{"url", "intervalSeconds", "selectors"} {
+                if !fields[field] {
+                        t.Errorf("Validate reported %+v, want a problem with %s", validationErr.Errors, field)
+                }
+        }
+}
@@ -4,6 +4,9 @@ import (
         "time"
 )
 
+// DefaultInterval is how often a website is checked when it has no interval of its own
+const DefaultInterval = 5 * time.Minute
+
 // Website represents a website being monitored
 type Website struct {
         ID             int       `json:"id"`
@@ -22,4 +25,311 @@ type Website struct {
         ClientKeyPath     string `json:"clientKeyPath"`     // Path to client key file
         SkipTLSVerify     bool   `json:"skipTLSVerify"`     // Whether to skip TLS verification (insecure)
         CustomRootCAPath  string `json:"customRootCAPath"`  // Path to custom root CA certificate
+
+        // Scheduling and content fields
+        IntervalSeconds int      `json:"intervalSeconds"` // Seconds between checks; 0 uses DefaultInterval
+        Selectors       []string `json:"selectors"`       // CSS selectors limiting change detection to parts of the page
+        Tags            []string `json:"tags"`            // Labels for organizing websites
+        Group           string   `json:"group"`           // Hierarchical group path such as "team/service"
+
+        // Request fields. Header, query and body values are templates that may
+        // refer to stored secrets with {{secret "name"}}; see newRequest.
+        Method  string            `json:"method"`  // HTTP method; empty means GET
+        Headers map[string]string `json:"headers"` // Request headers by name
+        Query   map[string]string `json:"query"`   // Query parameters added to the URL
+        Body    string            `json:"body"`    // Request body, for methods such as POST
+
+        // Basic, Bearer, OAuth2 or form authentication; nil for none
+        Auth *AuthConfig `json:"auth,omitempty"`
+
+        // Proxy replaces or bypasses the global proxy; nil uses the global proxy
+        Proxy *ProxyConfig `json:"proxy,omitempty"`
+
+        // Redirects limits the redirects checks follow; nil follows up to
+        // DefaultMaxRedirects
+        Redirects *RedirectPolicy `json:"redirects,omitempty"`
+
+        // Where the last check that got a response ended up, the redirects on
+        // the way, and whether either differs from the check before
+        FinalURL        string     `json:"finalURL,omitempty"`
+        RedirectChain   []Redirect `json:"redirectChain,omitempty"`
+        RedirectChanged bool       `json:"redirectChanged"`
+
+        // Steps make the website a transaction check, which runs a sequence of
+        // requests and detects changes on the final page. StepResults reports
+        // the steps of the last check.
+        Steps       []Step       `json:"steps,omitempty"`
+        StepResults []StepResult `json:"stepResults,omitempty"`
+
+        // User who owns the website; empty for websites only admins manage
+        Owner string `json:"owner"`
+
+        // Paused websites are skipped by scheduled checks, until PausedUntil if set
+        Paused      bool      `json:"paused"`
+        PausedUntil time.Time `json:"pausedUntil"`
+
+        // Whether the last check ran during a maintenance window, so its
+        // errors and changes are not alerted on
+        Maintenance bool `json:"maintenance"`
+
+        // version orders snapshots of the website, so an older one is never
+        // saved over a newer one; see Monitor.persist
+        version uint64
+}
+
+// NewWebsite creates a website with the given ID and owner from the
+// configuration fields of config. The new website starts out waiting for its
+// first check.
+func NewWebsite(id int, config *Website) *Website {
+        website := &Website{
+                ID:           id,
+                IsFirstCheck: true,
+                Owner:        config.Owner,
+        }
+        website.ApplyConfig(config)
+        return website
+}
+
+// ApplyConfig copies the user-configurable fields of config onto the website.
+// Changing the URL, request or selectors resets change detection, since the
+// previous hash no longer describes the same content.
+func (w *Website) ApplyConfig(config *Website) {
+        requestChanged := w.Method != config.Method || w.Body != config.Body ||
+                !equalMaps(w.Headers, config.Headers) || !equalMaps(w.Query, config.Query) ||
+                !w.Auth.equal(config.Auth) || !equalSteps(w.Steps, config.Steps)
+        if w.URL != config.URL || requestChanged || !equalStrings(w.Selectors, config.Selectors) {
+                w.LastHash = ""
+                w.HasChanged = false
+                w.IsFirstCheck = true
+                w.FinalURL = ""
+                w.RedirectChain = nil
+                w.RedirectChanged = false
+        }
+
+        w.URL = config.URL
+        w.Name = config.Name
+        w.UsePKI = config.UsePKI
+        w.ClientCertPath = config.ClientCertPath
+        w.ClientKeyPath = config.ClientKeyPath
+        w.SkipTLSVerify = config.SkipTLSVerify
+        w.CustomRootCAPath = config.CustomRootCAPath
+        w.IntervalSeconds = config.IntervalSeconds
+        w.Selectors = copyStrings(config.Selectors)
+        w.Tags = copyStrings(config.Tags)
+        w.Group = CleanGroup(config.Group)
+        w.Method = config.Method
+        w.Headers = copyMap(config.Headers)
+        w.Query = copyMap(config.Query)
+        w.Body = config.Body
+        w.Auth = config.Auth.clone()
+        w.Proxy = config.Proxy.clone()
+        w.Redirects = config.Redirects.clone()
+        w.Steps = copySteps(config.Steps)
+        if len(w.Steps) == 0 {
+                w.StepResults = nil
+        }
+}
+
+// ConfigChanges lists the user-configurable fields ApplyConfig would change,
+// by their JSON names. Empty and missing lists, maps and settings compare as
+// the same.
+func (w *Website) ConfigChanges(config *Website) []string {
+        var fields []string
+        check := func(name string, differs bool) {
+                if differs {
+                        fields = append(fields, name)
+                }
+        }
+        check("url", w.URL != config.URL)
+        check("name", w.Name != config.Name)
+        check("intervalSeconds", w.IntervalSeconds != config.IntervalSeconds)
+        check("selectors", !equalStrings(w.Selectors, config.Selectors))
+        check("tags", !equalStrings(w.Tags, config.Tags))
+        check("group", w.Group != CleanGroup(config.Group))
+        check("usePKI", w.UsePKI != config.UsePKI)
+        check("clientCertPath", w.ClientCertPath != config.ClientCertPath)
+        check("clientKeyPath", w.ClientKeyPath != config.ClientKeyPath)
+        check("skipTLSVerify", w.SkipTLSVerify != config.SkipTLSVerify)
+        check("customRootCAPath", w.CustomRootCAPath != config.CustomRootCAPath)
+        check("method", w.Method != config.Method)
+        check("headers", !equalMaps(w.Headers, config.Headers))
+        check("query", !equalMaps(w.Query, config.Query))
+        check("body", w.Body != config.Body)
+        check("auth", !w.Auth.equal(config.Auth))
+        check("proxy", !w.Proxy.equal(config.Proxy))
+        check("redirects", !w.Redirects.equal(config.Redirects))
+        check("steps", !equalSteps(w.Steps, config.Steps))
+        return fields
+}
+
+// Validate normalizes the website's URL and checks its configuration fields.
+// Problems are reported together as a *ValidationError.
+func (w *Website) Validate() error {
+        problems := &ValidationError{}
+
+        if normalized, err := NormalizeURL(w.URL); err != nil {
+                problems.Errors = append(problems.Errors, err.(*ValidationError).Errors...)
+        } else {
+                w.URL = normalized
+        }
+
+        // Check for client certificate if PKI is enabled
+        if w.UsePKI && w.ClientCertPath != "" && w.ClientKeyPath == "" {
+                problems.add("clientKeyPath", CodeRequired, "Client key path is required when client certificate is provided")
+        }
+        if w.UsePKI && w.ClientKeyPath != "" && w.ClientCertPath == "" {
+                problems.add("clientCertPath", CodeRequired, "Client certificate path is required when client key is provided")
+        }
+
+        w.validateRequest(problems)
+        if w.Auth != nil {
+                w.Auth.validate(problems)
+        }
+        if w.Proxy != nil {
+                w.Proxy.validate(problems)
+        }
+        if w.Redirects != nil {
+                w.Redirects.validate(problems)
+        }
+        w.validateSteps(problems)
+
+        if w.IntervalSeconds < 0 {
+                problems.add("intervalSeconds", CodeInvalid, "Interval cannot be negative")
+        }
+        if err := ValidateSelectors(w.Selectors); err != nil {
+                problems.add("selectors", CodeInvalid, err.Error())
+        }
+        return problems.err()
+}
+
+// Interval returns how often the website should be checked, ignoring group
+// defaults; see Monitor.EffectiveInterval
+func (w *Website) Interval() time.Duration {
+        if w.IntervalSeconds > 0 {
+                return time.Duration(w.IntervalSeconds) * time.Second
+        }
+        return DefaultInterval
+}
+
+// IsPaused reports whether the website is paused at the given time
+func (w *Website) IsPaused(now time.Time) bool {
+        return w.Paused && (w.PausedUntil.IsZero() || now.Before(w.PausedUntil))
+}
+
+// IsDue reports whether the website is not paused and interval has elapsed
+// since its last check
+func (w *Website) IsDue(now time.Time, interval time.Duration) bool {
+        if w.IsPaused(now) {
+                return false
+        }
+        return w.LastChecked.IsZero() || now.Sub(w.LastChecked) >= interval
+}
+
+// Redacted returns a copy of the website for the audit log, with the
+// credentials of its authentication and proxy settings replaced by Redacted
+func (w *Website) Redacted() interface{} {
+        if w == nil {
+                return nil
+        }
+        c := w.clone()
+        c.Auth = w.Auth.redacted()
+        c.Proxy = w.Proxy.redacted()
+        return c
+}
+
+// clone returns a copy of the website that shares no state with the original
+func (w *Website) clone() *Website {
+        c := *w
+        c.Selectors = copyStrings(w.Selectors)
+        c.Tags = copyStrings(w.Tags)
+        c.Headers = copyMap(w.Headers)
+        c.Query = copyMap(w.Query)
+        c.Auth = w.Auth.clone()
+        c.Proxy = w.Proxy.clone()
+        c.Redirects = w.Redirects.clone()
+        c.RedirectChain = append([]Redirect(nil), w.RedirectChain...)
+        c.Steps = copySteps(w.Steps)
+        c.StepResults = append([]StepResult(nil), w.StepResults...)
+        return &c
+}
+
+// copyStrings returns a copy of a string slice, preserving nil
+func copyStrings(values []string) []string {
+        if values == nil {
+                return nil
+        }
+        return append([]string{}, values...)
+}
+
+// copyMap returns a copy of a string map, preserving nil
+func copyMap(values map[string]string) map[string]string {
+        if values == nil {
+                return nil
+        }
+        c := make(map[string]string, len(values))
+        for k, v := range values {
+                c[k] = v
+        }
+        return c
+}
+
+// equalMaps reports whether two string maps hold the same entries
+func equalMaps(a, b map[string]string) bool {
+        if len(a) != len(b) {
+                return false
+        }
+        for k, v := range a {
+                if other, ok := b[k]; !ok || other != v {
+                        return false
+                }
+        }
+        return true
+}
+
+// equalStrings reports whether two string slices hold the same values in order
+func equalStrings(a, b []string) bool {
+        if len(a) != len(b) {
+                return false
+        }
+        for i := range a {
+                if a[i] != b[i] {
+                        return false
+                }
+        }
+        return true
+}
+
+// applyResult updates the website's check state from a completed fetch
+func (w *Website) applyResult(result checkResult, checkedAt time.Time) {
+        w.LastChecked = checkedAt
+        w.LastStatusCode = result.statusCode
+        w.StepResults = result.steps
+
+        // Track where the website redirects to, noticing when that changes
+        w.RedirectChanged = false
+        if result.finalURL != "" {
+                w.RedirectChanged = w.FinalURL != "" &&
+                        (w.FinalURL != result.finalURL || !equalRedirects(w.RedirectChain, result.redirects))
+                w.FinalURL = result.finalURL
+                w.RedirectChain = result.redirects
+        }
+
+        if result.err != "" {
+                w.Error = result.err
+                w.HasChanged = false
+                return
+        }
+
+        // Check if content has changed
+        if w.IsFirstCheck {
+                w.IsFirstCheck = false
+                w.HasChanged = false
+        } else if w.LastHash != result.hash {
+                w.HasChanged = true
+        } else {
+                w.HasChanged = false
+        }
+
+        w.LastHash = result.hash
+        w.Error = ""
 }
@@ -0,0 +1,106 @@
+package sites
+
+import (
+        "fmt"
+        "strings"
+
+        "website-monitor/monitor"
+)
+
+// Action is the kind of change a reconcile makes to one website
+type Action string
+
+// Reconcile actions
+const (
+        ActionAdd    Action = "add"
+        ActionUpdate Action = "update"
+        ActionRemove Action = "remove"
+)
+
+// Change is one step of a reconcile plan
+type Change struct {
+        Action  Action           `json:"action"`
+        ID      int              `json:"id,omitempty"` // Existing website, for updates and removals
+        URL     string           `json:"url"`
+        Fields  []string         `json:"fields,omitempty"` // Fields that differ, for updates
+        Desired *monitor.Website `json:"-"`
+}
+
+// String describes the change for plan output
+func (c Change) String() string {
+        switch c.Action {
+        case ActionAdd:
+                return fmt.Sprintf("+ add     %s", c.URL)
+        case ActionUpdate:
+                return fmt.Sprintf("~ update  %s (#%d): %s", c.URL, c.ID, strings.Join(c.Fields, ", "))
+        default:
+                return fmt.Sprintf("- remove  %s (#%d)", c.URL, c.ID)
+        }
+}
+
+// Plan works out the changes that make the current websites match the desired
+// ones. Websites are matched by URL, compared by monitor.URLKey. Current
+// websites that are not in the desired list are removed only when prune is set.
+func Plan(current, desired []*monitor.Website, prune bool) []Change {
+        byURL := map[string][]*monitor.Website{}
+        for _, website := range current {
+                key := monitor.URLKey(website.URL)
+                byURL[key] = append(byURL[key], website)
+        }
+
+        var plan []Change
+        for _, want := range desired {
+                key := monitor.URLKey(want.URL)
+                matches := byURL[key]
+                if len(matches) == 0 {
+                        plan = append(plan, Change{Action: ActionAdd, URL: want.URL, Desired: want})
+                        continue
+                }
+
+                have := matches[0]
+                byURL[key] = matches[1:]
+                if fields := have.ConfigChanges(want); len(fields) > 0 {
+                        plan = append(plan, Change{Action: ActionUpdate, ID: have.ID, URL: want.URL, Fields: fields, Desired: want})
+                }
+        }
+
+        if prune {
+                // Anything left unmatched, including duplicates of a desired URL
+                for _, website := range current {
+                        for _, left := range byURL[monitor.URLKey(website.URL)] {
+                                if left == website {
+                                        plan = append(plan, Change{Action: ActionRemove, ID: website.ID, URL: website.URL})
+                                }
+                        }
+                }
+        }
+        return plan
+}
+
+// Target applies reconcile changes to a set of monitored websites
+type Target interface {
+        Add(config *monitor.Website) error
+        Update(id int, config *monitor.Website) error
+        Remove(id int) error
+}
+
+// Apply carries out a plan against a target. A change that fails doesn't
+// stop the others; Apply returns an error for each failed change.
+func Apply(target Target, plan []Change) []error {
+        var errs []error
+        for _, change := range plan {
+                var err error
+                switch change.Action {
+                case ActionAdd:
+                        err = target.Add(change.Desired)
+                case ActionUpdate:
+                        err = target.Update(change.ID, change.Desired)
+                case ActionRemove:
+                        err = target.Remove(change.ID)
+                }
+                if err != nil {
+                        errs = append(errs, fmt.Errorf("%s %s: %v", change.Action, change.URL, err))
+                }
+        }
+        return errs
+}
@@ -0,0 +1,173 @@
+package sites
+
+import (
+        "encoding/json"
+        "errors"
+        "reflect"
+        "strings"
+        "testing"
+
+        "website-monitor/monitor"
+)
+
+// stored returns the websites as the monitor keeps them after a restart:
+// added with the next IDs and loaded back from their JSON
+func stored(t *testing.T, configs []*monitor.Website) []*monitor.Website {
+        t.Helper()
+        var websites []*monitor.Website
+        for i, config := range configs {
+                data, err := json.Marshal(monitor.NewWebsite(i+1, config))
+                if err != nil {
+                        t.Fatal(err)
+                }
+                var website monitor.Website
+                if err := json.Unmarshal(data, &website); err != nil {
+                        t.Fatal(err)
+                }
+                websites = append(websites, &website)
+        }
+        return websites
+}
+
+// parse parses site definitions, failing the test if they are invalid
+func parse(t *testing.T, yaml string) []*monitor.Website {
+        t.Helper()
+        websites, err := Parse([]byte(yaml))
+        if err != nil {
+                t.Fatal(err)
+        }
+        return websites
+}
+
+const definitions = `
+websites:
+  - url: https://a.example.com/
+    name: A
+    headers: {}
+    auth:
+      type: form
+      loginURL: https://a.example.com/login
+      username: monitor
+      password: '{{secret "a"}}'
+      loginFields: {}
+    redirects: {}
+  - url: https://b.example.com/
+    steps:
+      - url: /login
+        headers: {}
+        form: {}
+        extract: []
+  - url: https://c.example.com/
+`
+
+func TestPlan(t *testing.T) {
+        current := stored(t, parse(t, definitions))
+        current = append(current, &monitor.Website{ID: 4, URL: "https://gone.example.com/"}, &monitor.Website{ID: 5, URL: "https://c.example.com"})
+
+        tests := []struct {
+                name    string
+                desired string
+                prune   bool
+                want    []string // Changes as printed
+        }{
+                {
+                        name:    "unchanged",
+                        desired: definitions,
+                },
+                {
+                        name:    "prune",
+                        desired: definitions,
+                        prune:   true,
+                        want: []string{
+                                "- remove  https://gone.example.com/ (#4)",
+                                "- remove  https://c.example.com (#5)",
+                        },
+                },
+                {
+                        name: "create and update",
+                        desired: `
+websites:
+  - url: https://a.example.com
+    name: Renamed
+    tags: [new]
+    auth:
+      type: form
+      loginURL: https://a.example.com/login
+      username: monitor
+      password: '{{secret "a"}}'
+    redirects:
+      mode: none
+  - url: https://new.example.com/
+`,
+                        want: []string{
+                                "~ update  https://a.example.com/ (#1): name, tags, redirects",
+                                "+ add     https://new.example.com/",
+                        },
+                },
+        }
+
+        for _, test := range tests {
+                t.Run(test.name, func(t *testing.T) {
+                        var got []string
+                        for _, change := range Plan(current, parse(t, test.desired), test.prune) {
+                                got = append(got, change.String())
+                        }
+                        if !reflect.DeepEqual(got, test.want) {
+                                t.Errorf("plan = %q, want %q", got, test.want)
+                        }
+                })
+        }
+}
+
+// fakeTarget records the changes applied to it, failing those for URLs
+// containing "fail"
+type fakeTarget struct {
+        applied []string
+}
+
+func (f *fakeTarget) Add(config *monitor.Website) error {
+        if strings.Contains(config.URL, "fail") {
+                return errors.New("Website is not allowed")
+        }
+        f.applied = append(f.applied, "add "+config.URL)
+        return nil
+}
+
+func (f *fakeTarget) Update(id int, config *monitor.Website) error {
+        f.applied = append(f.applied, "update "+config.URL)
+        return nil
+}
+
+func (f *fakeTarget) Remove(id int) error {
+        if id == 13 {
+                return errors.New("Website not found")
+        }
+        f.applied = append(f.applied, "remove "+strings.Repeat("#", id))
+        return nil
+}
+
+func TestApplyContinuesPastFailures(t *testing.T) {
+        plan := []Change{
+                {Action: ActionAdd, URL: "https://fail.example.com/", Desired: &monitor.Website{URL: "https://fail.example.com/"}},
+                {Action: ActionAdd, URL: "https://a.example.com/", Desired: &monitor.Website{URL: "https://a.example.com/"}},
+                {Action: ActionRemove, ID: 13, URL: "https://gone.example.com/"},
+                {Action: ActionUpdate, ID: 2, URL: "https://b.example.com/", Desired: &monitor.Website{URL: "https://b.example.com/"}},
+        }
+        target := &fakeTarget{}
+        errs := Apply(target, plan)
+
+        if want := []string{"add https://a.example.com/", "update https://b.example.com/"}; !reflect.DeepEqual(target.applied, want) {
+                t.Errorf("applied %q, want %q", target.applied, want)
+        }
+        var messages []string
+        for _, err := range errs {
+                messages = append(messages, err.Error())
+        }
+        want := []string{
+                "add https://fail.example.com/: Website is not allowed",
+                "remove https://gone.example.com/: Website not found",
+        }
+        if !reflect.DeepEqual(messages, want) {
+                t.Errorf("errors = %q, want %q", messages, want)
+        }
+}
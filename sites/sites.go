@@ -0,0 +1,322 @@
+// Package sites reads declarative website definitions from a YAML file and
+// reconciles the monitored websites against them.
+package sites
+
+import (
+        "bytes"
+        "errors"
+        "fmt"
+        "io"
+        "os"
+        "time"
+
+        "gopkg.in/yaml.v3"
+        "website-monitor/monitor"
+)
+
+// File is the top-level structure of a site definitions file:
+//
+//	defaults:
+//	  interval: 10m
+//	  tags: [production]
+//	websites:
+//	  - url: https://example.com/pricing
+//	    name: Pricing page
+//	    selectors: ["#prices"]
+//	    tags: [marketing]
+//	    group: marketing/landing-pages
+//	  - url: https://api.example.com/orders
+//	    method: POST
+//	    headers:
+//	      Authorization: Bearer {{secret "orders-token"}}
+//	    body: '{"status": "open"}'
+//	  - url: https://reports.example.com
+//	    auth:
+//	      type: oauth2
+//	      tokenURL: https://login.example.com/oauth/token
+//	      clientId: monitor
+//	      clientSecret: '{{secret "reports-client"}}'
+//	  - url: https://shop.example.com
+//	    steps:
+//	      - name: Login page
+//	        url: /login
+//	        extract:
+//	          - var: csrf
+//	            selector: input[name=csrf]
+//	            attr: value
+//	      - name: Log in
+//	        form:
+//	          csrf: "{{.csrf}}"
+//	          user: monitor
+//	          password: '{{secret "shop-password"}}'
+//	        expectText: Welcome
+//	  - url: https://example.com/docs
+//	    redirects:
+//	      mode: same-host
+//	      maxHops: 3
+//	  - url: https://partner.example.net
+//	    proxy:
+//	      url: socks5://proxy.example.com:1080
+//	      username: monitor
+//	      password: '{{secret "proxy-password"}}'
+//	  - url: https://intranet.example.com
+//	    proxy:
+//	      direct: true
+//	    pki:
+//	      clientCert: certs/client.pem
+//	      clientKey: certs/client.key
+type File struct {
+        Defaults Defaults     `yaml:"defaults"`
+        Websites []Definition `yaml:"websites"`
+}
+
+// Defaults are applied to every definition that doesn't set its own value.
+// Default tags are added to each website's own tags.
+type Defaults struct {
+        Interval Duration `yaml:"interval"`
+        Tags     []string `yaml:"tags"`
+        Group    string   `yaml:"group"`
+}
+
+// Definition describes one website
+type Definition struct {
+        URL       string   `yaml:"url"`
+        Name      string   `yaml:"name"`
+        Interval  Duration `yaml:"interval"`
+        Selectors []string `yaml:"selectors"`
+        Tags      []string `yaml:"tags"`
+        Group     string   `yaml:"group"`
+        PKI       *PKI     `yaml:"pki"`
+
+        // Request fields; header, query and body values are templates
+        Method  string            `yaml:"method"`
+        Headers map[string]string `yaml:"headers"`
+        Query   map[string]string `yaml:"query"`
+        Body    string            `yaml:"body"`
+        Auth    *Auth             `yaml:"auth"`
+        Proxy   *Proxy            `yaml:"proxy"`
+
+        // Redirect handling; see monitor.RedirectPolicy
+        Redirects *Redirects `yaml:"redirects"`
+
+        // Steps make the definition a transaction check; see monitor.Step
+        Steps []Step `yaml:"steps"`
+}
+
+// PKI holds the mutual TLS settings of a definition
+type PKI struct {
+        ClientCert    string `yaml:"clientCert"`
+        ClientKey     string `yaml:"clientKey"`
+        RootCA        string `yaml:"rootCA"`
+        SkipTLSVerify bool   `yaml:"skipTLSVerify"`
+}
+
+// Auth holds the authentication settings of a definition; see
+// monitor.AuthConfig
+type Auth struct {
+        Type             string            `yaml:"type"`
+        Username         string            `yaml:"username"`
+        Password         string            `yaml:"password"`
+        Token            string            `yaml:"token"`
+        TokenURL         string            `yaml:"tokenURL"`
+        ClientID         string            `yaml:"clientId"`
+        ClientSecret     string            `yaml:"clientSecret"`
+        Scopes           []string          `yaml:"scopes"`
+        ClientAuthInBody bool              `yaml:"clientAuthInBody"`
+        LoginURL         string            `yaml:"loginURL"`
+        UsernameField    string            `yaml:"usernameField"`
+        PasswordField    string            `yaml:"passwordField"`
+        LoginFields      map[string]string `yaml:"loginFields"`
+        SessionMarker    string            `yaml:"sessionMarker"`
+}
+
+// Proxy holds the proxy settings of a definition; see monitor.ProxyConfig
+type Proxy struct {
+        URL      string   `yaml:"url"`
+        Username string   `yaml:"username"`
+        Password string   `yaml:"password"`
+        NoProxy  []string `yaml:"noProxy"`
+        Direct   bool     `yaml:"direct"`
+}
+
+// Redirects holds the redirect policy of a definition
+type Redirects struct {
+        Mode    string `yaml:"mode"`
+        MaxHops int    `yaml:"maxHops"`
+}
+
+// Step is one request of a transaction check; see monitor.Step
+type Step struct {
+        Name           string            `yaml:"name"`
+        Method         string            `yaml:"method"`
+        URL            string            `yaml:"url"`
+        Headers        map[string]string `yaml:"headers"`
+        Form           map[string]string `yaml:"form"`
+        Body           string            `yaml:"body"`
+        Extract        []Extract         `yaml:"extract"`
+        ExpectStatus   int               `yaml:"expectStatus"`
+        ExpectText     string            `yaml:"expectText"`
+        ExpectSelector string            `yaml:"expectSelector"`
+}
+
+// Extract sets a variable from a step's response; see monitor.Extract
+type Extract struct {
+        Var      string `yaml:"var"`
+        Regex    string `yaml:"regex"`
+        Selector string `yaml:"selector"`
+        Attr     string `yaml:"attr"`
+}
+
+// Duration is a time.Duration written as a string such as "90s" or "10m"
+type Duration time.Duration
+
+// UnmarshalYAML parses a duration string
+func (d *Duration) UnmarshalYAML(value *yaml.Node) error {
+        var s string
+        if err := value.Decode(&s); err != nil {
+                return err
+        }
+        parsed, err := time.ParseDuration(s)
+        if err != nil {
+                return fmt.Errorf("line %d: invalid duration %q", value.Line, s)
+        }
+        *d = Duration(parsed)
+        return nil
+}
+
+// Load reads and validates a site definitions file
+func Load(path string) ([]*monitor.Website, error) {
+        data, err := os.ReadFile(path)
+        if err != nil {
+                return nil, err
+        }
+
+        websites, err := Parse(data)
+        if err != nil {
+                return nil, fmt.Errorf("%s: %v", path, err)
+        }
+        return websites, nil
+}
+
+// Parse decodes site definitions and returns the website configurations they
+// describe, with defaults applied
+func Parse(data []byte) ([]*monitor.Website, error) {
+        var file File
+        decoder := yaml.NewDecoder(bytes.NewReader(data))
+        decoder.KnownFields(true)
+        if err := decoder.Decode(&file); err != nil && !errors.Is(err, io.EOF) {
+                return nil, err
+        }
+
+        seen := map[string]bool{}
+        websites := make([]*monitor.Website, 0, len(file.Websites))
+        for i, def := range file.Websites {
+                website := def.website(file.Defaults)
+                if err := website.Validate(); err != nil {
+                        return nil, fmt.Errorf("website %d: %v", i+1, err)
+                }
+                key := monitor.URLKey(website.URL)
+                if seen[key] {
+                        return nil, fmt.Errorf("website %d: duplicate url %s", i+1, website.URL)
+                }
+                seen[key] = true
+                websites = append(websites, website)
+        }
+        return websites, nil
+}
+
+// website converts the definition to a website configuration
+func (def Definition) website(defaults Defaults) *monitor.Website {
+        url := def.URL
+        if normalized, err := monitor.NormalizeURL(url); err == nil {
+                url = normalized
+        }
+        website := &monitor.Website{
+                URL:       url,
+                Name:      def.Name,
+                Selectors: def.Selectors,
+                Tags:      mergeTags(defaults.Tags, def.Tags),
+                Group:     monitor.CleanGroup(def.Group),
+                Method:    def.Method,
+                Headers:   def.Headers,
+                Query:     def.Query,
+                Body:      def.Body,
+        }
+        if website.Group == "" {
+                website.Group = monitor.CleanGroup(defaults.Group)
+        }
+        if website.Name == "" {
+                website.Name = website.URL
+        }
+
+        interval := time.Duration(def.Interval)
+        if interval == 0 {
+                interval = time.Duration(defaults.Interval)
+        }
+        website.IntervalSeconds = int(interval / time.Second)
+
+        if def.PKI != nil {
+                website.UsePKI = true
+                website.ClientCertPath = def.PKI.ClientCert
+                website.ClientKeyPath = def.PKI.ClientKey
+                website.CustomRootCAPath = def.PKI.RootCA
+                website.SkipTLSVerify = def.PKI.SkipTLSVerify
+        }
+        if def.Auth != nil {
+                website.Auth = &monitor.AuthConfig{
+                        Type:             def.Auth.Type,
+                        Username:         def.Auth.Username,
+                        Password:         def.Auth.Password,
+                        Token:            def.Auth.Token,
+                        TokenURL:         def.Auth.TokenURL,
+                        ClientID:         def.Auth.ClientID,
+                        ClientSecret:     def.Auth.ClientSecret,
+                        Scopes:           def.Auth.Scopes,
+                        ClientAuthInBody: def.Auth.ClientAuthInBody,
+                        LoginURL:         def.Auth.LoginURL,
+                        UsernameField:    def.Auth.UsernameField,
+                        PasswordField:    def.Auth.PasswordField,
+                        LoginFields:      def.Auth.LoginFields,
+                        SessionMarker:    def.Auth.SessionMarker,
+                }
+        }
+        if def.Proxy != nil {
+                proxy := monitor.ProxyConfig(*def.Proxy)
+                website.Proxy = &proxy
+        }
+        if def.Redirects != nil {
+                redirects := monitor.RedirectPolicy(*def.Redirects)
+                website.Redirects = &redirects
+        }
+        for _, step := range def.Steps {
+                converted := monitor.Step{
+                        Name:           step.Name,
+                        Method:         step.Method,
+                        URL:            step.URL,
+                        Headers:        step.Headers,
+                        Form:           step.Form,
+                        Body:           step.Body,
+                        ExpectStatus:   step.ExpectStatus,
+                        ExpectText:     step.ExpectText,
+                        ExpectSelector: step.ExpectSelector,
+                }
+                for _, extract := range step.Extract {
+                        converted.Extract = append(converted.Extract, monitor.Extract(extract))
+                }
+                website.Steps = append(website.Steps, converted)
+        }
+        return website
+}
+
+// mergeTags combines default and website tags, dropping duplicates
+func mergeTags(defaults, tags []string) []string {
+        var merged []string
+        seen := map[string]bool{}
+        for _, tag := range append(append([]string{}, defaults...), tags...) {
+                if !seen[tag] {
+                        seen[tag] = true
+                        merged = append(merged, tag)
+                }
+        }
+        return merged
+}
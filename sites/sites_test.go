@@ -0,0 +1,98 @@
+package sites
+
+import (
+        "reflect"
+        "strings"
+        "testing"
+
+        "website-monitor/monitor"
+)
+
+func TestParse(t *testing.T) {
+        websites, err := Parse([]byte(`
+defaults:
+  interval: 10m
+  tags: [production]
+  group: web
+websites:
+  - url: example.com/pricing
+    name: Pricing
+    tags: [marketing, production]
+  - url: https://api.example.com/orders
+    interval: 30s
+    group: api
+    method: POST
+    headers:
+      Authorization: Bearer {{secret "orders-token"}}
+    redirects:
+      mode: none
+  - url: https://shop.example.com
+    pki:
+      clientCert: client.pem
+      clientKey: client.key
+    steps:
+      - url: /login
+        extract:
+          - var: csrf
+            selector: input[name=csrf]
+            attr: value
+      - form:
+          csrf: "{{.csrf}}"
+`))
+        if err != nil {
+                t.Fatal(err)
+        }
+        if len(websites) != 3 {
+                t.Fatalf("parsed %d websites, want 3", len(websites))
+        }
+
+        pricing, orders, shop := websites[0], websites[1], websites[2]
+        if pricing.URL != "https://example.com/pricing" || pricing.Name != "Pricing" || pricing.IntervalSeconds != 600 || pricing.Group != "web" {
+                t.Errorf("pricing = %s %q every %ds in %q", pricing.URL, pricing.Name, pricing.IntervalSeconds, pricing.Group)
+        }
+        if !reflect.DeepEqual(pricing.Tags, []string{"production", "marketing"}) {
+                t.Errorf("pricing tags = %v, want the default tag first without duplicates", pricing.Tags)
+        }
+        if orders.IntervalSeconds != 30 || orders.Group != "api" || orders.Method != "POST" || orders.Redirects == nil || orders.Redirects.Mode != monitor.RedirectNone {
+                t.Errorf("orders = %+v", orders)
+        }
+        if orders.Name != orders.URL {
+                t.Errorf("orders name = %q, want its URL", orders.Name)
+        }
+        if !shop.UsePKI || shop.ClientCertPath != "client.pem" || len(shop.Steps) != 2 || shop.Steps[1].Form["csrf"] != "{{.csrf}}" {
+                t.Errorf("shop = %+v", shop)
+        }
+        if extract := shop.Steps[0].Extract; len(extract) != 1 || extract[0].Attr != "value" {
+                t.Errorf("shop extracts %+v", extract)
+        }
+}
+
+func TestParseErrors(t *testing.T) {
+        tests := []struct {
+                name string
+                yaml string
+                err  string
+        }{
+                {"unknown field", "websites:\n  - url: https://example.com\n    colour: red\n", "field colour not found"},
+                {"invalid duration", "defaults:\n  interval: often\n", `invalid duration "often"`},
+                {"invalid website", "websites:\n  - url: https://example.com\n  - url: ftp://example.com\n", "website 2: URL scheme must be http or https"},
+                {"duplicate URL", "websites:\n  - url: https://example.com\n  - url: https://EXAMPLE.com/\n", "website 2: duplicate url"},
+                {"plain-text credential", "websites:\n  - url: https://example.com\n    auth:\n      type: bearer\n      token: hunter2\n", "must only refer to stored secrets"},
+        }
+
+        for _, test := range tests {
+                t.Run(test.name, func(t *testing.T) {
+                        _, err := Parse([]byte(test.yaml))
+                        if err == nil || !strings.Contains(err.Error(), test.err) {
+                                t.Errorf("Parse = %v, want an error containing %q", err, test.err)
+                        }
+                })
+        }
+}
+
+func TestParseEmpty(t *testing.T) {
+        websites, err := Parse(nil)
+        if err != nil || len(websites) != 0 {
+                t.Errorf("Parse of an empty file = %v, %v, want no websites", websites, err)
+        }
+}
@@ -0,0 +1,48 @@
+package sites
+
+import (
+        "bytes"
+        "log"
+        "os"
+        "time"
+
+        "website-monitor/monitor"
+)
+
+// Watch polls a site definitions file and calls onChange with the parsed
+// websites whenever its contents change, until stop is closed. Polling the
+// contents rather than watching inodes also picks up files replaced by a
+// rename, as happens on git checkout. Files that fail to parse are logged and
+// skipped, leaving the last good definitions in place.
+func Watch(path string, interval time.Duration, stop <-chan struct{}, onChange func([]*monitor.Website)) {
+        last, _ := os.ReadFile(path)
+
+        ticker := time.NewTicker(interval)
+        defer ticker.Stop()
+
+        for {
+                select {
+                case <-stop:
+                        return
+                case <-ticker.C:
+                }
+
+                data, err := os.ReadFile(path)
+                if err != nil {
+                        log.Printf("Error reading site definitions %s: %v", path, err)
+                        continue
+                }
+                if bytes.Equal(data, last) {
+                        continue
+                }
+                last = data
+
+                websites, err := Parse(data)
+                if err != nil {
+                        log.Printf("Ignoring invalid site definitions %s: %v", path, err)
+                        continue
+                }
+                log.Printf("Site definitions %s changed, reconciling", path)
+                onChange(websites)
+        }
+}
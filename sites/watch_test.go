@@ -0,0 +1,74 @@
+package sites
+
+import (
+        "os"
+        "path/filepath"
+        "testing"
+        "time"
+
+        "website-monitor/monitor"
+)
+
+func TestWatchReloadsChangedFiles(t *testing.T) {
+        path := filepath.Join(t.TempDir(), "sites.yaml")
+        write := func(content string) {
+                t.Helper()
+                // Replace the file, as git checkout does
+                tmp := path + ".tmp"
+                if err := os.WriteFile(tmp, []byte(content), 0644); err != nil {
+                        t.Fatal(err)
+                }
+                if err := os.Rename(tmp, path); err != nil {
+                        t.Fatal(err)
+                }
+        }
+        write("websites:\n  - url: https://a.example.com/\n")
+
+        changes := make(chan []*monitor.Website, 10)
+        stop := make(chan struct{})
+        done := make(chan struct{})
+        go func() {
+                Watch(path, 5*time.Millisecond, stop, func(websites []*monitor.Website) { changes <- websites })
+                close(done)
+        }()
+        defer func() {
+                close(stop)
+                <-done
+        }()
+
+        next := func() []*monitor.Website {
+                t.Helper()
+                select {
+                case websites := <-changes:
+                        return websites
+                case <-time.After(2 * time.Second):
+                        t.Fatal("the change was not noticed")
+                        return nil
+                }
+        }
+        quiet := func() {
+                t.Helper()
+                select {
+                case websites := <-changes:
+                        t.Fatalf("unexpected reload with %d websites", len(websites))
+                case <-time.After(50 * time.Millisecond):
+                }
+        }
+
+        // The contents at the start are not reported again
+        quiet()
+
+        write("websites:\n  - url: https://a.example.com/\n  - url: https://b.example.com/\n")
+        if websites := next(); len(websites) != 2 || websites[1].URL != "https://b.example.com/" {
+                t.Errorf("reloaded %+v, want both websites", websites)
+        }
+
+        // Invalid files are skipped, keeping the last good definitions
+        write("websites:\n  - url: ftp://a.example.com/\n")
+        quiet()
+
+        write("websites: []\n")
+        if websites := next(); len(websites) != 0 {
+                t.Errorf("reloaded %d websites, want none", len(websites))
+        }
+}
@@ -3,6 +3,12 @@ document.addEventListener('DOMContentLoaded', function() {
     const addWebsiteForm = document.getElementById('addWebsiteForm');
     const websiteUrl = document.getElementById('websiteUrl');
     const websiteName = document.getElementById('websiteName');
+    const websiteGroup = document.getElementById('websiteGroup');
+    const websiteTags = document.getElementById('websiteTags');
+    const groupOptions = document.getElementById('groupOptions');
+    const groupFilter = document.getElementById('groupFilter');
+    const tagFilter = document.getElementById('tagFilter');
+    const groupActions = document.querySelector('.group-actions');
     const usePKI = document.getElementById('usePKI');
     const pkiOptionsDiv = document.querySelector('.pki-options');
     const clientCertPath = document.getElementById('clientCertPath');
@@ -12,6 +18,10 @@ document.addEventListener('DOMContentLoaded', function() {
     const changedWebsitesList = document.getElementById('changedWebsitesList');
     const unchangedWebsitesList = document.getElementById('unchangedWebsitesList');
     const checkAllBtn = document.getElementById('checkAllBtn');
+    const exportFormat = document.getElementById('exportFormat');
+    const exportBtn = document.getElementById('exportBtn');
+    const importBtn = document.getElementById('importBtn');
+    const importFile = document.getElementById('importFile');
     const websiteItemTemplate = document.getElementById('websiteItemTemplate');
     
     // Load websites on page load
@@ -20,6 +30,24 @@ document.addEventListener('DOMContentLoaded', function() {
     // Set up interval to refresh website data
     setInterval(loadWebsites, 60000); // Refresh every minute
     
+    // Update live as the server reports check events
+    let reloadTimer = null;
+    if (window.EventSource) {
+        const events = new EventSource('/api/events');
+        events.addEventListener('check-started', function(e) {
+            const event = JSON.parse(e.data);
+            document.querySelectorAll(`.website-item[data-id="${event.websiteId}"] .website-status`).forEach(status => {
+                status.textContent = 'Checking...';
+                status.className = 'website-status';
+            });
+        });
+        events.addEventListener('check-completed', function() {
+            // Batch the reloads when many checks finish together
+            clearTimeout(reloadTimer);
+            reloadTimer = setTimeout(loadWebsites, 500);
+        });
+    }
+    
     // Event listeners
     if (addWebsiteForm) {
         addWebsiteForm.addEventListener('submit', handleAddWebsite);
@@ -29,6 +57,36 @@ document.addEventListener('DOMContentLoaded', function() {
         checkAllBtn.addEventListener('click', handleCheckAll);
     }
     
+    if (groupFilter) {
+        groupFilter.addEventListener('change', function() {
+            if (groupActions) {
+                groupActions.style.display = this.value ? 'flex' : 'none';
+            }
+            loadWebsites();
+        });
+    }
+    
+    if (tagFilter) {
+        tagFilter.addEventListener('change', loadWebsites);
+    }
+    
+    if (groupActions) {
+        groupActions.querySelectorAll('button').forEach(button => {
+            button.addEventListener('click', () => handleGroupAction(button.dataset.groupAction));
+        });
+    }
+    
+    if (exportBtn && exportFormat) {
+        exportBtn.addEventListener('click', function() {
+            window.location.href = `/api/export?format=${exportFormat.value}`;
+        });
+    }
+    
+    if (importBtn && importFile) {
+        importBtn.addEventListener('click', () => importFile.click());
+        importFile.addEventListener('change', handleImport);
+    }
+    
     // Show/hide PKI options based on checkbox
     if (usePKI && pkiOptionsDiv) {
         usePKI.addEventListener('change', function() {
@@ -95,7 +153,17 @@ document.addEventListener('DOMContentLoaded', function() {
     // Functions
     async function loadWebsites() {
         try {
-            const response = await fetch('/api/websites');
+            const params = new URLSearchParams();
+            if (groupFilter && groupFilter.value) params.set('group', groupFilter.value);
+            if (tagFilter && tagFilter.value.trim()) params.append('tag', tagFilter.value.trim());
+            
+            const response = await fetch(`/api/websites?${params}`);
+            
+            // The session has expired or was ended elsewhere
+            if (response.status === 401) {
+                window.location.href = '/login';
+                return;
+            }
             
             if (!response.ok) {
                 throw new Error(`HTTP error! Status: ${response.status}`);
@@ -103,12 +171,48 @@ document.addEventListener('DOMContentLoaded', function() {
             
             const websites = await response.json();
             renderWebsites(websites);
+            loadGroups();
         } catch (error) {
             console.error('Error loading websites:', error);
             showError('Failed to load websites. Please try again later.');
         }
     }
     
+    async function loadGroups() {
+        try {
+            const response = await fetch('/api/groups');
+            
+            if (!response.ok) {
+                throw new Error(`HTTP error! Status: ${response.status}`);
+            }
+            
+            const groups = await response.json();
+            
+            if (groupFilter) {
+                const selected = groupFilter.value;
+                groupFilter.innerHTML = '<option value="">All groups</option>';
+                groups.forEach(group => {
+                    const option = document.createElement('option');
+                    option.value = group.path;
+                    option.textContent = `${group.path} (${group.websites})`;
+                    groupFilter.appendChild(option);
+                });
+                groupFilter.value = selected;
+            }
+            
+            if (groupOptions) {
+                groupOptions.innerHTML = '';
+                groups.forEach(group => {
+                    const option = document.createElement('option');
+                    option.value = group.path;
+                    groupOptions.appendChild(option);
+                });
+            }
+        } catch (error) {
+            console.error('Error loading groups:', error);
+        }
+    }
+    
     function renderWebsites(websites) {
         // Clear current lists
         changedWebsitesList.innerHTML = '';
@@ -132,6 +236,15 @@ document.addEventListener('DOMContentLoaded', function() {
             // Fill in website details
             itemClone.querySelector('.website-name').textContent = website.name;
             itemClone.querySelector('.website-url').textContent = website.url;
+            itemClone.querySelector('.website-group').textContent = website.group || '';
+            
+            const tagsSpan = itemClone.querySelector('.website-tags');
+            (website.tags || []).forEach(tag => {
+                const tagElement = document.createElement('span');
+                tagElement.className = 'website-tag';
+                tagElement.textContent = tag;
+                tagsSpan.appendChild(tagElement);
+            });
             
             const lastCheckedSpan = itemClone.querySelector('.website-last-checked span');
             if (website.lastChecked && new Date(website.lastChecked).getTime() > 0) {
@@ -143,11 +256,22 @@ document.addEventListener('DOMContentLoaded', function() {
             const statusElement = itemClone.querySelector('.website-status');
             
             // Set the appropriate status
-            if (website.error) {
+            if (website.paused) {
+                statusElement.textContent = website.pausedUntil && new Date(website.pausedUntil).getTime() > 0
+                    ? `Paused until ${formatDate(new Date(website.pausedUntil))}`
+                    : 'Paused';
+                statusElement.classList.add('paused');
+            } else if (website.maintenance) {
+                statusElement.textContent = 'In maintenance';
+                statusElement.classList.add('paused');
+            } else if (website.error) {
                 statusElement.textContent = `Error: ${website.error}`;
                 statusElement.classList.add('error');
             } else if (website.isFirstCheck) {
                 statusElement.textContent = 'Pending first check';
+            } else if (website.redirectChanged) {
+                statusElement.textContent = `Now redirects to ${website.finalURL}`;
+                statusElement.classList.add('changed');
             } else if (website.hasChanged) {
                 statusElement.textContent = 'Changed since last check';
                 statusElement.classList.add('changed');
@@ -166,11 +290,15 @@ document.addEventListener('DOMContentLoaded', function() {
             const visitBtn = itemClone.querySelector('.visit-btn');
             visitBtn.addEventListener('click', () => window.open(website.url, '_blank'));
             
+            const pauseBtn = itemClone.querySelector('.pause-btn');
+            pauseBtn.textContent = website.paused ? 'Resume' : 'Pause';
+            pauseBtn.addEventListener('click', () => handlePauseWebsite(website.id, !website.paused));
+            
             const removeBtn = itemClone.querySelector('.remove-btn');
             removeBtn.addEventListener('click', () => handleRemoveWebsite(website.id));
             
-            // Add to the appropriate list
-            if (website.error || website.hasChanged) {
+            // Add to the appropriate list; alerts are suppressed during maintenance
+            if (!website.maintenance && (website.error || website.hasChanged || website.redirectChanged)) {
                 changedWebsitesList.appendChild(itemClone);
                 changedCount++;
             } else {
@@ -212,6 +340,8 @@ document.addEventListener('DOMContentLoaded', function() {
         const requestData = {
             url,
             name,
+            group: websiteGroup ? websiteGroup.value.trim() : '',
+            tags: websiteTags ? websiteTags.value.split(',').map(tag => tag.trim()).filter(tag => tag) : [],
             usePKI: usePKI && usePKI.checked
         };
         
@@ -240,7 +370,7 @@ document.addEventListener('DOMContentLoaded', function() {
             });
             
             if (!response.ok) {
-                throw new Error(`HTTP error! Status: ${response.status}`);
+                throw new Error(await responseError(response));
             }
             
             // Reset form
@@ -253,7 +383,7 @@ document.addEventListener('DOMContentLoaded', function() {
             loadWebsites();
         } catch (error) {
             console.error('Error adding website:', error);
-            showError('Failed to add website. Please try again.');
+            showError('Failed to add website: ' + error.message);
         }
     }
     
@@ -279,6 +409,24 @@ document.addEventListener('DOMContentLoaded', function() {
         }
     }
     
+    async function handlePauseWebsite(id, pause) {
+        try {
+            const response = await fetch(`/api/websites/${id}/${pause ? 'pause' : 'resume'}`, {
+                method: 'POST'
+            });
+            
+            if (!response.ok) {
+                throw new Error(`HTTP error! Status: ${response.status}`);
+            }
+            
+            // Reload websites
+            loadWebsites();
+        } catch (error) {
+            console.error('Error pausing website:', error);
+            showError('Failed to update website. Please try again.');
+        }
+    }
+    
     async function handleCheckWebsite(id) {
         try {
             const response = await fetch(`/api/websites/${id}/check`, {
@@ -302,20 +450,24 @@ document.addEventListener('DOMContentLoaded', function() {
         checkAllBtn.textContent = 'Checking...';
         
         try {
-            const websitesResponse = await fetch('/api/websites');
+            const response = await fetch('/api/checks', { method: 'POST' });
             
-            if (!websitesResponse.ok) {
-                throw new Error(`HTTP error! Status: ${websitesResponse.status}`);
+            if (!response.ok) {
+                throw new Error(`HTTP error! Status: ${response.status}`);
             }
             
-            const websites = await websitesResponse.json();
-            
-            // Check each website
-            const checkPromises = websites.map(website => 
-                fetch(`/api/websites/${website.id}/check`, { method: 'POST' })
-            );
-            
-            await Promise.all(checkPromises);
+            // Poll the job until every website has been checked
+            let job = await response.json();
+            while (job.status !== 'done') {
+                checkAllBtn.textContent = `Checking... (${job.completed}/${job.total})`;
+                await new Promise(resolve => setTimeout(resolve, 1000));
+                
+                const jobResponse = await fetch(`/api/checks/${job.id}`);
+                if (!jobResponse.ok) {
+                    throw new Error(`HTTP error! Status: ${jobResponse.status}`);
+                }
+                job = await jobResponse.json();
+            }
             
             // Reload websites
             loadWebsites();
@@ -328,6 +480,72 @@ document.addEventListener('DOMContentLoaded', function() {
         }
     }
     
+    async function handleGroupAction(action) {
+        const group = groupFilter ? groupFilter.value : '';
+        if (!group) return;
+        
+        if (action === 'delete' && !confirm(`Remove every website in "${group}" and its subgroups from monitoring?`)) {
+            return;
+        }
+        
+        const path = group.split('/').map(encodeURIComponent).join('/');
+        const request = action === 'delete'
+            ? fetch(`/api/groups/${path}`, { method: 'DELETE' })
+            : fetch(`/api/groups/${path}/${action}`, { method: 'POST' });
+        
+        try {
+            const response = await request;
+            
+            if (!response.ok) {
+                throw new Error(`HTTP error! Status: ${response.status}`);
+            }
+            
+            if (action === 'delete') {
+                groupFilter.value = '';
+                if (groupActions) groupActions.style.display = 'none';
+            }
+            
+            loadWebsites();
+        } catch (error) {
+            console.error(`Error running ${action} on group:`, error);
+            showError(`Failed to ${action} group. Please try again.`);
+        }
+    }
+    
+    async function handleImport() {
+        if (!importFile.files || importFile.files.length === 0) return;
+        
+        const file = importFile.files[0];
+        const extension = file.name.split('.').pop().toLowerCase();
+        const format = extension === 'csv' ? 'csv' : (extension === 'opml' || extension === 'xml') ? 'opml' : 'json';
+        
+        try {
+            const response = await fetch(`/api/import?format=${format}`, {
+                method: 'POST',
+                body: file
+            });
+            
+            if (!response.ok) {
+                throw new Error(await response.text());
+            }
+            
+            const report = await response.json();
+            let message = `Imported ${report.imported} website(s), skipped ${report.duplicates} duplicate(s) and ${report.invalid} invalid row(s).`;
+            const problems = report.results.filter(result => result.status !== 'imported');
+            if (problems.length > 0) {
+                message += '\n\n' + problems.slice(0, 10).map(result => `Row ${result.row}: ${result.error}`).join('\n');
+            }
+            alert(message);
+            
+            loadWebsites();
+        } catch (error) {
+            console.error('Error importing websites:', error);
+            showError('Failed to import websites: ' + error.message);
+        } finally {
+            importFile.value = '';
+        }
+    }
+    
     // Helper functions
     function formatDate(date) {
         const now = new Date();
@@ -351,6 +569,21 @@ document.addEventListener('DOMContentLoaded', function() {
         }
     }
     
+    // Returns the message of an error response, listing each problem when
+    // the server sends structured validation errors
+    async function responseError(response) {
+        const text = await response.text();
+        try {
+            const body = JSON.parse(text);
+            if (body.errors && body.errors.length > 0) {
+                return body.errors.map(problem => problem.message).join('\n');
+            }
+            return body.error || text;
+        } catch (e) {
+            return text;
+        }
+    }
+    
     function showError(message) {
         alert(message);
     }